@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"go-app/internals/config"
+	"go-app/schema"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+)
+
+// The errors returned by JWT.Verify, their messages are sent to the client.
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("token issuer is not accepted")
+	ErrInvalidAudience  = errors.New("token audience is not accepted")
+)
+
+var ErrNoSigningKey = errors.New("no jwt signing key is configured")
+
+// JWT verifies bearer tokens and signs the access tokens of the users.
+type JWT interface {
+	// Verify checks the signature and the registered claims of token and returns its claims.
+	Verify(token string) (*schema.Claims, error)
+	// Sign returns a token of claims, the configured issuer and audience are used when they are not set.
+	Sign(claims *schema.Claims) (string, error)
+}
+
+type JWTImpl struct {
+	Config *config.JWTConfig
+
+	parser *jwt.Parser
+	keys   *keySet
+	// signingKey is nil when the tokens are only verified.
+	signingKey interface{}
+	now        func() time.Time
+}
+
+type JWTOpts struct {
+	Config *config.JWTConfig
+}
+
+// tokenClaims lets jwt decode the claims, they are validated by JWTImpl once the signature is verified.
+type tokenClaims struct {
+	schema.Claims
+}
+
+func (tokenClaims) Valid() error {
+	return nil
+}
+
+func NewJWT(opts *JWTOpts) (JWT, error) {
+	c := opts.Config
+	switch c.Algorithm {
+	case AlgorithmHS256, AlgorithmRS256, AlgorithmES256:
+	default:
+		return nil, errors.Errorf("unsupported jwt algorithm %q", c.Algorithm)
+	}
+	keys, err := loadKeys(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the jwt keys")
+	}
+	signingKey, err := loadSigningKey(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the jwt signing key")
+	}
+	return &JWTImpl{
+		Config:     c,
+		parser:     &jwt.Parser{ValidMethods: []string{c.Algorithm}, SkipClaimsValidation: true},
+		keys:       keys,
+		signingKey: signingKey,
+		now:        time.Now,
+	}, nil
+}
+
+func (j *JWTImpl) Verify(token string) (*schema.Claims, error) {
+	claims := &tokenClaims{}
+	if _, err := j.parser.ParseWithClaims(token, claims, j.keys.keyFunc); err != nil {
+		return nil, errors.Wrap(ErrInvalidToken, err.Error())
+	}
+	if err := j.validate(&claims.Claims); err != nil {
+		return nil, err
+	}
+	return &claims.Claims, nil
+}
+
+func (j *JWTImpl) Sign(claims *schema.Claims) (string, error) {
+	if j.signingKey == nil {
+		return "", ErrNoSigningKey
+	}
+	c := *claims
+	if c.Issuer == "" {
+		c.Issuer = j.Config.Issuer
+	}
+	if len(c.Audience) == 0 && j.Config.Audience != "" {
+		c.Audience = schema.Audience{j.Config.Audience}
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(j.Config.Algorithm), tokenClaims{c})
+	if j.Config.KeyID != "" {
+		token.Header["kid"] = j.Config.KeyID
+	}
+	s, err := token.SignedString(j.signingKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign token")
+	}
+	return s, nil
+}
+
+// validate checks the time based claims with the configured skew, and the issuer and audience when configured.
+// Tokens without expiry are rejected.
+func (j *JWTImpl) validate(c *schema.Claims) error {
+	now := j.now()
+	skew := j.Config.ClockSkew
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(skew)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Add(skew).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if c.IssuedAt != 0 && now.Add(skew).Before(time.Unix(c.IssuedAt, 0)) {
+		return ErrTokenNotValidYet
+	}
+	if j.Config.Issuer != "" && c.Issuer != j.Config.Issuer {
+		return ErrInvalidIssuer
+	}
+	if j.Config.Audience != "" && !c.Audience.Contains(j.Config.Audience) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
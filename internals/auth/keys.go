@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"go-app/internals/config"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+// keySet holds the verification keys, either a single configured key or the keys of a JWK set by kid.
+type keySet struct {
+	key   interface{}
+	byKID map[string]interface{}
+}
+
+func (ks *keySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	if ks.byKID == nil {
+		return ks.key, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := ks.byKID[kid]; ok {
+		return key, nil
+	}
+	// a set with a single key also verifies the tokens without kid
+	if kid == "" && len(ks.byKID) == 1 {
+		for _, key := range ks.byKID {
+			return key, nil
+		}
+	}
+	return nil, errors.Errorf("unknown key %q", kid)
+}
+
+func loadKeys(c *config.JWTConfig) (*keySet, error) {
+	if c.JWKSFile != "" {
+		return loadJWKS(c.JWKSFile, c.Algorithm)
+	}
+	switch c.Algorithm {
+	case AlgorithmHS256:
+		if c.Secret == "" {
+			return nil, errors.New("secret is required for HS256")
+		}
+		return &keySet{key: []byte(c.Secret)}, nil
+	case AlgorithmRS256:
+		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(c.PublicKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid RS256 public key")
+		}
+		return &keySet{key: key}, nil
+	default:
+		key, err := jwt.ParseECPublicKeyFromPEM([]byte(c.PublicKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ES256 public key")
+		}
+		return &keySet{key: key}, nil
+	}
+}
+
+// loadSigningKey returns the key signing the access tokens, nil when none is configured.
+func loadSigningKey(c *config.JWTConfig) (interface{}, error) {
+	switch {
+	case c.Algorithm == AlgorithmHS256:
+		if c.Secret == "" {
+			return nil, nil
+		}
+		return []byte(c.Secret), nil
+	case c.PrivateKey == "":
+		return nil, nil
+	case c.Algorithm == AlgorithmRS256:
+		key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(c.PrivateKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid RS256 private key")
+		}
+		return key, nil
+	default:
+		key, err := jwt.ParseECPrivateKeyFromPEM([]byte(c.PrivateKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ES256 private key")
+		}
+		return key, nil
+	}
+}
+
+// jwk is a JSON Web Key (RFC 7517) with the members of the RSA, EC and symmetric keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads the signing keys of alg from a JWK set file, keys for other algorithms or for encryption are skipped.
+func loadJWKS(path, alg string) (*keySet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the jwks file")
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.Wrap(err, "invalid jwks file")
+	}
+	ks := &keySet{byKID: map[string]interface{}{}}
+	for _, k := range set.Keys {
+		if (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != alg) {
+			continue
+		}
+		key, err := k.publicKey(alg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q", k.Kid)
+		}
+		if key != nil {
+			ks.byKID[k.Kid] = key
+		}
+	}
+	if len(ks.byKID) == 0 {
+		return nil, errors.Errorf("jwks file has no %s signing key", alg)
+	}
+	return ks, nil
+}
+
+// publicKey returns the verification key of k, nil when its type does not match alg.
+func (k *jwk) publicKey(alg string) (interface{}, error) {
+	switch {
+	case alg == AlgorithmHS256 && k.Kty == "oct":
+		return decodeSegment(k.K)
+	case alg == AlgorithmRS256 && k.Kty == "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case alg == AlgorithmES256 && k.Kty == "EC":
+		if k.Crv != "P-256" {
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url value")
+	}
+	return b, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
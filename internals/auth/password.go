@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"go-app/internals/config"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+// The argon2id defaults follow the OWASP recommendation (19 MiB, 2 iterations, 1 lane).
+const (
+	defaultArgon2Memory      = 19 * 1024
+	defaultArgon2Iterations  = 2
+	defaultArgon2Parallelism = 1
+	defaultBcryptCost        = 12
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash")
+
+// PasswordHasher hashes passwords with the configured algorithm and verifies the hashes of all the supported ones.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, an error is only returned for malformed hashes.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash reports whether hash was produced by another algorithm or with other parameters than the configured ones.
+	NeedsRehash(hash string) bool
+}
+
+type PasswordHasherImpl struct {
+	Config *config.PasswordConfig
+}
+
+type PasswordHasherOpts struct {
+	Config *config.PasswordConfig
+}
+
+func NewPasswordHasher(opts *PasswordHasherOpts) (PasswordHasher, error) {
+	c := config.PasswordConfig{}
+	if opts.Config != nil {
+		c = *opts.Config
+	}
+	switch c.Algorithm {
+	case "":
+		c.Algorithm = PasswordArgon2id
+	case PasswordArgon2id, PasswordBcrypt:
+	default:
+		return nil, errors.Errorf("unsupported password hash algorithm %q", c.Algorithm)
+	}
+	if c.Memory == 0 {
+		c.Memory = defaultArgon2Memory
+	}
+	if c.Iterations == 0 {
+		c.Iterations = defaultArgon2Iterations
+	}
+	if c.Parallelism == 0 {
+		c.Parallelism = defaultArgon2Parallelism
+	}
+	if c.BcryptCost == 0 {
+		c.BcryptCost = defaultBcryptCost
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return nil, errors.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &PasswordHasherImpl{Config: &c}, nil
+}
+
+func (p *PasswordHasherImpl) Hash(password string) (string, error) {
+	if p.Config.Algorithm == PasswordBcrypt {
+		h, err := bcrypt.GenerateFromPassword([]byte(password), p.Config.BcryptCost)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to hash password")
+		}
+		return string(h), nil
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "failed to generate salt")
+	}
+	params := &argon2Params{Memory: p.Config.Memory, Iterations: p.Config.Iterations, Parallelism: p.Config.Parallelism}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, argon2KeyLen)
+	return params.encode(salt, key), nil
+}
+
+func (p *PasswordHasherImpl) Verify(hash, password string) (bool, error) {
+	if isBcrypt(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, errors.Wrap(ErrUnknownPasswordHash, err.Error())
+		}
+	}
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (p *PasswordHasherImpl) NeedsRehash(hash string) bool {
+	if isBcrypt(hash) {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return p.Config.Algorithm != PasswordBcrypt || err != nil || cost != p.Config.BcryptCost
+	}
+	params, _, _, err := decodeArgon2(hash)
+	return p.Config.Algorithm != PasswordArgon2id || err != nil ||
+		*params != argon2Params{Memory: p.Config.Memory, Iterations: p.Config.Iterations, Parallelism: p.Config.Parallelism}
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// encode returns the hash in the PHC string format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
+func (a *argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (*argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errors.Wrap(ErrUnknownPasswordHash, "unsupported argon2 version")
+	}
+	params := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, errors.Wrap(ErrUnknownPasswordHash, "invalid argon2 parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(ErrUnknownPasswordHash, "invalid argon2 salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errors.Wrap(ErrUnknownPasswordHash, "invalid argon2 key")
+	}
+	return params, salt, key, nil
+}
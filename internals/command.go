@@ -0,0 +1,168 @@
+package internals
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const apiKeyUsage = `usage: go-app apikey <command> [flags]
+
+commands:
+  issue   -name NAME -scopes SCOPE[,SCOPE] [-expires DURATION]
+  rotate  -id ID [-grace DURATION]
+  revoke  -id ID
+  list
+
+scopes: accounts:read, accounts:write, transfers:write`
+
+// setupCommand sets up the parts of the app the commands need, up to the connection to mongodb.
+func setupCommand(ctx context.Context) *AppImpl {
+	a := AppImpl{Ctx: ctx, Worker: &sync.WaitGroup{}}
+	a.setupLogger()
+	a.Config = config.GetConfigFromFile()
+	a.setupHealth()
+	a.setupMetrics()
+	a.setupTracing()
+	a.setupDB()
+	return &a
+}
+
+// RunAPIKeyCommand issues, rotates, revokes and lists the api keys, it only connects to mongodb.
+func RunAPIKeyCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 || !strings.Contains(" issue rotate revoke list ", " "+args[0]+" ") {
+		return errors.New(apiKeyUsage)
+	}
+	a := setupCommand(ctx)
+	defer a.DB.MongoDB().Close()
+
+	keys := service.NewAPIKeyService(&service.APIKeyServiceOpts{
+		Logger: a.AbstractLogger.CreateSubLogger(a.Logger, "api-key-service"),
+		DB:     a.DB,
+	})
+
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	fs.SetOutput(out)
+	switch args[0] {
+	case "issue":
+		name := fs.String("name", "", "name of the caller using the key")
+		scopes := fs.String("scopes", "", "comma separated scopes granted to the key")
+		expires := fs.Duration("expires", 0, "lifetime of the key, the key does not expire when zero")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			return errors.New("-name and -scopes are required")
+		}
+		opts := &schema.APIKey_IssueOpts{Name: *name, Scopes: strings.Split(*scopes, ",")}
+		if *expires > 0 {
+			t := time.Now().UTC().Add(*expires)
+			opts.ExpiresAt = &t
+		}
+		resp, err := keys.Issue(ctx, opts)
+		if err != nil {
+			return err
+		}
+		printIssuedKey(out, resp)
+	case "rotate":
+		id := fs.String("id", "", "id of the key to rotate")
+		grace := fs.Duration("grace", 24*time.Hour, "how long the rotated key stays valid")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		oid, err := primitive.ObjectIDFromHex(*id)
+		if err != nil {
+			return errors.New("-id must be a valid id")
+		}
+		resp, err := keys.Rotate(ctx, &schema.APIKey_RotateOpts{ID: oid, GracePeriod: *grace})
+		if err != nil {
+			return err
+		}
+		printIssuedKey(out, resp)
+	case "revoke":
+		id := fs.String("id", "", "id of the key to revoke")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		oid, err := primitive.ObjectIDFromHex(*id)
+		if err != nil {
+			return errors.New("-id must be a valid id")
+		}
+		if err := keys.Revoke(ctx, oid); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "revoked %s\n", oid.Hex())
+	case "list":
+		list, err := keys.List(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+		for _, k := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID.Hex(), k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+				formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), formatTime(k.RevokedAt))
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+const encryptionUsage = `usage: go-app encryption <command>
+
+commands:
+  rotate  re-encrypt with the active key the fields encrypted with another key or stored in plaintext`
+
+// RunEncryptionCommand re-encrypts the encrypted fields with the active key of the key file, it only connects to
+// mongodb. Run it after activating a new key, the old key can be removed from the key file once it succeeds.
+func RunEncryptionCommand(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "rotate" {
+		return errors.New(encryptionUsage)
+	}
+	a := setupCommand(ctx)
+	defer a.DB.MongoDB().Close()
+
+	c := a.Config.MongoDBConfig.EncryptionConfig
+	if c == nil || c.KeyFile == "" {
+		return errors.New("field level encryption is not configured, set mongo_db_config.encryption_config.key_file")
+	}
+	keyring, err := mongodb.LoadKeyring(c.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load encryption keys")
+	}
+	updated, err := service.RotateEncryptedFields(ctx, a.DB.MongoDB(), keyring)
+	namespaces := make([]string, 0, len(updated))
+	for ns := range updated {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		fmt.Fprintf(out, "%s: %d documents re-encrypted with key %s\n", ns, updated[ns], keyring.Active())
+	}
+	return err
+}
+
+func printIssuedKey(out io.Writer, resp *schema.APIKey_IssueResp) {
+	fmt.Fprintf(out, "id:      %s\nkey:     %s\nscopes:  %s\nexpires: %s\n", resp.ID.Hex(), resp.Key, strings.Join(resp.Scopes, ","), formatTime(resp.ExpiresAt))
+	fmt.Fprintln(out, "the key is not stored, keep it now as it cannot be shown again")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
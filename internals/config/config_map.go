@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"time"
 )
 
 type Config struct {
@@ -10,6 +11,10 @@ type Config struct {
 	WebServerConfig *WebServerConfig `mapstructure:"web_server_config"`
 	RouterConfig    *RouterConfig    `mapstructure:"router_config"`
 	SentryConfig    *SentryConfig    `mapstructure:"sentry_config"`
+	AdminConfig     *AdminConfig     `mapstructure:"admin_config"`
+	HealthConfig    *HealthConfig    `mapstructure:"health_config"`
+	MetricsConfig   *MetricsConfig   `mapstructure:"metrics_config"`
+	TracingConfig   *TracingConfig   `mapstructure:"tracing_config"`
 }
 
 type AppConfig struct {
@@ -18,14 +23,150 @@ type AppConfig struct {
 
 type ServiceConfig struct {
 	DemoServiceConfig *DemoServiceConfig `mapstructure:"demo_service_config"`
+	UserServiceConfig *UserServiceConfig `mapstructure:"user_service_config"`
 }
 
 type RouterConfig struct {
 	EnableSentry bool `mapstructure:"enable_sentry"`
+	// DefaultAPIVersion serves the unversioned api paths without an Accept-Version header, e.g. "v1".
+	// The oldest version is used when it is empty.
+	DefaultAPIVersion string `mapstructure:"default_api_version"`
+	// Deprecations announce the api versions and routes which are going away.
+	Deprecations []*DeprecationConfig `mapstructure:"deprecations"`
+	// JWT authenticates the requests to the protected routes.
+	JWT *JWTConfig `mapstructure:"jwt"`
+	// EnableAPIKeys accepts the api keys in the X-API-Key header on the protected routes.
+	EnableAPIKeys bool `mapstructure:"enable_api_keys"`
+	// AuthDisabled serves the protected routes without credentials when neither JWT nor the api keys are enabled,
+	// for local development only. The app does not start without authentication otherwise.
+	AuthDisabled bool `mapstructure:"auth_disabled"`
+	// StepUp requires a recent second factor from the users calling the sensitive routes.
+	StepUp *StepUpConfig `mapstructure:"step_up"`
+	// RateLimit limits the requests to the api routes of each client.
+	RateLimit *RateLimitConfig `mapstructure:"rate_limit"`
+	// Idempotency replays the responses of the mutating routes to the retries with the same Idempotency-Key header.
+	Idempotency *IdempotencyConfig `mapstructure:"idempotency"`
+}
+
+// IdempotencyConfig keeps the responses to the requests with an Idempotency-Key header in mongodb for TTL. A request
+// holds its key for LockTimeout at most, the retries arriving meanwhile are rejected. It should exceed the time a
+// request may take, a key held longer is handed to the next retry.
+type IdempotencyConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	TTL         time.Duration `mapstructure:"ttl"`
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+}
+
+// RateLimitConfig limits the requests with token buckets, kept in memory or in mongodb with Store "mongodb" to share
+// them between the instances of the app. IP limits every client ip before the request is authenticated, APIKey limits
+// each api key once authenticated. Routes are the limits of single routes, e.g. stricter ones for transfers, they apply
+// per caller on top of the others.
+type RateLimitConfig struct {
+	Enabled bool                    `mapstructure:"enabled"`
+	Store   string                  `mapstructure:"store"`
+	IP      *RateLimitRule          `mapstructure:"ip"`
+	APIKey  *RateLimitRule          `mapstructure:"api_key"`
+	Routes  []*RouteRateLimitConfig `mapstructure:"routes"`
+}
+
+// RateLimitRule allows bursts of Limit requests, the bucket is refilled with Limit requests per Period.
+type RateLimitRule struct {
+	Limit  int           `mapstructure:"limit"`
+	Period time.Duration `mapstructure:"period"`
+}
+
+// RouteRateLimitConfig limits the requests to Route (e.g. "/transfers") of every api version, Method defaults to every
+// method.
+type RouteRateLimitConfig struct {
+	Method        string `mapstructure:"method"`
+	Route         string `mapstructure:"route"`
+	RateLimitRule `mapstructure:",squash"`
+}
+
+// StepUpConfig requires the users to have verified their second factor at most MaxAge ago to call the sensitive
+// routes, such as transfers. Requests authenticated by an api key are not affected.
+type StepUpConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	MaxAge  time.Duration `mapstructure:"max_age"`
+}
+
+// DeprecationConfig sets the Deprecation and Sunset headers on the responses of a deprecated api version,
+// or of a single route of it when Route (e.g. "/accounts/:id") is set. Method defaults to every method.
+// DeprecatedAt and Sunset are dates, either RFC 3339 or 2006-01-02. Link points to the migration guide.
+type DeprecationConfig struct {
+	Version      string `mapstructure:"version"`
+	Method       string `mapstructure:"method"`
+	Route        string `mapstructure:"route"`
+	DeprecatedAt string `mapstructure:"deprecated_at"`
+	Sunset       string `mapstructure:"sunset"`
+	Link         string `mapstructure:"link"`
+}
+
+// JWTConfig verifies the bearer tokens of the protected routes. Algorithm is one of HS256, RS256 or ES256, the key is
+// Secret for HS256 and the PEM encoded PublicKey otherwise. JWKSFile replaces them with a local JWK set, its keys are
+// selected by the kid header of the token. Issuer and Audience are required in the tokens when set, ClockSkew is
+// tolerated when checking exp, nbf and iat.
+// The access tokens of the users are signed with Secret for HS256 and the PEM encoded PrivateKey otherwise, KeyID is
+// set as their kid header.
+type JWTConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Algorithm  string        `mapstructure:"algorithm"`
+	Secret     string        `mapstructure:"secret" redact:"true"`
+	PublicKey  string        `mapstructure:"public_key"`
+	JWKSFile   string        `mapstructure:"jwks_file"`
+	PrivateKey string        `mapstructure:"private_key" redact:"true"`
+	KeyID      string        `mapstructure:"key_id"`
+	Issuer     string        `mapstructure:"issuer"`
+	Audience   string        `mapstructure:"audience"`
+	ClockSkew  time.Duration `mapstructure:"clock_skew"`
 }
 
 type DemoServiceConfig struct {
 	SomeAdditionalData string `mapstructure:"some_additional_data"`
+	// WatchTransactions subscribes to inserts into the transaction collection through a change stream.
+	// Requires a replica set.
+	WatchTransactions bool `mapstructure:"watch_transactions"`
+	// AccountCacheConfig configures the read-through cache of account details.
+	AccountCacheConfig *CacheConfig `mapstructure:"account_cache_config"`
+}
+
+// UserServiceConfig configures the user accounts. Logins issue an access token, which expires after AccessTokenTTL,
+// and a refresh token, which expires after RefreshTokenTTL and is replaced by every refresh.
+type UserServiceConfig struct {
+	Password        *PasswordConfig `mapstructure:"password"`
+	TOTP            *TOTPConfig     `mapstructure:"totp"`
+	AccessTokenTTL  time.Duration   `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration   `mapstructure:"refresh_token_ttl"`
+}
+
+// TOTPConfig configures the second factor of the users. Issuer names the accounts in the authenticator apps, Skew is
+// the number of 30 second steps a code may be early or late, RecoveryCodes the number of single use codes issued with
+// the secret. After MaxAttempts invalid codes in a row the codes of the user are rejected for Lockout.
+type TOTPConfig struct {
+	Issuer        string        `mapstructure:"issuer"`
+	Skew          int           `mapstructure:"skew"`
+	RecoveryCodes int           `mapstructure:"recovery_codes"`
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	Lockout       time.Duration `mapstructure:"lockout"`
+}
+
+// PasswordConfig configures the hashing of the passwords, Algorithm is argon2id or bcrypt. Memory (in KiB), Iterations
+// and Parallelism are the argon2id parameters, BcryptCost the bcrypt one, zero values use the recommended defaults.
+// Hashes of either algorithm are verified, those not matching the configuration are replaced at the next login.
+type PasswordConfig struct {
+	Algorithm   string `mapstructure:"algorithm"`
+	Memory      uint32 `mapstructure:"memory"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+	BcryptCost  int    `mapstructure:"bcrypt_cost"`
+}
+
+// CacheConfig configures an in-process LRU cache. Size is the maximum number of entries,
+// TTL how long an entry is served after it was loaded.
+type CacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Size    int           `mapstructure:"size"`
+	TTL     time.Duration `mapstructure:"ttl"`
 }
 
 /*
@@ -36,10 +177,51 @@ type MongoDBConfig struct {
 	Scheme     string `mapstructure:"scheme"`
 	Host       string `mapstructure:"host"`
 	Username   string `mapstructure:"username"`
-	Password   string `mapstructure:"password"`
+	Password   string `mapstructure:"password" redact:"true"`
 	ReplicaSet string `mapstructure:"replica_set"`
 	AppName    string `mapstructure:"app_name"`
-	ReadPref   string `mapstructure:"read_pref"`
+
+	// Client wide read preference, read concern and write concern.
+	MongoDBPolicyConfig `mapstructure:",squash"`
+	// Per database (and per collection) overrides keyed by database name.
+	Databases map[string]*MongoDBDatabaseConfig `mapstructure:"databases"`
+
+	ChangeStreamConfig *ChangeStreamConfig      `mapstructure:"change_stream_config"`
+	TimeoutConfig      *MongoDBTimeoutConfig    `mapstructure:"timeout_config"`
+	EncryptionConfig   *MongoDBEncryptionConfig `mapstructure:"encryption_config"`
+}
+
+// MongoDBEncryptionConfig configures client side field level encryption.
+// KeyFile is the path of the JSON key file holding the data keys, encryption is disabled when it is empty.
+type MongoDBEncryptionConfig struct {
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// MongoDBTimeoutConfig holds the default deadline of each class of mongodb operations.
+// The deadline is only applied when the caller's context has no earlier deadline.
+// Zero uses the built-in default, a negative value disables the deadline.
+type MongoDBTimeoutConfig struct {
+	Read        time.Duration `mapstructure:"read"`
+	Write       time.Duration `mapstructure:"write"`
+	Transaction time.Duration `mapstructure:"transaction"`
+	Admin       time.Duration `mapstructure:"admin"`
+}
+
+// MongoDBPolicyConfig holds the read preference, read concern and write concern for a level
+// of the mongodb hierarchy. Empty values inherit from the parent level.
+//
+//	read_pref:     primary | primaryPreferred | secondary | secondaryPreferred | nearest
+//	read_concern:  local | majority | linearizable | available | snapshot
+//	write_concern: majority | <number of nodes> | <custom tag>
+type MongoDBPolicyConfig struct {
+	ReadPref     string `mapstructure:"read_pref"`
+	ReadConcern  string `mapstructure:"read_concern"`
+	WriteConcern string `mapstructure:"write_concern"`
+}
+
+type MongoDBDatabaseConfig struct {
+	MongoDBPolicyConfig `mapstructure:",squash"`
+	Collections         map[string]*MongoDBPolicyConfig `mapstructure:"collections"`
 }
 
 func (d *MongoDBConfig) ConnectionURL() string {
@@ -57,6 +239,15 @@ func (d *MongoDBConfig) ConnectionURL() string {
 	return url
 }
 
+// ChangeStreamConfig configures the supervised change stream consumers.
+// Resume tokens are persisted in ResumeTokenDB.ResumeTokenColl so consumers continue where they left off after a restart.
+type ChangeStreamConfig struct {
+	ResumeTokenDB   string        `mapstructure:"resume_token_db"`
+	ResumeTokenColl string        `mapstructure:"resume_token_coll"`
+	MinBackoff      time.Duration `mapstructure:"min_backoff"`
+	MaxBackoff      time.Duration `mapstructure:"max_backoff"`
+}
+
 /*
 WEB SERVER RELATED CONFIG
 */
@@ -64,6 +255,40 @@ WEB SERVER RELATED CONFIG
 type WebServerConfig struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
+	// ReadinessPath serves 200 while the server accepts traffic and the app health is ready, 503 otherwise and once shutdown started.
+	ReadinessPath string `mapstructure:"readiness_path"`
+	// DrainDelay is how long readiness fails before the listener is closed, so load balancers stop routing first.
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+	// ShutdownTimeout bounds how long in-flight requests are drained before connections are force closed.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	TLSConfig       *TLSConfig    `mapstructure:"tls_config"`
+
+	// BodyLimit is the maximum request body size in bytes, larger requests get 413.
+	BodyLimit    int           `mapstructure:"body_limit"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+	// Concurrency is the maximum number of concurrent connections.
+	Concurrency int `mapstructure:"concurrency"`
+	// MaxHeaderSize is the per connection read buffer, which bounds the size of request headers.
+	MaxHeaderSize int `mapstructure:"max_header_size"`
+	// Prefork spawns a process per CPU sharing the port. It cannot be combined with TLS.
+	Prefork bool `mapstructure:"prefork"`
+}
+
+// TLSConfig enables HTTPS on the web server. Certificates and the client CA are reloaded when the files change on disk.
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// MinVersion is one of "1.2" or "1.3", defaults to "1.2".
+	MinVersion string `mapstructure:"min_version"`
+	// CipherSuites are IANA names such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. They only apply to TLS 1.2.
+	CipherSuites []string `mapstructure:"cipher_suites"`
+	// ClientCAFile enables mTLS, client certificates must be signed by one of its CAs.
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ClientCertOptional accepts connections without a client certificate, those presented are still verified.
+	ClientCertOptional bool `mapstructure:"client_cert_optional"`
 }
 
 /*
@@ -72,5 +297,52 @@ SENTRY AND TRACKING CONFIG
 
 type SentryConfig struct {
 	EnableSentry bool   `mapstructure:"enable_sentry"`
-	Host         string `mapstructure:"dsn"`
+	Host         string `mapstructure:"dsn" redact:"true"`
+}
+
+/*
+ADMIN CONFIG
+*/
+
+// MetricsConfig configures the prometheus registry served on the admin listener.
+// Namespace prefixes every metric name, e.g. go_app_http_requests_total.
+type MetricsConfig struct {
+	Namespace string `mapstructure:"namespace"`
+}
+
+// Exporters of the recorded spans.
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+)
+
+// TracingConfig configures the OpenTelemetry spans of requests, mongodb operations and outbound calls.
+// OTLPEndpoint is the host:port of an OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables apply when it is empty.
+// FilePath is the file the spans are appended to with the file exporter.
+// SampleRatio is the fraction of new traces recorded, zero records all of them. Sampled parents are always followed.
+type TracingConfig struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	ServiceName  string  `mapstructure:"service_name"`
+	Exporter     string  `mapstructure:"exporter"`
+	OTLPEndpoint string  `mapstructure:"otlp_endpoint"`
+	OTLPInsecure bool    `mapstructure:"otlp_insecure"`
+	FilePath     string  `mapstructure:"file_path"`
+	SampleRatio  float64 `mapstructure:"sample_ratio"`
+}
+
+// HealthConfig configures the component checks behind the liveness and readiness endpoints.
+// CheckTimeout applies to checks without their own timeout.
+type HealthConfig struct {
+	CheckTimeout time.Duration `mapstructure:"check_timeout"`
+}
+
+// AdminConfig configures the admin listener serving health, metrics, pprof and runtime controls.
+// It runs on its own port so it can be kept off the public network.
+type AdminConfig struct {
+	Enabled         bool             `mapstructure:"enabled"`
+	WebServerConfig *WebServerConfig `mapstructure:"web_server_config"`
+	// AuthToken is required as a bearer token on every admin endpoint except the health probes.
+	AuthToken   string `mapstructure:"auth_token" redact:"true"`
+	EnablePprof bool   `mapstructure:"enable_pprof"`
 }
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+const redacted = "******"
+
+// Redacted returns the config as a map keyed like the config file, with the values of fields
+// tagged `redact:"true"` masked. It is meant for displaying the running config.
+func (c *Config) Redacted() map[string]interface{} {
+	m, _ := redactValue(reflect.ValueOf(c)).(map[string]interface{})
+	return m
+}
+
+func redactValue(v reflect.Value) interface{} {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		redactStruct(v, m)
+		return m
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = redactValue(iter.Value())
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = redactValue(v.Index(i))
+		}
+		return s
+	default:
+		return v.Interface()
+	}
+}
+
+func redactStruct(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			redactStruct(v.Field(i), m)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if f.Tag.Get("redact") == "true" && !v.Field(i).IsZero() {
+			m[name] = redacted
+			continue
+		}
+		m[name] = redactValue(v.Field(i))
+	}
+}
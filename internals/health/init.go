@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+
+	DefaultCheckTimeout = 2 * time.Second
+)
+
+var ErrNotReady = errors.New("app is starting or shutting down")
+
+// Check probes a single component.
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+	// Timeout bounds Func, zero uses the default check timeout.
+	Timeout time.Duration
+	// Critical checks fail the report, non critical ones only degrade it.
+	Critical bool
+	// Liveness checks also run for the liveness report. Only use it for process local state,
+	// a dependency outage must not get the process restarted.
+	Liveness bool
+}
+
+// Checker is implemented by components exposing their health checks.
+type Checker interface {
+	HealthChecks() []*Check
+}
+
+type CheckResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status string         `json:"status"`
+	Error  string         `json:"error,omitempty"`
+	Checks []*CheckResult `json:"checks"`
+}
+
+// OK reports whether the report should be served with a success status code, degraded counts as ok.
+func (r *Report) OK() bool {
+	return r.Status != StatusFail
+}
+
+type Health interface {
+	Register(checks ...*Check)
+	// SetReady flips readiness, the app sets it once started and clears it as soon as it starts closing.
+	SetReady(ready bool)
+	Live(ctx context.Context) *Report
+	Ready(ctx context.Context) *Report
+}
+
+type HealthImpl struct {
+	Logger       *zerolog.Logger
+	CheckTimeout time.Duration
+
+	mu     sync.RWMutex
+	checks []*Check
+	ready  atomic.Bool
+}
+
+type HealthOpts struct {
+	Logger       *zerolog.Logger
+	CheckTimeout time.Duration
+}
+
+func NewHealth(opts *HealthOpts) Health {
+	h := HealthImpl{
+		Logger:       opts.Logger,
+		CheckTimeout: opts.CheckTimeout,
+	}
+	if h.CheckTimeout <= 0 {
+		h.CheckTimeout = DefaultCheckTimeout
+	}
+	return &h
+}
+
+func (h *HealthImpl) Register(checks ...*Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, checks...)
+}
+
+func (h *HealthImpl) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+func (h *HealthImpl) Live(ctx context.Context) *Report {
+	h.mu.RLock()
+	var checks []*Check
+	for _, c := range h.checks {
+		if c.Liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Ready runs every check. It fails without running them while the app is not ready.
+func (h *HealthImpl) Ready(ctx context.Context) *Report {
+	if !h.ready.Load() {
+		return &Report{Status: StatusFail, Error: ErrNotReady.Error(), Checks: []*CheckResult{}}
+	}
+	h.mu.RLock()
+	checks := append([]*Check{}, h.checks...)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// run executes the checks concurrently and aggregates their results.
+func (h *HealthImpl) run(ctx context.Context, checks []*Check) *Report {
+	results := make([]*CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *Check) {
+			defer wg.Done()
+			results[i] = h.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	r := Report{Status: StatusOK, Checks: results}
+	sort.Slice(r.Checks, func(i, j int) bool { return r.Checks[i].Name < r.Checks[j].Name })
+	for _, cr := range r.Checks {
+		if cr.Status == StatusOK {
+			continue
+		}
+		if cr.Critical {
+			r.Status = StatusFail
+		} else if r.Status == StatusOK {
+			r.Status = StatusDegraded
+		}
+	}
+	return &r
+}
+
+func (h *HealthImpl) runCheck(ctx context.Context, c *Check) *CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = h.CheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errc <- errors.Errorf("check panicked: %v", p)
+			}
+		}()
+		errc <- c.Func(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		// checks ignoring ctx are abandoned, their result is dropped
+		err = errors.Wrap(ctx.Err(), "check timed out")
+	}
+
+	cr := CheckResult{Name: c.Name, Status: StatusOK, Critical: c.Critical, Duration: time.Since(start).String()}
+	if err != nil {
+		cr.Status, cr.Error = StatusFail, err.Error()
+		if h.Logger != nil {
+			h.Logger.Warn().Err(err).Str("check", c.Name).Bool("critical", c.Critical).Msg("health check failed")
+		}
+	}
+	return &cr
+}
@@ -2,21 +2,31 @@ package internals
 
 import (
 	"context"
+	"go-app/internals/auth"
 	"go-app/internals/config"
 	"go-app/internals/db"
+	"go-app/internals/health"
 	"go-app/internals/logger"
+	"go-app/internals/metrics"
 	"go-app/internals/mongodb"
+	"go-app/internals/tracing"
 
 	"fmt"
 	"go-app/internals/ws"
 	"go-app/router"
 	"go-app/service"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/getsentry/sentry-go"
 	"github.com/gofiber/fiber"
 	"github.com/rs/zerolog"
 )
 
+// tracingShutdownTimeout bounds the export of the pending spans on close.
+const tracingShutdownTimeout = 5 * time.Second
+
 type App interface {
 	Start()
 	Close()
@@ -30,11 +40,22 @@ type AppImpl struct {
 	DB             db.DB
 	Service        service.Service
 	WebServer      ws.Server
+	// AdminServer serves the operational endpoints on the admin port, nil when disabled.
+	AdminServer ws.Server
+	Health      health.Health
+	Metrics     metrics.Metrics
+	Tracing     tracing.Tracing
+	// JWT verifies the bearer tokens and signs the access tokens of the users, nil when jwt authentication is disabled.
+	JWT       auth.JWT
+	Passwords auth.PasswordHasher
+	// Worker tracks long running goroutines which must finish before dependencies are closed.
+	Worker *sync.WaitGroup
 }
 
 func CreateNewApp(ctx context.Context) App {
 	a := AppImpl{
-		Ctx: ctx,
+		Ctx:    ctx,
+		Worker: &sync.WaitGroup{},
 	}
 	return &a
 }
@@ -42,17 +63,40 @@ func CreateNewApp(ctx context.Context) App {
 func (a *AppImpl) Start() {
 	a.setupLogger()
 	a.getConfig()
+	a.setupHealth()
+	a.setupMetrics()
+	a.setupTracing()
 	a.setupDB()
+	a.setupAuth()
 	a.setupService()
 	a.setupWebServer()
+	a.setupAdminServer()
 	a.setupSentry()
+	a.Health.SetReady(true)
 }
 
 func (a *AppImpl) Close() {
 	// Closing down all the components
-	a.WebServer.Close()
+	a.Health.SetReady(false)
+	// The web server is drained first, in-flight requests may still be using the service and db
+	if err := a.WebServer.Close(); err != nil {
+		a.Logger.Err(err).Msg("failed to gracefully close webserver")
+	}
+	// The admin server goes last so probes and metrics stay available while the public server drains
+	if a.AdminServer != nil {
+		if err := a.AdminServer.Close(); err != nil {
+			a.Logger.Err(err).Msg("failed to gracefully close admin server")
+		}
+	}
+	a.Worker.Wait()
 	a.Service.Close()
 	a.DB.MongoDB().Close()
+	// flushes the spans recorded while the components were closing
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := a.Tracing.Shutdown(ctx); err != nil {
+		a.Logger.Err(err).Msg("failed to flush traces")
+	}
 	a.Logger.Debug().Msg("app gracefully closed")
 }
 
@@ -79,17 +123,46 @@ func (a *AppImpl) getConfig() {
 	a.Config = c
 }
 
+func (a *AppImpl) setupHealth() {
+	hc := a.Config.HealthConfig
+	if hc == nil {
+		hc = &config.HealthConfig{}
+	}
+	a.Health = health.NewHealth(&health.HealthOpts{
+		Logger:       a.AbstractLogger.CreateSubLogger(a.Logger, "health"),
+		CheckTimeout: hc.CheckTimeout,
+	})
+}
+
+func (a *AppImpl) setupMetrics() {
+	a.Metrics = metrics.NewMetrics(&metrics.MetricsOpts{
+		Config: a.Config.MetricsConfig,
+	})
+}
+
+func (a *AppImpl) setupTracing() {
+	t, err := tracing.NewTracing(&tracing.TracingOpts{
+		Config: a.Config.TracingConfig,
+	})
+	if err != nil {
+		a.Logger.Fatal().Err(err).Msg("failed to setup tracing")
+	}
+	a.Tracing = t
+}
+
 func (a *AppImpl) setupDB() {
 	a.DB = db.NewDB(&db.DBOpts{
 		MongoDB: a.setupMongoDB(),
 	})
+	a.Health.Register(a.DB.MongoDB().HealthChecks()...)
 }
 
 func (a *AppImpl) setupMongoDB() mongodb.MongoDB {
 	mongodb, err := mongodb.NewMongoDB(&mongodb.MongoDBOpts{
-		Config: a.Config.MongoDBConfig,
-		Logger: a.AbstractLogger.CreateSubLogger(a.Logger, "mongodb"),
-		Ctx:    a.Ctx,
+		Config:       a.Config.MongoDBConfig,
+		Logger:       a.AbstractLogger.CreateSubLogger(a.Logger, "mongodb"),
+		Ctx:          a.Ctx,
+		Interceptors: []mongodb.OperationInterceptor{a.Metrics.MongoDBInterceptor(), a.Tracing.MongoDBInterceptor()},
 	})
 
 	if err != nil {
@@ -99,24 +172,133 @@ func (a *AppImpl) setupMongoDB() mongodb.MongoDB {
 }
 
 func (a *AppImpl) setupRouter() *router.Router {
+	apiKeys := a.setupAPIKeys()
+	if a.JWT == nil && apiKeys == nil {
+		if !a.Config.RouterConfig.AuthDisabled {
+			a.Logger.Fatal().Msg("authentication is not configured, enable jwt or the api keys, or set auth_disabled for local development")
+		}
+		a.Logger.Warn().Msg("authentication is disabled, the protected routes are served without credentials")
+	}
 	router := router.NewRouter(&router.RouterOpts{
-		AbstractLogger: a.AbstractLogger,
-		DemoService:    a.Service.GetDemoService(),
-		RouterConfig:   a.Config.RouterConfig,
+		AbstractLogger:   a.AbstractLogger,
+		DemoService:      a.Service.GetDemoService(),
+		RouterConfig:     a.Config.RouterConfig,
+		WebServerConfig:  a.Config.WebServerConfig,
+		Metrics:          a.Metrics,
+		Tracing:          a.Tracing,
+		JWT:              a.JWT,
+		APIKeyService:    apiKeys,
+		UserService:      a.setupUsers(),
+		RateLimitStore:   a.setupRateLimit(),
+		IdempotencyStore: a.setupIdempotency(),
 	})
 	return router
 }
 
+// setupAuth sets up the password hashing and the jwt authentication, which is nil when disabled.
+func (a *AppImpl) setupAuth() {
+	var c *config.PasswordConfig
+	if us := a.Config.AppConfig.ServiceConfig.UserServiceConfig; us != nil {
+		c = us.Password
+	}
+	passwords, err := auth.NewPasswordHasher(&auth.PasswordHasherOpts{Config: c})
+	if err != nil {
+		a.Logger.Fatal().Err(err).Msg("failed to setup password hashing")
+	}
+	a.Passwords = passwords
+
+	if jc := a.Config.RouterConfig.JWT; jc != nil && jc.Enabled {
+		a.JWT, err = auth.NewJWT(&auth.JWTOpts{Config: jc})
+		if err != nil {
+			a.Logger.Fatal().Err(err).Msg("failed to setup jwt authentication")
+		}
+	}
+}
+
+// setupUsers returns nil when the users cannot log in, as no access tokens are issued without jwt authentication.
+func (a *AppImpl) setupUsers() service.UserService {
+	if a.JWT == nil {
+		return nil
+	}
+	return a.Service.GetUserService()
+}
+
+// setupRateLimit returns the store of the rate limits, nil when the requests are not limited.
+func (a *AppImpl) setupRateLimit() service.RateLimitStore {
+	c := a.Config.RouterConfig.RateLimit
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	switch c.Store {
+	case "", service.RateLimitStoreMemory:
+		return service.NewMemoryRateLimitStore(&service.MemoryRateLimitStoreOpts{})
+	case service.RateLimitStoreMongoDB:
+		return service.NewMongoRateLimitStore(&service.MongoRateLimitStoreOpts{DB: a.DB})
+	default:
+		a.Logger.Fatal().Str("store", c.Store).Msg("unsupported rate limit store")
+		return nil
+	}
+}
+
+// setupIdempotency returns the store of the idempotency keys, nil when the Idempotency-Key header is ignored.
+func (a *AppImpl) setupIdempotency() service.IdempotencyStore {
+	c := a.Config.RouterConfig.Idempotency
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	return service.NewIdempotencyStore(&service.IdempotencyStoreOpts{DB: a.DB, Config: c})
+}
+
+// setupAPIKeys returns nil when the api keys are not accepted.
+func (a *AppImpl) setupAPIKeys() service.APIKeyService {
+	if !a.Config.RouterConfig.EnableAPIKeys {
+		return nil
+	}
+	return a.Service.GetAPIKeyService()
+}
+
 func (a *AppImpl) setupWebServer() {
 	router := a.setupRouter()
 	a.WebServer = ws.NewWebServer(&ws.FiberServerOpts{
 		FiberApp: router.App,
 		Ctx:      a.Ctx,
+		Worker:   a.Worker,
 		Config:   a.Config.WebServerConfig,
 		Logger:   a.AbstractLogger.CreateSubLogger(a.Logger, "ws"),
+		Health:   a.Health,
 	})
 
-	go a.WebServer.Start()
+	a.Health.Register(a.WebServer.HealthChecks()...)
+
+	if err := a.WebServer.Start(); err != nil {
+		a.Logger.Fatal().Err(err).Msg("failed to start webserver")
+	}
+}
+
+func (a *AppImpl) setupAdminServer() {
+	if a.Config.AdminConfig == nil || !a.Config.AdminConfig.Enabled {
+		return
+	}
+	adminRouter := router.NewAdminRouter(&router.AdminRouterOpts{
+		AbstractLogger: a.AbstractLogger,
+		Config:         a.Config.AdminConfig,
+		AppConfig:      a.Config,
+		DemoService:    a.Service.GetDemoService(),
+		Health:         a.Health,
+		Metrics:        a.Metrics,
+	})
+	a.AdminServer = ws.NewWebServer(&ws.FiberServerOpts{
+		FiberApp: adminRouter.App,
+		Ctx:      a.Ctx,
+		Worker:   a.Worker,
+		Config:   a.Config.AdminConfig.WebServerConfig,
+		Logger:   a.AbstractLogger.CreateSubLogger(a.Logger, "admin"),
+		Health:   a.Health,
+	})
+
+	if err := a.AdminServer.Start(); err != nil {
+		a.Logger.Fatal().Err(err).Msg("failed to start admin server")
+	}
 }
 
 func (a *AppImpl) setupService() {
@@ -126,7 +308,15 @@ func (a *AppImpl) setupService() {
 		AbstractLogger: a.AbstractLogger,
 		Config:         a.Config.AppConfig.ServiceConfig,
 		DB:             a.DB,
+		Metrics:        a.Metrics.Registerer(),
+		HTTPTransport:  a.Tracing.Transport(http.DefaultTransport),
+		JWT:            a.JWT,
+		Passwords:      a.Passwords,
 	})
+	if err := a.Service.EnsureIndexes(a.Ctx); err != nil {
+		a.Logger.Fatal().Err(err).Msg("failed to create the mongodb indexes")
+	}
+	a.Health.Register(a.Service.HealthChecks()...)
 }
 
 func (a *AppImpl) setupSentry() {
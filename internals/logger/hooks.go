@@ -6,6 +6,7 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TracingHook struct{}
@@ -16,11 +17,14 @@ func (h TracingHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
 	if tracingID != nil {
 		e.Interface(schema.RequestIDKey, tracingID)
 	}
+	// correlates the log line with the span of the request
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		e.Str("trace_id", sc.TraceID().String()).Str("span_id", sc.SpanID().String())
+	}
 }
 
 func getSpanIdFromContext(ctx context.Context) interface{} {
-	id := ctx.Value(ctx.Value(schema.RequestIDKey))
-	return id
+	return ctx.Value(schema.RequestIDKey)
 }
 
 type SentryHook struct{}
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UnmatchedRoute labels the requests which did not match any route, so arbitrary paths do not create new series.
+const UnmatchedRoute = "unmatched"
+
+type Metrics interface {
+	// Registerer is used by the components to register their own collectors.
+	Registerer() prometheus.Registerer
+	// Handler serves the registry in the prometheus text format.
+	Handler() fiber.Handler
+	// Middleware records request counts and latencies by route, method and status.
+	Middleware() fiber.Handler
+	// MongoDBInterceptor records the latency of every mongodb operation.
+	MongoDBInterceptor() mongodb.OperationInterceptor
+}
+
+type MetricsImpl struct {
+	Registry *prometheus.Registry
+	Config   *config.MetricsConfig
+
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	httpInFlight  prometheus.Gauge
+	mongoDuration *prometheus.HistogramVec
+}
+
+type MetricsOpts struct {
+	Config *config.MetricsConfig
+}
+
+func NewMetrics(opts *MetricsOpts) Metrics {
+	c := opts.Config
+	if c == nil {
+		c = &config.MetricsConfig{}
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	m := MetricsImpl{
+		Registry: reg,
+		Config:   c,
+	}
+	f := promauto.With(m.Registerer())
+	m.httpRequests = f.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	m.httpDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	m.httpInFlight = f.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+	m.mongoDuration = f.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_operation_duration_seconds",
+		Help:    "MongoDB operation latency by operation, class, database, collection and result.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation", "class", "database", "collection", "result"})
+	return &m
+}
+
+// Registerer prefixes the metrics registered through it with the configured namespace.
+func (m *MetricsImpl) Registerer() prometheus.Registerer {
+	if m.Config.Namespace == "" {
+		return m.Registry
+	}
+	return prometheus.WrapRegistererWithPrefix(m.Config.Namespace+"_", m.Registry)
+}
+
+func (m *MetricsImpl) Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry}))
+}
+
+func (m *MetricsImpl) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		err := c.Next()
+
+		// the error handler only runs after the middlewares, so the status of a returned error is resolved here
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+		// fiber reuses the memory of these strings across requests, label values must be copies
+		route := utils.CopyString(c.Route().Path)
+		// requests matching no route end on a catch-all middleware route
+		if status == fiber.StatusNotFound && route == "/" && c.Path() != "/" {
+			route = UnmatchedRoute
+		}
+
+		labels := prometheus.Labels{"route": route, "method": utils.CopyString(c.Method()), "status": strconv.Itoa(status)}
+		m.httpRequests.With(labels).Inc()
+		m.httpDuration.With(labels).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (m *MetricsImpl) MongoDBInterceptor() mongodb.OperationInterceptor {
+	return func(ctx context.Context, op mongodb.Operation, next func(ctx context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		result := "ok"
+		switch {
+		case err == nil, errors.Is(err, mongo.ErrNoDocuments):
+		case mongodb.IsTimeout(err):
+			result = "timeout"
+		default:
+			result = "error"
+		}
+		m.mongoDuration.With(prometheus.Labels{
+			"operation":  op.Name,
+			"class":      string(op.Class),
+			"database":   op.Database,
+			"collection": op.Collection,
+			"result":     result,
+		}).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,324 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultResumeTokenDB   = "go_app"
+	DefaultResumeTokenColl = "resume_token"
+
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// ChangeEvent is a decoded change stream event.
+type ChangeEvent struct {
+	ID            bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	Namespace     ChangeNamespace     `bson:"ns"`
+	DocumentKey   bson.Raw            `bson:"documentKey"`
+	FullDocument  bson.Raw            `bson:"fullDocument"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+
+	registry *bsoncodec.Registry
+}
+
+type ChangeNamespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+
+// DecodeFullDocument decodes the full document of the event into v.
+// The full document is only present for inserts, replaces and, with FullDocument set to updateLookup, updates.
+func (ce *ChangeEvent) DecodeFullDocument(v interface{}) error {
+	if len(ce.FullDocument) == 0 {
+		return errors.New("change event has no full document")
+	}
+	if ce.registry != nil {
+		return bson.UnmarshalWithRegistry(ce.registry, ce.FullDocument, v)
+	}
+	return bson.Unmarshal(ce.FullDocument, v)
+}
+
+// ChangeHandler handles a single change event. Returning an error restarts the stream from the last
+// persisted resume token, so the event is delivered again (at least once delivery).
+type ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+// ResumeTokenStore persists the resume token of a named consumer.
+type ResumeTokenStore interface {
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type resumeTokenDoc struct {
+	Name      string    `bson:"_id"`
+	Token     bson.Raw  `bson:"token"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// CollectionResumeTokenStore stores one document per consumer, keyed by the consumer name.
+type CollectionResumeTokenStore struct {
+	Collection Collection
+}
+
+func NewResumeTokenStore(coll Collection) ResumeTokenStore {
+	s := CollectionResumeTokenStore{Collection: coll}
+	return &s
+}
+
+func (s *CollectionResumeTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var doc resumeTokenDoc
+	if err := s.Collection.FindOne(ctx, bson.M{"_id": name}).Decode(&doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to load resume token")
+	}
+	return doc.Token, nil
+}
+
+func (s *CollectionResumeTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	_, err := s.Collection.UpdateOne(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updated_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to save resume token")
+	}
+	return nil
+}
+
+// ChangeStream is the part of *mongo.ChangeStream used by the consumers.
+type ChangeStream interface {
+	Next(ctx context.Context) bool
+	Decode(v interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// ChangeStreamOpener opens a change stream, opts carry the resume token the stream starts after, if any.
+type ChangeStreamOpener func(ctx context.Context, pipeline interface{}, opts *options.ChangeStreamOptions) (ChangeStream, error)
+
+// ChangeStreamConsumer is a supervised change stream subscription. Events are fanned out to every registered
+// handler in registration order. The stream is reopened from the last persisted resume token whenever it fails,
+// with exponential backoff, until the consumer is closed or its context is cancelled.
+type ChangeStreamConsumer interface {
+	Register(h ChangeHandler)
+	Start()
+	Close() error
+}
+
+type ChangeStreamConsumerImpl struct {
+	Ctx        context.Context
+	Logger     *zerolog.Logger
+	Worker     *sync.WaitGroup
+	Name       string
+	Collection Collection
+	Pipeline   interface{}
+	Options    *options.ChangeStreamOptions
+	Store      ResumeTokenStore
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Registry   *bsoncodec.Registry
+	Opener     ChangeStreamOpener
+
+	mu       sync.RWMutex
+	handlers []ChangeHandler
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+type ChangeStreamConsumerOpts struct {
+	Ctx    context.Context
+	Logger *zerolog.Logger
+	Worker *sync.WaitGroup
+	// Name identifies the consumer, it is used as the key of the persisted resume token.
+	Name       string
+	Collection Collection
+	Pipeline   interface{}
+	// Options defaults to FullDocument updateLookup.
+	Options    *options.ChangeStreamOptions
+	Store      ResumeTokenStore
+	Handlers   []ChangeHandler
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Registry decodes the full documents of events, so encrypted fields are decrypted.
+	Registry *bsoncodec.Registry
+	// Opener defaults to Collection.Watch.
+	Opener ChangeStreamOpener
+}
+
+func NewChangeStreamConsumer(opts *ChangeStreamConsumerOpts) ChangeStreamConsumer {
+	c := ChangeStreamConsumerImpl{
+		Ctx:        opts.Ctx,
+		Logger:     opts.Logger,
+		Worker:     opts.Worker,
+		Name:       opts.Name,
+		Collection: opts.Collection,
+		Pipeline:   opts.Pipeline,
+		Options:    opts.Options,
+		Store:      opts.Store,
+		MinBackoff: opts.MinBackoff,
+		MaxBackoff: opts.MaxBackoff,
+		Registry:   opts.Registry,
+		Opener:     opts.Opener,
+		handlers:   opts.Handlers,
+	}
+	if c.Ctx == nil {
+		c.Ctx = context.Background()
+	}
+	if c.Logger == nil {
+		l := zerolog.Nop()
+		c.Logger = &l
+	}
+	if c.Pipeline == nil {
+		c.Pipeline = mongo.Pipeline{}
+	}
+	if c.Options == nil {
+		c.Options = options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = defaultMinBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+	if c.Opener == nil {
+		c.Opener = c.watch
+	}
+	return &c
+}
+
+// Register adds a handler. Handlers can be registered before or after Start.
+func (c *ChangeStreamConsumerImpl) Register(h ChangeHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, h)
+}
+
+func (c *ChangeStreamConsumerImpl) Start() {
+	ctx, cancel := context.WithCancel(c.Ctx)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	if c.Worker != nil {
+		c.Worker.Add(1)
+	}
+	go c.supervise(ctx)
+}
+
+// Close stops the consumer and waits for the in-flight event, if any, to be handled.
+func (c *ChangeStreamConsumerImpl) Close() error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	<-c.done
+	return nil
+}
+
+func (c *ChangeStreamConsumerImpl) supervise(ctx context.Context) {
+	defer func() {
+		close(c.done)
+		if c.Worker != nil {
+			c.Worker.Done()
+		}
+	}()
+
+	backoff := c.MinBackoff
+	for {
+		err := c.consume(ctx, func() { backoff = c.MinBackoff })
+		if ctx.Err() != nil {
+			c.Logger.Debug().Str("consumer", c.Name).Msg("change stream consumer closed")
+			return
+		}
+		c.Logger.Err(err).Str("consumer", c.Name).Dur("backoff", backoff).Msg("change stream failed, restarting")
+
+		select {
+		case <-ctx.Done():
+			c.Logger.Debug().Str("consumer", c.Name).Msg("change stream consumer closed")
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+// consume runs a single change stream until it fails or ctx is cancelled.
+// onProgress is called after every successfully handled event.
+func (c *ChangeStreamConsumerImpl) consume(ctx context.Context, onProgress func()) error {
+	csOpts := *c.Options
+	if c.Store != nil {
+		token, err := c.Store.Load(ctx, c.Name)
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			csOpts.SetStartAfter(token)
+		}
+	}
+
+	cs, err := c.Opener(ctx, c.Pipeline, &csOpts)
+	if err != nil {
+		return errors.Wrap(err, "failed to open change stream")
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(ctx) {
+		event := ChangeEvent{registry: c.Registry}
+		if err := cs.Decode(&event); err != nil {
+			return errors.Wrap(err, "failed to decode change event")
+		}
+		if err := c.dispatch(ctx, &event); err != nil {
+			return err
+		}
+		if c.Store != nil {
+			if err := c.Store.Save(ctx, c.Name, cs.ResumeToken()); err != nil {
+				return err
+			}
+		}
+		onProgress()
+	}
+	if err := cs.Err(); err != nil {
+		return errors.Wrap(err, "change stream closed")
+	}
+	return errors.New("change stream closed")
+}
+
+func (c *ChangeStreamConsumerImpl) watch(ctx context.Context, pipeline interface{}, opts *options.ChangeStreamOptions) (ChangeStream, error) {
+	cs, err := c.Collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (c *ChangeStreamConsumerImpl) dispatch(ctx context.Context, event *ChangeEvent) error {
+	c.mu.RLock()
+	handlers := c.handlers
+	c.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, event); err != nil {
+			return errors.Wrapf(err, "handler failed for %s event", event.OperationType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package mongodb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+Client side field level encryption.
+
+Struct fields tagged with `encrypt:"deterministic"` or `encrypt:"randomized"` are encrypted by the bson codecs
+of the client (see NewRegistry) before they leave the process, and decrypted when decoded back into the struct.
+Encrypted values are stored as binary subtype 6 and are opaque to the server.
+
+  - randomized: AES-256-GCM with a random nonce. The same value encrypts differently every time, so the field
+    cannot be queried.
+  - deterministic: AES-256-GCM with a synthetic nonce derived from an HMAC of the value (SIV style). The same value
+    always encrypts to the same bytes under a key, so equality lookups work with EncryptedEq.
+
+Every ciphertext records the id of the key it was encrypted with. New values are encrypted with the active key
+of the keyring; older keys stay in the keyring to decrypt existing documents until they are re-encrypted with
+RotateEncryptedFields.
+*/
+
+const (
+	EncryptDeterministic = "deterministic"
+	EncryptRandomized    = "randomized"
+
+	// BinaryEncrypted is the bson binary subtype of encrypted values.
+	BinaryEncrypted byte = 0x06
+
+	// DataKeySize is the size of a data key: 32 bytes of AES-256 key followed by 32 bytes of HMAC-SHA256 key.
+	DataKeySize = 64
+
+	encryptionVersion byte = 1
+	modeDeterministic byte = 1
+	modeRandomized    byte = 2
+)
+
+var ErrDecrypt = errors.New("failed to decrypt field")
+
+type dataKey struct {
+	id   string
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// Keyring holds the data keys used for field level encryption.
+type Keyring struct {
+	active string
+	keys   map[string]*dataKey
+}
+
+// NewKeyring builds a keyring from raw data keys of DataKeySize bytes keyed by id.
+// active is the id of the key new values are encrypted with.
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	k := Keyring{active: active, keys: map[string]*dataKey{}}
+	for id, raw := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, errors.Errorf("invalid key id %q", id)
+		}
+		if len(raw) != DataKeySize {
+			return nil, errors.Errorf("key %s must be %d bytes, got %d", id, DataKeySize, len(raw))
+		}
+		block, err := aes.NewCipher(raw[:32])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", id)
+		}
+		k.keys[id] = &dataKey{id: id, aead: aead, mac: append([]byte(nil), raw[32:]...)}
+	}
+	if _, ok := k.keys[active]; !ok {
+		return nil, errors.Errorf("active key %q is not in the keyring", active)
+	}
+	return &k, nil
+}
+
+// keyFile is the format of the key file referenced by the encryption config:
+//
+//	{"active": "2024-06", "keys": [{"id": "2024-06", "key": "<base64 of 64 random bytes>"}]}
+//
+// A key can be generated with `openssl rand -base64 64`. To rotate, add a new key, make it active and run
+// `go-app encryption rotate`; the old key can be removed once no document refers to it anymore.
+type keyFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	} `json:"keys"`
+}
+
+// LoadKeyring reads a keyring from a key file.
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read key file")
+	}
+	var kf keyFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, errors.Wrap(err, "invalid key file")
+	}
+	keys := map[string][]byte{}
+	for _, k := range kf.Keys {
+		raw, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", k.ID)
+		}
+		if _, ok := keys[k.ID]; ok {
+			return nil, errors.Errorf("duplicate key %s", k.ID)
+		}
+		keys[k.ID] = raw
+	}
+	return NewKeyring(kf.Active, keys)
+}
+
+// Active returns the id of the key new values are encrypted with.
+func (k *Keyring) Active() string {
+	return k.active
+}
+
+// KeyIDs returns the ids of all keys in the keyring, sorted.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// encrypt encrypts a bson value of type t with the active key.
+func (k *Keyring) encrypt(mode byte, t bsontype.Type, value []byte) (primitive.Binary, error) {
+	return k.encryptWith(k.keys[k.active], mode, t, value)
+}
+
+// Ciphertext layout: version | mode | len(key id) | key id | nonce | GCM(type | value).
+// The header up to the key id is authenticated as additional data.
+func (k *Keyring) encryptWith(dk *dataKey, mode byte, t bsontype.Type, value []byte) (primitive.Binary, error) {
+	header := append([]byte{encryptionVersion, mode, byte(len(dk.id))}, dk.id...)
+	plain := append([]byte{byte(t)}, value...)
+
+	nonce := make([]byte, dk.aead.NonceSize())
+	switch mode {
+	case modeDeterministic:
+		h := hmac.New(sha256.New, dk.mac)
+		h.Write(header)
+		h.Write(plain)
+		copy(nonce, h.Sum(nil))
+	case modeRandomized:
+		if _, err := rand.Read(nonce); err != nil {
+			return primitive.Binary{}, errors.Wrap(err, "failed to generate nonce")
+		}
+	default:
+		return primitive.Binary{}, errors.Errorf("unknown encryption mode %d", mode)
+	}
+
+	data := make([]byte, 0, len(header)+len(nonce)+len(plain)+dk.aead.Overhead())
+	data = append(append(data, header...), nonce...)
+	data = dk.aead.Seal(data, nonce, plain, header)
+	return primitive.Binary{Subtype: BinaryEncrypted, Data: data}, nil
+}
+
+func parseHeader(data []byte) (mode byte, keyID string, header []byte, err error) {
+	if len(data) < 3 || data[0] != encryptionVersion {
+		return 0, "", nil, errors.Wrap(ErrDecrypt, "unknown ciphertext version")
+	}
+	n := int(data[2])
+	if len(data) < 3+n {
+		return 0, "", nil, errors.Wrap(ErrDecrypt, "truncated ciphertext")
+	}
+	return data[1], string(data[3 : 3+n]), data[:3+n], nil
+}
+
+// decrypt returns the bson type and value encrypted in data.
+func (k *Keyring) decrypt(data []byte) (bsontype.Type, []byte, error) {
+	_, keyID, header, err := parseHeader(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	dk, ok := k.keys[keyID]
+	if !ok {
+		return 0, nil, errors.Wrapf(ErrDecrypt, "unknown key %s", keyID)
+	}
+	rest := data[len(header):]
+	if len(rest) < dk.aead.NonceSize() {
+		return 0, nil, errors.Wrap(ErrDecrypt, "truncated ciphertext")
+	}
+	nonce, sealed := rest[:dk.aead.NonceSize()], rest[dk.aead.NonceSize():]
+	plain, err := dk.aead.Open(nil, nonce, sealed, header)
+	if err != nil || len(plain) == 0 {
+		return 0, nil, errors.Wrapf(ErrDecrypt, "authentication failed with key %s", keyID)
+	}
+	return bsontype.Type(plain[0]), plain[1:], nil
+}
+
+// stale reports whether an encrypted value needs re-encryption with the active key.
+func (k *Keyring) stale(data []byte) bool {
+	_, keyID, _, err := parseHeader(data)
+	return err != nil || keyID != k.active
+}
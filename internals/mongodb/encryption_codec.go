@@ -0,0 +1,359 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// NewRegistry returns the bson registry used by the clients: the default registry with a struct codec that
+// encrypts and decrypts the fields tagged with `encrypt`. With a nil keyring tagged fields are stored in plaintext.
+//
+// Only the direct fields of a struct are considered, nested structs are handled by their own tags.
+func NewRegistry(keyring *Keyring) *bsoncodec.Registry {
+	def, err := bsoncodec.NewStructCodec(bsoncodec.DefaultStructTagParser)
+	if err != nil {
+		panic(err)
+	}
+	c := &encryptingStructCodec{keyring: keyring, def: def}
+
+	r := bson.NewRegistry()
+	r.RegisterKindEncoder(reflect.Struct, c)
+	r.RegisterKindDecoder(reflect.Struct, c)
+	r.RegisterTypeEncoder(tEncryptedEq, bsoncodec.ValueEncoderFunc(c.encodeEq))
+	return r
+}
+
+type encryptedField struct {
+	name string
+	mode byte
+}
+
+type encryptingStructCodec struct {
+	keyring *Keyring
+	def     *bsoncodec.StructCodec
+	fields  sync.Map // reflect.Type -> map[string]encryptedField
+}
+
+// encryptedFields returns the encrypted fields of t keyed by their bson name.
+func encryptedFields(t reflect.Type) (map[string]encryptedField, error) {
+	fields := map[string]encryptedField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("encrypt")
+		if !ok {
+			continue
+		}
+		var mode byte
+		switch tag {
+		case EncryptDeterministic:
+			mode = modeDeterministic
+		case EncryptRandomized:
+			mode = modeRandomized
+		default:
+			return nil, errors.Errorf("invalid encrypt tag %q on %s.%s", tag, t.Name(), sf.Name)
+		}
+		st, err := bsoncodec.DefaultStructTagParser.ParseStructTags(sf)
+		if err != nil {
+			return nil, err
+		}
+		if st.Skip {
+			continue
+		}
+		if st.Inline {
+			return nil, errors.Errorf("encrypt tag is not supported on inline field %s.%s", t.Name(), sf.Name)
+		}
+		fields[st.Name] = encryptedField{name: st.Name, mode: mode}
+	}
+	return fields, nil
+}
+
+func (c *encryptingStructCodec) lookupFields(t reflect.Type) (map[string]encryptedField, error) {
+	if f, ok := c.fields.Load(t); ok {
+		return f.(map[string]encryptedField), nil
+	}
+	f, err := encryptedFields(t)
+	if err != nil {
+		return nil, err
+	}
+	c.fields.Store(t, f)
+	return f, nil
+}
+
+func (c *encryptingStructCodec) EncodeValue(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	fields, err := c.lookupFields(val.Type())
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 || c.keyring == nil {
+		return c.def.EncodeValue(ec, vw, val)
+	}
+
+	var buf bsonrw.SliceWriter
+	bw, err := bsonrw.NewBSONValueWriter(&buf)
+	if err != nil {
+		return err
+	}
+	if err := c.def.EncodeValue(ec, bw, val); err != nil {
+		return err
+	}
+
+	doc, err := c.transform(bsoncore.Document(buf), fields, func(f encryptedField, v bsoncore.Value) (bsoncore.Value, error) {
+		if v.Type == bsontype.Null {
+			return v, nil
+		}
+		b, err := c.keyring.encrypt(f.mode, v.Type, v.Data)
+		if err != nil {
+			return v, errors.Wrapf(err, "failed to encrypt %s", f.name)
+		}
+		return bsoncore.Value{Type: bsontype.Binary, Data: bsoncore.AppendBinary(nil, b.Subtype, b.Data)}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+func (c *encryptingStructCodec) DecodeValue(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	fields, err := c.lookupFields(val.Type())
+	if err != nil {
+		return err
+	}
+	// a top level document reader reports type 0
+	if t := vr.Type(); len(fields) == 0 || c.keyring == nil || (t != bsontype.EmbeddedDocument && t != bsontype.Type(0)) {
+		return c.def.DecodeValue(dc, vr, val)
+	}
+
+	raw, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+	doc, err := c.transform(raw, fields, func(f encryptedField, v bsoncore.Value) (bsoncore.Value, error) {
+		subtype, data, ok := v.BinaryOK()
+		if !ok || subtype != BinaryEncrypted {
+			// plaintext written before the field was encrypted
+			return v, nil
+		}
+		t, plain, err := c.keyring.decrypt(data)
+		if err != nil {
+			return v, errors.Wrapf(err, "field %s", f.name)
+		}
+		return bsoncore.Value{Type: t, Data: plain}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.def.DecodeValue(dc, bsonrw.NewBSONDocumentReader(doc), val)
+}
+
+// transform rebuilds doc with fn applied to the values of the encrypted fields.
+func (c *encryptingStructCodec) transform(doc bsoncore.Document, fields map[string]encryptedField, fn func(encryptedField, bsoncore.Value) (bsoncore.Value, error)) (bsoncore.Document, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	idx, out := bsoncore.AppendDocumentStart(nil)
+	for _, e := range elems {
+		v := e.Value()
+		if f, ok := fields[e.Key()]; ok {
+			if v, err = fn(f, v); err != nil {
+				return nil, err
+			}
+		}
+		out = bsoncore.AppendValueElement(out, e.Key(), v)
+	}
+	return bsoncore.AppendDocumentEnd(out, idx)
+}
+
+var tEncryptedEq = reflect.TypeOf(encryptedEq{})
+
+type encryptedEq struct {
+	value interface{}
+}
+
+// EncryptedEq matches a deterministically encrypted field against value, e.g.
+//
+//	coll.Find(ctx, bson.M{"account_holder_name": mongodb.EncryptedEq(name)})
+//
+// It matches values encrypted with any key of the keyring, so lookups keep working during a key rotation.
+// It only works with clients created by this package, on fields tagged `encrypt:"deterministic"`.
+func EncryptedEq(value interface{}) interface{} {
+	return encryptedEq{value: value}
+}
+
+func (c *encryptingStructCodec) encodeEq(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	eq := val.Interface().(encryptedEq)
+	t, data, err := bson.MarshalValueWithRegistry(ec.Registry, eq.value)
+	if err != nil {
+		return err
+	}
+
+	idx, doc := bsoncore.AppendDocumentStart(nil)
+	if c.keyring == nil {
+		doc = bsoncore.AppendValueElement(doc, "$eq", bsoncore.Value{Type: t, Data: data})
+	} else {
+		var aidx int32
+		aidx, doc = bsoncore.AppendArrayElementStart(doc, "$in")
+		for i, id := range c.keyring.KeyIDs() {
+			b, err := c.keyring.encryptWith(c.keyring.keys[id], modeDeterministic, t, data)
+			if err != nil {
+				return err
+			}
+			doc = bsoncore.AppendBinaryElement(doc, strconv.Itoa(i), b.Subtype, b.Data)
+		}
+		if doc, err = bsoncore.AppendArrayEnd(doc, aidx); err != nil {
+			return err
+		}
+	}
+	if doc, err = bsoncore.AppendDocumentEnd(doc, idx); err != nil {
+		return err
+	}
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+// rotatedField is a field rewritten by RotateEncryptedFields: an encrypted field, or a nested struct holding
+// encrypted fields when nested is set.
+type rotatedField struct {
+	nested map[string]rotatedField
+}
+
+// rotatedFields returns the fields of t that hold encrypted values keyed by their bson name, seen guards
+// against recursive types.
+func rotatedFields(t reflect.Type, seen map[reflect.Type]bool) (map[string]rotatedField, error) {
+	encrypted, err := encryptedFields(t)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]rotatedField{}
+	for name := range encrypted {
+		fields[name] = rotatedField{}
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if _, ok := sf.Tag.Lookup("encrypt"); ok || !sf.IsExported() {
+			continue
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || seen[ft] {
+			continue
+		}
+		nested, err := rotatedFields(ft, seen)
+		if err != nil {
+			return nil, err
+		}
+		if len(nested) == 0 {
+			continue
+		}
+		st, err := bsoncodec.DefaultStructTagParser.ParseStructTags(sf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case st.Skip:
+		case st.Inline:
+			for name, f := range nested {
+				fields[name] = f
+			}
+		default:
+			fields[st.Name] = rotatedField{nested: nested}
+		}
+	}
+	return fields, nil
+}
+
+// staleFields reports whether one of the fields of doc is in plaintext or encrypted with another key than the
+// active one.
+func (k *Keyring) staleFields(doc bson.Raw, fields map[string]rotatedField) bool {
+	for name, f := range fields {
+		v, err := doc.LookupErr(name)
+		if err != nil || v.Type == bsontype.Null {
+			continue
+		}
+		if f.nested != nil {
+			if nested, ok := v.DocumentOK(); ok && k.staleFields(nested, f.nested) {
+				return true
+			}
+			continue
+		}
+		if subtype, data, ok := v.BinaryOK(); !ok || subtype != BinaryEncrypted || k.stale(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateEncryptedFields re-encrypts with the active key the encrypted fields of the documents of coll that were
+// encrypted with another key, or written in plaintext before the fields were encrypted. prototype is a value of
+// the model type stored in coll, the encrypted fields of its nested structs are re-encrypted too. A document
+// modified concurrently is skipped and picked up by the next run. Returns the number of documents updated.
+func (k *Keyring) RotateEncryptedFields(ctx context.Context, coll Collection, prototype interface{}) (int64, error) {
+	t := reflect.TypeOf(prototype)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return 0, errors.Errorf("prototype must be a struct, got %s", t)
+	}
+	fields, err := rotatedFields(t, map[reflect.Type]bool{})
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, errors.Errorf("%s has no encrypted fields", t)
+	}
+	reg := NewRegistry(k)
+
+	cur, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list documents")
+	}
+	defer cur.Close(ctx)
+
+	var updated int64
+	for cur.Next(ctx) {
+		raw := cur.Current
+		if !k.staleFields(raw, fields) {
+			continue
+		}
+		filter := bson.D{{Key: "_id", Value: raw.Lookup("_id")}}
+		for name := range fields {
+			if v, err := raw.LookupErr(name); err == nil && v.Type != bsontype.Null {
+				filter = append(filter, bson.E{Key: name, Value: v})
+			}
+		}
+
+		doc := reflect.New(t)
+		if err := bson.UnmarshalWithRegistry(reg, raw, doc.Interface()); err != nil {
+			return updated, errors.Wrapf(err, "failed to decode %s", raw.Lookup("_id"))
+		}
+		b, err := bson.MarshalWithRegistry(reg, doc.Interface())
+		if err != nil {
+			return updated, errors.Wrapf(err, "failed to encode %s", raw.Lookup("_id"))
+		}
+		set := bson.D{}
+		for name := range fields {
+			if v, err := bson.Raw(b).LookupErr(name); err == nil {
+				set = append(set, bson.E{Key: name, Value: v})
+			}
+		}
+		res, err := coll.UpdateOne(ctx, filter, bson.M{"$set": set})
+		if err != nil {
+			return updated, errors.Wrapf(err, "failed to update %s", raw.Lookup("_id"))
+		}
+		updated += res.ModifiedCount
+	}
+	return updated, cur.Err()
+}
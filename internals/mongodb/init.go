@@ -5,17 +5,19 @@ package mongodb
 import (
 	"context"
 	"go-app/internals/config"
+	"go-app/internals/health"
 	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type MongoDB interface {
 	Close() error
 	Cli() Client
+	ChangeStream(opts *ChangeStreamConsumerOpts) ChangeStreamConsumer
+	HealthChecks() []*health.Check
 }
 
 type MongoDBImpl struct {
@@ -24,6 +26,11 @@ type MongoDBImpl struct {
 	Logger *zerolog.Logger
 	Config *config.MongoDBConfig
 	Client Client
+	// Keyring used for field level encryption, nil when encryption is not configured.
+	Keyring *Keyring
+
+	mu        sync.Mutex
+	consumers []ChangeStreamConsumer
 }
 
 type MongoDBOpts struct {
@@ -31,13 +38,75 @@ type MongoDBOpts struct {
 	Logger *zerolog.Logger
 	Config *config.MongoDBConfig
 	Worker *sync.WaitGroup
+	// Interceptors wrap every driver call, the first one is the outermost.
+	Interceptors []OperationInterceptor
 }
 
 func (mdbi *MongoDBImpl) Cli() Client {
 	return mdbi.Client
 }
 
+// ChangeStream creates a supervised change stream consumer. Unset options are filled from the app context,
+// logger and ChangeStreamConfig; resume tokens are persisted in the configured resume token collection.
+// The consumer is closed along with the MongoDB connection.
+func (mdbi *MongoDBImpl) ChangeStream(opts *ChangeStreamConsumerOpts) ChangeStreamConsumer {
+	o := *opts
+	if o.Ctx == nil {
+		o.Ctx = mdbi.Ctx
+	}
+	if o.Logger == nil && mdbi.Logger != nil {
+		l := mdbi.Logger.With().Str("consumer", o.Name).Logger()
+		o.Logger = &l
+	}
+	if o.Worker == nil {
+		o.Worker = mdbi.Worker
+	}
+
+	csc := &config.ChangeStreamConfig{}
+	if mdbi.Config != nil && mdbi.Config.ChangeStreamConfig != nil {
+		csc = mdbi.Config.ChangeStreamConfig
+	}
+	if o.Store == nil {
+		dbName, collName := csc.ResumeTokenDB, csc.ResumeTokenColl
+		if dbName == "" {
+			dbName = DefaultResumeTokenDB
+		}
+		if collName == "" {
+			collName = DefaultResumeTokenColl
+		}
+		o.Store = NewResumeTokenStore(mdbi.Client.Database(dbName).Collection(collName))
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = csc.MinBackoff
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = csc.MaxBackoff
+	}
+
+	if o.Registry == nil {
+		o.Registry = NewRegistry(mdbi.Keyring)
+	}
+
+	c := NewChangeStreamConsumer(&o)
+	mdbi.mu.Lock()
+	mdbi.consumers = append(mdbi.consumers, c)
+	mdbi.mu.Unlock()
+	return c
+}
+
+// HealthChecks pings the primary, readiness fails while mongodb is unreachable.
+func (mdbi *MongoDBImpl) HealthChecks() []*health.Check {
+	return []*health.Check{{Name: "mongodb", Func: mdbi.Client.Ping, Critical: true}}
+}
+
 func (mdbi *MongoDBImpl) Close() error {
+	mdbi.mu.Lock()
+	for _, c := range mdbi.consumers {
+		c.Close()
+	}
+	mdbi.consumers = nil
+	mdbi.mu.Unlock()
+
 	err := mdbi.Client.Disconnect(context.TODO())
 	if err != nil {
 		mdbi.Logger.Err(err).Msg("error while closing mongodb connection")
@@ -47,22 +116,38 @@ func (mdbi *MongoDBImpl) Close() error {
 	return err
 }
 
-func getMongoDBClientOpts(c *config.MongoDBConfig) *options.ClientOptions {
+func getMongoDBClientOpts(c *config.MongoDBConfig, ps *policySet) *options.ClientOptions {
 	clientOpts := options.Client().ApplyURI(c.ConnectionURL())
-	if c.ReadPref != "" {
-		mode, err := readpref.ModeFromString(c.ReadPref)
-		if err != nil {
-			rp, err := readpref.New(mode)
-			if err == nil {
-				clientOpts = clientOpts.SetReadPreference(rp)
-			}
-		}
+	if ps.client.ReadPref != nil {
+		clientOpts.SetReadPreference(ps.client.ReadPref)
+	}
+	if ps.client.ReadConcern != nil {
+		clientOpts.SetReadConcern(ps.client.ReadConcern)
+	}
+	if ps.client.WriteConcern != nil {
+		clientOpts.SetWriteConcern(ps.client.WriteConcern)
 	}
 	return clientOpts
 }
 
+// keyringFromConfig loads the field level encryption keyring, it returns nil when no key file is configured.
+func keyringFromConfig(c *config.MongoDBEncryptionConfig) (*Keyring, error) {
+	if c == nil || c.KeyFile == "" {
+		return nil, nil
+	}
+	return LoadKeyring(c.KeyFile)
+}
+
 func NewMongoDB(opts *MongoDBOpts) (MongoDB, error) {
-	client, err := NewClient(opts)
+	keyring, err := keyringFromConfig(opts.Config.EncryptionConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load encryption keys")
+	}
+	if keyring == nil && opts.Logger != nil {
+		opts.Logger.Warn().Msg("field level encryption is not configured, encrypted fields are stored in plaintext")
+	}
+
+	client, err := NewClient(opts, keyring)
 	if err != nil {
 		return nil, errors.Wrap(err, "connect failed")
 	}
@@ -71,12 +156,15 @@ func NewMongoDB(opts *MongoDBOpts) (MongoDB, error) {
 		return nil, errors.Wrap(err, "ping failed")
 	}
 
-	mongodb := MongoDBImpl{Client: client, Ctx: opts.Ctx, Worker: opts.Worker, Logger: opts.Logger, Config: opts.Config}
+	if opts.Worker == nil {
+		opts.Worker = &sync.WaitGroup{}
+	}
+	mongodb := MongoDBImpl{Client: client, Ctx: opts.Ctx, Worker: opts.Worker, Logger: opts.Logger, Config: opts.Config, Keyring: keyring}
 	return &mongodb, nil
 }
 
-func NewMockMongoDB(url string) (MongoDB, error) {
-	client, err := NewTestClient(url)
+func NewMockMongoDB(url string, keyring *Keyring) (MongoDB, error) {
+	client, err := NewTestClient(url, keyring)
 	if err != nil {
 		return nil, errors.Wrap(err, "connect failed")
 	}
@@ -85,6 +173,6 @@ func NewMockMongoDB(url string) (MongoDB, error) {
 		return nil, errors.Wrap(err, "ping failed")
 	}
 
-	mongodb := MongoDBImpl{Client: client}
+	mongodb := MongoDBImpl{Client: client, Ctx: context.Background(), Worker: &sync.WaitGroup{}, Keyring: keyring}
 	return &mongodb, nil
 }
@@ -0,0 +1,649 @@
+package mongodb
+
+import (
+	"context"
+	"go-app/internals/health"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+In-memory implementation of MongoDB, Client, Database and Collection.
+
+It is meant for tests that should not depend on a MongoDB binary. Documents are stored as bson.D, so anything
+that round trips through the bson codecs behaves like it does against a server. Supported:
+  - filters: implicit equality, $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $not, $and, $or, $nor
+  - updates: $set, $unset, $inc, $setOnInsert, $push, $pull of equal values, upserts
+  - find options: sort, skip, limit
+  - aggregate stages: $match, $sort, $skip, $limit, $count
+  - transactions with snapshot isolation; write-write conflicts fail with a TransientTransactionError
+    which WithTransaction retries, like the driver does.
+  - indexes are created and listed, but not used: unique indexes are not enforced and TTL indexes do not
+    drop the expired documents.
+
+Change streams are not supported, the change stream consumers are tested with the streams of a ChangeStreamOpener.
+*/
+
+// ErrNotSupported is returned for operations the in-memory implementation does not provide.
+var ErrNotSupported = errors.New("not supported by the in-memory mongodb")
+
+type MemoryMongoDB struct {
+	Client  Client
+	Keyring *Keyring
+}
+
+type MemoryMongoDBOpts struct {
+	// Keyring used for field level encryption, may be nil.
+	Keyring *Keyring
+}
+
+// NewMemoryMongoDB returns an empty in-memory MongoDB. Every instance has its own storage.
+func NewMemoryMongoDB(opts *MemoryMongoDBOpts) MongoDB {
+	m := MemoryMongoDB{
+		Client:  &memoryClient{store: newMemoryStore(), registry: NewRegistry(opts.Keyring)},
+		Keyring: opts.Keyring,
+	}
+	return &m
+}
+
+func (m *MemoryMongoDB) Cli() Client {
+	return m.Client
+}
+
+func (m *MemoryMongoDB) Close() error {
+	return nil
+}
+
+func (m *MemoryMongoDB) HealthChecks() []*health.Check {
+	return []*health.Check{{Name: "mongodb", Func: m.Client.Ping, Critical: true}}
+}
+
+func (m *MemoryMongoDB) ChangeStream(opts *ChangeStreamConsumerOpts) ChangeStreamConsumer {
+	return NewChangeStreamConsumer(opts)
+}
+
+type memoryDoc struct {
+	doc bson.D
+	rev uint64
+}
+
+type namespace struct {
+	db   string
+	coll string
+}
+
+// memoryStore is the committed state. Stored documents are never mutated, updates replace them.
+type memoryStore struct {
+	mu    sync.Mutex
+	rev   uint64
+	colls map[namespace][]*memoryDoc
+	// indexes holds the indexes created on each collection, besides the _id index.
+	indexes map[namespace][]*mongo.IndexSpecification
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{colls: map[namespace][]*memoryDoc{}, indexes: map[namespace][]*mongo.IndexSpecification{}}
+}
+
+func (s *memoryStore) snapshot() map[namespace][]*memoryDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := make(map[namespace][]*memoryDoc, len(s.colls))
+	for ns, docs := range s.colls {
+		snap[ns] = append([]*memoryDoc(nil), docs...)
+	}
+	return snap
+}
+
+func (s *memoryStore) revOf(ns namespace, key string) uint64 {
+	for _, d := range s.colls[ns] {
+		if idKey(d.doc) == key {
+			return d.rev
+		}
+	}
+	return 0
+}
+
+// memoryTxn is a transaction working on a snapshot of the store taken when it started.
+type memoryTxn struct {
+	view map[namespace][]*memoryDoc
+	// base holds, for every written document, its revision in the snapshot (0 if it did not exist).
+	base map[namespace]map[string]uint64
+	// order lists the written documents in the order they were first written, commit applies them in that order.
+	order []txnKey
+}
+
+type txnKey struct {
+	ns  namespace
+	key string
+}
+
+func (t *memoryTxn) touch(ns namespace, key string, rev uint64) {
+	if t.base[ns] == nil {
+		t.base[ns] = map[string]uint64{}
+	}
+	if _, ok := t.base[ns][key]; !ok {
+		t.base[ns][key] = rev
+		t.order = append(t.order, txnKey{ns: ns, key: key})
+	}
+}
+
+func writeConflict() error {
+	return mongo.CommandError{
+		Code:    112,
+		Name:    "WriteConflict",
+		Message: "Write conflict during plan execution and yielding is disabled.",
+		Labels:  []string{"TransientTransactionError"},
+	}
+}
+
+// txnState gives a collection operation access to the documents it should work on, either the committed
+// state or the snapshot of the transaction running on ctx.
+type txnState struct {
+	store *memoryStore
+	txn   *memoryTxn
+}
+
+func (ts *txnState) docs(ns namespace) []*memoryDoc {
+	if ts.txn != nil {
+		return ts.txn.view[ns]
+	}
+	return ts.store.colls[ns]
+}
+
+// write replaces (or with doc nil, deletes) the document with key in ns.
+func (ts *txnState) write(ns namespace, key string, doc bson.D) error {
+	docs := ts.docs(ns)
+	idx := -1
+	var prevRev uint64
+	for i, d := range docs {
+		if idKey(d.doc) == key {
+			idx, prevRev = i, d.rev
+			break
+		}
+	}
+
+	if ts.txn != nil {
+		// first writer wins, like the server does
+		if ts.store.revOf(ns, key) != prevRev {
+			return writeConflict()
+		}
+		ts.txn.touch(ns, key, prevRev)
+	}
+
+	var nd *memoryDoc
+	if doc != nil {
+		if ts.txn != nil {
+			nd = &memoryDoc{doc: doc, rev: prevRev}
+		} else {
+			ts.store.rev++
+			nd = &memoryDoc{doc: doc, rev: ts.store.rev}
+		}
+	}
+
+	next := append([]*memoryDoc(nil), docs...)
+	switch {
+	case idx >= 0 && nd != nil:
+		next[idx] = nd
+	case idx >= 0:
+		next = append(next[:idx], next[idx+1:]...)
+	case nd != nil:
+		next = append(next, nd)
+	}
+
+	if ts.txn != nil {
+		ts.txn.view[ns] = next
+	} else {
+		ts.store.colls[ns] = next
+	}
+	return nil
+}
+
+func (s *memoryStore) commit(txn *memoryTxn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ns, keys := range txn.base {
+		for key, rev := range keys {
+			if s.revOf(ns, key) != rev {
+				return writeConflict()
+			}
+		}
+	}
+	ts := txnState{store: s}
+	for _, k := range txn.order {
+		var doc bson.D
+		for _, d := range txn.view[k.ns] {
+			if idKey(d.doc) == k.key {
+				doc = d.doc
+				break
+			}
+		}
+		if err := ts.write(k.ns, k.key, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryClient struct {
+	store    *memoryStore
+	registry *bsoncodec.Registry
+}
+
+func (mc *memoryClient) Database(name string, opts ...*options.DatabaseOptions) Database {
+	return &memoryDatabase{name: name, client: mc}
+}
+
+func (mc *memoryClient) Disconnect(ctx context.Context) error {
+	return nil
+}
+
+func (mc *memoryClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (mc *memoryClient) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
+	id, _ := uuid.New().MarshalBinary()
+	return &memorySession{store: mc.store, id: id}, nil
+}
+
+func (mc *memoryClient) UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error {
+	sess, _ := mc.StartSession()
+	defer sess.EndSession(ctx)
+	return fn(mongo.NewSessionContext(ctx, sess))
+}
+
+type memoryDatabase struct {
+	name   string
+	client *memoryClient
+}
+
+func (md *memoryDatabase) Collection(name string, opts ...*options.CollectionOptions) Collection {
+	return &memoryCollection{ns: namespace{db: md.name, coll: name}, store: md.client.store, registry: md.client.registry}
+}
+
+func (md *memoryDatabase) Client() Client {
+	return md.client
+}
+
+// memorySession implements mongo.Session. The embedded interface is never set, it only satisfies the
+// unexported method of mongo.Session; every exported method is implemented below.
+type memorySession struct {
+	mongo.Session
+	store *memoryStore
+	id    []byte
+
+	mu  sync.Mutex
+	txn *memoryTxn
+}
+
+func (ms *memorySession) StartTransaction(opts ...*options.TransactionOptions) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.txn != nil {
+		return errors.New("transaction already in progress")
+	}
+	ms.txn = &memoryTxn{view: ms.store.snapshot(), base: map[namespace]map[string]uint64{}}
+	return nil
+}
+
+func (ms *memorySession) AbortTransaction(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.txn == nil {
+		return errors.New("no transaction started")
+	}
+	ms.txn = nil
+	return nil
+}
+
+func (ms *memorySession) CommitTransaction(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.txn == nil {
+		return errors.New("no transaction started")
+	}
+	err := ms.store.commit(ms.txn)
+	ms.txn = nil
+	return err
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors for up to 120 seconds like the driver.
+func (ms *memorySession) WithTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	deadline := time.Now().Add(120 * time.Second)
+	sctx := mongo.NewSessionContext(ctx, ms)
+	for attempt := 0; ; attempt++ {
+		if err := ms.StartTransaction(opts...); err != nil {
+			return nil, err
+		}
+		res, err := fn(sctx)
+		if err == nil {
+			err = ms.CommitTransaction(ctx)
+			if err == nil {
+				return res, nil
+			}
+		} else {
+			_ = ms.AbortTransaction(ctx)
+		}
+
+		var le mongo.LabeledError
+		if !errors.As(err, &le) || !le.HasErrorLabel("TransientTransactionError") || time.Now().After(deadline) {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// jittered backoff so conflicting transactions do not keep colliding
+		time.Sleep(time.Duration(rand.Int63n(int64(time.Millisecond) * int64(attempt%10+1))))
+	}
+}
+
+func (ms *memorySession) EndSession(ctx context.Context) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.txn = nil
+}
+
+func (ms *memorySession) ClusterTime() bson.Raw                           { return nil }
+func (ms *memorySession) OperationTime() *primitive.Timestamp             { return nil }
+func (ms *memorySession) Client() *mongo.Client                           { return nil }
+func (ms *memorySession) AdvanceClusterTime(bson.Raw) error               { return nil }
+func (ms *memorySession) AdvanceOperationTime(*primitive.Timestamp) error { return nil }
+
+func (ms *memorySession) ID() bson.Raw {
+	raw, _ := bson.Marshal(bson.D{{Key: "id", Value: primitive.Binary{Subtype: 4, Data: ms.id}}})
+	return raw
+}
+
+type memoryCollection struct {
+	ns       namespace
+	store    *memoryStore
+	registry *bsoncodec.Registry
+}
+
+// state locks the store and returns the state ctx operates on. The caller must call unlock.
+// Locks are always taken session first, then store.
+func (mc *memoryCollection) state(ctx context.Context) (*txnState, func()) {
+	ts := &txnState{store: mc.store}
+	if ms, ok := mongo.SessionFromContext(ctx).(*memorySession); ok {
+		ms.mu.Lock()
+		mc.store.mu.Lock()
+		ts.txn = ms.txn
+		return ts, func() {
+			mc.store.mu.Unlock()
+			ms.mu.Unlock()
+		}
+	}
+	mc.store.mu.Lock()
+	return ts, mc.store.mu.Unlock
+}
+
+func (mc *memoryCollection) find(ctx context.Context, filter interface{}) ([]bson.D, error) {
+	f, err := mc.toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	ts, unlock := mc.state(ctx)
+	defer unlock()
+
+	var res []bson.D
+	for _, d := range ts.docs(mc.ns) {
+		ok, err := matches(d.doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, d.doc)
+		}
+	}
+	return res, nil
+}
+
+func (mc *memoryCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	fo := options.MergeFindOneOptions(opts...)
+	docs, err := mc.find(ctx, filter)
+	if err == nil {
+		docs, err = sortSkipLimit(docs, fo.Sort, fo.Skip, nil)
+	}
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, mc.registry)
+	}
+	if len(docs) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, mc.registry)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, mc.registry)
+}
+
+func (mc *memoryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	fo := options.MergeFindOptions(opts...)
+	docs, err := mc.find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if docs, err = sortSkipLimit(docs, fo.Sort, fo.Skip, fo.Limit); err != nil {
+		return nil, err
+	}
+	return mc.newCursor(docs)
+}
+
+func (mc *memoryCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	co := options.MergeCountOptions(opts...)
+	docs, err := mc.find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if docs, err = sortSkipLimit(docs, nil, co.Skip, co.Limit); err != nil {
+		return 0, err
+	}
+	return int64(len(docs)), nil
+}
+
+func (mc *memoryCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	stages, err := toPipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := mc.find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			return nil, errors.New("a pipeline stage specification object must contain exactly one field")
+		}
+		if docs, err = applyStage(docs, stage[0]); err != nil {
+			return nil, err
+		}
+	}
+	return mc.newCursor(docs)
+}
+
+func (mc *memoryCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (interface{}, error) {
+	doc, id, err := mc.prepareInsert(document)
+	if err != nil {
+		return nil, err
+	}
+	ts, unlock := mc.state(ctx)
+	defer unlock()
+
+	if err := mc.insert(ts, doc); err != nil {
+		return nil, writeException(err)
+	}
+	return id, nil
+}
+
+func (mc *memoryCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) ([]interface{}, error) {
+	ts, unlock := mc.state(ctx)
+	defer unlock()
+
+	var ids []interface{}
+	for i, document := range documents {
+		doc, id, err := mc.prepareInsert(document)
+		if err != nil {
+			return nil, err
+		}
+		if err := mc.insert(ts, doc); err != nil {
+			var we mongo.WriteError
+			if errors.As(err, &we) {
+				we.Index = i
+				return nil, mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: we}}}
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// writeException wraps the write errors of insert like the driver reports them, other errors are returned as is.
+func writeException(err error) error {
+	var we mongo.WriteError
+	if errors.As(err, &we) {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{we}}
+	}
+	return err
+}
+
+// insert fails with a mongo.WriteError for duplicate keys, and with the write conflict as is so that it keeps
+// its TransientTransactionError label.
+func (mc *memoryCollection) insert(ts *txnState, doc bson.D) error {
+	key := idKey(doc)
+	for _, d := range ts.docs(mc.ns) {
+		if idKey(d.doc) == key {
+			return mongo.WriteError{Code: 11000, Message: "E11000 duplicate key error collection: " + mc.ns.db + "." + mc.ns.coll + " index: _id_"}
+		}
+	}
+	return ts.write(mc.ns, key, doc)
+}
+
+func (mc *memoryCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (int64, error) {
+	f, err := mc.toDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+	ts, unlock := mc.state(ctx)
+	defer unlock()
+
+	for _, d := range ts.docs(mc.ns) {
+		ok, err := matches(d.doc, f)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if err := ts.write(mc.ns, idKey(d.doc), nil); err != nil {
+				return 0, err
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mc *memoryCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return mc.update(ctx, filter, update, false, opts...)
+}
+
+func (mc *memoryCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return mc.update(ctx, filter, update, true, opts...)
+}
+
+func (mc *memoryCollection) update(ctx context.Context, filter interface{}, update interface{}, many bool, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	uo := options.MergeUpdateOptions(opts...)
+	f, err := mc.toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	u, err := mc.toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUpdate(u); err != nil {
+		return nil, err
+	}
+
+	ts, unlock := mc.state(ctx)
+	defer unlock()
+
+	res := mongo.UpdateResult{}
+	for _, d := range ts.docs(mc.ns) {
+		ok, err := matches(d.doc, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		res.MatchedCount++
+		nd, err := applyUpdate(d.doc, u, false)
+		if err != nil {
+			return nil, err
+		}
+		if !equalValues(nd, d.doc) {
+			if err := ts.write(mc.ns, idKey(d.doc), nd); err != nil {
+				return nil, err
+			}
+			res.ModifiedCount++
+		}
+		if !many {
+			break
+		}
+	}
+
+	if res.MatchedCount == 0 && uo.Upsert != nil && *uo.Upsert {
+		nd, err := applyUpdate(upsertSeed(f), u, true)
+		if err != nil {
+			return nil, err
+		}
+		nd, id, err := mc.prepareInsert(nd)
+		if err != nil {
+			return nil, err
+		}
+		if err := mc.insert(ts, nd); err != nil {
+			return nil, writeException(err)
+		}
+		res.UpsertedCount = 1
+		res.UpsertedID = id
+	}
+	return &res, nil
+}
+
+func (mc *memoryCollection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, errors.Wrap(ErrNotSupported, "change streams")
+}
+
+func (mc *memoryCollection) toDoc(v interface{}) (bson.D, error) {
+	return toDocWithRegistry(mc.registry, v)
+}
+
+func (mc *memoryCollection) newCursor(docs []bson.D) (*mongo.Cursor, error) {
+	items := make([]interface{}, 0, len(docs))
+	for _, d := range docs {
+		items = append(items, d)
+	}
+	return mongo.NewCursorFromDocuments(items, nil, mc.registry)
+}
+
+// prepareInsert normalizes document and assigns an ObjectID when it has no _id, like the driver does.
+func (mc *memoryCollection) prepareInsert(document interface{}) (bson.D, interface{}, error) {
+	doc, err := mc.toDoc(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range doc {
+		if e.Key == "_id" {
+			return doc, e.Value, nil
+		}
+	}
+	id := primitive.NewObjectID()
+	return append(bson.D{{Key: "_id", Value: id}}, doc...), id, nil
+}
@@ -0,0 +1,131 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// idIndexName is the name of the index every collection has on _id.
+const idIndexName = "_id_"
+
+func indexOptionsConflict(msg string) error {
+	return mongo.CommandError{Code: 85, Name: "IndexOptionsConflict", Message: msg}
+}
+
+// indexName generates the name of the index on keys like the driver does, eg: expires_at_1.
+func indexName(keys bson.D) (string, error) {
+	parts := make([]string, 0, 2*len(keys))
+	for _, e := range keys {
+		switch v := e.Value.(type) {
+		case int32, int64:
+			parts = append(parts, e.Key, fmt.Sprintf("%d", v))
+		case string:
+			parts = append(parts, e.Key, v)
+		default:
+			return "", errors.Errorf("invalid index key value for %s", e.Key)
+		}
+	}
+	return strings.Join(parts, "_"), nil
+}
+
+func (mc *memoryCollection) indexSpec(m mongo.IndexModel) (*mongo.IndexSpecification, error) {
+	keys, err := mc.toDoc(m.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("index keys must not be empty")
+	}
+	raw, err := bson.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	spec := &mongo.IndexSpecification{Namespace: mc.ns.db + "." + mc.ns.coll, KeysDocument: raw, Version: 2}
+	if o := m.Options; o != nil {
+		if o.Name != nil {
+			spec.Name = *o.Name
+		}
+		spec.ExpireAfterSeconds = o.ExpireAfterSeconds
+		spec.Unique = o.Unique
+		spec.Sparse = o.Sparse
+	}
+	if spec.Name == "" {
+		spec.Name, err = indexName(keys)
+	}
+	return spec, err
+}
+
+func sameIndex(a, b *mongo.IndexSpecification) bool {
+	return bytes.Equal(a.KeysDocument, b.KeysDocument) &&
+		reflect.DeepEqual(a.ExpireAfterSeconds, b.ExpireAfterSeconds) &&
+		reflect.DeepEqual(a.Unique, b.Unique) &&
+		reflect.DeepEqual(a.Sparse, b.Sparse)
+}
+
+// CreateIndexes records the indexes, they are not part of the transaction running on ctx. Creating an index which
+// exists with the same keys and options is a no-op, like it is on a server.
+func (mc *memoryCollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) ([]string, error) {
+	specs := make([]*mongo.IndexSpecification, 0, len(models))
+	for _, m := range models {
+		spec, err := mc.indexSpec(m)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Name == idIndexName {
+			return nil, indexOptionsConflict("the index name " + idIndexName + " is reserved for the _id index")
+		}
+		specs = append(specs, spec)
+	}
+
+	mc.store.mu.Lock()
+	defer mc.store.mu.Unlock()
+	next := append([]*mongo.IndexSpecification(nil), mc.store.indexes[mc.ns]...)
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		exists := false
+		for _, e := range next {
+			switch {
+			case e.Name == spec.Name && !sameIndex(e, spec):
+				return nil, indexOptionsConflict("An existing index has the same name as the requested index: " + spec.Name)
+			case e.Name != spec.Name && bytes.Equal(e.KeysDocument, spec.KeysDocument):
+				return nil, indexOptionsConflict("Index already exists with a different name: " + e.Name)
+			case e.Name == spec.Name:
+				exists = true
+			}
+		}
+		if !exists {
+			next = append(next, spec)
+		}
+		names = append(names, spec.Name)
+	}
+	mc.store.indexes[mc.ns] = next
+	return names, nil
+}
+
+// ListIndexSpecifications lists the _id index first, once the collection exists, then the created indexes.
+func (mc *memoryCollection) ListIndexSpecifications(ctx context.Context, opts ...*options.ListIndexesOptions) ([]*mongo.IndexSpecification, error) {
+	mc.store.mu.Lock()
+	defer mc.store.mu.Unlock()
+	indexes := mc.store.indexes[mc.ns]
+	if len(indexes) == 0 && len(mc.store.colls[mc.ns]) == 0 {
+		return nil, nil
+	}
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: int32(1)}})
+	if err != nil {
+		return nil, err
+	}
+	specs := []*mongo.IndexSpecification{{Name: idIndexName, Namespace: mc.ns.db + "." + mc.ns.coll, KeysDocument: raw, Version: 2}}
+	for _, spec := range indexes {
+		s := *spec
+		specs = append(specs, &s)
+	}
+	return specs, nil
+}
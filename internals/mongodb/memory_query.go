@@ -0,0 +1,462 @@
+package mongodb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toDoc normalizes a document (struct, bson.M, bson.D, map...) by round tripping it through the bson codecs,
+// so nested documents become bson.D and arrays bson.A.
+func toDoc(v interface{}) (bson.D, error) {
+	return toDocWithRegistry(bson.DefaultRegistry, v)
+}
+
+func toDocWithRegistry(r *bsoncodec.Registry, v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.MarshalWithRegistry(r, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid document")
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, errors.Wrap(err, "invalid document")
+	}
+	return d, nil
+}
+
+func toPipeline(v interface{}) ([]bson.D, error) {
+	raw, err := bson.Marshal(bson.M{"pipeline": v})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pipeline")
+	}
+	var p struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	if err := bson.Unmarshal(raw, &p); err != nil {
+		return nil, errors.Wrap(err, "invalid pipeline")
+	}
+	return p.Pipeline, nil
+}
+
+// idKey returns a key uniquely identifying the _id of doc.
+func idKey(doc bson.D) string {
+	for _, e := range doc {
+		if e.Key == "_id" {
+			t, b, err := bson.MarshalValue(e.Value)
+			if err != nil {
+				return fmt.Sprint(e.Value)
+			}
+			return string(rune(t)) + string(b)
+		}
+	}
+	return ""
+}
+
+func get(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lookup resolves a dotted path. Arrays along the path are traversed, so every reachable value is returned.
+func lookup(v interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	switch t := v.(type) {
+	case bson.D:
+		child, ok := get(t, path[0])
+		if !ok {
+			return nil
+		}
+		return lookup(child, path[1:])
+	case bson.A:
+		var res []interface{}
+		for _, item := range t {
+			res = append(res, lookup(item, path)...)
+		}
+		return res
+	}
+	return nil
+}
+
+// matches reports whether doc satisfies filter.
+func matches(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElem(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchElem(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := e.Value.(bson.A)
+		if !ok || len(clauses) == 0 {
+			return false, errors.Errorf("%s must be a nonempty array", e.Key)
+		}
+		for _, c := range clauses {
+			cd, ok := c.(bson.D)
+			if !ok {
+				return false, errors.Errorf("%s entries must be objects", e.Key)
+			}
+			m, err := matches(doc, cd)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !m:
+				return false, nil
+			case e.Key == "$or" && m:
+				return true, nil
+			case e.Key == "$nor" && m:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, errors.Errorf("unknown top level operator: %s", e.Key)
+	}
+
+	values := lookup(doc, strings.Split(e.Key, "."))
+	if cond, ok := e.Value.(bson.D); ok && isOperatorDoc(cond) {
+		return matchOperators(values, cond)
+	}
+	return matchEq(values, e.Value), nil
+}
+
+func isOperatorDoc(d bson.D) bool {
+	return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+// matchEq implements equality with the server semantics: null matches missing fields and a scalar
+// matches arrays containing it.
+func matchEq(values []interface{}, v interface{}) bool {
+	if len(values) == 0 {
+		return v == nil
+	}
+	for _, val := range values {
+		if equalValues(val, v) {
+			return true
+		}
+		if arr, ok := val.(bson.A); ok {
+			for _, item := range arr {
+				if equalValues(item, v) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchCmp(values []interface{}, v interface{}, ok func(c int) bool) bool {
+	for _, val := range values {
+		candidates := []interface{}{val}
+		if arr, isArr := val.(bson.A); isArr {
+			candidates = arr
+		}
+		for _, c := range candidates {
+			// comparison operators only match values of the same type class
+			if typeRank(c) != typeRank(v) {
+				continue
+			}
+			if ok(compareValues(c, v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchOperators(values []interface{}, cond bson.D) (bool, error) {
+	for _, op := range cond {
+		var m bool
+		switch op.Key {
+		case "$eq":
+			m = matchEq(values, op.Value)
+		case "$ne":
+			m = !matchEq(values, op.Value)
+		case "$gt":
+			m = matchCmp(values, op.Value, func(c int) bool { return c > 0 })
+		case "$gte":
+			m = matchCmp(values, op.Value, func(c int) bool { return c >= 0 })
+		case "$lt":
+			m = matchCmp(values, op.Value, func(c int) bool { return c < 0 })
+		case "$lte":
+			m = matchCmp(values, op.Value, func(c int) bool { return c <= 0 })
+		case "$in", "$nin":
+			arr, ok := op.Value.(bson.A)
+			if !ok {
+				return false, errors.Errorf("%s needs an array", op.Key)
+			}
+			for _, item := range arr {
+				if matchEq(values, item) {
+					m = true
+					break
+				}
+			}
+			if op.Key == "$nin" {
+				m = !m
+			}
+		case "$exists":
+			m = (len(values) > 0) == truthy(op.Value)
+		case "$not":
+			inner, ok := op.Value.(bson.D)
+			if !ok {
+				return false, errors.New("$not needs a document")
+			}
+			r, err := matchOperators(values, inner)
+			if err != nil {
+				return false, err
+			}
+			m = !r
+		default:
+			return false, errors.Errorf("unknown operator: %s", op.Key)
+		}
+		if !m {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case nil:
+		return false
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+// typeRank follows the BSON comparison order of types.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case primitive.MinKey:
+		return 0
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, int, float64, float32, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D, bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	case primitive.MaxKey:
+		return 13
+	}
+	return 12
+}
+
+// compareValues orders two values following the BSON comparison order.
+func compareValues(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch ra {
+	case 1:
+		return 0
+	case 2:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb || (math.IsNaN(fa) && !math.IsNaN(fb)):
+			return -1
+		case fa > fb || (math.IsNaN(fb) && !math.IsNaN(fa)):
+			return 1
+		}
+		return 0
+	case 3:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	case 6:
+		return bytes.Compare(a.(primitive.Binary).Data, b.(primitive.Binary).Data)
+	case 7:
+		oa, ob := a.(primitive.ObjectID), b.(primitive.ObjectID)
+		return bytes.Compare(oa[:], ob[:])
+	case 8:
+		ba, bb := a.(bool), b.(bool)
+		switch {
+		case ba == bb:
+			return 0
+		case !ba:
+			return -1
+		}
+		return 1
+	case 9:
+		da, db := a.(primitive.DateTime), b.(primitive.DateTime)
+		switch {
+		case da < db:
+			return -1
+		case da > db:
+			return 1
+		}
+		return 0
+	case 10:
+		return primitive.CompareTimestamp(a.(primitive.Timestamp), b.(primitive.Timestamp))
+	}
+	// documents, arrays and the rest: compare their encoded form
+	_, ea, _ := bson.MarshalValue(a)
+	_, eb, _ := bson.MarshalValue(b)
+	return bytes.Compare(ea, eb)
+}
+
+func equalValues(a, b interface{}) bool {
+	if typeRank(a) != typeRank(b) {
+		return false
+	}
+	if typeRank(a) == 2 {
+		return compareValues(a, b) == 0
+	}
+	return reflect.DeepEqual(a, b) || compareValues(a, b) == 0
+}
+
+// sortSkipLimit applies the find options. sortSpec may be nil, bson.D or anything marshaling to a document.
+func sortSkipLimit(docs []bson.D, sortSpec interface{}, skip, limit *int64) ([]bson.D, error) {
+	if sortSpec != nil {
+		spec, err := toDoc(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		docs = append([]bson.D(nil), docs...)
+		sortDocs(docs, spec)
+	}
+	if skip != nil && *skip > 0 {
+		if int(*skip) >= len(docs) {
+			return nil, nil
+		}
+		docs = docs[*skip:]
+	}
+	if limit != nil && *limit != 0 {
+		l := *limit
+		if l < 0 {
+			l = -l
+		}
+		if int(l) < len(docs) {
+			docs = docs[:l]
+		}
+	}
+	return docs, nil
+}
+
+func sortDocs(docs []bson.D, spec bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, s := range spec {
+			dir := 1
+			if f, ok := toFloat(s.Value); ok && f < 0 {
+				dir = -1
+			}
+			path := strings.Split(s.Key, ".")
+			var a, b interface{}
+			if v := lookup(docs[i], path); len(v) > 0 {
+				a = v[0]
+			}
+			if v := lookup(docs[j], path); len(v) > 0 {
+				b = v[0]
+			}
+			if c := compareValues(a, b); c != 0 {
+				return c*dir < 0
+			}
+		}
+		return false
+	})
+}
+
+func applyStage(docs []bson.D, stage bson.E) ([]bson.D, error) {
+	switch stage.Key {
+	case "$match":
+		f, ok := stage.Value.(bson.D)
+		if !ok {
+			return nil, errors.New("$match needs a document")
+		}
+		var res []bson.D
+		for _, d := range docs {
+			m, err := matches(d, f)
+			if err != nil {
+				return nil, err
+			}
+			if m {
+				res = append(res, d)
+			}
+		}
+		return res, nil
+	case "$sort":
+		return sortSkipLimit(docs, stage.Value, nil, nil)
+	case "$skip", "$limit":
+		n, ok := toFloat(stage.Value)
+		if !ok {
+			return nil, errors.Errorf("%s needs a number", stage.Key)
+		}
+		v := int64(n)
+		if stage.Key == "$skip" {
+			return sortSkipLimit(docs, nil, &v, nil)
+		}
+		return sortSkipLimit(docs, nil, nil, &v)
+	case "$count":
+		field, ok := stage.Value.(string)
+		if !ok || field == "" {
+			return nil, errors.New("$count needs a field name")
+		}
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []bson.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	}
+	return nil, errors.Wrapf(ErrNotSupported, "aggregation stage %s", stage.Key)
+}
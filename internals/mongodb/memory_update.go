@@ -0,0 +1,266 @@
+package mongodb
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// validateUpdate rejects replacement documents and unsupported operators before anything is written.
+func validateUpdate(u bson.D) error {
+	if len(u) == 0 {
+		return errors.New("update document must not be empty")
+	}
+	for _, e := range u {
+		switch e.Key {
+		case "$set", "$unset", "$inc", "$setOnInsert", "$push", "$pull":
+		default:
+			if !strings.HasPrefix(e.Key, "$") {
+				return errors.New("update document must contain only atomic operators")
+			}
+			return errors.Wrapf(ErrNotSupported, "update operator %s", e.Key)
+		}
+		if _, ok := e.Value.(bson.D); !ok {
+			return errors.Errorf("%s needs a document", e.Key)
+		}
+	}
+	return nil
+}
+
+// applyUpdate returns a copy of doc with the update operators of u applied, doc itself is never modified.
+// $setOnInsert only applies when isUpsert is set.
+func applyUpdate(doc bson.D, u bson.D, isUpsert bool) (bson.D, error) {
+	nd := copyValue(doc).(bson.D)
+	for _, op := range u {
+		if op.Key == "$setOnInsert" && !isUpsert {
+			continue
+		}
+		for _, f := range op.Value.(bson.D) {
+			if f.Key == "_id" && op.Key != "$setOnInsert" && !isUpsert {
+				if cur, ok := get(nd, "_id"); !ok || !equalValues(cur, f.Value) {
+					return nil, errors.New("performing an update on the path '_id' would modify the immutable field '_id'")
+				}
+			}
+			path := strings.Split(f.Key, ".")
+			var err error
+			switch op.Key {
+			case "$set", "$setOnInsert":
+				nd, err = setPath(nd, path, copyValue(f.Value))
+			case "$unset":
+				nd = unsetPath(nd, path)
+			case "$inc":
+				nd, err = incPath(nd, path, f.Value)
+			case "$push":
+				nd, err = pushPath(nd, path, copyValue(f.Value))
+			case "$pull":
+				nd, err = pullPath(nd, path, f.Value)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s %s", op.Key, f.Key)
+			}
+		}
+	}
+	return nd, nil
+}
+
+// upsertSeed builds the document an upsert starts from: the equality conditions of the filter.
+func upsertSeed(filter bson.D) bson.D {
+	seed := bson.D{}
+	for _, e := range filter {
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		v := e.Value
+		if cond, ok := v.(bson.D); ok && isOperatorDoc(cond) {
+			eq, ok := get(cond, "$eq")
+			if !ok {
+				continue
+			}
+			v = eq
+		}
+		seed, _ = setPath(seed, strings.Split(e.Key, "."), copyValue(v))
+	}
+	return seed
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case bson.D:
+		c := make(bson.D, len(t))
+		for i, e := range t {
+			c[i] = bson.E{Key: e.Key, Value: copyValue(e.Value)}
+		}
+		return c
+	case bson.A:
+		c := make(bson.A, len(t))
+		for i, item := range t {
+			c[i] = copyValue(item)
+		}
+		return c
+	}
+	return v
+}
+
+// updatePath calls fn with the current value at path, creating intermediate documents as needed,
+// and stores its result. fn returning remove deletes the field.
+func updatePath(doc bson.D, path []string, fn func(cur interface{}, exists bool) (v interface{}, remove bool, err error)) (bson.D, error) {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			v, remove, err := fn(e.Value, true)
+			if err != nil {
+				return nil, err
+			}
+			if remove {
+				return append(doc[:i:i], doc[i+1:]...), nil
+			}
+			doc[i].Value = v
+			return doc, nil
+		}
+		child, ok := e.Value.(bson.D)
+		if !ok {
+			if e.Value == nil {
+				child = bson.D{}
+			} else {
+				return nil, errors.Errorf("cannot create field %s in element {%s: %v}", path[1], e.Key, e.Value)
+			}
+		}
+		child, err := updatePath(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = child
+		return doc, nil
+	}
+
+	// field does not exist
+	if len(path) == 1 {
+		v, remove, err := fn(nil, false)
+		if err != nil || remove {
+			return doc, err
+		}
+		return append(doc, bson.E{Key: path[0], Value: v}), nil
+	}
+	child, err := updatePath(bson.D{}, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	if len(child) == 0 {
+		return doc, nil
+	}
+	return append(doc, bson.E{Key: path[0], Value: child}), nil
+}
+
+func setPath(doc bson.D, path []string, v interface{}) (bson.D, error) {
+	return updatePath(doc, path, func(interface{}, bool) (interface{}, bool, error) {
+		return v, false, nil
+	})
+}
+
+func unsetPath(doc bson.D, path []string) bson.D {
+	nd, err := updatePath(doc, path, func(interface{}, bool) (interface{}, bool, error) {
+		return nil, true, nil
+	})
+	if err != nil {
+		// unsetting below a non document is a no-op
+		return doc
+	}
+	return nd
+}
+
+func incPath(doc bson.D, path []string, by interface{}) (bson.D, error) {
+	if _, ok := toFloat(by); !ok {
+		return nil, errors.New("cannot increment with non-numeric argument")
+	}
+	return updatePath(doc, path, func(cur interface{}, exists bool) (interface{}, bool, error) {
+		if !exists {
+			return by, false, nil
+		}
+		if _, ok := toFloat(cur); !ok {
+			return nil, false, errors.New("cannot apply $inc to a value of non-numeric type")
+		}
+		return addNumbers(cur, by), false, nil
+	})
+}
+
+func pushPath(doc bson.D, path []string, v interface{}) (bson.D, error) {
+	items := bson.A{v}
+	if spec, ok := v.(bson.D); ok && isOperatorDoc(spec) {
+		each, ok := get(spec, "$each")
+		if !ok || len(spec) != 1 {
+			return nil, errors.Wrap(ErrNotSupported, "$push modifiers other than $each")
+		}
+		if items, ok = each.(bson.A); !ok {
+			return nil, errors.New("$each needs an array")
+		}
+	}
+	return updatePath(doc, path, func(cur interface{}, exists bool) (interface{}, bool, error) {
+		if !exists || cur == nil {
+			return append(bson.A{}, items...), false, nil
+		}
+		arr, ok := cur.(bson.A)
+		if !ok {
+			return nil, false, errors.New("the field to $push to must be an array")
+		}
+		return append(arr, items...), false, nil
+	})
+}
+
+// pullPath removes the items equal to v from the array at path, conditions are not supported.
+func pullPath(doc bson.D, path []string, v interface{}) (bson.D, error) {
+	if cond, ok := v.(bson.D); ok && isOperatorDoc(cond) {
+		return nil, errors.Wrap(ErrNotSupported, "$pull conditions")
+	}
+	return updatePath(doc, path, func(cur interface{}, exists bool) (interface{}, bool, error) {
+		if !exists {
+			return nil, true, nil
+		}
+		arr, ok := cur.(bson.A)
+		if !ok {
+			return nil, false, errors.New("cannot apply $pull to a non-array value")
+		}
+		kept := bson.A{}
+		for _, item := range arr {
+			if !equalValues(item, v) {
+				kept = append(kept, item)
+			}
+		}
+		return kept, false, nil
+	})
+}
+
+// addNumbers adds two numbers with the server's type promotion: int32 < int64 < double.
+func addNumbers(a, b interface{}) interface{} {
+	_, af := a.(float64)
+	_, bf := b.(float64)
+	_, af32 := a.(float32)
+	_, bf32 := b.(float32)
+	if af || bf || af32 || bf32 {
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		return fa + fb
+	}
+	ia, ib := toInt64(a), toInt64(b)
+	_, a32 := a.(int32)
+	_, b32 := b.(int32)
+	sum := ia + ib
+	if a32 && b32 && int64(int32(sum)) == sum {
+		return int32(sum)
+	}
+	return sum
+}
+
+func toInt64(v interface{}) int64 {
+	switch t := v.(type) {
+	case int32:
+		return int64(t)
+	case int64:
+		return t
+	case int:
+		return int64(t)
+	}
+	return 0
+}
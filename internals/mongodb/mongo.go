@@ -18,6 +18,7 @@ type Client interface {
 	Database(string, ...*options.DatabaseOptions) Database
 	Disconnect(context.Context) error
 	StartSession(...*options.SessionOptions) (mongo.Session, error)
+	// UseSession bounds the whole of fn by the transaction timeout.
 	UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error
 	Ping(context.Context) error
 }
@@ -44,6 +45,9 @@ type Collection interface {
 	Aggregate(context.Context, interface{}, ...*options.AggregateOptions) (*mongo.Cursor, error)
 	UpdateOne(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 	UpdateMany(context.Context, interface{}, interface{}, ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	Watch(context.Context, interface{}, ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+	CreateIndexes(context.Context, []mongo.IndexModel, ...*options.CreateIndexesOptions) ([]string, error)
+	ListIndexSpecifications(context.Context, ...*options.ListIndexesOptions) ([]*mongo.IndexSpecification, error)
 }
 
 type SingleResult interface {
@@ -51,14 +55,26 @@ type SingleResult interface {
 }
 
 type mongoClient struct {
-	cl *mongo.Client
+	cl       *mongo.Client
+	registry *bsoncodec.Registry
+	policies *policySet
+	exec     *executor
 }
 
 type mongoDatabase struct {
-	db *mongo.Database
+	db       *mongo.Database
+	registry *bsoncodec.Registry
+	policies *policySet
+	// policy is the policy of the client and the database, see CollectionPolicy.
+	policy *Policy
+	exec   *executor
 }
 type mongoCollection struct {
-	coll *mongo.Collection
+	coll     *mongo.Collection
+	registry *bsoncodec.Registry
+	// policy is the policy of the client, the database and the collection, see CollectionPolicy.
+	policy *Policy
+	exec   *executor
 }
 
 type mongoSingleResult struct {
@@ -71,6 +87,7 @@ type mongoCursor struct {
 
 type mongoSession struct {
 	mongo.Session
+	exec *executor
 }
 
 type nullawareDecoder struct {
@@ -94,73 +111,179 @@ func (d *nullawareDecoder) DecodeValue(dctx bsoncodec.DecodeContext, vr bsonrw.V
 	return nil
 }
 
-func NewClient(opts *MongoDBOpts) (Client, error) {
-	c, err := mongo.Connect(context.TODO(), getMongoDBClientOpts(opts.Config))
+// NewClient connects to the configured deployment. keyring encrypts the tagged fields of models, it may be nil.
+func NewClient(opts *MongoDBOpts, keyring *Keyring) (Client, error) {
+	ps, err := newPolicySet(opts.Config)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid read/write policy")
+	}
+	e := &executor{timeouts: NewTimeouts(opts.Config.TimeoutConfig), interceptors: opts.Interceptors}
+	reg := NewRegistry(keyring)
+
+	var c *mongo.Client
+	err = e.run(context.TODO(), Operation{Name: "connect", Class: AdminOperation}, func(ctx context.Context) error {
+		c, err = mongo.Connect(ctx, getMongoDBClientOpts(opts.Config, ps).SetRegistry(reg))
+		return err
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "connect failed")
 	}
-	return &mongoClient{cl: c}, err
+	return &mongoClient{cl: c, registry: reg, policies: ps, exec: e}, err
 
 }
 
-func NewTestClient(url string) (Client, error) {
-	c, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(url))
+// NewTestClient connects to url with the default policies and timeouts. keyring may be nil.
+func NewTestClient(url string, keyring *Keyring) (Client, error) {
+	e := &executor{timeouts: NewTimeouts(nil)}
+	reg := NewRegistry(keyring)
+	c, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(url).SetRegistry(reg))
 	if err != nil {
 		return nil, errors.Wrap(err, "connect failed")
 	}
-	return &mongoClient{cl: c}, err
+	return &mongoClient{cl: c, registry: reg, exec: e}, err
 }
 
 func (mc *mongoClient) Ping(ctx context.Context) error {
-	return mc.cl.Ping(ctx, readpref.Primary())
+	return mc.exec.run(ctx, Operation{Name: "ping", Class: AdminOperation}, func(ctx context.Context) error {
+		return mc.cl.Ping(ctx, readpref.Primary())
+	})
 }
 
+// Database returns a handle to dbName. The database policy from config is applied before opts,
+// so explicitly passed options still take precedence.
 func (mc *mongoClient) Database(dbName string, opts ...*options.DatabaseOptions) Database {
+	if p := mc.policies.database(dbName); !p.IsZero() {
+		opts = append([]*options.DatabaseOptions{p.databaseOptions()}, opts...)
+	}
 	db := mc.cl.Database(dbName, opts...)
-	return &mongoDatabase{db: db}
+	policy := mc.policies.clientPolicy().merge(databaseOptionsPolicy(opts...))
+	return &mongoDatabase{db: db, registry: mc.registry, policies: mc.policies, policy: policy, exec: mc.exec}
 }
 
+// UseSession runs fn with a new session. The whole of fn is bounded by the transaction timeout, not only the
+// transactions it runs: a session exists to group related operations (eg: a transaction and its retries), so they
+// share a single deadline like WithTransaction does. Each operation of fn is still bounded by the deadline of its
+// class when that is earlier. Use WithOperationTimeout on ctx for sessions which need longer.
 func (mc *mongoClient) UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error {
-	return mc.cl.UseSession(ctx, fn)
+	return mc.exec.run(ctx, Operation{Name: "useSession", Class: TransactionOperation}, func(ctx context.Context) error {
+		return mc.cl.UseSession(ctx, fn)
+	})
 }
 
 func (mc *mongoClient) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
 	session, err := mc.cl.StartSession(opts...)
-	return &mongoSession{session}, err
+	return &mongoSession{Session: session, exec: mc.exec}, err
 }
 
 func (mc *mongoClient) Disconnect(ctx context.Context) error {
-	return mc.cl.Disconnect(ctx)
+	return mc.exec.run(ctx, Operation{Name: "disconnect", Class: AdminOperation}, func(ctx context.Context) error {
+		return mc.cl.Disconnect(ctx)
+	})
+}
+
+// WithTransaction runs fn inside a transaction bounded by the transaction timeout, including the retries of
+// transient errors done by the driver.
+func (ms *mongoSession) WithTransaction(ctx context.Context, fn func(ctx mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	var res interface{}
+	err := ms.exec.run(ctx, Operation{Name: "withTransaction", Class: TransactionOperation}, func(ctx context.Context) error {
+		var err error
+		res, err = ms.Session.WithTransaction(ctx, fn, opts...)
+		return err
+	})
+	return res, err
 }
 
+// Collection returns a handle to colName. The collection policy from config is applied before opts,
+// so explicitly passed options still take precedence.
 func (md *mongoDatabase) Collection(colName string, opts ...*options.CollectionOptions) Collection {
+	if p := md.policies.collection(md.db.Name(), colName); !p.IsZero() {
+		opts = append([]*options.CollectionOptions{p.collectionOptions()}, opts...)
+	}
 	collection := md.db.Collection(colName, opts...)
-	return &mongoCollection{coll: collection}
+	policy := md.policy.merge(collectionOptionsPolicy(opts...))
+	return &mongoCollection{coll: collection, registry: md.registry, policy: policy, exec: md.exec}
 }
 
 func (md *mongoDatabase) Client() Client {
 	client := md.db.Client()
-	return &mongoClient{cl: client}
+	return &mongoClient{cl: client, registry: md.registry, policies: md.policies, exec: md.exec}
 }
 
+// collection returns the underlying collection with the per call policy from ctx applied, if any.
+// The call fails when the policy cannot be applied, rather than running with the policy of the collection.
+func (mc *mongoCollection) collection(ctx context.Context) (*mongo.Collection, error) {
+	p := PolicyFromContext(ctx)
+	if p.IsZero() {
+		return mc.coll, nil
+	}
+	coll, err := mc.coll.Clone(p.collectionOptions())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to apply the policy of the call")
+	}
+	return coll, nil
+}
+
+func (mc *mongoCollection) op(name string, class OperationClass) Operation {
+	return Operation{Name: name, Class: class, Database: mc.coll.Database().Name(), Collection: mc.coll.Name()}
+}
+
+// FindOne reads the document within the read deadline. The returned result is already materialized,
+// so decoding it does not depend on the deadline.
 func (mc *mongoCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-	return mc.coll.FindOne(ctx, filter)
+	var raw bson.Raw
+	err := mc.exec.run(ctx, mc.op("findOne", ReadOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		raw, err = coll.FindOne(ctx, filter, opts...).Raw()
+		return err
+	})
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, mc.registry)
+	}
+	return mongo.NewSingleResultFromDocument(raw, nil, mc.registry)
 }
 
 func (mc *mongoCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
-	return mc.coll.UpdateOne(ctx, filter, update, opts...)
+	var res *mongo.UpdateResult
+	err := mc.exec.run(ctx, mc.op("updateOne", WriteOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = coll.UpdateOne(ctx, filter, update, opts...)
+		return err
+	})
+	return res, err
 }
 
 func (mc *mongoCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (interface{}, error) {
-	id, err := mc.coll.InsertOne(ctx, document)
+	var res *mongo.InsertOneResult
+	err := mc.exec.run(ctx, mc.op("insertOne", WriteOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = coll.InsertOne(ctx, document, opts...)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return id.InsertedID, err
+	return res.InsertedID, err
 }
 
 func (mc *mongoCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) ([]interface{}, error) {
-	res, err := mc.coll.InsertMany(ctx, documents, opts...)
+	var res *mongo.InsertManyResult
+	err := mc.exec.run(ctx, mc.op("insertMany", WriteOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = coll.InsertMany(ctx, documents, opts...)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -168,24 +291,110 @@ func (mc *mongoCollection) InsertMany(ctx context.Context, documents []interface
 }
 
 func (mc *mongoCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (int64, error) {
-	count, err := mc.coll.DeleteOne(ctx, filter)
-	return count.DeletedCount, err
+	var res *mongo.DeleteResult
+	err := mc.exec.run(ctx, mc.op("deleteOne", WriteOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = coll.DeleteOne(ctx, filter, opts...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, err
 }
 
+// Find bounds the initial query by the read deadline, iterating the returned cursor is bound by the
+// context passed to the cursor methods.
 func (mc *mongoCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
-	return mc.coll.Find(ctx, filter, opts...)
+	var cur *mongo.Cursor
+	err := mc.exec.run(ctx, mc.op("find", ReadOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		cur, err = coll.Find(ctx, filter, opts...)
+		return err
+	})
+	return cur, err
 }
 
 func (mc *mongoCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-	return mc.coll.Aggregate(ctx, pipeline, opts...)
+	var cur *mongo.Cursor
+	err := mc.exec.run(ctx, mc.op("aggregate", ReadOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		cur, err = coll.Aggregate(ctx, pipeline, opts...)
+		return err
+	})
+	return cur, err
 }
 
 func (mc *mongoCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
-	return mc.coll.UpdateMany(ctx, filter, update, opts...)
+	var res *mongo.UpdateResult
+	err := mc.exec.run(ctx, mc.op("updateMany", WriteOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = coll.UpdateMany(ctx, filter, update, opts...)
+		return err
+	})
+	return res, err
 }
 
 func (mc *mongoCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	return mc.coll.CountDocuments(ctx, filter, opts...)
+	var count int64
+	err := mc.exec.run(ctx, mc.op("countDocuments", ReadOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		count, err = coll.CountDocuments(ctx, filter, opts...)
+		return err
+	})
+	return count, err
+}
+
+// Watch bounds opening the change stream by the read deadline, iterating the stream is bound by the
+// context passed to the stream methods.
+func (mc *mongoCollection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	var cs *mongo.ChangeStream
+	err := mc.exec.run(ctx, mc.op("watch", ReadOperation), func(ctx context.Context) error {
+		coll, err := mc.collection(ctx)
+		if err != nil {
+			return err
+		}
+		cs, err = coll.Watch(ctx, pipeline, opts...)
+		return err
+	})
+	return cs, err
+}
+
+// CreateIndexes is bounded by the admin deadline. Creating an index which exists with the same keys and options
+// is a no-op.
+func (mc *mongoCollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) ([]string, error) {
+	var names []string
+	err := mc.exec.run(ctx, mc.op("createIndexes", AdminOperation), func(ctx context.Context) error {
+		var err error
+		names, err = mc.coll.Indexes().CreateMany(ctx, models, opts...)
+		return err
+	})
+	return names, err
+}
+
+func (mc *mongoCollection) ListIndexSpecifications(ctx context.Context, opts ...*options.ListIndexesOptions) ([]*mongo.IndexSpecification, error) {
+	var specs []*mongo.IndexSpecification
+	err := mc.exec.run(ctx, mc.op("listIndexes", ReadOperation), func(ctx context.Context) error {
+		var err error
+		specs, err = mc.coll.Indexes().ListSpecifications(ctx, opts...)
+		return err
+	})
+	return specs, err
 }
 
 func (sr *mongoSingleResult) Decode(v interface{}) error {
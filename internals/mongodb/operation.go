@@ -0,0 +1,46 @@
+package mongodb
+
+import (
+	"context"
+)
+
+// Operation describes a single wrapped driver call.
+type Operation struct {
+	Name       string
+	Class      OperationClass
+	Database   string
+	Collection string
+}
+
+// OperationInterceptor wraps every driver call, e.g. to record metrics. It must call next and
+// return its error. The deadline of the operation class is already applied to ctx.
+type OperationInterceptor func(ctx context.Context, op Operation, next func(ctx context.Context) error) error
+
+// executor runs the wrapped driver calls. It applies the default deadline of the operation class,
+// runs the interceptors and converts timeout errors into *TimeoutError.
+type executor struct {
+	timeouts     *Timeouts
+	interceptors []OperationInterceptor
+}
+
+func (e *executor) run(ctx context.Context, op Operation, fn func(ctx context.Context) error) error {
+	var t *Timeouts
+	var interceptors []OperationInterceptor
+	if e != nil {
+		t, interceptors = e.timeouts, e.interceptors
+	}
+	ctx, cancel, d := t.withTimeout(ctx, op.Class)
+	defer cancel()
+
+	call := func(ctx context.Context) error {
+		return wrapTimeout(fn(ctx), op.Name, op.Class, d)
+	}
+	// the first interceptor is the outermost
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		next, intercept := call, interceptors[i]
+		call = func(ctx context.Context) error {
+			return intercept(ctx, op, next)
+		}
+	}
+	return call(ctx)
+}
@@ -0,0 +1,252 @@
+package mongodb
+
+import (
+	"context"
+	"go-app/internals/config"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Policy groups the read preference, read concern and write concern used for mongodb operations.
+// Nil fields inherit from the enclosing level: client -> database -> collection -> call (ctx).
+type Policy struct {
+	ReadPref     *readpref.ReadPref
+	ReadConcern  *readconcern.ReadConcern
+	WriteConcern *writeconcern.WriteConcern
+}
+
+// IsZero reports whether the policy overrides nothing.
+func (p *Policy) IsZero() bool {
+	return p == nil || (p.ReadPref == nil && p.ReadConcern == nil && p.WriteConcern == nil)
+}
+
+// merge returns a copy of p where the non nil fields of o take precedence.
+func (p *Policy) merge(o *Policy) *Policy {
+	m := Policy{}
+	if p != nil {
+		m = *p
+	}
+	if o == nil {
+		return &m
+	}
+	if o.ReadPref != nil {
+		m.ReadPref = o.ReadPref
+	}
+	if o.ReadConcern != nil {
+		m.ReadConcern = o.ReadConcern
+	}
+	if o.WriteConcern != nil {
+		m.WriteConcern = o.WriteConcern
+	}
+	return &m
+}
+
+func (p *Policy) databaseOptions() *options.DatabaseOptions {
+	opts := options.Database()
+	if p.ReadPref != nil {
+		opts.SetReadPreference(p.ReadPref)
+	}
+	if p.ReadConcern != nil {
+		opts.SetReadConcern(p.ReadConcern)
+	}
+	if p.WriteConcern != nil {
+		opts.SetWriteConcern(p.WriteConcern)
+	}
+	return opts
+}
+
+func (p *Policy) collectionOptions() *options.CollectionOptions {
+	opts := options.Collection()
+	if p.ReadPref != nil {
+		opts.SetReadPreference(p.ReadPref)
+	}
+	if p.ReadConcern != nil {
+		opts.SetReadConcern(p.ReadConcern)
+	}
+	if p.WriteConcern != nil {
+		opts.SetWriteConcern(p.WriteConcern)
+	}
+	return opts
+}
+
+// PolicyFromConfig parses a policy config. Empty values are left nil so they inherit from the parent level.
+func PolicyFromConfig(c *config.MongoDBPolicyConfig) (*Policy, error) {
+	p := Policy{}
+	if c == nil {
+		return &p, nil
+	}
+	if c.ReadPref != "" {
+		mode, err := readpref.ModeFromString(c.ReadPref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid read_pref %q", c.ReadPref)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid read_pref %q", c.ReadPref)
+		}
+		p.ReadPref = rp
+	}
+	if c.ReadConcern != "" {
+		switch c.ReadConcern {
+		case "local", "majority", "linearizable", "available", "snapshot":
+			p.ReadConcern = readconcern.New(readconcern.Level(c.ReadConcern))
+		default:
+			return nil, errors.Errorf("invalid read_concern %q", c.ReadConcern)
+		}
+	}
+	if c.WriteConcern != "" {
+		switch w := strings.TrimSpace(c.WriteConcern); {
+		case w == "majority":
+			p.WriteConcern = writeconcern.Majority()
+		case isNumber(w):
+			n, _ := strconv.Atoi(w)
+			p.WriteConcern = &writeconcern.WriteConcern{W: n}
+		default:
+			p.WriteConcern = writeconcern.Custom(w)
+		}
+	}
+	return &p, nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// policySet is the parsed form of the policies declared in config.MongoDBConfig.
+type policySet struct {
+	client    *Policy
+	databases map[string]*databasePolicy
+}
+
+type databasePolicy struct {
+	policy      *Policy
+	collections map[string]*Policy
+}
+
+func newPolicySet(c *config.MongoDBConfig) (*policySet, error) {
+	ps := policySet{client: &Policy{}, databases: map[string]*databasePolicy{}}
+	if c == nil {
+		return &ps, nil
+	}
+
+	p, err := PolicyFromConfig(&c.MongoDBPolicyConfig)
+	if err != nil {
+		return nil, err
+	}
+	ps.client = p
+
+	for dbName, dbConfig := range c.Databases {
+		if dbConfig == nil {
+			continue
+		}
+		dp, err := PolicyFromConfig(&dbConfig.MongoDBPolicyConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "database %s", dbName)
+		}
+		d := databasePolicy{policy: dp, collections: map[string]*Policy{}}
+		for collName, collConfig := range dbConfig.Collections {
+			cp, err := PolicyFromConfig(collConfig)
+			if err != nil {
+				return nil, errors.Wrapf(err, "collection %s.%s", dbName, collName)
+			}
+			d.collections[collName] = cp
+		}
+		ps.databases[dbName] = &d
+	}
+	return &ps, nil
+}
+
+func (ps *policySet) clientPolicy() *Policy {
+	if ps == nil {
+		return nil
+	}
+	return ps.client
+}
+
+func (ps *policySet) database(name string) *Policy {
+	if ps == nil {
+		return nil
+	}
+	if d, ok := ps.databases[name]; ok {
+		return d.policy
+	}
+	return nil
+}
+
+func (ps *policySet) collection(dbName, collName string) *Policy {
+	if ps == nil {
+		return nil
+	}
+	if d, ok := ps.databases[dbName]; ok {
+		return d.collections[collName]
+	}
+	return nil
+}
+
+type policyCtxKey struct{}
+
+// WithPolicy returns a copy of ctx carrying a per call policy override.
+// Overrides stack, so the innermost non nil field wins.
+//
+// Eg:
+//
+//	// balance reads must observe majority committed data
+//	ctx = mongodb.WithReadConcern(ctx, readconcern.Majority())
+//	// reports can be served by secondaries
+//	ctx = mongodb.WithReadPref(ctx, readpref.SecondaryPreferred())
+//
+// Note: inside a multi document transaction the transaction's read and write concern are used.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	return context.WithValue(ctx, policyCtxKey{}, PolicyFromContext(ctx).merge(p))
+}
+
+func WithReadPref(ctx context.Context, rp *readpref.ReadPref) context.Context {
+	return WithPolicy(ctx, &Policy{ReadPref: rp})
+}
+
+func WithReadConcern(ctx context.Context, rc *readconcern.ReadConcern) context.Context {
+	return WithPolicy(ctx, &Policy{ReadConcern: rc})
+}
+
+func WithWriteConcern(ctx context.Context, wc *writeconcern.WriteConcern) context.Context {
+	return WithPolicy(ctx, &Policy{WriteConcern: wc})
+}
+
+// PolicyFromContext returns the per call policy override stored in ctx, nil if there is none.
+func PolicyFromContext(ctx context.Context) *Policy {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(policyCtxKey{}).(*Policy)
+	return p
+}
+
+// CollectionPolicy returns the policy coll runs the calls made with ctx with: the policies of the client, database,
+// collection and call, each level overriding the one above. Nil fields are left to the connection string and server
+// defaults. It fails for the collections not backed by the driver, eg: the in-memory ones.
+func CollectionPolicy(ctx context.Context, coll Collection) (*Policy, error) {
+	mc, ok := coll.(*mongoCollection)
+	if !ok {
+		return nil, errors.Wrapf(ErrNotSupported, "policy of %T", coll)
+	}
+	return mc.policy.merge(PolicyFromContext(ctx)), nil
+}
+
+// databaseOptionsPolicy returns the policy set by explicitly passed database options.
+func databaseOptionsPolicy(opts ...*options.DatabaseOptions) *Policy {
+	o := options.MergeDatabaseOptions(opts...)
+	return &Policy{ReadPref: o.ReadPreference, ReadConcern: o.ReadConcern, WriteConcern: o.WriteConcern}
+}
+
+// collectionOptionsPolicy returns the policy set by explicitly passed collection options.
+func collectionOptionsPolicy(opts ...*options.CollectionOptions) *Policy {
+	o := options.MergeCollectionOptions(opts...)
+	return &Policy{ReadPref: o.ReadPreference, ReadConcern: o.ReadConcern, WriteConcern: o.WriteConcern}
+}
@@ -0,0 +1,151 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"go-app/internals/config"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OperationClass groups mongodb operations that share a default deadline.
+type OperationClass string
+
+const (
+	ReadOperation        OperationClass = "read"
+	WriteOperation       OperationClass = "write"
+	TransactionOperation OperationClass = "transaction"
+	AdminOperation       OperationClass = "admin"
+)
+
+const (
+	DefaultReadTimeout        = 10 * time.Second
+	DefaultWriteTimeout       = 10 * time.Second
+	DefaultTransactionTimeout = 30 * time.Second
+	DefaultAdminTimeout       = 10 * time.Second
+)
+
+// ErrTimeout is matched (errors.Is) by every TimeoutError.
+var ErrTimeout = errors.New("mongodb operation timed out")
+
+// TimeoutError is returned when a mongodb operation exceeds its deadline, either the default deadline
+// of its class or a tighter one set by the caller.
+type TimeoutError struct {
+	Op      string
+	Class   OperationClass
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("mongodb %s operation %s timed out after %s: %v", e.Class, e.Op, e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("mongodb %s operation %s timed out: %v", e.Class, e.Op, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// IsTimeout reports whether err was caused by a mongodb operation running out of time.
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrTimeout) || mongo.IsTimeout(err)
+}
+
+// Timeouts holds the default deadline of each operation class.
+type Timeouts struct {
+	Read        time.Duration
+	Write       time.Duration
+	Transaction time.Duration
+	Admin       time.Duration
+}
+
+// NewTimeouts builds the timeouts from config, falling back to the defaults for unset values.
+func NewTimeouts(c *config.MongoDBTimeoutConfig) *Timeouts {
+	t := Timeouts{
+		Read:        DefaultReadTimeout,
+		Write:       DefaultWriteTimeout,
+		Transaction: DefaultTransactionTimeout,
+		Admin:       DefaultAdminTimeout,
+	}
+	if c == nil {
+		return &t
+	}
+	if c.Read != 0 {
+		t.Read = c.Read
+	}
+	if c.Write != 0 {
+		t.Write = c.Write
+	}
+	if c.Transaction != 0 {
+		t.Transaction = c.Transaction
+	}
+	if c.Admin != 0 {
+		t.Admin = c.Admin
+	}
+	return &t
+}
+
+func (t *Timeouts) forClass(class OperationClass) time.Duration {
+	if t == nil {
+		return 0
+	}
+	switch class {
+	case ReadOperation:
+		return t.Read
+	case WriteOperation:
+		return t.Write
+	case TransactionOperation:
+		return t.Transaction
+	case AdminOperation:
+		return t.Admin
+	}
+	return 0
+}
+
+type timeoutCtxKey struct{}
+
+// WithOperationTimeout overrides the default deadline for the mongodb operations executed with ctx.
+// Unlike a context deadline it can be longer than the default, eg: for a slow report.
+// Each operation gets the full duration, a deadline already present on ctx still wins if it is earlier.
+func WithOperationTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutCtxKey{}, d)
+}
+
+// withTimeout bounds ctx by the deadline of class, unless ctx already expires earlier.
+// Returns the applied timeout, zero if none was applied.
+func (t *Timeouts) withTimeout(ctx context.Context, class OperationClass) (context.Context, context.CancelFunc, time.Duration) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := t.forClass(class)
+	if override, ok := ctx.Value(timeoutCtxKey{}).(time.Duration); ok {
+		d = override
+	}
+	if d <= 0 {
+		return ctx, func() {}, 0
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return ctx, func() {}, 0
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return ctx, cancel, d
+}
+
+// wrapTimeout converts driver and context timeouts into a *TimeoutError, other errors are returned as is.
+func wrapTimeout(err error, op string, class OperationClass, d time.Duration) error {
+	if err == nil || errors.Is(err, ErrTimeout) {
+		return err
+	}
+	if mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Op: op, Class: class, Timeout: d, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Generator builds an OpenAPI document, the schemas are derived from go types.
+type Generator interface {
+	// Schema returns the schema of the type of v. Named structs are added to the components and referenced.
+	Schema(v interface{}) *Schema
+	// AddOperation documents the operation served by method on path, path uses the OpenAPI template syntax, e.g. /accounts/{id}.
+	AddOperation(method, path string, op *Operation)
+	Document() *Document
+}
+
+type GeneratorImpl struct {
+	mu    sync.Mutex
+	doc   *Document
+	types map[string]reflect.Type
+}
+
+type GeneratorOpts struct {
+	Info Info
+}
+
+func NewGenerator(opts *GeneratorOpts) Generator {
+	return &GeneratorImpl{
+		doc: &Document{
+			OpenAPI:    Version,
+			Info:       opts.Info,
+			Paths:      map[string]*PathItem{},
+			Components: Components{Schemas: map[string]*Schema{}},
+		},
+		types: map[string]reflect.Type{},
+	}
+}
+
+func (g *GeneratorImpl) Schema(v interface{}) *Schema {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *GeneratorImpl) AddOperation(method, path string, op *Operation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	item, ok := g.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		g.doc.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+func (g *GeneratorImpl) Document() *Document {
+	return g.doc
+}
+
+func (g *GeneratorImpl) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if s, ok := knownSchemas[t]; ok {
+		cp := *s
+		return &cp
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := g.componentName(t)
+		if _, ok := g.doc.Components.Schemas[name]; !ok {
+			// registered before its fields so recursive types end up referencing it
+			g.doc.Components.Schemas[name] = &Schema{}
+			*g.doc.Components.Schemas[name] = *g.structSchema(t)
+		}
+		return Ref(name)
+	default:
+		// interfaces and anything without a json representation accept any value
+		return &Schema{}
+	}
+}
+
+// componentName names the component of t after the type, types with the same name in different packages are prefixed with their package.
+func (g *GeneratorImpl) componentName(t reflect.Type) string {
+	name := t.Name()
+	if other, ok := g.types[name]; ok && other != t {
+		name = path.Base(t.PkgPath()) + "_" + name
+	}
+	g.types[name] = t
+	return name
+}
+
+func (g *GeneratorImpl) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		// the fields of embedded structs are promoted to the parent object
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			es := g.structSchema(ft)
+			for k, v := range es.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, es.Required...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schemaOf(f.Type)
+		if applyValidation(fs, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// knownSchemas are the types with a custom json representation.
+var knownSchemas = map[reflect.Type]*Schema{
+	reflect.TypeOf(time.Time{}):          {Type: "string", Format: "date-time"},
+	reflect.TypeOf(primitive.ObjectID{}): {Type: "string", Pattern: "^[0-9a-fA-F]{24}$"},
+}
+
+// applyValidation adds the constraints of the validate tag of a field to its schema and reports whether the field is required.
+// Rules following dive apply to the items of the field.
+func applyValidation(s *Schema, tag string) bool {
+	var required bool
+	target := s
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			required = target == s
+		case "dive":
+			if target.Items == nil {
+				return required
+			}
+			target = target.Items
+		case "min", "gte":
+			setMin(target, value, false)
+		case "gt":
+			setMin(target, value, true)
+		case "max", "lte":
+			setMax(target, value, false)
+		case "lt":
+			setMax(target, value, true)
+		case "len":
+			setMin(target, value, false)
+			setMax(target, value, false)
+		case "oneof":
+			for _, v := range strings.Fields(value) {
+				target.Enum = append(target.Enum, typedValue(target, v))
+			}
+		case "ne":
+			target.Not = &Schema{Enum: []interface{}{typedValue(target, value)}}
+		case "email":
+			target.Format = "email"
+		case "url", "uri":
+			target.Format = "uri"
+		case "uuid", "uuid4":
+			target.Format = "uuid"
+		}
+	}
+	return required
+}
+
+// setMin applies a lower bound, it bounds the length of strings and arrays and the value of numbers.
+func setMin(s *Schema, value string, exclusive bool) {
+	switch s.Type {
+	case "string", "array":
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return
+		}
+		if exclusive {
+			n++
+		}
+		if s.Type == "string" {
+			s.MinLength = &n
+		} else {
+			s.MinItems = &n
+		}
+	case "integer", "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return
+		}
+		s.Minimum = &f
+		s.ExclusiveMinimum = exclusive
+	}
+}
+
+// setMax applies an upper bound, see setMin.
+func setMax(s *Schema, value string, exclusive bool) {
+	switch s.Type {
+	case "string", "array":
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || (exclusive && n == 0) {
+			return
+		}
+		if exclusive {
+			n--
+		}
+		if s.Type == "string" {
+			s.MaxLength = &n
+		} else {
+			s.MaxItems = &n
+		}
+	case "integer", "number":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return
+		}
+		s.Maximum = &f
+		s.ExclusiveMaximum = exclusive
+	}
+}
+
+// typedValue converts a value of a validate rule to the type of the schema.
+func typedValue(s *Schema, value string) interface{} {
+	switch s.Type {
+	case "integer":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (t *TracingImpl) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := t.Propagator.Extract(c.UserContext(), propagation.HeaderCarrier(c.GetReqHeaders()))
+		// fiber reuses the memory of these strings across requests, the span keeps copies
+		method := utils.CopyString(c.Method())
+		ctx, span := t.tracer.Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(utils.CopyString(c.Path())),
+				semconv.URLScheme(utils.CopyString(c.Protocol())),
+				semconv.UserAgentOriginal(utils.CopyString(c.Get(fiber.HeaderUserAgent))),
+				semconv.ClientAddress(c.IP()),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// the error handler only runs after the middlewares, so the status of a returned error is resolved here
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+			span.RecordError(err)
+		}
+		// requests matching no route end on a catch-all middleware route and keep the method as span name
+		route := utils.CopyString(c.Route().Path)
+		if !(status == fiber.StatusNotFound && route == "/" && c.Path() != "/") {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
+
+func (t *TracingImpl) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, tracing: t}
+}
+
+type transport struct {
+	base    http.RoundTripper
+	tracing *TracingImpl
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// credentials in the url must not end up in the span
+	u := *req.URL
+	u.User = nil
+	ctx, span := tr.tracing.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(u.String()),
+			semconv.ServerAddress(u.Hostname()),
+		),
+	)
+	defer span.End()
+
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(ctx)
+	tr.tracing.Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := tr.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
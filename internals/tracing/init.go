@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracerName is the instrumentation scope of the spans recorded by the app.
+const TracerName = "go-app"
+
+type Tracing interface {
+	// TracerProvider is used by the components to record their own spans.
+	TracerProvider() trace.TracerProvider
+	// Middleware starts a server span for every request, continuing the W3C trace context of the caller.
+	// The context of the span is set as the user context of the request.
+	Middleware() fiber.Handler
+	// MongoDBInterceptor records a child span for every mongodb operation.
+	MongoDBInterceptor() mongodb.OperationInterceptor
+	// Transport records a client span for every outbound request and injects the trace context into its headers.
+	Transport(base http.RoundTripper) http.RoundTripper
+	// Shutdown flushes the pending spans and closes the exporter.
+	Shutdown(ctx context.Context) error
+}
+
+type TracingImpl struct {
+	Config     *config.TracingConfig
+	Provider   trace.TracerProvider
+	Propagator propagation.TextMapPropagator
+
+	tracer   trace.Tracer
+	shutdown []func(ctx context.Context) error
+}
+
+type TracingOpts struct {
+	Config *config.TracingConfig
+	// Exporter replaces the configured exporter and receives every span as soon as it ends, used by tests.
+	Exporter sdktrace.SpanExporter
+}
+
+// NewTracing creates the tracer provider. When tracing is disabled the spans are not recorded,
+// but the components can use the returned Tracing all the same.
+func NewTracing(opts *TracingOpts) (Tracing, error) {
+	c := opts.Config
+	if c == nil {
+		c = &config.TracingConfig{}
+	}
+	t := TracingImpl{
+		Config:     c,
+		Propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+
+	if !c.Enabled && opts.Exporter == nil {
+		t.Provider = noop.NewTracerProvider()
+		t.tracer = t.Provider.Tracer(TracerName)
+		return &t, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName(c))))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing resource")
+	}
+	popts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler(c.SampleRatio))),
+	}
+	if opts.Exporter != nil {
+		popts = append(popts, sdktrace.WithSyncer(opts.Exporter))
+	} else {
+		exporter, err := t.newExporter()
+		if err != nil {
+			return nil, err
+		}
+		popts = append(popts, sdktrace.WithBatcher(exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(popts...)
+	// the provider goes first so the pending spans are flushed before the exporter's file is closed
+	t.shutdown = append([]func(ctx context.Context) error{tp.Shutdown}, t.shutdown...)
+	t.Provider = tp
+	t.tracer = tp.Tracer(TracerName)
+	return &t, nil
+}
+
+func (t *TracingImpl) newExporter() (sdktrace.SpanExporter, error) {
+	switch t.Config.Exporter {
+	case config.TracingExporterOTLP:
+		var opts []otlptracehttp.Option
+		if t.Config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(t.Config.OTLPEndpoint))
+		}
+		if t.Config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		// the client connects lazily, an unreachable collector does not fail the start
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		return exporter, errors.Wrap(err, "failed to create otlp exporter")
+	case config.TracingExporterStdout, "":
+		return newWriterExporter(os.Stdout)
+	case config.TracingExporterFile:
+		if t.Config.FilePath == "" {
+			return nil, errors.New("tracing file_path is required with the file exporter")
+		}
+		f, err := os.OpenFile(t.Config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open tracing file %s", t.Config.FilePath)
+		}
+		t.shutdown = append(t.shutdown, func(ctx context.Context) error {
+			return f.Close()
+		})
+		return newWriterExporter(f)
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q", t.Config.Exporter)
+	}
+}
+
+// newWriterExporter writes the spans to w, one JSON document per span.
+func newWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	return exporter, errors.Wrap(err, "failed to create stdout exporter")
+}
+
+func serviceName(c *config.TracingConfig) string {
+	if c.ServiceName == "" {
+		return TracerName
+	}
+	return c.ServiceName
+}
+
+func sampler(ratio float64) sdktrace.Sampler {
+	if ratio <= 0 || ratio >= 1 {
+		return sdktrace.AlwaysSample()
+	}
+	return sdktrace.TraceIDRatioBased(ratio)
+}
+
+func (t *TracingImpl) TracerProvider() trace.TracerProvider {
+	return t.Provider
+}
+
+func (t *TracingImpl) Shutdown(ctx context.Context) error {
+	for _, fn := range t.shutdown {
+		if err := fn(ctx); err != nil {
+			return errors.Wrap(err, "failed to shutdown tracing")
+		}
+	}
+	return nil
+}
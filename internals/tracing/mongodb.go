@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MongoDBInterceptor names the spans after the operation and the collection, e.g. "findOne bank.account".
+// The operations run inside a transaction are children of its span.
+func (t *TracingImpl) MongoDBInterceptor() mongodb.OperationInterceptor {
+	return func(ctx context.Context, op mongodb.Operation, next func(ctx context.Context) error) error {
+		name := op.Name
+		attrs := []attribute.KeyValue{semconv.DBSystemMongoDB, semconv.DBOperation(op.Name)}
+		if op.Database != "" {
+			name += " " + op.Database
+			attrs = append(attrs, semconv.DBName(op.Database))
+		}
+		if op.Collection != "" {
+			name += "." + op.Collection
+			attrs = append(attrs, semconv.DBMongoDBCollection(op.Collection))
+		}
+		attrs = append(attrs, attribute.String("db.mongodb.operation_class", string(op.Class)))
+
+		ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		defer span.End()
+
+		err := next(ctx)
+		// a missing document is an expected outcome, not a failed operation
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -2,18 +2,35 @@ package ws
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"go-app/internals/config"
+	"go-app/internals/health"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
 
 	"github.com/rs/zerolog"
 )
 
+const (
+	DefaultShutdownTimeout = 30 * time.Second
+	DefaultReadinessPath   = "/readyz"
+)
+
 type Server interface {
-	Start()
+	// Start binds the address and serves in the background, it returns once the server accepts traffic or with the
+	// error which prevented it from binding the address.
+	Start() error
+	// Close stops the server gracefully and returns once in-flight requests are drained or force closed.
 	Close() error
+	// Ready reports whether the server accepts traffic. It turns false as soon as Close is called.
+	Ready() bool
+	HealthChecks() []*health.Check
 }
 
 type FiberServer struct {
@@ -22,6 +39,19 @@ type FiberServer struct {
 	Worker *sync.WaitGroup
 	Logger *zerolog.Logger
 	Config *config.WebServerConfig
+
+	// Health drives the readiness endpoint when set, it only reflects the server otherwise.
+	Health health.Health
+
+	ready   atomic.Bool
+	closing atomic.Bool
+
+	// mu guards the fields set by Start, so Close never races a concurrent Start
+	mu       sync.Mutex
+	listener *trackingListener
+	// listening is set once the address is bound
+	listening bool
+	certs     *certReloader
 }
 
 type FiberServerOpts struct {
@@ -30,6 +60,7 @@ type FiberServerOpts struct {
 	Worker   *sync.WaitGroup
 	Config   *config.WebServerConfig
 	Logger   *zerolog.Logger
+	Health   health.Health
 }
 
 func NewWebServer(opts *FiberServerOpts) Server {
@@ -39,20 +70,158 @@ func NewWebServer(opts *FiberServerOpts) Server {
 		Config: opts.Config,
 		Logger: opts.Logger,
 		Worker: opts.Worker,
+		Health: opts.Health,
+	}
+	if s.Worker == nil {
+		s.Worker = &sync.WaitGroup{}
 	}
+	s.App.Get(s.readinessPath(), s.readinessHandler)
 	return &s
 }
 
-func (fs *FiberServer) Start() {
-	err := fs.Listen(fmt.Sprintf(`%s:%d`, fs.Config.Host, fs.Config.Port))
+func (fs *FiberServer) readinessPath() string {
+	if fs.Config.ReadinessPath != "" {
+		return fs.Config.ReadinessPath
+	}
+	return DefaultReadinessPath
+}
+
+// readinessHandler agrees with the aggregated readiness of the admin router, without exposing the report publicly.
+func (fs *FiberServer) readinessHandler(c *fiber.Ctx) error {
+	if !fs.Ready() || (fs.Health != nil && !fs.Health.Ready(c.UserContext()).OK()) {
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (fs *FiberServer) Ready() bool {
+	return fs.ready.Load()
+}
+
+// HealthChecks fails while the server is not accepting traffic.
+func (fs *FiberServer) HealthChecks() []*health.Check {
+	return []*health.Check{{
+		Name: "webserver",
+		Func: func(ctx context.Context) error {
+			if !fs.Ready() {
+				return errors.New("webserver is not accepting traffic")
+			}
+			return nil
+		},
+		Critical: true,
+	}}
+}
+
+// Start binds the address and serves until Close is called. The worker is added before the serve loop is
+// started, so waiting on it always covers the server. Starting a closed or started server is a no-op.
+func (fs *FiberServer) Start() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closing.Load() || fs.listening {
+		return nil
+	}
+
+	serve, err := fs.listen()
+	if err != nil {
+		return errors.Wrap(err, "failed to start server")
+	}
+	fs.listening = true
+	fs.ready.Store(true)
+
+	fs.Worker.Add(1)
+	go func() {
+		defer fs.Worker.Done()
+		err := serve()
+		fs.ready.Store(false)
+		if err != nil && !fs.closing.Load() {
+			fs.Logger.Err(err).Msg("server stopped unexpectedly")
+			return
+		}
+		fs.Logger.Debug().Msg("server stopped listening")
+	}()
+	return nil
+}
+
+// listen binds the configured address, wrapping it with TLS when enabled, and returns the blocking serve loop.
+// The tracking listener sits below TLS so force closing also reaches connections stuck in a handshake.
+func (fs *FiberServer) listen() (func() error, error) {
+	addr := fmt.Sprintf(`%s:%d`, fs.Config.Host, fs.Config.Port)
+	tc := fs.Config.TLSConfig
+	tlsEnabled := tc != nil && tc.Enabled
+
+	// Fiber only supports prefork when it binds the address itself, so connections are not tracked and cannot be force closed
+	if fs.App.Config().Prefork {
+		if tlsEnabled {
+			return nil, errors.New("prefork is not supported together with tls")
+		}
+		return func() error { return fs.App.Listen(addr) }, nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		fs.Logger.Fatal().Err(err).Msg("failed to start server")
+		return nil, errors.Wrap(err, "failed to listen")
 	}
+	fs.listener = newTrackingListener(ln)
 
+	if !tlsEnabled {
+		return func() error { return fs.App.Listener(fs.listener) }, nil
+	}
+	certs, err := newCertReloader(tc, fs.Logger)
+	if err == nil {
+		err = certs.Watch()
+	}
+	if err != nil {
+		ln.Close()
+		return nil, errors.Wrap(err, "failed to setup tls")
+	}
+	fs.certs = certs
+	tlsListener := tls.NewListener(fs.listener, certs.TLSConfig())
+	return func() error { return fs.App.Listener(tlsListener) }, nil
 }
 
+// Close flips readiness to failing, waits DrainDelay so load balancers can stop routing traffic, stops
+// accepting connections and waits for in-flight requests to complete. Connections still open after
+// ShutdownTimeout are force closed.
 func (fs *FiberServer) Close() error {
-	err := fs.App.Shutdown()
+	if !fs.closing.CompareAndSwap(false, true) {
+		return nil
+	}
+	// waits for a concurrent Start to bind the listener, a later Start sees closing and does not bind
+	fs.mu.Lock()
+	fs.ready.Store(false)
+	listening, listener, certs := fs.listening, fs.listener, fs.certs
+	fs.mu.Unlock()
+	if !listening {
+		fs.Logger.Debug().Msg("webserver closed")
+		return nil
+	}
+
+	if d := fs.Config.DrainDelay; d > 0 {
+		fs.Logger.Debug().Dur("delay", d).Msg("readiness failing, waiting before closing listener")
+		time.Sleep(d)
+	}
+
+	timeout := fs.Config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if certs != nil {
+		defer certs.Close()
+	}
+
+	err := fs.App.ShutdownWithContext(ctx)
+	if listener != nil {
+		// the serve loop may not have picked the listener up yet when Close closely follows Start
+		listener.Close()
+	}
+	if errors.Is(err, context.DeadlineExceeded) && listener != nil {
+		n := listener.closeConns()
+		fs.Logger.Warn().Dur("timeout", timeout).Int("connections", n).Msg("in-flight requests did not drain in time, connections force closed")
+		err = nil
+	}
 	if err != nil {
 		fs.Logger.Err(err).Msg("error while closing webserver")
 	} else {
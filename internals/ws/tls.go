@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"go-app/internals/config"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves the certificate and client CA pool currently on disk.
+// Files are watched and reloaded on change, a failed reload keeps the previous material.
+type certReloader struct {
+	Config *config.TLSConfig
+	Logger *zerolog.Logger
+
+	base    *tls.Config
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	caPool  *x509.CertPool
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+func newCertReloader(c *config.TLSConfig, logger *zerolog.Logger) (*certReloader, error) {
+	base, err := baseTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	r := certReloader{Config: c, Logger: logger, base: base, done: make(chan struct{})}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func baseTLSConfig(c *config.TLSConfig) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return nil, errors.Errorf("unsupported tls min version %q", c.MinVersion)
+	}
+	tc := &tls.Config{MinVersion: minVersion}
+
+	if len(c.CipherSuites) > 0 {
+		ids := map[string]uint16{}
+		for _, cs := range tls.CipherSuites() {
+			ids[cs.Name] = cs.ID
+		}
+		for _, name := range c.CipherSuites {
+			id, ok := ids[name]
+			if !ok {
+				return nil, errors.Errorf("unsupported or insecure tls cipher suite %q", name)
+			}
+			tc.CipherSuites = append(tc.CipherSuites, id)
+		}
+	}
+
+	if c.ClientCAFile != "" {
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.ClientCertOptional {
+			tc.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tc, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.Config.CertFile, r.Config.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load tls certificate")
+	}
+	var pool *x509.CertPool
+	if r.Config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.Config.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read client ca file")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificate found in client ca file %s", r.Config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.caPool = &cert, pool
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig returns a config resolving the certificate and client CAs per handshake, so reloads apply to new connections.
+func (r *certReloader) TLSConfig() *tls.Config {
+	tc := r.base.Clone()
+	tc.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		c := r.base.Clone()
+		c.Certificates = []tls.Certificate{*r.cert}
+		c.ClientCAs = r.caPool
+		return c, nil
+	}
+	return tc
+}
+
+// Watch reloads the files when they change until Close is called.
+// Directories are watched rather than files, so atomic replacements (e.g. mounted kubernetes secrets) are picked up.
+func (r *certReloader) Watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "failed to create tls file watcher")
+	}
+	files := map[string]bool{}
+	for _, f := range []string{r.Config.CertFile, r.Config.KeyFile, r.Config.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		f = filepath.Clean(f)
+		files[f] = true
+		if err := w.Add(filepath.Dir(f)); err != nil {
+			w.Close()
+			return errors.Wrapf(err, "failed to watch %s", f)
+		}
+	}
+	r.watcher = w
+
+	go func() {
+		for {
+			select {
+			case <-r.done:
+				return
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				// kubernetes swaps the ..data symlink, so any change in the directory may update the files
+				if !files[filepath.Clean(e.Name)] && filepath.Base(e.Name) != "..data" {
+					continue
+				}
+				if e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				if err := r.reload(); err != nil {
+					r.Logger.Warn().Err(err).Msg("tls reload failed, keeping current certificates")
+					continue
+				}
+				r.Logger.Info().Str("file", e.Name).Msg("tls certificates reloaded")
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				r.Logger.Err(err).Msg("tls file watcher error")
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *certReloader) Close() {
+	close(r.done)
+	if r.watcher != nil {
+		r.watcher.Close()
+	}
+}
@@ -2,13 +2,28 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"go-app/internals"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
 func main() {
+	// go-app apikey ... manages the api keys and go-app encryption ... the encrypted fields instead of serving the app
+	commands := map[string]func(context.Context, []string, io.Writer) error{
+		"apikey":     internals.RunAPIKeyCommand,
+		"encryption": internals.RunEncryptionCommand,
+	}
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](context.Background(), os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	/*
 		Creating a system level context for proper shutdown behavior when closing the app.
 		Every component that requires a graceful shutdown should implement this ctx.
@@ -6,7 +6,9 @@ package mock
 
 import (
 	context "context"
+	mongodb "go-app/internals/mongodb"
 	schema "go-app/schema"
+	service "go-app/service"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -36,6 +38,20 @@ func (m *MockDemoService) EXPECT() *MockDemoServiceMockRecorder {
 	return m.recorder
 }
 
+// AccountCacheStats mocks base method.
+func (m *MockDemoService) AccountCacheStats() service.CacheStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccountCacheStats")
+	ret0, _ := ret[0].(service.CacheStats)
+	return ret0
+}
+
+// AccountCacheStats indicates an expected call of AccountCacheStats.
+func (mr *MockDemoServiceMockRecorder) AccountCacheStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccountCacheStats", reflect.TypeOf((*MockDemoService)(nil).AccountCacheStats))
+}
+
 // Account_Create mocks base method.
 func (m *MockDemoService) Account_Create(arg0 context.Context, arg1 *schema.Account_CreateOpts) (*schema.Account_CreateResp, error) {
 	m.ctrl.T.Helper()
@@ -80,6 +96,21 @@ func (mr *MockDemoServiceMockRecorder) DemoFunc(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DemoFunc", reflect.TypeOf((*MockDemoService)(nil).DemoFunc), arg0)
 }
 
+// GetAccount mocks base method.
+func (m *MockDemoService) GetAccount(arg0 context.Context, arg1 *schema.Account_GetOpts) (*schema.Account_GetResp, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccount", arg0, arg1)
+	ret0, _ := ret[0].(*schema.Account_GetResp)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccount indicates an expected call of GetAccount.
+func (mr *MockDemoServiceMockRecorder) GetAccount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccount", reflect.TypeOf((*MockDemoService)(nil).GetAccount), arg0, arg1)
+}
+
 // GetAccountDetailWithTransactions mocks base method.
 func (m *MockDemoService) GetAccountDetailWithTransactions(arg0 context.Context, arg1 *schema.AccountTransaction_GetOpts) (*schema.Account_Get, error) {
 	m.ctrl.T.Helper()
@@ -110,6 +141,20 @@ func (mr *MockDemoServiceMockRecorder) InsertOne(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertOne", reflect.TypeOf((*MockDemoService)(nil).InsertOne), arg0, arg1)
 }
 
+// OnTransactionCreated mocks base method.
+func (m *MockDemoService) OnTransactionCreated(arg0 context.Context, arg1 *mongodb.ChangeEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OnTransactionCreated", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// OnTransactionCreated indicates an expected call of OnTransactionCreated.
+func (mr *MockDemoServiceMockRecorder) OnTransactionCreated(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnTransactionCreated", reflect.TypeOf((*MockDemoService)(nil).OnTransactionCreated), arg0, arg1)
+}
+
 // SentryDemoFunc mocks base method.
 func (m *MockDemoService) SentryDemoFunc(arg0 context.Context) string {
 	m.ctrl.T.Helper()
@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 
@@ -35,16 +36,16 @@ func (m *MockHTTP) EXPECT() *MockHTTPMockRecorder {
 }
 
 // Get mocks base method.
-func (m *MockHTTP) Get(arg0 string) (*http.Response, error) {
+func (m *MockHTTP) Get(arg0 context.Context, arg1 string) (*http.Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Get", arg0)
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
 	ret0, _ := ret[0].(*http.Response)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Get indicates an expected call of Get.
-func (mr *MockHTTPMockRecorder) Get(arg0 interface{}) *gomock.Call {
+func (mr *MockHTTPMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockHTTP)(nil).Get), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockHTTP)(nil).Get), arg0, arg1)
 }
@@ -5,6 +5,8 @@
 package mock
 
 import (
+	context "context"
+	health "go-app/internals/health"
 	mongodb "go-app/internals/mongodb"
 	service "go-app/service"
 	reflect "reflect"
@@ -49,6 +51,34 @@ func (mr *MockServiceMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockService)(nil).Close))
 }
 
+// EnsureIndexes mocks base method.
+func (m *MockService) EnsureIndexes(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureIndexes", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureIndexes indicates an expected call of EnsureIndexes.
+func (mr *MockServiceMockRecorder) EnsureIndexes(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureIndexes", reflect.TypeOf((*MockService)(nil).EnsureIndexes), arg0)
+}
+
+// GetAPIKeyService mocks base method.
+func (m *MockService) GetAPIKeyService() service.APIKeyService {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyService")
+	ret0, _ := ret[0].(service.APIKeyService)
+	return ret0
+}
+
+// GetAPIKeyService indicates an expected call of GetAPIKeyService.
+func (mr *MockServiceMockRecorder) GetAPIKeyService() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyService", reflect.TypeOf((*MockService)(nil).GetAPIKeyService))
+}
+
 // GetDemoService mocks base method.
 func (m *MockService) GetDemoService() service.DemoService {
 	m.ctrl.T.Helper()
@@ -77,6 +107,34 @@ func (mr *MockServiceMockRecorder) GetHTTPService() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHTTPService", reflect.TypeOf((*MockService)(nil).GetHTTPService))
 }
 
+// GetUserService mocks base method.
+func (m *MockService) GetUserService() service.UserService {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserService")
+	ret0, _ := ret[0].(service.UserService)
+	return ret0
+}
+
+// GetUserService indicates an expected call of GetUserService.
+func (mr *MockServiceMockRecorder) GetUserService() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserService", reflect.TypeOf((*MockService)(nil).GetUserService))
+}
+
+// HealthChecks mocks base method.
+func (m *MockService) HealthChecks() []*health.Check {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HealthChecks")
+	ret0, _ := ret[0].([]*health.Check)
+	return ret0
+}
+
+// HealthChecks indicates an expected call of HealthChecks.
+func (mr *MockServiceMockRecorder) HealthChecks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HealthChecks", reflect.TypeOf((*MockService)(nil).HealthChecks))
+}
+
 // MongoDB mocks base method.
 func (m *MockService) MongoDB() mongodb.MongoDB {
 	m.ctrl.T.Helper()
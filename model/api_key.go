@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuthDB     = "demo_auth"
+	APIKeyColl = "api_key"
+)
+
+// APIKey is an api key of an internal caller. Only the SHA-256 hash of the key is stored, Prefix identifies the key
+// to humans, e.g. in listings.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name       string             `json:"name,omitempty" bson:"name,omitempty"`
+	Prefix     string             `json:"prefix,omitempty" bson:"prefix,omitempty"`
+	Hash       string             `json:"-" bson:"hash,omitempty"`
+	Scopes     []string           `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// RotatedFrom and RotatedTo link the keys replacing each other.
+	RotatedFrom *primitive.ObjectID `json:"rotated_from,omitempty" bson:"rotated_from,omitempty"`
+	RotatedTo   *primitive.ObjectID `json:"rotated_to,omitempty" bson:"rotated_to,omitempty"`
+	CreatedAt   time.Time           `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
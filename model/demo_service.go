@@ -30,10 +30,14 @@ type DemoService struct {
 type Account struct {
 	ID                primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	UniqueAccountID   string             `json:"account_id,omitempty" bson:"account_id,omitempty"`
-	AccountHolderName string             `json:"account_holder_name,omitempty" bson:"account_holder_name,omitempty"`
-	Balance           float32            `json:"balance,omitempty" bson:"balance,omitempty"`
-	CreatedAt         time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
-	UpdatedAt         *time.Time         `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	AccountHolderName string             `json:"account_holder_name,omitempty" bson:"account_holder_name,omitempty" encrypt:"deterministic"`
+	// OwnerID is the user owning the account, accounts opened before the users existed have none.
+	OwnerID   *primitive.ObjectID `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	Balance   float32             `json:"balance,omitempty" bson:"balance,omitempty"`
+	CreatedAt time.Time           `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt *time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	// Version is incremented on every update and used for compare-and-swap writes.
+	Version int64 `json:"version" bson:"version"`
 }
 
 type Transaction struct {
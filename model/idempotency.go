@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// IdempotencyColl holds the idempotency keys of the requests and their responses, in AuthDB.
+const IdempotencyColl = "idempotency_key"
+
+// IdempotencyKey is an idempotency key of a caller. Fingerprint identifies the request which used the key first,
+// Response is set once it completed. LockedUntil bounds the processing of the request, Version is incremented when
+// the key is handed to another request. ExpiresAt is when the key can be used again, a TTL index on it drops the
+// expired keys.
+type IdempotencyKey struct {
+	ID          string               `json:"_id" bson:"_id"`
+	Fingerprint string               `json:"fingerprint" bson:"fingerprint"`
+	Response    *IdempotencyResponse `json:"response,omitempty" bson:"response,omitempty"`
+	LockedUntil time.Time            `json:"locked_until" bson:"locked_until"`
+	Version     int64                `json:"version" bson:"version"`
+	CreatedAt   time.Time            `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time            `json:"expires_at" bson:"expires_at"`
+}
+
+// IdempotencyResponse is the response replayed to the retries of a request.
+type IdempotencyResponse struct {
+	Status      int    `json:"status" bson:"status"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Body        []byte `json:"body" bson:"body"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// RateLimitColl holds the token buckets of the rate limits shared by the instances of the app, in AuthDB.
+const RateLimitColl = "rate_limit"
+
+// RateLimitBucket is the token bucket of a rate limit key. Version is incremented on every update and used for
+// compare-and-swap writes. ExpiresAt is when the bucket is full again, a TTL index on it drops the idle buckets.
+type RateLimitBucket struct {
+	ID        string    `json:"_id" bson:"_id"`
+	Tokens    float64   `json:"tokens" bson:"tokens"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+	Version   int64     `json:"version" bson:"version"`
+}
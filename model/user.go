@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	UserColl         = "user"
+	UserEmailColl    = "user_email"
+	RefreshTokenColl = "refresh_token"
+)
+
+type User struct {
+	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Email        string             `json:"email,omitempty" bson:"email,omitempty"`
+	PasswordHash string             `json:"-" bson:"password_hash,omitempty"`
+	Roles        []string           `json:"roles,omitempty" bson:"roles,omitempty"`
+	// TOTP is the second factor of the user, nil until the user enrolls.
+	TOTP      *UserTOTP `json:"-" bson:"totp,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// UserTOTP is a TOTP second factor, it is only required once ConfirmedAt is set.
+type UserTOTP struct {
+	Secret      string     `json:"-" bson:"secret,omitempty" encrypt:"randomized"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty" bson:"confirmed_at,omitempty"`
+	// LastStep is the time step of the last accepted code, the codes of that step and before are not accepted again.
+	LastStep int64 `json:"last_step,omitempty" bson:"last_step,omitempty"`
+	// RecoveryCodes are the SHA-256 hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"`
+	// FailedAttempts counts the invalid codes since the last accepted one, LockedUntil is set once there are too many.
+	FailedAttempts int        `json:"-" bson:"failed_attempts,omitempty"`
+	LockedUntil    *time.Time `json:"-" bson:"locked_until,omitempty"`
+}
+
+// UserEmail reserves an email for a user, its id makes the emails unique.
+type UserEmail struct {
+	Email  string             `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+}
+
+// RefreshToken is a refresh token of a user, only its SHA-256 hash is stored. Every refresh marks the token used and
+// issues the next token of the family, the tokens of a login. Presenting a used token again revokes the whole family.
+// The expired tokens are dropped by a TTL index on expires_at, see Service.EnsureIndexes.
+type RefreshToken struct {
+	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID   primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	FamilyID primitive.ObjectID `json:"family_id,omitempty" bson:"family_id,omitempty"`
+	Hash     string             `json:"-" bson:"hash,omitempty"`
+	// AuthTime is when the user logged in, the access tokens of the family carry it.
+	AuthTime  time.Time  `json:"auth_time,omitempty" bson:"auth_time,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at,omitempty" bson:"created_at,omitempty"`
+}
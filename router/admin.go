@@ -0,0 +1,161 @@
+package router
+
+import (
+	"crypto/subtle"
+	"go-app/internals/config"
+	"go-app/internals/health"
+	"go-app/internals/logger"
+	"go-app/internals/metrics"
+	"go-app/schema"
+	"go-app/service"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/keyauth"
+	"github.com/gofiber/fiber/v2/middleware/monitor"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/rs/zerolog"
+)
+
+// AdminRouter serves the operational endpoints on the admin listener.
+// Everything except the health probes requires the configured bearer token.
+type AdminRouter struct {
+	*fiber.App
+	Logger    *zerolog.Logger
+	Config    *config.AdminConfig
+	AppConfig *config.Config
+	Validator *CustomValidator
+
+	DemoService service.DemoService
+	Health      health.Health
+	Metrics     metrics.Metrics
+}
+
+type AdminRouterOpts struct {
+	AbstractLogger *logger.ApplicationLogger
+	Config         *config.AdminConfig
+	AppConfig      *config.Config
+	DemoService    service.DemoService
+	Health         health.Health
+	Metrics        metrics.Metrics
+}
+
+func NewAdminRouter(opts *AdminRouterOpts) *AdminRouter {
+	lr := opts.AbstractLogger.Setup(&logger.ApplicationLoggerOpts{
+		ConsoleWriter: logger.NewZeroLogConsoleWriter(),
+		Config: &logger.ApplicationLoggerConfig{
+			ZerlogConfig: logger.ZerlogConfig{
+				Component:        "admin",
+				EnableStackTrace: true,
+				EnableCaller:     true,
+			},
+			HookConfig: logger.HookConfig{
+				EnableHook:        true,
+				EnableTracingHook: true,
+				EnableSentryHook:  true,
+			},
+		},
+	})
+
+	a := AdminRouter{
+		App:         fiber.New(NewFiberConfig(opts.Config.WebServerConfig)),
+		Logger:      lr,
+		Config:      opts.Config,
+		AppConfig:   opts.AppConfig,
+		Validator:   NewValidator(),
+		DemoService: opts.DemoService,
+		Health:      opts.Health,
+		Metrics:     opts.Metrics,
+	}
+
+	a.App.Use(requestid.New(requestid.Config{
+		Header:     "X-Request-ID",
+		ContextKey: schema.RequestIDKey,
+	}))
+	a.App.Use(RecoverPanics(a.Logger))
+	a.RegisterRoutes()
+	return &a
+}
+
+func (a *AdminRouter) RegisterRoutes() {
+	a.App.Get("/livez", a.LivenessHandler)
+	a.App.Get("/readyz", a.ReadinessHandler)
+
+	auth := a.authMiddleware()
+	if a.Metrics != nil {
+		a.App.Get("/metrics", auth, a.Metrics.Handler())
+	}
+	a.App.Get("/monitor", auth, monitor.New(monitor.Config{Refresh: time.Second * 10}))
+	a.App.Get("/config", auth, a.ConfigHandler)
+	a.App.Get("/log-level", auth, a.GetLogLevelHandler)
+	a.App.Put("/log-level", auth, a.UpdateLogLevelHandler)
+	if a.Config.EnablePprof {
+		a.App.Use("/debug/pprof", auth)
+		a.App.Use(pprof.New())
+	}
+
+	// demo error routes, kept off the public router
+	a.App.Get("/internal-error", auth, a.InternalServerHandler)
+	a.App.Get("/bad-request", auth, a.BadRequestHandler)
+	a.App.Get("/bad-request-2", auth, a.BadRequestWithSentryWarningHandler)
+	a.App.Get("/bad-request-3", auth, a.BadRequestWithSentryWarningInsideServiceHandler)
+}
+
+// authMiddleware checks the bearer token in constant time. Without a configured token every request is rejected.
+func (a *AdminRouter) authMiddleware() fiber.Handler {
+	token := []byte(a.Config.AuthToken)
+	return keyauth.New(keyauth.Config{
+		KeyLookup:  "header:" + fiber.HeaderAuthorization,
+		AuthScheme: "Bearer",
+		Validator: func(c *fiber.Ctx, key string) (bool, error) {
+			if len(token) == 0 || subtle.ConstantTimeCompare([]byte(key), token) != 1 {
+				return false, keyauth.ErrMissingOrMalformedAPIKey
+			}
+			return true, nil
+		},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return service.ErrUnauthorized.WithMessage("missing or invalid admin token")
+		},
+	})
+}
+
+func (a *AdminRouter) LivenessHandler(c *fiber.Ctx) error {
+	return healthResponse(c, a.Health.Live(c.UserContext()))
+}
+
+func (a *AdminRouter) ReadinessHandler(c *fiber.Ctx) error {
+	return healthResponse(c, a.Health.Ready(c.UserContext()))
+}
+
+func healthResponse(c *fiber.Ctx, r *health.Report) error {
+	status := http.StatusOK
+	if !r.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(NewJSONResp(r.OK(), r))
+}
+
+func (a *AdminRouter) ConfigHandler(c *fiber.Ctx) error {
+	return c.JSON(NewJSONResp(true, a.AppConfig.Redacted()))
+}
+
+func (a *AdminRouter) GetLogLevelHandler(c *fiber.Ctx) error {
+	return c.JSON(NewJSONResp(true, schema.LogLevel_Get{Level: zerolog.GlobalLevel().String()}))
+}
+
+// UpdateLogLevelHandler changes the global level, which applies to every logger of the process.
+func (a *AdminRouter) UpdateLogLevelHandler(c *fiber.Ctx) error {
+	s := new(schema.LogLevel_UpdateOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := a.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	level, _ := zerolog.ParseLevel(s.Level)
+	zerolog.SetGlobalLevel(level)
+	a.Logger.Info().Str("level", level.String()).Msg("log level changed")
+	return c.JSON(NewJSONResp(true, schema.LogLevel_Get{Level: level.String()}))
+}
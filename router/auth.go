@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"go-app/internals/auth"
+	"go-app/schema"
+	"go-app/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderAPIKey carries the api key of internal callers.
+const HeaderAPIKey = "X-API-Key"
+
+// authEnabled reports whether the routes which are not public require credentials.
+func (r *Router) authEnabled() bool {
+	return r.JWT != nil || r.APIKeyService != nil
+}
+
+// authenticate verifies the api key or the bearer token of the request and passes the caller to the handler, in the
+// request context for the services and in the locals. Api keys must have been granted the scopes of the route.
+func (r *Router) authenticate(scopes []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if key := c.Get(HeaderAPIKey); key != "" && r.APIKeyService != nil {
+			return r.authenticateAPIKey(c, key, scopes)
+		}
+		if r.JWT == nil {
+			return unauthorized(c, `APIKey realm="api"`, "missing api key")
+		}
+
+		token, ok := bearerToken(c)
+		if !ok {
+			return unauthorized(c, bearerChallenge("", ""), "missing bearer token")
+		}
+		claims, err := r.JWT.Verify(token)
+		if err != nil {
+			msg := jwtErrMsg(err)
+			return unauthorized(c, bearerChallenge("invalid_token", msg), msg)
+		}
+		c.Locals(schema.ClaimsKey, claims)
+		c.SetUserContext(context.WithValue(c.UserContext(), schema.ClaimsKey, claims))
+		return c.Next()
+	}
+}
+
+func (r *Router) authenticateAPIKey(c *fiber.Ctx, key string, scopes []string) error {
+	apiKey, err := r.APIKeyService.Authenticate(c.UserContext(), key)
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKey), errors.Is(err, service.ErrAPIKeyExpired), errors.Is(err, service.ErrAPIKeyRevoked):
+		c.Set(fiber.HeaderWWWAuthenticate, `APIKey realm="api"`)
+		return err
+	case err != nil:
+		return r.serviceErr(c, err)
+	}
+	for _, s := range scopes {
+		if !apiKey.HasScopes(s) {
+			return service.ErrForbidden.WithMessage("api key is missing the scope " + s)
+		}
+	}
+	c.Locals(schema.APIKeyKey, apiKey)
+	c.SetUserContext(context.WithValue(c.UserContext(), schema.APIKeyKey, apiKey))
+	return c.Next()
+}
+
+// stepUpEnabled reports whether the sensitive routes require a recent second factor, users only have one when they
+// can log in.
+func (r *Router) stepUpEnabled() bool {
+	return r.Config != nil && r.Config.StepUp != nil && r.Config.StepUp.Enabled && r.UserService != nil
+}
+
+// requireStepUp rejects the users whose token does not assert a second factor verified within the max age, the
+// client is expected to step up and retry with the new token (RFC 9470). Api keys have no second factor.
+func (r *Router) requireStepUp(c *fiber.Ctx) error {
+	claims, ok := schema.ClaimsFromContext(c.UserContext())
+	if !ok {
+		return c.Next()
+	}
+	maxAge := r.Config.StepUp.MaxAge
+	if claims.HasAMR(schema.AMROTP) && time.Since(time.Unix(claims.AuthTime, 0)) <= maxAge {
+		return c.Next()
+	}
+	challenge := bearerChallenge("insufficient_user_authentication", service.ErrStepUpRequired.Message) + ", max_age=" + strconv.Itoa(int(maxAge.Seconds()))
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	return service.ErrStepUpRequired
+}
+
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// jwtErrMsg returns the message sent to the client for a verification error, the details of invalid tokens are not sent.
+func jwtErrMsg(err error) string {
+	for _, e := range []error{auth.ErrTokenExpired, auth.ErrTokenNotValidYet, auth.ErrInvalidIssuer, auth.ErrInvalidAudience} {
+		if errors.Is(err, e) {
+			return e.Error()
+		}
+	}
+	return auth.ErrInvalidToken.Error()
+}
+
+// bearerChallenge returns the WWW-Authenticate challenge of a bearer token failure (RFC 6750).
+func bearerChallenge(code, msg string) string {
+	challenge := `Bearer realm="api"`
+	if code != "" {
+		challenge += `, error="` + code + `", error_description="` + msg + `"`
+	}
+	return challenge
+}
+
+// unauthorized returns an authentication failure to the ErrorHandler, along with its WWW-Authenticate challenge.
+func unauthorized(c *fiber.Ctx, challenge, msg string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	return service.ErrUnauthorized.WithMessage(msg)
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"go-app/schema"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (r *Router) CreateAccountHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.Account_CreateOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	resp, err := r.DemoService.Account_Create(ctx, s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(NewJSONResp(true, resp))
+}
+
+func (r *Router) GetAccountHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := ParseObjectIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+	account, err := r.DemoService.GetAccount(ctx, &schema.Account_GetOpts{ID: id})
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.JSON(NewJSONResp(true, account))
+}
+
+func (r *Router) GetAccountWithTransactionsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := ParseObjectIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+	account, err := r.DemoService.GetAccountDetailWithTransactions(ctx, &schema.AccountTransaction_GetOpts{ID: id})
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	if account.Transactions == nil {
+		account.Transactions = []schema.Transaction_Get{}
+	}
+	return c.JSON(NewJSONResp(true, account))
+}
+
+func (r *Router) GetAccountTransactionsHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	id, err := ParseObjectIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+	account, err := r.DemoService.GetAccountDetailWithTransactions(ctx, &schema.AccountTransaction_GetOpts{ID: id})
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	// an account without transactions renders an empty list rather than null
+	transactions := account.Transactions
+	if transactions == nil {
+		transactions = []schema.Transaction_Get{}
+	}
+	return c.JSON(NewJSONResp(true, transactions))
+}
+
+func (r *Router) CreateTransferHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.Transaction_CreateOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	errs := r.Validator.Validate(s)
+	// nefield compares ObjectIDs by their kind only, so the accounts are compared here
+	if !s.DebitAccountID.IsZero() && s.DebitAccountID == s.CreditAccountID {
+		errs = append(errs, ErrorResp{ErrCode: "ValidationErr", ErrMsg: "debit_account_id must be different from credit_account_id", ErrField: "debit_account_id"})
+	}
+	if errs != nil {
+		return ValidationErrs(errs)
+	}
+	if err := r.DemoService.Transaction_Create(ctx, s); err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(NewJSONResp(true, schema.Transaction_CreateResp{TransactionID: s.TransactionID}))
+}
+
+// serviceErr returns an error returned by a service to the ErrorHandler, which renders it. Internal errors are logged
+// as their details are not sent to the client.
+func (r *Router) serviceErr(c *fiber.Ctx, err error) error {
+	if status, _ := ServiceErrResponse(err); status >= http.StatusInternalServerError {
+		r.Logger.Err(err).Ctx(c.UserContext()).Str("path", c.Path()).Msg("request failed")
+	}
+	return err
+}
@@ -4,13 +4,14 @@ import (
 	"context"
 	"fmt"
 	"go-app/schema"
+	"go-app/service"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func (r *Router) HelloWorldHandler(c *fiber.Ctx) error {
-	ctx := c.Context()
+	ctx := c.UserContext()
 	resp := map[string]string{
 		"message": "Hello World",
 	}
@@ -19,40 +20,43 @@ func (r *Router) HelloWorldHandler(c *fiber.Ctx) error {
 	return c.JSON(resp)
 }
 
-func (r *Router) InternalServerHandler(c *fiber.Ctx) error {
+func (a *AdminRouter) InternalServerHandler(c *fiber.Ctx) error {
 	ctx := c.Context()
-	r.Logger.Info().Ctx(ctx).Msg("here-1")
+	a.Logger.Info().Ctx(ctx).Msg("here-1")
 	var x []string
 	fmt.Println(x[0])
-	return c.Status(http.StatusInternalServerError).JSON(NewErrResponse(false, NewErr("InternalServerErr", "oops something went wrong")))
+	return service.ErrInternal
 }
 
-func (r *Router) BadRequestHandler(c *fiber.Ctx) error {
+func (a *AdminRouter) BadRequestHandler(c *fiber.Ctx) error {
 	ctx := c.Context()
-	r.Logger.Info().Ctx(ctx).Msg("here-1")
-	return c.Status(fiber.StatusBadRequest).JSON(NewErrResponse(false, NewErr("BadRequest", "request failed")))
+	a.Logger.Info().Ctx(ctx).Msg("here-1")
+	return service.ErrBadRequest
 }
 
-func (r *Router) BadRequestWithSentryWarningHandler(c *fiber.Ctx) error {
-	r.Logger.Warn().Ctx(context.WithValue(c.Context(), "meta", "some useful information for debugging")).Msg("new warning message for sentry")
-	return c.Status(fiber.StatusBadRequest).JSON(NewErrResponse(false, NewErr("BadRequest", "request failed with sentry")))
+func (a *AdminRouter) BadRequestWithSentryWarningHandler(c *fiber.Ctx) error {
+	a.Logger.Warn().Ctx(context.WithValue(c.Context(), "meta", "some useful information for debugging")).Msg("new warning message for sentry")
+	return service.ErrBadRequest.WithMessage("request failed with sentry")
 }
 
-func (r *Router) BadRequestWithSentryWarningInsideServiceHandler(c *fiber.Ctx) error {
-	r.DemoService.SentryDemoFunc(c.Context())
-	return fiber.NewError(fiber.StatusBadRequest, "request failed with sentry within service")
+func (a *AdminRouter) BadRequestWithSentryWarningInsideServiceHandler(c *fiber.Ctx) error {
+	a.DemoService.SentryDemoFunc(c.Context())
+	return service.ErrBadRequest.WithMessage("request failed with sentry within service")
 }
 
 func (r *Router) InsertOneHandler(c *fiber.Ctx) error {
-	ctx := c.Context()
+	ctx := c.UserContext()
 	s := new(schema.InsertOneOpts)
 	if err := DecodeJSONBody(c, s); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(NewErrResponse(false, err.(ErrorResp)))
+		return err
 	}
 	if err := r.Validator.Validate(s); err != nil {
-		return c.Status(http.StatusBadRequest).JSON(NewErrResponse(false, err...))
+		return ValidationErrs(err)
 	}
 	r.Logger.Info().Ctx(ctx).Msg("here-2")
-	id, _ := r.DemoService.InsertOne(ctx, s)
-	return c.Status(http.StatusOK).JSON(NewJSONResp(true, fiber.Map{"id": id.Hex()}))
+	id, err := r.DemoService.InsertOne(ctx, s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.Status(http.StatusOK).JSON(NewJSONResp(true, schema.InsertOneResp{ID: id.Hex()}))
 }
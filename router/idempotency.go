@@ -0,0 +1,112 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-app/schema"
+	"go-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// HeaderIdempotencyKey is set by the clients to retry a mutating request safely.
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on the responses replayed to a retry.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the idempotency keys, UUIDs are expected.
+const maxIdempotencyKeyLength = 255
+
+func (r *Router) idempotencyEnabled() bool {
+	return r.Config != nil && r.Config.Idempotency != nil && r.Config.Idempotency.Enabled && r.IdempotencyStore != nil
+}
+
+// idempotent processes the requests with an Idempotency-Key header once per key and caller, their retries are
+// replayed the first response. It is nil for the routes which are not idempotent.
+func (r *Router) idempotent(doc *RouteDoc) fiber.Handler {
+	if !doc.Idempotent || !r.idempotencyEnabled() {
+		return nil
+	}
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			msg := fmt.Sprintf("%s must not be longer than %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength)
+			return ErrorResp{ErrCode: "ValidationErr", ErrMsg: msg, ErrField: HeaderIdempotencyKey}
+		}
+
+		ctx := c.UserContext()
+		// the keys of the callers are distinct, a caller is never replayed the response of another one
+		key = callerKey(c) + ":" + key
+		fingerprint := requestFingerprint(c)
+		resp, err := r.IdempotencyStore.Begin(ctx, key, fingerprint)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyKeyInUse):
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return err
+		case err != nil:
+			// a conflict, or a failure of the store as the request could be processed twice without its key
+			return r.serviceErr(c, err)
+		case resp != nil:
+			c.Set(HeaderIdempotentReplayed, "true")
+			c.Set(fiber.HeaderContentType, resp.ContentType)
+			return c.Status(resp.Status).Send(resp.Body)
+		}
+
+		err = c.Next()
+		if err != nil {
+			// the error is rendered here to store its response
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				if notApplied(err) {
+					r.release(c, key, fingerprint)
+				}
+				return herr
+			}
+		}
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError && notApplied(err) {
+			// the request left nothing behind, its retries are processed again
+			r.release(c, key, fingerprint)
+			return nil
+		}
+		// the other server errors, such as the timeouts, may come after the request was applied: their response is
+		// stored like any other, so that a retry does not process the request twice
+		resp = &schema.IdempotentResponse{
+			Status:      status,
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        append([]byte(nil), c.Response().Body()...),
+		}
+		if err := r.IdempotencyStore.Complete(ctx, key, fingerprint, resp); err != nil {
+			// the retries are rejected until the lock of the key expires
+			r.Logger.Err(err).Ctx(ctx).Msg("failed to complete idempotent request")
+		}
+		return nil
+	}
+}
+
+// notApplied reports whether err is known to have left no side effect, e.g. a transaction which was aborted. A commit
+// whose result is unknown may have been applied.
+func notApplied(err error) bool {
+	var se interface{ HasErrorLabel(string) bool }
+	return errors.As(err, &se) && se.HasErrorLabel("TransientTransactionError") && !se.HasErrorLabel("UnknownTransactionCommitResult")
+}
+
+func (r *Router) release(c *fiber.Ctx, key, fingerprint string) {
+	if err := r.IdempotencyStore.Release(c.UserContext(), key, fingerprint); err != nil {
+		r.Logger.Err(err).Ctx(c.UserContext()).Msg("failed to release idempotency key")
+	}
+}
+
+// requestFingerprint identifies the request by its method, path and body, a key reused for another request conflicts.
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
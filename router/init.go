@@ -1,8 +1,12 @@
 package router
 
 import (
+	"context"
+	"go-app/internals/auth"
 	"go-app/internals/config"
 	"go-app/internals/logger"
+	"go-app/internals/metrics"
+	"go-app/internals/tracing"
 	"go-app/schema"
 	"go-app/service"
 	"reflect"
@@ -16,7 +20,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/rs/zerolog"
 
@@ -24,6 +27,8 @@ import (
 	en_translations "github.com/go-playground/validator/v10/translations/en"
 )
 
+// RequestFieldsToLog are the fields of the request logs. The request headers are logged by RequestLogger, with the
+// credentials redacted.
 var RequestFieldsToLog = []string{
 	"time",
 	"referer",
@@ -47,26 +52,60 @@ var RequestFieldsToLog = []string{
 	"method",
 	"requestId",
 	"error",
-	"reqHeaders",
 }
 
+// redactedHeaders carry the credentials of the caller, their values are not logged.
+var redactedHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderProxyAuthorization, fiber.HeaderCookie, HeaderAPIKey}
+
+// localSecretBody marks the requests whose bodies are not logged, see RouteDoc.Secret.
+const localSecretBody = "secretBody"
+
 type Router struct {
 	*fiber.App
 	Logger    *zerolog.Logger
 	Config    *config.RouterConfig
 	Validator *CustomValidator
+	// JWT authenticates the requests to the routes which are not public, they are open when nil.
+	JWT auth.JWT
+	// APIKeyService authenticates the api keys of the requests to the routes which are not public, nil disables api keys.
+	APIKeyService service.APIKeyService
 
 	DemoService service.DemoService
+	// UserService registers and logs in the users, their routes are not served when it is nil.
+	UserService service.UserService
+	// RateLimitStore keeps the buckets of the rate limits, the requests are not limited when it is nil.
+	RateLimitStore service.RateLimitStore
+	// IdempotencyStore keeps the idempotency keys, the Idempotency-Key header is ignored when it is nil.
+	IdempotencyStore service.IdempotencyStore
+
+	routes []*documentedRoute
 }
 
 type RouterOpts struct {
-	AbstractLogger *logger.ApplicationLogger
-	DemoService    service.DemoService
-	RouterConfig   *config.RouterConfig
+	AbstractLogger  *logger.ApplicationLogger
+	DemoService     service.DemoService
+	RouterConfig    *config.RouterConfig
+	WebServerConfig *config.WebServerConfig
+	// Metrics records the requests served by the router, may be nil.
+	Metrics metrics.Metrics
+	// Tracing records a span for every request, may be nil.
+	Tracing tracing.Tracing
+	// JWT authenticates the requests to the routes which are not public, they are open when nil.
+	JWT auth.JWT
+	// APIKeyService authenticates the api keys of the requests to the routes which are not public, nil disables api keys.
+	APIKeyService service.APIKeyService
+	// UserService registers and logs in the users, their routes are not served when it is nil.
+	UserService service.UserService
+	// RateLimitStore keeps the buckets of the rate limits, the requests are not limited when it is nil.
+	RateLimitStore service.RateLimitStore
+	// IdempotencyStore keeps the idempotency keys, the Idempotency-Key header is ignored when it is nil.
+	IdempotencyStore service.IdempotencyStore
 }
 
 type middlewareConfig struct {
-	logger *zerolog.Logger
+	logger  *zerolog.Logger
+	metrics metrics.Metrics
+	tracing tracing.Tracing
 }
 
 func NewRouter(opts *RouterOpts) *Router {
@@ -99,24 +138,44 @@ func NewRouter(opts *RouterOpts) *Router {
 		},
 	})
 
-	fiberConfig := fiber.Config{
-		JSONEncoder: json.Marshal,
-		JSONDecoder: json.Unmarshal,
-	}
-
 	r := Router{
-		App:         fiber.New(fiberConfig),
-		Logger:      lr,
-		Config:      opts.RouterConfig,
-		Validator:   NewValidator(),
-		DemoService: opts.DemoService,
+		App:              fiber.New(NewFiberConfig(opts.WebServerConfig)),
+		Logger:           lr,
+		Config:           opts.RouterConfig,
+		Validator:        NewValidator(),
+		JWT:              opts.JWT,
+		APIKeyService:    opts.APIKeyService,
+		DemoService:      opts.DemoService,
+		UserService:      opts.UserService,
+		RateLimitStore:   opts.RateLimitStore,
+		IdempotencyStore: opts.IdempotencyStore,
 	}
 
-	r.enableMiddlewares(&middlewareConfig{logger: rr})
+	r.enableMiddlewares(&middlewareConfig{logger: rr, metrics: opts.Metrics, tracing: opts.Tracing})
 	r.RegisterRoutes()
 	return &r
 }
 
+// NewFiberConfig applies the server limits, zero values keep the fiber defaults.
+func NewFiberConfig(c *config.WebServerConfig) fiber.Config {
+	fc := fiber.Config{
+		JSONEncoder:  json.Marshal,
+		JSONDecoder:  json.Unmarshal,
+		ErrorHandler: ErrorHandler,
+	}
+	if c == nil {
+		return fc
+	}
+	fc.BodyLimit = c.BodyLimit
+	fc.ReadTimeout = c.ReadTimeout
+	fc.WriteTimeout = c.WriteTimeout
+	fc.IdleTimeout = c.IdleTimeout
+	fc.Concurrency = c.Concurrency
+	fc.ReadBufferSize = c.MaxHeaderSize
+	fc.Prefork = c.Prefork
+	return fc
+}
+
 func (r *Router) enableMiddlewares(config *middlewareConfig) {
 
 	r.App.Use(requestid.New(requestid.Config{
@@ -124,9 +183,21 @@ func (r *Router) enableMiddlewares(config *middlewareConfig) {
 		ContextKey: schema.RequestIDKey,
 	}))
 
-	r.App.Use(recover.New(recover.Config{
-		EnableStackTrace: true,
-	}))
+	// handlers pass c.UserContext() to the services, it carries the request id and the span of the request
+	r.App.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(context.WithValue(c.UserContext(), schema.RequestIDKey, c.Locals(schema.RequestIDKey)))
+		return c.Next()
+	})
+
+	if config.tracing != nil {
+		r.App.Use(config.tracing.Middleware())
+	}
+
+	r.App.Use(RecoverPanics(r.Logger))
+
+	if config.metrics != nil {
+		r.App.Use(config.metrics.Middleware())
+	}
 
 	r.App.Use(compress.New(compress.Config{
 		Level: compress.LevelBestSpeed, // 1
@@ -137,10 +208,7 @@ func (r *Router) enableMiddlewares(config *middlewareConfig) {
 
 	r.App.Use(helmet.New())
 
-	r.App.Use(fiberzerolog.New(fiberzerolog.Config{
-		Logger: config.logger,
-		Fields: RequestFieldsToLog,
-	}))
+	r.App.Use(RequestLogger(config.logger))
 
 	if r.Config.EnableSentry {
 		r.App.Use(fibersentry.New(fibersentry.Config{
@@ -151,6 +219,40 @@ func (r *Router) enableMiddlewares(config *middlewareConfig) {
 
 }
 
+// RequestLogger logs every request with RequestFieldsToLog and the request headers. The credentials in the headers
+// are redacted and the bodies of the requests and responses of the routes with a Secret doc are left out.
+func RequestLogger(logger *zerolog.Logger) fiber.Handler {
+	secret := func(c *fiber.Ctx) bool {
+		return c.Locals(localSecretBody) != nil
+	}
+	return fiberzerolog.New(fiberzerolog.Config{
+		Logger: logger,
+		GetLogger: func(c *fiber.Ctx) zerolog.Logger {
+			zc := logger.With()
+			c.Request().Header.VisitAll(func(k, v []byte) {
+				if isRedactedHeader(string(k)) {
+					zc = zc.Str(string(k), "[REDACTED]")
+					return
+				}
+				zc = zc.Bytes(string(k), v)
+			})
+			return zc.Logger()
+		},
+		Fields:      RequestFieldsToLog,
+		SkipBody:    secret,
+		SkipResBody: secret,
+	})
+}
+
+func isRedactedHeader(name string) bool {
+	for _, h := range redactedHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
 // var enhanceSentryEvent = func(c *fiber.Ctx) error {
 // 	if hub := fibersentry.GetHubFromContext(c); hub != nil {
 // 	}
@@ -0,0 +1,293 @@
+package router
+
+import (
+	_ "embed"
+	"fmt"
+	"go-app/internals/openapi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	OpenAPIRoute = "/openapi.json"
+	DocsRoute    = "/docs"
+)
+
+//go:embed static/docs.html
+var docsHTML []byte
+
+// RouteDoc documents a route in the OpenAPI document.
+type RouteDoc struct {
+	Summary string
+	Tags    []string
+	// Public routes are served without authentication.
+	Public bool
+	// Scopes are required from the api keys calling the route.
+	Scopes []string
+	// Sensitive routes require a recent second factor from the users when step-up is enabled.
+	Sensitive bool
+	// Secret routes carry passwords, tokens or second factor secrets in their bodies, which are not logged.
+	Secret bool
+	// Idempotent routes replay their response to the retries with the same Idempotency-Key header.
+	Idempotent bool
+	// Params describes the path and query parameters, path parameters without a ParamDoc are documented as strings.
+	Params []ParamDoc
+	// Request is a value of the type of the json body of the request, nil for routes without body.
+	Request interface{}
+	// Response is a value of the type of the payload of the success response.
+	Response interface{}
+	// Status is the status of the success response, http.StatusOK when zero.
+	Status int
+	// Bare responses are not wrapped in the Response envelope.
+	Bare bool
+	// Errors lists the error codes of the route by response status. The errors of DecodeJSONBody and of the
+	// validator are added to the routes with a Request.
+	Errors map[int][]string
+}
+
+type ParamDoc struct {
+	Name string
+	// In is either path or query.
+	In          string
+	Description string
+	Required    bool
+	// Type is a value of the type of the parameter, string when nil.
+	Type interface{}
+}
+
+type documentedRoute struct {
+	method string
+	path   string
+	doc    *RouteDoc
+	// rateLimited routes may respond with 429.
+	rateLimited bool
+	// idempotent routes accept an Idempotency-Key header.
+	idempotent bool
+}
+
+// requestBodyErrors are the errors of decoding and validating a json body.
+var requestBodyErrors = map[int][]string{
+	http.StatusBadRequest:            {"StatusBadRequest", "StatusUnsupportedMediaType", "ValidationErr"},
+	http.StatusRequestEntityTooLarge: {"StatusRequestEntityTooLarge"},
+}
+
+// The security schemes of the routes which are not public.
+const (
+	bearerAuth = "bearerAuth"
+	apiKeyAuth = "apiKeyAuth"
+)
+
+// handle registers handler for method and path on router, the app or a version group, along with its documentation.
+// The routes which are not public require a bearer token or an api key.
+func (r *Router) handle(router fiber.Router, method, path string, handler fiber.Handler, doc *RouteDoc) {
+	var handlers []fiber.Handler
+	// first, so that the body is not logged when a middleware rejects the request
+	if doc.Secret {
+		handlers = append(handlers, markSecretBody)
+	}
+	limitIP, limitCaller := r.limitIP(), r.limitCaller(method, path, doc)
+	if limitIP != nil {
+		handlers = append(handlers, limitIP)
+	}
+	if !doc.Public && r.authEnabled() {
+		handlers = append(handlers, r.authenticate(doc.Scopes))
+	}
+	if limitCaller != nil {
+		handlers = append(handlers, limitCaller)
+	}
+	if !doc.Public && r.authEnabled() && doc.Sensitive && r.stepUpEnabled() {
+		handlers = append(handlers, r.requireStepUp)
+	}
+	idempotent := r.idempotent(doc)
+	if idempotent != nil {
+		handlers = append(handlers, idempotent)
+	}
+	router.Add(method, path, append(handlers, handler)...)
+	if g, ok := router.(*fiber.Group); ok {
+		path = g.Prefix + path
+	}
+	r.routes = append(r.routes, &documentedRoute{method: method, path: path, doc: doc, rateLimited: limitIP != nil || limitCaller != nil, idempotent: idempotent != nil})
+}
+
+func markSecretBody(c *fiber.Ctx) error {
+	c.Locals(localSecretBody, true)
+	return c.Next()
+}
+
+// OpenAPIPath converts the parameters of a fiber route path to the OpenAPI template syntax, e.g. /accounts/:id to /accounts/{id}.
+func OpenAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + strings.TrimSuffix(s[1:], "?") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// OpenAPI generates the OpenAPI document of the routes registered with handle.
+func (r *Router) OpenAPI() *openapi.Document {
+	g := openapi.NewGenerator(&openapi.GeneratorOpts{
+		Info: openapi.Info{
+			Title: "go-app",
+			Description: "The api is served under /api/{version}. Requests to /api without a version are served by the version " +
+				"of the Accept-Version header, or by the default version.",
+			Version: strings.Join(APIVersions, ", "),
+		},
+	})
+	envelope := g.Schema(Response{})
+	for _, rt := range r.routes {
+		g.AddOperation(rt.method, OpenAPIPath(rt.path), r.operation(g, envelope, rt))
+	}
+	doc := g.Document()
+	doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		apiKeyAuth: {Type: "apiKey", In: "header", Name: HeaderAPIKey},
+	}
+	return doc
+}
+
+func (r *Router) operation(g openapi.Generator, envelope *openapi.Schema, rt *documentedRoute) *openapi.Operation {
+	doc := rt.doc
+	op := &openapi.Operation{
+		Summary:    doc.Summary,
+		Tags:       doc.Tags,
+		Parameters: parameters(g, rt),
+		Responses:  map[string]*openapi.Response{},
+	}
+
+	errs := map[int][]string{}
+	for status, codes := range doc.Errors {
+		errs[status] = append(errs[status], codes...)
+	}
+	if !doc.Public {
+		op.Security = []map[string][]string{{bearerAuth: {}}, {apiKeyAuth: {}}}
+		errs[http.StatusUnauthorized] = append(errs[http.StatusUnauthorized], "Unauthorized")
+	}
+	var description []string
+	if len(doc.Scopes) > 0 {
+		description = append(description, "Api keys require the scopes: "+strings.Join(doc.Scopes, ", ")+".")
+		errs[http.StatusForbidden] = append(errs[http.StatusForbidden], "Forbidden")
+	}
+	if doc.Sensitive && r.stepUpEnabled() {
+		description = append(description, fmt.Sprintf("Users require a token from a step-up within the last %s.", r.Config.StepUp.MaxAge))
+		errs[http.StatusUnauthorized] = append(errs[http.StatusUnauthorized], "StepUpRequired")
+	}
+	op.Description = strings.Join(description, " ")
+	if rt.rateLimited {
+		errs[http.StatusTooManyRequests] = append(errs[http.StatusTooManyRequests], "TooManyRequests")
+	}
+	if rt.idempotent {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{
+			Name:        HeaderIdempotencyKey,
+			In:          "header",
+			Description: "retries with the same key are replayed the response of the first request",
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+		errs[http.StatusBadRequest] = append(errs[http.StatusBadRequest], "ValidationErr")
+		errs[http.StatusConflict] = append(errs[http.StatusConflict], "IdempotencyKeyMismatch", "IdempotencyKeyInUse")
+	}
+	if doc.Request != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: g.Schema(doc.Request)}},
+		}
+		for status, codes := range requestBodyErrors {
+			errs[status] = append(errs[status], codes...)
+		}
+	}
+
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var schema *openapi.Schema
+	switch {
+	case doc.Bare:
+		schema = g.Schema(doc.Response)
+	case doc.Response == nil:
+		schema = envelope
+	default:
+		schema = &openapi.Schema{AllOf: []*openapi.Schema{envelope, {
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"payload": g.Schema(doc.Response)},
+		}}}
+	}
+	op.Responses[strconv.Itoa(status)] = &openapi.Response{
+		Description: http.StatusText(status),
+		Content:     map[string]*openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: schema}},
+	}
+
+	for status, codes := range errs {
+		codes = dedup(codes)
+		op.Responses[strconv.Itoa(status)] = &openapi.Response{
+			Description: fmt.Sprintf("%s: %s", http.StatusText(status), strings.Join(codes, ", ")),
+			Content:     map[string]*openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: envelope}},
+		}
+	}
+	return op
+}
+
+// parameters documents the parameters of the path of the route followed by the query parameters.
+func parameters(g openapi.Generator, rt *documentedRoute) []*openapi.Parameter {
+	docs := map[string]ParamDoc{}
+	for _, p := range rt.doc.Params {
+		docs[p.In+":"+p.Name] = p
+	}
+	param := func(p ParamDoc) *openapi.Parameter {
+		s := &openapi.Schema{Type: "string"}
+		if p.Type != nil {
+			s = g.Schema(p.Type)
+		}
+		return &openapi.Parameter{Name: p.Name, In: p.In, Description: p.Description, Required: p.Required, Schema: s}
+	}
+
+	var params []*openapi.Parameter
+	for _, s := range strings.Split(rt.path, "/") {
+		if !strings.HasPrefix(s, ":") {
+			continue
+		}
+		name := strings.TrimSuffix(s[1:], "?")
+		p, ok := docs["path:"+name]
+		if !ok {
+			p = ParamDoc{Name: name, In: "path"}
+		}
+		// OpenAPI requires path parameters
+		p.Required = true
+		params = append(params, param(p))
+	}
+	for _, p := range rt.doc.Params {
+		if p.In == "query" {
+			params = append(params, param(p))
+		}
+	}
+	return params
+}
+
+func dedup(codes []string) []string {
+	sort.Strings(codes)
+	var out []string
+	for i, c := range codes {
+		if i == 0 || c != codes[i-1] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// OpenAPIHandler serves the OpenAPI document of the router.
+func (r *Router) OpenAPIHandler(spec *openapi.Document) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(spec)
+	}
+}
+
+// DocsHandler serves a page rendering the OpenAPI document.
+func (r *Router) DocsHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(docsHTML)
+}
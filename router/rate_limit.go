@@ -0,0 +1,131 @@
+package router
+
+import (
+	"fmt"
+	"go-app/internals/config"
+	"go-app/schema"
+	"go-app/service"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The rate limit headers (draft-ietf-httpapi-ratelimit-headers), Reset is in seconds.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// rateLimitKey holds the result of the most restrictive rate limit of the request in the locals.
+const rateLimitKey = "rate-limit"
+
+func (r *Router) rateLimitEnabled() bool {
+	return r.Config != nil && r.Config.RateLimit != nil && r.Config.RateLimit.Enabled && r.RateLimitStore != nil
+}
+
+// validRule reports whether rule limits anything, a zero limit or period disables it.
+func validRule(rule *config.RateLimitRule) bool {
+	return rule != nil && rule.Limit > 0 && rule.Period > 0
+}
+
+// routeRateLimit returns the rule of the route registered for method and path, path is relative to the api version.
+func (r *Router) routeRateLimit(method, path string) *config.RateLimitRule {
+	for _, rc := range r.Config.RateLimit.Routes {
+		if rc.Route == path && (rc.Method == "" || strings.ToUpper(rc.Method) == method) && validRule(&rc.RateLimitRule) {
+			return &rc.RateLimitRule
+		}
+	}
+	return nil
+}
+
+// limitIP limits the requests of every client ip, before they are authenticated so that the failed attempts count.
+// It is nil without an ip limit.
+func (r *Router) limitIP() fiber.Handler {
+	if !r.rateLimitEnabled() || !validRule(r.Config.RateLimit.IP) {
+		return nil
+	}
+	rule := r.Config.RateLimit.IP
+	return func(c *fiber.Ctx) error {
+		if ok, err := r.allow(c, "ip:"+c.IP(), rule); !ok {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// limitCaller limits the requests of the authenticated api keys and the requests of every caller to the route of
+// method and path. It is nil when neither is limited.
+func (r *Router) limitCaller(method, path string, doc *RouteDoc) fiber.Handler {
+	if !r.rateLimitEnabled() {
+		return nil
+	}
+	var keyRule *config.RateLimitRule
+	if !doc.Public && r.APIKeyService != nil && validRule(r.Config.RateLimit.APIKey) {
+		keyRule = r.Config.RateLimit.APIKey
+	}
+	routeRule := r.routeRateLimit(method, path)
+	if keyRule == nil && routeRule == nil {
+		return nil
+	}
+	return func(c *fiber.Ctx) error {
+		if key, ok := c.Locals(schema.APIKeyKey).(*schema.APIKey_Get); ok && keyRule != nil {
+			if ok, err := r.allow(c, "key:"+key.ID.Hex(), keyRule); !ok {
+				return err
+			}
+		}
+		if routeRule != nil {
+			// the versions of a route share its limit
+			if ok, err := r.allow(c, "route:"+method+" "+path+":"+callerKey(c), routeRule); !ok {
+				return err
+			}
+		}
+		return c.Next()
+	}
+}
+
+// callerKey identifies the caller of the request by its api key, its user or its ip.
+func callerKey(c *fiber.Ctx) string {
+	if key, ok := c.Locals(schema.APIKeyKey).(*schema.APIKey_Get); ok {
+		return "key:" + key.ID.Hex()
+	}
+	if claims, ok := c.Locals(schema.ClaimsKey).(*schema.Claims); ok && claims.Subject != "" {
+		return "user:" + claims.Subject
+	}
+	return "ip:" + c.IP()
+}
+
+// allow takes a token of key and returns the 429 error when there is none. Requests are allowed when the store
+// fails, the limits are not worth an outage.
+func (r *Router) allow(c *fiber.Ctx, key string, rule *config.RateLimitRule) (bool, error) {
+	res, err := r.RateLimitStore.Take(c.UserContext(), key, rule.Limit, rule.Period)
+	if err != nil {
+		r.Logger.Err(err).Ctx(c.UserContext()).Str("key", key).Msg("failed to take a rate limit token, the request is allowed")
+		return true, nil
+	}
+	setRateLimitHeaders(c, res)
+	if res.Allowed {
+		return true, nil
+	}
+	retry := ceilSeconds(res.RetryAfter.Seconds())
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retry))
+	msg := fmt.Sprintf("rate limit exceeded, retry in %d seconds", retry)
+	return false, service.ErrTooManyRequests.WithMessage(msg)
+}
+
+// setRateLimitHeaders sets the headers of res unless another limit of the request has fewer remaining requests.
+func setRateLimitHeaders(c *fiber.Ctx, res *service.RateLimitResult) {
+	if prev, ok := c.Locals(rateLimitKey).(*service.RateLimitResult); ok && prev.Remaining < res.Remaining {
+		return
+	}
+	c.Locals(rateLimitKey, res)
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
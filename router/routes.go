@@ -1,17 +1,222 @@
 package router
 
 import (
-	"time"
+	"go-app/schema"
+	"net/http"
 
-	"github.com/gofiber/fiber/v2/middleware/monitor"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// serviceErrors are the errors every route calling a service may respond with, see ServiceErrResponse.
+var serviceErrors = map[int][]string{
+	http.StatusInternalServerError: {"InternalServerErr"},
+	http.StatusGatewayTimeout:      {"Timeout"},
+}
+
+func withServiceErrors(errs map[int][]string) map[int][]string {
+	out := map[int][]string{}
+	for status, codes := range serviceErrors {
+		out[status] = append(out[status], codes...)
+	}
+	for status, codes := range errs {
+		out[status] = append(out[status], codes...)
+	}
+	return out
+}
+
+var totpErrors = withServiceErrors(map[int][]string{
+	http.StatusNotFound:            {"UserNotFound"},
+	http.StatusConflict:            {"TOTPNotEnabled", "TOTPAlreadyEnabled"},
+	http.StatusUnprocessableEntity: {"InvalidCode"},
+	http.StatusTooManyRequests:     {"TooManyAttempts"},
+})
+
+var accountIDParam = ParamDoc{Name: "id", In: "path", Description: "id of the account", Type: primitive.ObjectID{}}
+
+var (
+	helloWorldDoc = &RouteDoc{
+		Summary:  "Hello world",
+		Tags:     []string{"demo"},
+		Public:   true,
+		Response: map[string]string{},
+		Bare:     true,
+	}
+	insertOneDoc = &RouteDoc{
+		Summary:    "Insert a demo document",
+		Tags:       []string{"demo"},
+		Public:     true,
+		Idempotent: true,
+		Request:    schema.InsertOneOpts{},
+		Response:   schema.InsertOneResp{},
+	}
+	createAccountDoc = &RouteDoc{
+		Summary:    "Open an account",
+		Tags:       []string{"accounts"},
+		Scopes:     []string{schema.ScopeAccountsWrite},
+		Idempotent: true,
+		Request:    schema.Account_CreateOpts{},
+		Response:   schema.Account_CreateResp{},
+		Status:     http.StatusCreated,
+		Errors:     withServiceErrors(nil),
+	}
+	getAccountDoc = &RouteDoc{
+		Summary:  "Get an account",
+		Tags:     []string{"accounts"},
+		Scopes:   []string{schema.ScopeAccountsRead},
+		Params:   []ParamDoc{accountIDParam},
+		Response: schema.Account_GetResp{},
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusBadRequest: {"ValidationErr"},
+			http.StatusNotFound:   {"AccountNotFound"},
+		}),
+	}
+	getAccountWithTransactionsDoc = &RouteDoc{
+		Summary:  "Get an account with its transactions",
+		Tags:     []string{"accounts"},
+		Scopes:   []string{schema.ScopeAccountsRead},
+		Params:   []ParamDoc{accountIDParam},
+		Response: schema.Account_Get{},
+		Errors:   getAccountDoc.Errors,
+	}
+	getAccountTransactionsDoc = &RouteDoc{
+		Summary:  "List the transactions of an account",
+		Tags:     []string{"accounts"},
+		Scopes:   []string{schema.ScopeAccountsRead},
+		Params:   []ParamDoc{accountIDParam},
+		Response: []schema.Transaction_Get{},
+		Errors:   getAccountDoc.Errors,
+	}
+	createTransferDoc = &RouteDoc{
+		Summary:    "Transfer an amount between two accounts",
+		Tags:       []string{"transfers"},
+		Scopes:     []string{schema.ScopeTransfersWrite},
+		Sensitive:  true,
+		Idempotent: true,
+		Request:    schema.Transaction_CreateOpts{},
+		Response:   schema.Transaction_CreateResp{},
+		Status:     http.StatusCreated,
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusNotFound:            {"AccountNotFound"},
+			http.StatusConflict:            {"Conflict"},
+			http.StatusUnprocessableEntity: {"InsufficientBalance"},
+		}),
+	}
+	registerDoc = &RouteDoc{
+		Summary:  "Register a user",
+		Tags:     []string{"users"},
+		Public:   true,
+		Secret:   true,
+		Request:  schema.User_RegisterOpts{},
+		Response: schema.User_Get{},
+		Status:   http.StatusCreated,
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusConflict: {"EmailTaken"},
+		}),
+	}
+	loginDoc = &RouteDoc{
+		Summary:  "Log in with an email and a password",
+		Tags:     []string{"users"},
+		Public:   true,
+		Secret:   true,
+		Request:  schema.User_LoginOpts{},
+		Response: schema.User_TokenResp{},
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusUnauthorized: {"InvalidCredentials"},
+		}),
+	}
+	refreshDoc = &RouteDoc{
+		Summary:  "Exchange a refresh token for new tokens",
+		Tags:     []string{"users"},
+		Public:   true,
+		Secret:   true,
+		Request:  schema.User_RefreshOpts{},
+		Response: schema.User_TokenResp{},
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusUnauthorized: {"InvalidRefreshToken"},
+		}),
+	}
+	logoutDoc = &RouteDoc{
+		Summary: "Revoke the session of a refresh token",
+		Tags:    []string{"users"},
+		Public:  true,
+		Secret:  true,
+		Request: schema.User_LogoutOpts{},
+		Errors:  refreshDoc.Errors,
+	}
+	stepUpDoc = &RouteDoc{
+		Summary:  "Verify the second factor for a token allowed on the sensitive routes",
+		Tags:     []string{"users"},
+		Secret:   true,
+		Request:  schema.TOTP_VerifyOpts{},
+		Response: schema.TOTP_StepUpResp{},
+		Errors:   totpErrors,
+	}
+	enrollTOTPDoc = &RouteDoc{
+		Summary:  "Enroll a TOTP second factor",
+		Tags:     []string{"users"},
+		Secret:   true,
+		Response: schema.TOTP_EnrollResp{},
+		Status:   http.StatusCreated,
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusNotFound: {"UserNotFound"},
+			http.StatusConflict: {"TOTPAlreadyEnabled"},
+		}),
+	}
+	confirmTOTPDoc = &RouteDoc{
+		Summary: "Confirm the enrollment of the second factor with a first code",
+		Tags:    []string{"users"},
+		Secret:  true,
+		Request: schema.TOTP_ConfirmOpts{},
+		Errors:  totpErrors,
+	}
+	getCurrentUserDoc = &RouteDoc{
+		Summary:  "Get the user of the bearer token",
+		Tags:     []string{"users"},
+		Response: schema.User_Get{},
+		Errors: withServiceErrors(map[int][]string{
+			http.StatusNotFound: {"UserNotFound"},
+		}),
+	}
 )
 
 func (r *Router) RegisterRoutes() {
-	r.App.Get("/metrics", monitor.New(monitor.Config{Refresh: time.Second * 10}))
-	r.App.Get("/", r.HelloWorldHandler)
-	r.App.Get("/internal-error", r.InternalServerHandler)
-	r.App.Get("/bad-request", r.BadRequestHandler)
-	r.App.Get("/bad-request-2", r.BadRequestWithSentryWarningHandler)
-	r.App.Get("/bad-request-3", r.BadRequestWithSentryWarningInsideServiceHandler)
-	r.App.Post("/insert", r.InsertOneHandler)
+	r.handle(r.App, http.MethodGet, "/", r.HelloWorldHandler, helloWorldDoc)
+	r.handle(r.App, http.MethodPost, "/insert", r.InsertOneHandler, insertOneDoc)
+
+	r.App.Use(APIPrefix, r.versionNegotiation())
+
+	v1 := r.Version("v1")
+	r.handle(v1, http.MethodPost, "/accounts", r.CreateAccountHandler, createAccountDoc)
+	r.handle(v1, http.MethodGet, "/accounts/:id", r.GetAccountHandler, getAccountDoc)
+	r.handle(v1, http.MethodGet, "/accounts/:id/transactions", r.GetAccountTransactionsHandler, getAccountTransactionsDoc)
+	r.handle(v1, http.MethodPost, "/transfers", r.CreateTransferHandler, createTransferDoc)
+	r.registerUserRoutes(v1)
+
+	// v2 embeds the transactions in the account
+	v2 := r.Version("v2")
+	r.handle(v2, http.MethodPost, "/accounts", r.CreateAccountHandler, createAccountDoc)
+	r.handle(v2, http.MethodGet, "/accounts/:id", r.GetAccountWithTransactionsHandler, getAccountWithTransactionsDoc)
+	r.handle(v2, http.MethodGet, "/accounts/:id/transactions", r.GetAccountTransactionsHandler, getAccountTransactionsDoc)
+	r.handle(v2, http.MethodPost, "/transfers", r.CreateTransferHandler, createTransferDoc)
+	r.registerUserRoutes(v2)
+
+	// the document covers the routes registered above, keep the api routes above these
+	r.App.Get(OpenAPIRoute, r.OpenAPIHandler(r.OpenAPI()))
+	r.App.Get(DocsRoute, r.DocsHandler)
+}
+
+// registerUserRoutes serves the routes of the users when they can log in.
+func (r *Router) registerUserRoutes(router fiber.Router) {
+	if r.UserService == nil {
+		return
+	}
+	r.handle(router, http.MethodPost, "/auth/register", r.RegisterHandler, registerDoc)
+	r.handle(router, http.MethodPost, "/auth/login", r.LoginHandler, loginDoc)
+	r.handle(router, http.MethodPost, "/auth/refresh", r.RefreshHandler, refreshDoc)
+	r.handle(router, http.MethodPost, "/auth/logout", r.LogoutHandler, logoutDoc)
+	r.handle(router, http.MethodPost, "/auth/step-up", r.StepUpHandler, stepUpDoc)
+	r.handle(router, http.MethodGet, "/users/me", r.GetCurrentUserHandler, getCurrentUserDoc)
+	r.handle(router, http.MethodPost, "/users/me/totp", r.EnrollTOTPHandler, enrollTOTPDoc)
+	r.handle(router, http.MethodPost, "/users/me/totp/confirm", r.ConfirmTOTPHandler, confirmTOTPDoc)
 }
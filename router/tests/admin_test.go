@@ -0,0 +1,422 @@
+package router_test
+
+import (
+	"context"
+	"errors"
+	"go-app/internals/config"
+	"go-app/internals/health"
+	"go-app/internals/logger"
+	"go-app/internals/metrics"
+	"go-app/router"
+	"go-app/schema"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminRouter_BadRequestHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	type fields struct {
+		App    *fiber.App
+		Logger *zerolog.Logger
+		Config *config.AdminConfig
+	}
+
+	type args struct {
+		c *fiber.Ctx
+	}
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		body          io.Reader
+		fields        fields
+		args          args
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "Test Success",
+			url:    "/bad-request",
+			method: http.MethodGet,
+			body:   nil,
+			fields: fields{
+				App:    tri.App,
+				Logger: tri.Logger,
+				Config: tri.AdminConfig,
+			},
+			args: args{
+				c: &fiber.Ctx{},
+			},
+			prepare: func(tt *TC) {},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"success":false,"error":[{"code":"BadRequest","msg":"request failed"}]}`, string(data))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &router.AdminRouter{
+				App:         tt.fields.App,
+				Logger:      tt.fields.Logger,
+				Config:      tt.fields.Config,
+				DemoService: tri.demoService,
+			}
+			r.RegisterRoutes()
+			tt.prepare(&tt)
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Set("Authorization", "Bearer "+tri.AdminConfig.AuthToken)
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
+
+func TestAdminRouter_InternalServerHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	type fields struct {
+		App    *fiber.App
+		Logger *zerolog.Logger
+		Config *config.AdminConfig
+	}
+
+	type args struct {
+		c *fiber.Ctx
+	}
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		body          io.Reader
+		fields        fields
+		args          args
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "Test Success",
+			url:    "/internal-error",
+			method: http.MethodGet,
+			body:   nil,
+			fields: fields{
+				App:    tri.App,
+				Logger: tri.Logger,
+				Config: tri.AdminConfig,
+			},
+			args: args{
+				c: &fiber.Ctx{},
+			},
+			prepare: func(tt *TC) {},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				// the panic is rendered by the error handler, its details are not sent
+				assertBody(t, resp, http.StatusInternalServerError, `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}],"request_id":"test-request-id"}`)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &router.AdminRouter{
+				App:         tt.fields.App,
+				Logger:      tt.fields.Logger,
+				Config:      tt.fields.Config,
+				DemoService: tri.demoService,
+			}
+			r.App.Use(requestid.New(requestid.Config{ContextKey: schema.RequestIDKey}))
+			r.App.Use(router.RecoverPanics(tt.fields.Logger))
+			r.RegisterRoutes()
+			tt.prepare(&tt)
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			req.Header.Set("Authorization", "Bearer "+tri.AdminConfig.AuthToken)
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
+
+func TestAdminRouter_Endpoints(t *testing.T) {
+
+	appConfig := config.GetTestConfigFromFile()
+	appConfig.MongoDBConfig.Password = "secret"
+
+	metricsRegistry := metrics.NewMetrics(&metrics.MetricsOpts{Config: appConfig.MetricsConfig})
+	// checks describes the state of the health checks of a subtest.
+	type checks struct {
+		ready bool
+		// closed fails the service check, as it does once the services are closed during a graceful shutdown
+		closed          bool
+		dbErr, cacheErr error
+		dbDelay         time.Duration
+	}
+	// newAdminRouter registers checks reading only their own copy of the state, a timed out check
+	// goroutine abandoned by an earlier subtest never races the next one
+	newAdminRouter := func(c checks) *router.AdminRouter {
+		h := health.NewHealth(&health.HealthOpts{CheckTimeout: 50 * time.Millisecond})
+		h.Register(
+			&health.Check{Name: "process", Liveness: true, Critical: true, Func: func(ctx context.Context) error { return nil }},
+			&health.Check{Name: "service", Critical: true, Func: func(ctx context.Context) error {
+				if c.closed {
+					return errors.New("services are closed")
+				}
+				return nil
+			}},
+			&health.Check{Name: "db", Critical: true, Func: func(ctx context.Context) error {
+				select {
+				case <-time.After(c.dbDelay):
+					return c.dbErr
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}},
+			&health.Check{Name: "cache", Func: func(ctx context.Context) error { return c.cacheErr }},
+		)
+		h.SetReady(c.ready)
+		return router.NewAdminRouter(&router.AdminRouterOpts{
+			AbstractLogger: &logger.ApplicationLogger{},
+			Config:         appConfig.AdminConfig,
+			AppConfig:      appConfig,
+			Health:         h,
+			Metrics:        metricsRegistry,
+		})
+	}
+	report := func(resp *http.Response) *health.Report {
+		var got struct {
+			Success bool           `json:"success"`
+			Payload *health.Report `json:"payload"`
+		}
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+		assert.Equal(t, got.Success, got.Payload.OK())
+		return got.Payload
+	}
+	token := "Bearer " + appConfig.AdminConfig.AuthToken
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		body          io.Reader
+		auth          string
+		checks        checks
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "not ready while starting",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, health.StatusFail, r.Status)
+				assert.Equal(t, health.ErrNotReady.Error(), r.Error)
+			},
+		},
+		{
+			name:   "liveness only runs liveness checks",
+			url:    "/livez",
+			method: http.MethodGet,
+			checks: checks{dbErr: errors.New("connection refused")},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, health.StatusOK, r.Status)
+				assert.Len(t, r.Checks, 1)
+				assert.Equal(t, "process", r.Checks[0].Name)
+			},
+		},
+		{
+			name:   "liveness passes while shutting down",
+			url:    "/livez",
+			method: http.MethodGet,
+			checks: checks{closed: true},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, health.StatusOK, report(resp).Status)
+			},
+		},
+		{
+			name:   "critical check fails readiness",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checks: checks{ready: true, dbErr: errors.New("connection refused")},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, health.StatusFail, r.Status)
+				assert.Len(t, r.Checks, 4)
+				assert.Equal(t, "db", r.Checks[1].Name)
+				assert.Equal(t, "connection refused", r.Checks[1].Error)
+			},
+		},
+		{
+			name:   "check timeout fails readiness",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checks: checks{ready: true, dbDelay: time.Second},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, health.StatusFail, r.Checks[1].Status)
+				assert.Contains(t, r.Checks[1].Error, "timed out")
+			},
+		},
+		{
+			name:   "non critical check degrades readiness",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checks: checks{ready: true, cacheErr: errors.New("cache unavailable")},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, health.StatusDegraded, r.Status)
+				assert.Equal(t, health.StatusFail, r.Checks[0].Status)
+				assert.Equal(t, health.StatusOK, r.Checks[1].Status)
+			},
+		},
+		{
+			name:   "closed services fail readiness",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checks: checks{ready: true, closed: true},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				r := report(resp)
+				assert.Equal(t, "service", r.Checks[3].Name)
+				assert.Equal(t, health.StatusFail, r.Checks[3].Status)
+			},
+		},
+		{
+			name:   "not ready while shutting down",
+			url:    "/readyz",
+			method: http.MethodGet,
+			checks: checks{ready: false},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			},
+		},
+		{
+			name:   "missing token",
+			url:    "/metrics",
+			method: http.MethodGet,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"success":false,"error":[{"code":"Unauthorized","msg":"missing or invalid admin token"}],"request_id":"test-request-id"}`, string(data))
+			},
+		},
+		{
+			name:   "invalid token",
+			url:    "/debug/pprof/",
+			method: http.MethodGet,
+			auth:   "Bearer wrong",
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			},
+		},
+		{
+			name:   "prometheus exposition",
+			url:    "/metrics",
+			method: http.MethodGet,
+			auth:   token,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Contains(t, string(data), "# TYPE go_goroutines gauge")
+			},
+		},
+		{
+			name:   "pprof",
+			url:    "/debug/pprof/",
+			method: http.MethodGet,
+			auth:   token,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			name:   "config is redacted",
+			url:    "/config",
+			method: http.MethodGet,
+			auth:   token,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				var got struct {
+					Payload map[string]map[string]interface{} `json:"payload"`
+				}
+				assert.Nil(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, "******", got.Payload["mongo_db_config"]["password"])
+				assert.Equal(t, "******", got.Payload["admin_config"]["auth_token"])
+				assert.Equal(t, appConfig.MongoDBConfig.Host, got.Payload["mongo_db_config"]["host"])
+			},
+		},
+		{
+			name:   "update log level",
+			url:    "/log-level",
+			method: http.MethodPut,
+			body:   strings.NewReader(`{"level":"warn"}`),
+			auth:   token,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel())
+			},
+		},
+		{
+			name:   "invalid log level",
+			url:    "/log-level",
+			method: http.MethodPut,
+			body:   strings.NewReader(`{"level":"verbose"}`),
+			auth:   token,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel())
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAdminRouter(tt.checks)
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			req.Header.Add("Content-Type", "application/json")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := a.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
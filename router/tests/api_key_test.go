@@ -0,0 +1,173 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRouter_APIKey(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	apiKeysOnly := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		APIKeyService:  tri.apiKeyService,
+	})
+	j, err := auth.NewJWT(&auth.JWTOpts{Config: &config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "secret"}})
+	assert.Nil(t, err)
+	withJWT := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		APIKeyService:  tri.apiKeyService,
+		JWT:            j,
+	})
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	const accountURL = "/api/v1/accounts/6602ef6e0dc2f69705594eb3"
+	reader := &schema.APIKey_Get{ID: oid, Name: "billing", Scopes: []string{schema.ScopeAccountsRead}}
+
+	type TC struct {
+		name          string
+		router        *router.Router
+		method        string
+		url           string
+		body          io.Reader
+		key           string
+		ctx           context.Context
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "key with the scope of the route",
+			router: apiKeysOnly,
+			method: http.MethodGet,
+			url:    accountURL,
+			key:    "gak_key",
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(reader, nil).Times(1)
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, opts *schema.Account_GetOpts) (*schema.Account_GetResp, error) {
+					tt.ctx = ctx
+					return &schema.Account_GetResp{ID: oid}, nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				key, ok := tt.ctx.Value(schema.APIKeyKey).(*schema.APIKey_Get)
+				if assert.True(t, ok) {
+					assert.Equal(t, "billing", key.Name)
+				}
+			},
+		},
+		{
+			name:   "key without the scope of the route",
+			router: apiKeysOnly,
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(`{}`),
+			key:    "gak_key",
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(reader, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusForbidden, `{"success":false,"error":[{"code":"Forbidden","msg":"api key is missing the scope transfers:write"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "expired key",
+			router: apiKeysOnly,
+			method: http.MethodGet,
+			url:    accountURL,
+			key:    "gak_key",
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(nil, service.ErrAPIKeyExpired).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, `APIKey realm="api"`, resp.Header.Get("WWW-Authenticate"))
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"api key is expired"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "failed lookup",
+			router: apiKeysOnly,
+			method: http.MethodGet,
+			url:    accountURL,
+			key:    "gak_key",
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(nil, errors.New("connection reset")).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusInternalServerError, `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "missing key",
+			router: apiKeysOnly,
+			method: http.MethodGet,
+			url:    accountURL,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"missing api key"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "bearer token is required without key",
+			router: withJWT,
+			method: http.MethodGet,
+			url:    accountURL,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"missing bearer token"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "key instead of bearer token",
+			router: withJWT,
+			method: http.MethodGet,
+			url:    accountURL,
+			key:    "gak_key",
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(reader, nil).Times(1)
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Return(&schema.Account_GetResp{ID: oid}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			if tt.key != "" {
+				req.Header.Set(router.HeaderAPIKey, tt.key)
+			}
+			resp, err := tt.router.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package router_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/router"
+	"go-app/schema"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return s
+}
+
+func TestRouter_JWT(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.Nil(t, err)
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	coord := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "es-1", "use": "sig", "crv": "P-256", "x": coord(ecKey.X.FillBytes(make([]byte, 32))), "y": coord(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "RSA", "kid": "rs-1", "use": "sig", "n": coord(rsaKey.N.Bytes()), "e": "AQAB"},
+	}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	newRouter := func(c *config.JWTConfig) *router.Router {
+		c.Issuer, c.Audience, c.ClockSkew = "go-app", "go-app", 30*time.Second
+		j, err := auth.NewJWT(&auth.JWTOpts{Config: c})
+		assert.Nil(t, err)
+		return router.NewRouter(&router.RouterOpts{
+			AbstractLogger: &logger.ApplicationLogger{},
+			DemoService:    tri.demoService,
+			RouterConfig:   tri.Config,
+			JWT:            j,
+		})
+	}
+	hs := newRouter(&config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "secret"})
+	rs := newRouter(&config.JWTConfig{Algorithm: auth.AlgorithmRS256, PublicKey: rsaPEM})
+	es := newRouter(&config.JWTConfig{Algorithm: auth.AlgorithmES256, JWKSFile: jwksFile})
+
+	now := time.Now()
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": "go-app", "aud": "go-app", "sub": "user-1", "roles": []string{"customer"}, "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+	hsToken := func(overrides jwt.MapClaims) string {
+		return signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", claims(overrides))
+	}
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	const accountURL = "/api/v1/accounts/6602ef6e0dc2f69705594eb3"
+
+	type TC struct {
+		name          string
+		router        *router.Router
+		url           string
+		token         string
+		ctx           context.Context
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	authorized := func(tt *TC) {
+		tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, opts *schema.Account_GetOpts) (*schema.Account_GetResp, error) {
+			tt.ctx = ctx
+			return &schema.Account_GetResp{ID: oid}, nil
+		}).Times(1)
+	}
+	rejected := func(msg string) func(tt *TC, resp *http.Response) {
+		return func(tt *TC, resp *http.Response) {
+			assert.Contains(t, resp.Header.Get("WWW-Authenticate"), `Bearer realm="api"`)
+			assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"`+msg+`"}],"request_id":"test-request-id"}`)
+		}
+	}
+
+	tests := []TC{
+		{
+			name:    "HS256 token",
+			router:  hs,
+			url:     accountURL,
+			token:   hsToken(jwt.MapClaims{"aud": []string{"other", "go-app"}}),
+			prepare: authorized,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				c, ok := schema.ClaimsFromContext(tt.ctx)
+				if assert.True(t, ok) {
+					assert.Equal(t, "user-1", c.Subject)
+					assert.Equal(t, []string{"customer"}, c.Roles)
+					assert.Equal(t, schema.Audience{"other", "go-app"}, c.Audience)
+				}
+			},
+		},
+		{
+			name:    "RS256 token",
+			router:  rs,
+			url:     accountURL,
+			token:   signToken(t, jwt.SigningMethodRS256, rsaKey, "", claims(nil)),
+			prepare: authorized,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			name:    "ES256 token verified by the key of its kid",
+			router:  es,
+			url:     accountURL,
+			token:   signToken(t, jwt.SigningMethodES256, ecKey, "es-1", claims(nil)),
+			prepare: authorized,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			name:          "unknown kid",
+			router:        es,
+			url:           accountURL,
+			token:         signToken(t, jwt.SigningMethodES256, ecKey, "es-2", claims(nil)),
+			checkResponse: rejected("invalid token"),
+		},
+		{
+			name:          "algorithm not configured",
+			router:        rs,
+			url:           accountURL,
+			token:         hsToken(nil),
+			checkResponse: rejected("invalid token"),
+		},
+		{
+			name:          "invalid signature",
+			router:        hs,
+			url:           accountURL,
+			token:         signToken(t, jwt.SigningMethodHS256, []byte("other"), "", claims(nil)),
+			checkResponse: rejected("invalid token"),
+		},
+		{
+			name:          "missing token",
+			router:        hs,
+			url:           accountURL,
+			checkResponse: rejected("missing bearer token"),
+		},
+		{
+			name:          "expired token",
+			router:        hs,
+			url:           accountURL,
+			token:         hsToken(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}),
+			checkResponse: rejected("token is expired"),
+		},
+		{
+			name:    "expired within the clock skew",
+			router:  hs,
+			url:     accountURL,
+			token:   hsToken(jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()}),
+			prepare: authorized,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			name:          "token without expiry",
+			router:        hs,
+			url:           accountURL,
+			token:         hsToken(jwt.MapClaims{"exp": nil}),
+			checkResponse: rejected("token is expired"),
+		},
+		{
+			name:          "not valid yet",
+			router:        hs,
+			url:           accountURL,
+			token:         hsToken(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}),
+			checkResponse: rejected("token is not valid yet"),
+		},
+		{
+			name:          "wrong issuer",
+			router:        hs,
+			url:           accountURL,
+			token:         hsToken(jwt.MapClaims{"iss": "someone-else"}),
+			checkResponse: rejected("token issuer is not accepted"),
+		},
+		{
+			name:          "wrong audience",
+			router:        hs,
+			url:           accountURL,
+			token:         hsToken(jwt.MapClaims{"aud": "someone-else"}),
+			checkResponse: rejected("token audience is not accepted"),
+		},
+		{
+			name:   "public route",
+			router: hs,
+			url:    "/",
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().DemoFunc(gomock.Any()).DoAndReturn(func(ctx context.Context) string {
+					tt.ctx = ctx
+					return "test"
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				_, ok := schema.ClaimsFromContext(tt.ctx)
+				assert.False(t, ok)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := tt.router.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"go-app/internals/mongodb"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type bankTC struct {
+	name          string
+	url           string
+	method        string
+	body          io.Reader
+	prepare       func(tt *bankTC)
+	checkResponse func(tt *bankTC, resp *http.Response)
+}
+
+func runBankTests(t *testing.T, tri *TestRouter, tests []bankTC) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &router.Router{
+				App:         tri.App,
+				Logger:      tri.Logger,
+				Config:      tri.Config,
+				DemoService: tri.demoService,
+				Validator:   router.NewValidator(),
+			}
+			r.RegisterRoutes()
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Add("Content-Type", "application/json")
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
+
+func assertBody(t *testing.T, resp *http.Response, status int, body string) {
+	assert.Equal(t, status, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.JSONEq(t, body, string(data))
+}
+
+func TestRouter_CreateAccountHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	createdAt := time.Date(2024, 3, 26, 10, 0, 0, 0, time.UTC)
+
+	tests := []bankTC{
+		{
+			name:   "success",
+			url:    "/api/v1/accounts",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"account_holder_name":"Jane Doe"}`),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().
+					Account_Create(gomock.Any(), &schema.Account_CreateOpts{AccountHolderName: "Jane Doe"}).
+					Return(&schema.Account_CreateResp{ID: oid, UniqueAccountID: "acc-1", AccountHolderName: "Jane Doe", CreatedAt: createdAt}, nil).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusCreated, `{"success":true,"payload":{"id":"6602ef6e0dc2f69705594eb3","account_id":"acc-1","account_holder_name":"Jane Doe","balance":0,"created_at":"2024-03-26T10:00:00Z"}}`)
+			},
+		},
+		{
+			name:   "validation error",
+			url:    "/api/v1/accounts",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"account_holder_name":""}`),
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"ValidationErr","msg":"account_holder_name is a required field","field":"account_holder_name"}]}`)
+			},
+		},
+		{
+			name:   "unknown field",
+			url:    "/api/v1/accounts",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"account_holder_name":"Jane Doe","balance":100}`),
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"StatusBadRequest","msg":"Request body contains unknown field \"balance\""}]}`)
+			},
+		},
+		{
+			name:   "service error",
+			url:    "/api/v1/accounts",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"account_holder_name":"Jane Doe"}`),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().Account_Create(gomock.Any(), gomock.Any()).Return(nil, errors.New("failed to create account")).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusInternalServerError, `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}]}`)
+			},
+		},
+	}
+	runBankTests(t, tri, tests)
+}
+
+func TestRouter_GetAccountHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+
+	tests := []bankTC{
+		{
+			name:   "success",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().
+					GetAccount(gomock.Any(), &schema.Account_GetOpts{ID: oid}).
+					Return(&schema.Account_GetResp{ID: oid, UniqueAccountID: "acc-1", AccountHolderName: "Jane Doe", Balance: 25}, nil).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":{"id":"6602ef6e0dc2f69705594eb3","account_id":"acc-1","account_holder_name":"Jane Doe","balance":25}}`)
+			},
+		},
+		{
+			name:   "invalid id",
+			url:    "/api/v1/accounts/not-an-id",
+			method: http.MethodGet,
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"ValidationErr","msg":"id must be a valid id","field":"id"}]}`)
+			},
+		},
+		{
+			name:   "not found",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Return(nil, service.ErrAccountNotFound).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusNotFound, `{"success":false,"error":[{"code":"AccountNotFound","msg":"account not found"}]}`)
+			},
+		},
+		{
+			name:   "account of another user",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).
+					Return(nil, service.ErrForbidden.WithMessage(service.ActionAccountRead+" is not allowed")).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusForbidden, `{"success":false,"error":[{"code":"Forbidden","msg":"account:read is not allowed"}]}`)
+			},
+		},
+		{
+			name:   "timeout",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).
+					Return(nil, &mongodb.TimeoutError{Op: "findOne", Class: mongodb.ReadOperation, Err: context.DeadlineExceeded}).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusGatewayTimeout, `{"success":false,"error":[{"code":"Timeout","msg":"the request timed out"}]}`)
+			},
+		},
+	}
+	runBankTests(t, tri, tests)
+}
+
+func TestRouter_GetAccountTransactionsHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	debit, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb4")
+	createdAt := time.Date(2024, 3, 26, 10, 0, 0, 0, time.UTC)
+
+	tests := []bankTC{
+		{
+			name:   "success",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3/transactions",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().
+					GetAccountDetailWithTransactions(gomock.Any(), &schema.AccountTransaction_GetOpts{ID: oid}).
+					Return(&schema.Account_Get{ID: oid, Transactions: []schema.Transaction_Get{{TransactionID: "t-1", CreditAccountID: oid, DebitAccountID: debit, Type: "credit", Amount: 10, ClosingBalance: 15, CreatedAt: createdAt}}}, nil).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":[{"transaction_id":"t-1","credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb4","type":"credit","amount":10,"closing_balance":15,"created_at":"2024-03-26T10:00:00Z"}]}`)
+			},
+		},
+		{
+			name:   "no transactions",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3/transactions",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().GetAccountDetailWithTransactions(gomock.Any(), gomock.Any()).Return(&schema.Account_Get{ID: oid}, nil).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":[]}`)
+			},
+		},
+		{
+			name:   "invalid id",
+			url:    "/api/v1/accounts/1234/transactions",
+			method: http.MethodGet,
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"ValidationErr","msg":"id must be a valid id","field":"id"}]}`)
+			},
+		},
+		{
+			name:   "not found",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3/transactions",
+			method: http.MethodGet,
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().GetAccountDetailWithTransactions(gomock.Any(), gomock.Any()).Return(nil, service.ErrAccountNotFound).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusNotFound, `{"success":false,"error":[{"code":"AccountNotFound","msg":"account not found"}]}`)
+			},
+		},
+	}
+	runBankTests(t, tri, tests)
+}
+
+func TestRouter_CreateTransferHandler(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	credit, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	debit, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb4")
+	body := `{"credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb4","amount":10}`
+
+	tests := []bankTC{
+		{
+			name:   "success",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(body),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().
+					Transaction_Create(gomock.Any(), &schema.Transaction_CreateOpts{CreditAccountID: credit, DebitAccountID: debit, Amount: 10}).
+					DoAndReturn(func(ctx context.Context, opts *schema.Transaction_CreateOpts) error {
+						opts.TransactionID = "t-1"
+						return nil
+					}).
+					Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusCreated, `{"success":true,"payload":{"transaction_id":"t-1"}}`)
+			},
+		},
+		{
+			name:   "malformed account id",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"credit_account_id":"1234","debit_account_id":"6602ef6e0dc2f69705594eb4","amount":10}`),
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Contains(t, string(data), `"code":"StatusBadRequest"`)
+			},
+		},
+		{
+			name:   "validation errors",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{"credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb3","amount":-1}`),
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[`+
+					`{"code":"ValidationErr","msg":"amount must be greater than 0","field":"amount"},`+
+					`{"code":"ValidationErr","msg":"debit_account_id must be different from credit_account_id","field":"debit_account_id"}]}`)
+			},
+		},
+		{
+			name:   "missing fields",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{}`),
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[`+
+					`{"code":"ValidationErr","msg":"credit_account_id is a required field","field":"credit_account_id"},`+
+					`{"code":"ValidationErr","msg":"debit_account_id is a required field","field":"debit_account_id"},`+
+					`{"code":"ValidationErr","msg":"amount is a required field","field":"amount"}]}`)
+			},
+		},
+		{
+			name:   "credit account not found",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(body),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(service.ErrInvalidCreditAccount).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusNotFound, `{"success":false,"error":[{"code":"AccountNotFound","msg":"credit account not found","field":"credit_account_id"}]}`)
+			},
+		},
+		{
+			name:   "insufficient balance",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(body),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(service.ErrInsufficientBalance).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnprocessableEntity, `{"success":false,"error":[{"code":"InsufficientBalance","msg":"insufficient balance"}]}`)
+			},
+		},
+		{
+			name:   "conflict",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(body),
+			prepare: func(tt *bankTC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(errors.Wrap(service.ErrVersionConflict, "retries exhausted")).Times(1)
+			},
+			checkResponse: func(tt *bankTC, resp *http.Response) {
+				assertBody(t, resp, http.StatusConflict, `{"success":false,"error":[{"code":"Conflict","msg":"the account was modified concurrently, retry the request"}]}`)
+			},
+		},
+	}
+	runBankTests(t, tri, tests)
+}
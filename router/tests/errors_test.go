@@ -0,0 +1,146 @@
+package router_test
+
+import (
+	"go-app/internals/mongodb"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorHandler(t *testing.T) {
+
+	app := fiber.New(router.NewFiberConfig(nil))
+	app.Use(requestid.New(requestid.Config{ContextKey: schema.RequestIDKey}))
+	app.Use(router.RecoverPanics(&zerolog.Logger{}))
+
+	type TC struct {
+		name    string
+		method  string
+		url     string
+		handler fiber.Handler
+		status  int
+		body    string
+	}
+
+	tests := []TC{
+		{
+			name: "error of the catalog",
+			url:  "/catalog",
+			handler: func(c *fiber.Ctx) error {
+				return errors.Wrap(service.ErrInsufficientBalance, "failed to transfer")
+			},
+			status: http.StatusUnprocessableEntity,
+			body:   `{"success":false,"error":[{"code":"InsufficientBalance","msg":"insufficient balance"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "error of the catalog with a field",
+			url:  "/field",
+			handler: func(c *fiber.Ctx) error {
+				return service.ErrInvalidCreditAccount.Wrap(errors.New("connection reset"))
+			},
+			status: http.StatusNotFound,
+			body:   `{"success":false,"error":[{"code":"AccountNotFound","msg":"credit account not found","field":"credit_account_id"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "timeout",
+			url:  "/timeout",
+			handler: func(c *fiber.Ctx) error {
+				return errors.Wrap(mongodb.ErrTimeout, "failed to get account")
+			},
+			status: http.StatusGatewayTimeout,
+			body:   `{"success":false,"error":[{"code":"Timeout","msg":"the request timed out"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "unknown error",
+			url:  "/unknown",
+			handler: func(c *fiber.Ctx) error {
+				return errors.New("connection reset by 10.0.0.1")
+			},
+			status: http.StatusInternalServerError,
+			body:   `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "validation error",
+			url:  "/validation",
+			handler: func(c *fiber.Ctx) error {
+				return router.ErrorResp{ErrCode: "ValidationErr", ErrMsg: "id must be a valid id", ErrField: "id"}
+			},
+			status: http.StatusBadRequest,
+			body:   `{"success":false,"error":[{"code":"ValidationErr","msg":"id must be a valid id","field":"id"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "validation errors",
+			url:  "/validations",
+			handler: func(c *fiber.Ctx) error {
+				return router.ValidationErrs{
+					{ErrCode: "ValidationErr", ErrMsg: "name is a required field", ErrField: "name"},
+					{ErrCode: "ValidationErr", ErrMsg: "email must be a valid email address", ErrField: "email"},
+				}
+			},
+			status: http.StatusBadRequest,
+			body:   `{"success":false,"error":[{"code":"ValidationErr","msg":"name is a required field","field":"name"},{"code":"ValidationErr","msg":"email must be a valid email address","field":"email"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "decode error",
+			url:  "/decode",
+			handler: func(c *fiber.Ctx) error {
+				return router.NewErr("StatusRequestEntityTooLarge", "Request body must not be larger than 16 bytes")
+			},
+			status: http.StatusRequestEntityTooLarge,
+			body:   `{"success":false,"error":[{"code":"StatusRequestEntityTooLarge","msg":"Request body must not be larger than 16 bytes"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name: "panic",
+			url:  "/panic",
+			handler: func(c *fiber.Ctx) error {
+				var x []string
+				return c.SendString(x[0])
+			},
+			status: http.StatusInternalServerError,
+			body:   `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name:   "unknown route",
+			url:    "/missing",
+			status: http.StatusNotFound,
+			body:   `{"success":false,"error":[{"code":"NotFound","msg":"Cannot GET /missing"}],"request_id":"test-request-id"}`,
+		},
+		{
+			name:   "fiber error",
+			method: http.MethodPost,
+			url:    "/conflict",
+			handler: func(c *fiber.Ctx) error {
+				return fiber.NewError(fiber.StatusConflict, "resource is locked")
+			},
+			status: http.StatusConflict,
+			body:   `{"success":false,"error":[{"code":"Conflict","msg":"resource is locked"}],"request_id":"test-request-id"}`,
+		},
+	}
+	for i := range tests {
+		if tests[i].method == "" {
+			tests[i].method = http.MethodGet
+		}
+		if tests[i].handler != nil {
+			app.Add(tests[i].method, tests[i].url, tests[i].handler)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assertBody(t, resp, tt.status, tt.body)
+		})
+	}
+}
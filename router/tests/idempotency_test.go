@@ -0,0 +1,260 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/internals/mongodb"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRouter_Idempotency(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	cfg := *tri.Config
+	cfg.Idempotency = &config.IdempotencyConfig{Enabled: true}
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger:   &logger.ApplicationLogger{},
+		DemoService:      tri.demoService,
+		RouterConfig:     &cfg,
+		IdempotencyStore: tri.idempotency,
+	})
+
+	const transferBody = `{"credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb4","amount":10}`
+	const created = `{"success":true,"payload":{"transaction_id":""}}`
+	// the requests come from the ip of the test requests
+	const key = "ip:0.0.0.0:9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10"
+	const timeoutBody = `{"success":false,"error":[{"code":"Timeout","msg":"the request timed out"}],"request_id":"test-request-id"}`
+	// timedOut is the response stored for the request which timed out
+	var timedOut *schema.IdempotentResponse
+
+	type TC struct {
+		name          string
+		url           string
+		body          string
+		key           string
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name: "request without key",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusCreated, created)
+			},
+		},
+		{
+			name: "first request",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				var fingerprint string
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string) (*schema.IdempotentResponse, error) {
+					fingerprint = fp
+					return nil, nil
+				}).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				tri.idempotency.EXPECT().Complete(gomock.Any(), key, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string, resp *schema.IdempotentResponse) error {
+					assert.Equal(t, fingerprint, fp)
+					assert.Equal(t, http.StatusCreated, resp.Status)
+					assert.Equal(t, fiber.MIMEApplicationJSON, resp.ContentType)
+					assert.JSONEq(t, created, string(resp.Body))
+					return nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Empty(t, resp.Header.Get(router.HeaderIdempotentReplayed))
+				assertBody(t, resp, http.StatusCreated, created)
+			},
+		},
+		{
+			name: "retry is replayed",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				stored := &schema.IdempotentResponse{Status: http.StatusCreated, ContentType: fiber.MIMEApplicationJSON, Body: []byte(created)}
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(stored, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "true", resp.Header.Get(router.HeaderIdempotentReplayed))
+				assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get(fiber.HeaderContentType))
+				assertBody(t, resp, http.StatusCreated, created)
+			},
+		},
+		{
+			name: "key of another request",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, service.ErrIdempotencyKeyMismatch).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusConflict, `{"success":false,"error":[{"code":"IdempotencyKeyMismatch","msg":"idempotency key was used for another request"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name: "request in progress",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, service.ErrIdempotencyKeyInUse).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "1", resp.Header.Get(fiber.HeaderRetryAfter))
+				assertBody(t, resp, http.StatusConflict, `{"success":false,"error":[{"code":"IdempotencyKeyInUse","msg":"a request with the idempotency key is in progress"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name: "aborted request releases the key",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				aborted := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{"TransientTransactionError"}}
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, nil).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(service.ErrInternal.Wrap(aborted)).Times(1)
+				tri.idempotency.EXPECT().Release(gomock.Any(), key, gomock.Any()).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusInternalServerError, `{"success":false,"error":[{"code":"InternalServerErr","msg":"oops something went wrong"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name: "request failing with an unknown commit result is stored",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				unknown := mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired", Labels: []string{"TransientTransactionError", "UnknownTransactionCommitResult"}}
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, nil).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(errors.Wrap(unknown, "failed to commit")).Times(1)
+				tri.idempotency.EXPECT().Complete(gomock.Any(), key, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string, resp *schema.IdempotentResponse) error {
+					assert.Equal(t, http.StatusGatewayTimeout, resp.Status)
+					return nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+			},
+		},
+		{
+			name: "timed out request is stored",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, nil).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(service.ErrTimeout.Wrap(mongodb.ErrTimeout)).Times(1)
+				tri.idempotency.EXPECT().Complete(gomock.Any(), key, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string, resp *schema.IdempotentResponse) error {
+					timedOut = resp
+					return nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusGatewayTimeout, timeoutBody)
+			},
+		},
+		{
+			name: "retry after a timeout is replayed without transferring again",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				// the transfer of the timed out request may have been committed, it is not run again
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string) (*schema.IdempotentResponse, error) {
+					return timedOut, nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "true", resp.Header.Get(router.HeaderIdempotentReplayed))
+				assertBody(t, resp, http.StatusGatewayTimeout, timeoutBody)
+			},
+		},
+		{
+			name: "rejected request is stored",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				tri.idempotency.EXPECT().Begin(gomock.Any(), key, gomock.Any()).Return(nil, nil).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(service.ErrInsufficientBalance).Times(1)
+				tri.idempotency.EXPECT().Complete(gomock.Any(), key, gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, key, fp string, resp *schema.IdempotentResponse) error {
+					assert.Equal(t, http.StatusUnprocessableEntity, resp.Status)
+					return nil
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+			},
+		},
+		{
+			name: "key too long",
+			url:  "/api/v1/transfers",
+			body: transferBody,
+			key:  strings.Repeat("k", 256),
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"ValidationErr","msg":"Idempotency-Key must not be longer than 255 characters","field":"Idempotency-Key"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name: "route without idempotency",
+			url:  "/api/v1/accounts/6602ef6e0dc2f69705594eb3/transactions",
+			key:  "9f1c7c1e-7d0a-4c35-9b39-7b0e3c3b2a10",
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccountDetailWithTransactions(gomock.Any(), gomock.Any()).Return(&schema.Account_Get{}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			method := http.MethodPost
+			var body io.Reader
+			if tt.body == "" {
+				method = http.MethodGet
+			} else {
+				body = bytes.NewBufferString(tt.body)
+			}
+			req, err := http.NewRequest(method, tt.url, body)
+			assert.Nil(t, err)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			if tt.key != "" {
+				req.Header.Set(router.HeaderIdempotencyKey, tt.key)
+			}
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
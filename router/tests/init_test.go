@@ -3,6 +3,7 @@ package router_test
 import (
 	"go-app/internals/config"
 	"go-app/mock"
+	"go-app/router"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
@@ -10,12 +11,20 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// testRequestID is the id of the test requests sending it, the errors rendered by the ErrorHandler carry it.
+const testRequestID = "test-request-id"
+
 type TestRouter struct {
 	*fiber.App
-	Logger      *zerolog.Logger
-	Config      *config.RouterConfig
-	Ctrl        *gomock.Controller
-	demoService *mock.MockDemoService
+	Logger        *zerolog.Logger
+	Config        *config.RouterConfig
+	AdminConfig   *config.AdminConfig
+	MetricsConfig *config.MetricsConfig
+	Ctrl          *gomock.Controller
+	demoService   *mock.MockDemoService
+	apiKeyService *mock.MockAPIKeyService
+	userService   *mock.MockUserService
+	idempotency   *mock.MockIdempotencyStore
 }
 
 func (ts *TestRouter) Clean() {
@@ -25,11 +34,16 @@ func (ts *TestRouter) Clean() {
 func NewRouterTest(t *testing.T) *TestRouter {
 	ctrl := gomock.NewController(t)
 	r := TestRouter{
-		App:    fiber.New(fiber.Config{}),
+		App:    fiber.New(router.NewFiberConfig(nil)),
 		Logger: &zerolog.Logger{},
 		Config: config.GetTestConfigFromFile().RouterConfig,
 		Ctrl:   gomock.NewController(t),
 	}
+	r.AdminConfig = config.GetTestConfigFromFile().AdminConfig
+	r.MetricsConfig = config.GetTestConfigFromFile().MetricsConfig
 	r.demoService = mock.NewMockDemoService(ctrl)
+	r.apiKeyService = mock.NewMockAPIKeyService(ctrl)
+	r.userService = mock.NewMockUserService(ctrl)
+	r.idempotency = mock.NewMockIdempotencyStore(ctrl)
 	return &r
 }
@@ -0,0 +1,95 @@
+package router_test
+
+import (
+	"go-app/internals/logger"
+	"go-app/internals/metrics"
+	"go-app/router"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_Metrics(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	m := metrics.NewMetrics(&metrics.MetricsOpts{Config: tri.MetricsConfig})
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		Metrics:        m,
+	})
+	exposition := fiber.New()
+	exposition.Get("/metrics", m.Handler())
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "matched route",
+			url:    "/",
+			method: http.MethodGet,
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().DemoFunc(gomock.Any()).Return("test").Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+		},
+		{
+			name:   "unmatched route",
+			url:    "/does-not-exist/1234",
+			method: http.MethodGet,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+			},
+		},
+		{
+			name:   "route with error",
+			url:    "/insert",
+			method: http.MethodPost,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			assert.Nil(t, err)
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	assert.Nil(t, err)
+	resp, err := exposition.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	body := string(data)
+	assert.Contains(t, body, `go_app_http_requests_total{method="GET",route="/",status="200"} 1`)
+	assert.Contains(t, body, `go_app_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `go_app_http_requests_total{method="POST",route="/insert",status="400"} 1`)
+	assert.Contains(t, body, `go_app_http_request_duration_seconds_bucket{method="GET",route="/",status="200",le="+Inf"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
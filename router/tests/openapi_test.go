@@ -0,0 +1,127 @@
+package router_test
+
+import (
+	"encoding/json"
+	"flag"
+	"go-app/internals/logger"
+	"go-app/router"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the tests")
+
+const openAPIGoldenFile = "testdata/openapi.json"
+
+func TestRouter_OpenAPI(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		UserService:    tri.userService,
+	})
+
+	type TC struct {
+		name          string
+		url           string
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name: "openapi document",
+			url:  router.OpenAPIRoute,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+				var doc map[string]interface{}
+				assert.Nil(t, json.NewDecoder(resp.Body).Decode(&doc))
+				assert.Equal(t, "3.0.3", doc["openapi"])
+
+				paths := doc["paths"].(map[string]interface{})
+				get := paths["/api/v1/accounts/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+				param := get["parameters"].([]interface{})[0].(map[string]interface{})
+				assert.Equal(t, "id", param["name"])
+				assert.Equal(t, "path", param["in"])
+				assert.Equal(t, true, param["required"])
+				assert.Contains(t, get["responses"], "404")
+
+				schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+				// the constraints come from the validate tags
+				transfer := schemas["Transaction_CreateOpts"].(map[string]interface{})
+				assert.Equal(t, []interface{}{"credit_account_id", "debit_account_id", "amount"}, transfer["required"])
+				assert.NotContains(t, transfer["properties"], "TransactionID")
+				amount := transfer["properties"].(map[string]interface{})["amount"].(map[string]interface{})
+				assert.Equal(t, map[string]interface{}{"type": "number", "format": "float", "minimum": float64(0), "exclusiveMinimum": true}, amount)
+				name := schemas["InsertOneOpts"].(map[string]interface{})["properties"].(map[string]interface{})["name"].(map[string]interface{})
+				assert.Equal(t, map[string]interface{}{"type": "string", "maxLength": float64(12), "not": map[string]interface{}{"enum": []interface{}{"LoremIpsumLoremIpsum"}}}, name)
+			},
+		},
+		{
+			name: "docs ui",
+			url:  router.DocsRoute,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+				body, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Contains(t, string(body), `fetch("openapi.json")`)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			assert.Nil(t, err)
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
+
+// TestRouter_OpenAPIDrift fails when a route is not documented or when the document differs from the committed one.
+// Run go test ./router/tests -run TestRouter_OpenAPIDrift -update to accept the changes of the document.
+func TestRouter_OpenAPIDrift(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		UserService:    tri.userService,
+	})
+	doc := r.OpenAPI()
+
+	for _, route := range r.App.GetRoutes(true) {
+		if route.Method == http.MethodHead || route.Path == router.OpenAPIRoute || route.Path == router.DocsRoute {
+			continue
+		}
+		item, ok := doc.Paths[router.OpenAPIPath(route.Path)]
+		if !assert.True(t, ok, "route %s %s is not documented", route.Method, route.Path) {
+			continue
+		}
+		assert.Contains(t, *item, strings.ToLower(route.Method), "route %s %s is not documented", route.Method, route.Path)
+	}
+
+	got, err := json.MarshalIndent(doc, "", "    ")
+	assert.Nil(t, err)
+	if *update {
+		assert.Nil(t, os.WriteFile(openAPIGoldenFile, append(got, '\n'), 0o644))
+	}
+	want, err := os.ReadFile(openAPIGoldenFile)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(want), string(got), "the OpenAPI document changed, run the test with -update to accept it")
+}
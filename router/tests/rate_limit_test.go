@@ -0,0 +1,143 @@
+package router_test
+
+import (
+	"bytes"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRouter_RateLimit(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	cfg := *tri.Config
+	cfg.RateLimit = &config.RateLimitConfig{
+		Enabled: true,
+		IP:      &config.RateLimitRule{Limit: 4, Period: time.Minute},
+		APIKey:  &config.RateLimitRule{Limit: 3, Period: time.Minute},
+		Routes: []*config.RouteRateLimitConfig{
+			{Method: "post", Route: "/transfers", RateLimitRule: config.RateLimitRule{Limit: 1, Period: time.Minute}},
+		},
+	}
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   &cfg,
+		APIKeyService:  tri.apiKeyService,
+		RateLimitStore: service.NewMemoryRateLimitStore(&service.MemoryRateLimitStoreOpts{}),
+	})
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	key := &schema.APIKey_Get{ID: oid, Scopes: schema.Scopes}
+	tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(key, nil).AnyTimes()
+	const transferBody = `{"credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb4","amount":10}`
+
+	type TC struct {
+		name          string
+		method        string
+		url           string
+		body          io.Reader
+		header        map[string]string
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	assertLimit := func(resp *http.Response, limit, remaining, reset string) {
+		assert.Equal(t, limit, resp.Header.Get(router.HeaderRateLimitLimit))
+		assert.Equal(t, remaining, resp.Header.Get(router.HeaderRateLimitRemaining))
+		assert.Equal(t, reset, resp.Header.Get(router.HeaderRateLimitReset))
+	}
+
+	// the requests come from the same ip, each of them takes a token of the ip
+	tests := []TC{
+		{
+			name:   "transfer",
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				// the limit of the route is the most restrictive one
+				assertLimit(resp, "1", "0", "60")
+			},
+		},
+		{
+			name:   "transfer of another api version shares the limit of the route",
+			method: http.MethodPost,
+			url:    "/api/v2/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "60", resp.Header.Get(fiber.HeaderRetryAfter))
+				assertLimit(resp, "1", "0", "60")
+				assertBody(t, resp, http.StatusTooManyRequests, `{"success":false,"error":[{"code":"TooManyRequests","msg":"rate limit exceeded, retry in 60 seconds"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "read of the api key",
+			method: http.MethodGet,
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Return(&schema.Account_GetResp{ID: oid}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assertLimit(resp, "3", "0", "60")
+			},
+		},
+		{
+			name:   "api key over its limit",
+			method: http.MethodGet,
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "20", resp.Header.Get(fiber.HeaderRetryAfter))
+				assertBody(t, resp, http.StatusTooManyRequests, `{"success":false,"error":[{"code":"TooManyRequests","msg":"rate limit exceeded, retry in 20 seconds"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "ip over its limit",
+			method: http.MethodGet,
+			url:    "/",
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertLimit(resp, "4", "0", "60")
+				assertBody(t, resp, http.StatusTooManyRequests, `{"success":false,"error":[{"code":"TooManyRequests","msg":"rate limit exceeded, retry in 15 seconds"}],"request_id":"test-request-id"}`)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			req.Header.Add("Content-Type", "application/json")
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
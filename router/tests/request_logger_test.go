@@ -0,0 +1,187 @@
+package router_test
+
+import (
+	"bytes"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRequestLogger(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	var logs bytes.Buffer
+	l := zerolog.New(&logs)
+	app := fiber.New(router.NewFiberConfig(nil))
+	app.Use(router.RequestLogger(&l))
+	j, err := auth.NewJWT(&auth.JWTOpts{Config: &config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "secret"}})
+	assert.Nil(t, err)
+	r := &router.Router{
+		App:           app,
+		Logger:        &zerolog.Logger{},
+		Validator:     router.NewValidator(),
+		JWT:           j,
+		APIKeyService: tri.apiKeyService,
+		DemoService:   tri.demoService,
+		UserService:   tri.userService,
+	}
+	r.RegisterRoutes()
+
+	oid := primitive.NewObjectID()
+	userToken := signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{"sub": oid.Hex(), "exp": time.Now().Add(time.Minute).Unix()})
+	tokens := &schema.User_TokenResp{AccessToken: "issued-access-token", TokenType: schema.TokenTypeBearer, ExpiresIn: 900, RefreshToken: "issued-refresh-token", RefreshExpiresIn: 3600}
+
+	type TC struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		header  map[string]string
+		prepare func(tt *TC)
+		status  int
+		// secrets must not be logged, logged must be
+		secrets []string
+		logged  []string
+	}
+
+	tests := []TC{
+		{
+			name:   "register",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/register",
+			body:   `{"email":"jane@example.com","password":"correct horse battery"}`,
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Register(gomock.Any(), gomock.Any()).Return(&schema.User_Get{ID: oid, Email: "jane@example.com"}, nil).Times(1)
+			},
+			status:  http.StatusCreated,
+			secrets: []string{"correct horse battery"},
+			logged:  []string{"/api/v1/auth/register"},
+		},
+		{
+			name:   "login",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/login",
+			body:   `{"email":"jane@example.com","password":"correct horse battery"}`,
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Login(gomock.Any(), gomock.Any()).Return(tokens, nil).Times(1)
+			},
+			status:  http.StatusOK,
+			secrets: []string{"correct horse battery", "issued-access-token", "issued-refresh-token"},
+			logged:  []string{"/api/v1/auth/login"},
+		},
+		{
+			name:    "login rejected before the handler",
+			method:  http.MethodPost,
+			url:     "/api/v1/auth/login",
+			body:    `{"password":"correct horse battery","extra":true}`,
+			status:  http.StatusBadRequest,
+			secrets: []string{"correct horse battery"},
+		},
+		{
+			name:   "refresh",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/refresh",
+			body:   `{"refresh_token":"presented-refresh-token"}`,
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Refresh(gomock.Any(), gomock.Any()).Return(tokens, nil).Times(1)
+			},
+			status:  http.StatusOK,
+			secrets: []string{"presented-refresh-token", "issued-access-token", "issued-refresh-token"},
+		},
+		{
+			name:   "bearer token",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			header: map[string]string{fiber.HeaderAuthorization: "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().GetUser(gomock.Any(), oid).Return(&schema.User_Get{ID: oid, Email: "jane@example.com"}, nil).Times(1)
+			},
+			status:  http.StatusOK,
+			secrets: []string{userToken},
+			// the bodies of the other routes are still logged
+			logged: []string{"[REDACTED]", "jane@example.com"},
+		},
+		{
+			name:   "api key",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			header: map[string]string{router.HeaderAPIKey: "gak_leaked_key"},
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_leaked_key").Return(nil, service.ErrInvalidAPIKey).Times(1)
+			},
+			status:  http.StatusUnauthorized,
+			secrets: []string{"gak_leaked_key"},
+			logged:  []string{"[REDACTED]"},
+		},
+		{
+			name:   "enroll totp",
+			method: http.MethodPost,
+			url:    "/api/v1/users/me/totp",
+			header: map[string]string{fiber.HeaderAuthorization: "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().EnrollTOTP(gomock.Any(), oid).
+					Return(&schema.TOTP_EnrollResp{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/go-app:jane?secret=JBSWY3DPEHPK3PXP", RecoveryCodes: []string{"aaaa-bbbb-cccc-dddd"}}, nil).Times(1)
+			},
+			status:  http.StatusCreated,
+			secrets: []string{userToken, "JBSWY3DPEHPK3PXP", "aaaa-bbbb-cccc-dddd"},
+		},
+		{
+			name:   "step-up",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/step-up",
+			body:   `{"recovery_code":"eeee-ffff-gggg-hhhh"}`,
+			header: map[string]string{fiber.HeaderAuthorization: "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().StepUp(gomock.Any(), gomock.Any()).
+					Return(&schema.TOTP_StepUpResp{AccessToken: "step-up-access-token", TokenType: schema.TokenTypeBearer, ExpiresIn: 300}, nil).Times(1)
+			},
+			status:  http.StatusOK,
+			secrets: []string{userToken, "eeee-ffff-gggg-hhhh", "step-up-access-token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			logs.Reset()
+			var body io.Reader
+			if tt.body != "" {
+				body = bytes.NewBufferString(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, body)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+
+			assert.NotEmpty(t, logs.String())
+			for _, s := range tt.secrets {
+				assert.NotContains(t, logs.String(), s)
+			}
+			for _, s := range tt.logged {
+				assert.Contains(t, logs.String(), s)
+			}
+		})
+	}
+}
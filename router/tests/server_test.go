@@ -0,0 +1,489 @@
+package router_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go-app/internals/config"
+	"go-app/internals/health"
+	"go-app/internals/ws"
+	"go-app/router"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (tc *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key}
+}
+
+func (tc *testCert) writePEM(t *testing.T, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(tc.key)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw}), 0600))
+}
+
+// newTestCert issues a certificate for cn, self signed when parent is nil.
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"divv"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestFiberServer_TLS(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, "test-ca", 1, nil)
+	newTestCert(t, "127.0.0.1", 2, ca).writePEM(t, certFile, keyFile)
+	assert.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+	client := newTestCert(t, "teller-01", 3, ca)
+	untrusted := newTestCert(t, "intruder", 4, newTestCert(t, "other-ca", 5, nil))
+
+	app := fiber.New()
+	app.Get("/whoami", func(c *fiber.Ctx) error {
+		subject, ok := router.ClientCertSubject(c)
+		if !ok {
+			return c.SendStatus(http.StatusUnauthorized)
+		}
+		return c.SendString(subject.CommonName)
+	})
+	port := freePort(t)
+	server := ws.NewWebServer(&ws.FiberServerOpts{
+		FiberApp: app,
+		Logger:   &zerolog.Logger{},
+		Config: &config.WebServerConfig{
+			Host:            "127.0.0.1",
+			Port:            port,
+			ShutdownTimeout: time.Second,
+			TLSConfig: &config.TLSConfig{
+				Enabled:            true,
+				CertFile:           certFile,
+				KeyFile:            keyFile,
+				MinVersion:         "1.2",
+				ClientCAFile:       caFile,
+				ClientCertOptional: true,
+			},
+		},
+	})
+	assert.Nil(t, server.Start())
+	defer server.Close()
+	assert.Eventually(t, server.Ready, time.Second, 10*time.Millisecond)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	url := fmt.Sprintf("https://127.0.0.1:%d/whoami", port)
+
+	do := func(cert *testCert) (*http.Response, error) {
+		tc := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			// always present the certificate, even when the server does not list its issuer as acceptable
+			tc.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				c := cert.tlsCertificate()
+				return &c, nil
+			}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tc, DisableKeepAlives: true}}
+		return c.Get(url)
+	}
+
+	type TC struct {
+		name     string
+		prepare  func(tt *TC)
+		cert     *testCert
+		validate func(tt *TC, resp *http.Response, err error)
+	}
+
+	tests := []TC{
+		{
+			name: "verified client certificate subject is exposed",
+			cert: client,
+			validate: func(tt *TC, resp *http.Response, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Equal(t, "teller-01", string(data))
+				assert.EqualValues(t, 2, resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+			},
+		},
+		{
+			name: "missing client certificate is allowed when optional",
+			validate: func(tt *TC, resp *http.Response, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			},
+		},
+		{
+			name: "client certificate from unknown ca is rejected",
+			cert: untrusted,
+			validate: func(tt *TC, resp *http.Response, err error) {
+				assert.NotNil(t, err)
+			},
+		},
+		{
+			name: "server certificate is reloaded when the files change",
+			cert: client,
+			prepare: func(tt *TC) {
+				newTestCert(t, "127.0.0.1", 6, ca).writePEM(t, certFile, keyFile)
+				assert.Eventually(t, func() bool {
+					resp, err := do(client)
+					if err != nil {
+						return false
+					}
+					resp.Body.Close()
+					return resp.TLS.PeerCertificates[0].SerialNumber.Int64() == 6
+				}, 2*time.Second, 20*time.Millisecond)
+			},
+			validate: func(tt *TC, resp *http.Response, err error) {
+				assert.Nil(t, err)
+				assert.EqualValues(t, 6, resp.TLS.PeerCertificates[0].SerialNumber.Int64())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			resp, err := do(tt.cert)
+			tt.validate(&tt, resp, err)
+			if resp != nil {
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestFiberServer_Limits(t *testing.T) {
+
+	wsConfig := &config.WebServerConfig{
+		Host:            "127.0.0.1",
+		Port:            freePort(t),
+		ShutdownTimeout: time.Second,
+		BodyLimit:       16,
+		MaxHeaderSize:   2048,
+		ReadTimeout:     time.Second,
+	}
+	r := &router.Router{
+		App:       fiber.New(router.NewFiberConfig(wsConfig)),
+		Logger:    &zerolog.Logger{},
+		Validator: router.NewValidator(),
+	}
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+	r.DemoService = tri.demoService
+	r.RegisterRoutes()
+
+	server := ws.NewWebServer(&ws.FiberServerOpts{FiberApp: r.App, Logger: &zerolog.Logger{}, Config: wsConfig})
+	assert.Nil(t, server.Start())
+	defer server.Close()
+	assert.Eventually(t, server.Ready, time.Second, 10*time.Millisecond)
+
+	type TC struct {
+		name          string
+		body          string
+		header        string
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name: "body over limit",
+			body: `{"name":"LoremIpsumLoremIpsum"}`,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"success":false,"error":[{"code":"StatusRequestEntityTooLarge","msg":"Request body must not be larger than 16 bytes"}]}`, string(data))
+			},
+		},
+		{
+			name:   "headers over limit",
+			body:   `{}`,
+			header: strings.Repeat("a", 4096),
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.JSONEq(t, `{"success":false,"error":[{"code":"StatusRequestHeaderFieldsTooLarge","msg":"Request headers are too large"}]}`, string(data))
+			},
+		},
+		{
+			name: "body within limit",
+			body: `{"name":""}`,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/insert", wsConfig.Port), strings.NewReader(tt.body))
+			assert.Nil(t, err)
+			req.Header.Add("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Add("X-Padding", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			assert.Nil(t, err)
+			defer resp.Body.Close()
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
+
+func TestFiberServer_Shutdown(t *testing.T) {
+
+	// newServer starts a server whose /slow handler blocks until release is closed
+	newServer := func(t *testing.T, wsConfig *config.WebServerConfig, h health.Health) (ws.Server, *sync.WaitGroup, chan struct{}, chan struct{}) {
+		entered, release := make(chan struct{}, 10), make(chan struct{})
+		app := fiber.New()
+		app.Get("/slow", func(c *fiber.Ctx) error {
+			entered <- struct{}{}
+			<-release
+			return c.SendStatus(http.StatusOK)
+		})
+		wsConfig.Host, wsConfig.Port = "127.0.0.1", freePort(t)
+		worker := &sync.WaitGroup{}
+		server := ws.NewWebServer(&ws.FiberServerOpts{FiberApp: app, Logger: &zerolog.Logger{}, Config: wsConfig, Worker: worker, Health: h})
+		assert.Nil(t, server.Start())
+		assert.True(t, server.Ready())
+		return server, worker, entered, release
+	}
+	get := func(wsConfig *config.WebServerConfig, path string) (int, error) {
+		c := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := c.Get(fmt.Sprintf("http://127.0.0.1:%d%s", wsConfig.Port, path))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	closeAsync := func(server ws.Server) (chan error, time.Time) {
+		closed := make(chan error, 1)
+		start := time.Now()
+		go func() { closed <- server.Close() }()
+		return closed, start
+	}
+
+	type TC struct {
+		name string
+		run  func(t *testing.T)
+	}
+
+	tests := []TC{
+		{
+			name: "readiness fails during the drain delay while requests are still served",
+			run: func(t *testing.T) {
+				wsConfig := &config.WebServerConfig{DrainDelay: 300 * time.Millisecond, ShutdownTimeout: time.Second}
+				server, worker, _, release := newServer(t, wsConfig, nil)
+				close(release)
+				status, err := get(wsConfig, ws.DefaultReadinessPath)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusOK, status)
+
+				closed, start := closeAsync(server)
+				assert.Eventually(t, func() bool { return !server.Ready() }, time.Second, 5*time.Millisecond)
+				status, err = get(wsConfig, ws.DefaultReadinessPath)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusServiceUnavailable, status)
+				status, err = get(wsConfig, "/slow")
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusOK, status)
+
+				assert.Nil(t, <-closed)
+				assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+				worker.Wait()
+				_, err = get(wsConfig, ws.DefaultReadinessPath)
+				assert.NotNil(t, err)
+			},
+		},
+		{
+			name: "in-flight requests are drained before closing",
+			run: func(t *testing.T) {
+				wsConfig := &config.WebServerConfig{ShutdownTimeout: 2 * time.Second}
+				server, worker, entered, release := newServer(t, wsConfig, nil)
+				done := make(chan int, 1)
+				go func() {
+					status, _ := get(wsConfig, "/slow")
+					done <- status
+				}()
+				<-entered
+
+				closed, _ := closeAsync(server)
+				select {
+				case <-closed:
+					t.Fatal("close returned before the in-flight request was drained")
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(release)
+				assert.Nil(t, <-closed)
+				assert.Equal(t, http.StatusOK, <-done)
+				worker.Wait()
+			},
+		},
+		{
+			name: "connections are force closed after the shutdown timeout",
+			run: func(t *testing.T) {
+				wsConfig := &config.WebServerConfig{ShutdownTimeout: 200 * time.Millisecond}
+				server, worker, entered, release := newServer(t, wsConfig, nil)
+				defer close(release)
+				done := make(chan error, 1)
+				go func() {
+					_, err := get(wsConfig, "/slow")
+					done <- err
+				}()
+				<-entered
+
+				closed, start := closeAsync(server)
+				select {
+				case err := <-closed:
+					assert.Nil(t, err)
+				case <-time.After(2 * time.Second):
+					t.Fatal("close did not force close the connections")
+				}
+				assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+				assert.NotNil(t, <-done)
+				worker.Wait()
+			},
+		},
+		{
+			name: "readiness follows the app health",
+			run: func(t *testing.T) {
+				var failing atomic.Bool
+				h := health.NewHealth(&health.HealthOpts{})
+				h.Register(&health.Check{Name: "db", Critical: true, Func: func(ctx context.Context) error {
+					if failing.Load() {
+						return errors.New("db is down")
+					}
+					return nil
+				}})
+				wsConfig := &config.WebServerConfig{ShutdownTimeout: time.Second}
+				server, _, _, release := newServer(t, wsConfig, h)
+				close(release)
+				defer server.Close()
+
+				// the app is not ready yet
+				status, err := get(wsConfig, ws.DefaultReadinessPath)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusServiceUnavailable, status)
+
+				h.SetReady(true)
+				status, err = get(wsConfig, ws.DefaultReadinessPath)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusOK, status)
+
+				failing.Store(true)
+				status, err = get(wsConfig, ws.DefaultReadinessPath)
+				assert.Nil(t, err)
+				assert.Equal(t, http.StatusServiceUnavailable, status)
+			},
+		},
+		{
+			name: "close before start",
+			run: func(t *testing.T) {
+				wsConfig := &config.WebServerConfig{Host: "127.0.0.1", Port: freePort(t)}
+				worker := &sync.WaitGroup{}
+				server := ws.NewWebServer(&ws.FiberServerOpts{FiberApp: fiber.New(), Logger: &zerolog.Logger{}, Config: wsConfig, Worker: worker})
+				assert.Nil(t, server.Close())
+				// a closed server does not start
+				assert.Nil(t, server.Start())
+				assert.False(t, server.Ready())
+				worker.Wait()
+				_, err := get(wsConfig, ws.DefaultReadinessPath)
+				assert.NotNil(t, err)
+			},
+		},
+		{
+			name: "address in use",
+			run: func(t *testing.T) {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				assert.Nil(t, err)
+				defer ln.Close()
+				wsConfig := &config.WebServerConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+				worker := &sync.WaitGroup{}
+				server := ws.NewWebServer(&ws.FiberServerOpts{FiberApp: fiber.New(), Logger: &zerolog.Logger{}, Config: wsConfig, Worker: worker})
+				assert.NotNil(t, server.Start())
+				assert.False(t, server.Ready())
+				worker.Wait()
+				assert.Nil(t, server.Close())
+			},
+		},
+		{
+			name: "missing tls certificate",
+			run: func(t *testing.T) {
+				dir := t.TempDir()
+				wsConfig := &config.WebServerConfig{Host: "127.0.0.1", Port: freePort(t), TLSConfig: &config.TLSConfig{
+					Enabled:  true,
+					CertFile: filepath.Join(dir, "missing.crt"),
+					KeyFile:  filepath.Join(dir, "missing.key"),
+				}}
+				server := ws.NewWebServer(&ws.FiberServerOpts{FiberApp: fiber.New(), Logger: &zerolog.Logger{}, Config: wsConfig, Worker: &sync.WaitGroup{}})
+				assert.NotNil(t, server.Start())
+				assert.False(t, server.Ready())
+				_, err := get(wsConfig, ws.DefaultReadinessPath)
+				assert.NotNil(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
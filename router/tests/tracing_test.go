@@ -0,0 +1,158 @@
+package router_test
+
+import (
+	"context"
+	"go-app/internals/logger"
+	"go-app/internals/tracing"
+	"go-app/router"
+	"go-app/schema"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttr(s tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestRouter_Tracing(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tr, err := tracing.NewTracing(&tracing.TracingOpts{Exporter: exporter})
+	assert.Nil(t, err)
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		Tracing:        tr,
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		header        http.Header
+		ctx           context.Context
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+		validate      func(tt *TC, span tracetest.SpanStub)
+	}
+
+	tests := []TC{
+		{
+			name:   "continues the trace of the caller",
+			url:    "/",
+			method: http.MethodGet,
+			header: http.Header{"Traceparent": {"00-" + traceID + "-" + parentID + "-01"}},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().DemoFunc(gomock.Any()).DoAndReturn(func(ctx context.Context) string {
+					tt.ctx = ctx
+					return "test"
+				}).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+			validate: func(tt *TC, span tracetest.SpanStub) {
+				assert.Equal(t, "GET /", span.Name)
+				assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+				assert.Equal(t, traceID, span.SpanContext.TraceID().String())
+				assert.Equal(t, parentID, span.Parent.SpanID().String())
+				assert.True(t, span.Parent.IsRemote())
+				status, ok := spanAttr(span, "http.response.status_code")
+				assert.True(t, ok)
+				assert.EqualValues(t, http.StatusOK, status.AsInt64())
+				route, _ := spanAttr(span, "http.route")
+				assert.Equal(t, "/", route.AsString())
+
+				// the service receives the context of the request span
+				sc := trace.SpanContextFromContext(tt.ctx)
+				assert.Equal(t, span.SpanContext.SpanID(), sc.SpanID())
+				assert.NotNil(t, tt.ctx.Value(schema.RequestIDKey))
+			},
+		},
+		{
+			name:   "starts a new trace",
+			url:    "/",
+			method: http.MethodGet,
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().DemoFunc(gomock.Any()).Return("test").Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			},
+			validate: func(tt *TC, span tracetest.SpanStub) {
+				assert.True(t, span.SpanContext.IsValid())
+				assert.False(t, span.Parent.IsValid())
+				assert.NotEqual(t, traceID, span.SpanContext.TraceID().String())
+			},
+		},
+		{
+			name:   "unmatched route",
+			url:    "/does-not-exist/1234",
+			method: http.MethodGet,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+			},
+			validate: func(tt *TC, span tracetest.SpanStub) {
+				assert.Equal(t, "GET", span.Name)
+				_, ok := spanAttr(span, "http.route")
+				assert.False(t, ok)
+				status, _ := spanAttr(span, "http.response.status_code")
+				assert.EqualValues(t, http.StatusNotFound, status.AsInt64())
+				assert.Equal(t, codes.Unset, span.Status.Code)
+			},
+		},
+		{
+			name:   "route with error",
+			url:    "/insert",
+			method: http.MethodPost,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			},
+			validate: func(tt *TC, span tracetest.SpanStub) {
+				assert.Equal(t, "POST /insert", span.Name)
+				status, _ := spanAttr(span, "http.response.status_code")
+				assert.EqualValues(t, http.StatusBadRequest, status.AsInt64())
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			assert.Nil(t, err)
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+
+			spans := exporter.GetSpans()
+			if assert.Len(t, spans, 1) {
+				tt.validate(&tt, spans[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package router_test
+
+import (
+	"bytes"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/router"
+	"go-app/schema"
+	"go-app/service"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRouter_Users(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	j, err := auth.NewJWT(&auth.JWTOpts{Config: &config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "secret"}})
+	assert.Nil(t, err)
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig:   tri.Config,
+		JWT:            j,
+		APIKeyService:  tri.apiKeyService,
+		UserService:    tri.userService,
+	})
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := &schema.User_Get{ID: oid, Email: "jane@example.com", Roles: []string{schema.RoleCustomer}, CreatedAt: createdAt}
+	const userJSON = `{"id":"6602ef6e0dc2f69705594eb3","email":"jane@example.com","roles":["customer"],"created_at":"2026-01-02T03:04:05Z"}`
+	tokens := &schema.User_TokenResp{AccessToken: "access", TokenType: schema.TokenTypeBearer, ExpiresIn: 900, RefreshToken: "refresh", RefreshExpiresIn: 3600}
+	const tokensJSON = `{"access_token":"access","token_type":"Bearer","expires_in":900,"refresh_token":"refresh","refresh_expires_in":3600}`
+	userToken := signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{"sub": oid.Hex(), "exp": time.Now().Add(time.Minute).Unix()})
+	stepUpToken := func(authTime time.Time, amr ...string) string {
+		return signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+			"sub": oid.Hex(), "exp": time.Now().Add(time.Minute).Unix(), "auth_time": authTime.Unix(), "amr": amr,
+		})
+	}
+	const transferBody = `{"credit_account_id":"6602ef6e0dc2f69705594eb3","debit_account_id":"6602ef6e0dc2f69705594eb4","amount":10}`
+	const stepUpChallenge = `Bearer realm="api", error="insufficient_user_authentication", error_description="a recent second factor is required", max_age=300`
+	const stepUpRequired = `{"success":false,"error":[{"code":"StepUpRequired","msg":"a recent second factor is required"}],"request_id":"test-request-id"}`
+
+	type TC struct {
+		name          string
+		method        string
+		url           string
+		body          io.Reader
+		header        map[string]string
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "register",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/register",
+			body:   bytes.NewBufferString(`{"email":"jane@example.com","password":"correct horse battery"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Register(gomock.Any(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"}).Return(user, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusCreated, `{"success":true,"payload":`+userJSON+`}`)
+			},
+		},
+		{
+			name:   "register with a short password",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/register",
+			body:   bytes.NewBufferString(`{"email":"jane@example.com","password":"short"}`),
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"ValidationErr","field":"password","msg":"password must be at least 12 characters in length"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "register a taken email",
+			method: http.MethodPost,
+			url:    "/api/v2/auth/register",
+			body:   bytes.NewBufferString(`{"email":"jane@example.com","password":"correct horse battery"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Register(gomock.Any(), gomock.Any()).Return(nil, service.ErrEmailTaken).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusConflict, `{"success":false,"error":[{"code":"EmailTaken","field":"email","msg":"email is already registered"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "login",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/login",
+			body:   bytes.NewBufferString(`{"email":"jane@example.com","password":"correct horse battery"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Login(gomock.Any(), &schema.User_LoginOpts{Email: "jane@example.com", Password: "correct horse battery"}).Return(tokens, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":`+tokensJSON+`}`)
+			},
+		},
+		{
+			name:   "login with a wrong password",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/login",
+			body:   bytes.NewBufferString(`{"email":"jane@example.com","password":"incorrect"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Login(gomock.Any(), gomock.Any()).Return(nil, service.ErrInvalidCredentials).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"InvalidCredentials","msg":"invalid email or password"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "refresh",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/refresh",
+			body:   bytes.NewBufferString(`{"refresh_token":"old"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Refresh(gomock.Any(), &schema.User_RefreshOpts{RefreshToken: "old"}).Return(tokens, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":`+tokensJSON+`}`)
+			},
+		},
+		{
+			name:   "refresh with a used token",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/refresh",
+			body:   bytes.NewBufferString(`{"refresh_token":"old"}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Refresh(gomock.Any(), gomock.Any()).Return(nil, service.ErrRefreshTokenReused).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"InvalidRefreshToken","msg":"refresh token was already used, the session is revoked"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "logout of every session",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/logout",
+			body:   bytes.NewBufferString(`{"refresh_token":"refresh","all":true}`),
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().Logout(gomock.Any(), &schema.User_LogoutOpts{RefreshToken: "refresh", All: true}).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusOK, `{"success":true}`)
+			},
+		},
+		{
+			name:   "current user",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().GetUser(gomock.Any(), oid).Return(user, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":`+userJSON+`}`)
+			},
+		},
+		{
+			name:   "current user of an api key",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").Return(&schema.APIKey_Get{ID: oid}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"missing bearer token"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "current user of another issuer",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			header: map[string]string{"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{"sub": "service-account", "exp": time.Now().Add(time.Minute).Unix()})},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusNotFound, `{"success":false,"error":[{"code":"UserNotFound","msg":"user not found"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "step-up with an invalid body",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/step-up",
+			body:   bytes.NewBufferString(`{"code":"123456","device":"phone"}`),
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusBadRequest, `{"success":false,"error":[{"code":"StatusBadRequest","msg":"Request body contains unknown field \"device\""}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "enroll totp",
+			method: http.MethodPost,
+			url:    "/api/v1/users/me/totp",
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().EnrollTOTP(gomock.Any(), oid).
+					Return(&schema.TOTP_EnrollResp{Secret: "SECRET", URI: "otpauth://totp/go-app:jane", RecoveryCodes: []string{"aaaa-bbbb-cccc-dddd"}}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+				assertBody(t, resp, http.StatusCreated, `{"success":true,"payload":{"secret":"SECRET","otpauth_uri":"otpauth://totp/go-app:jane","recovery_codes":["aaaa-bbbb-cccc-dddd"]}}`)
+			},
+		},
+		{
+			name:   "confirm totp with a wrong code",
+			method: http.MethodPost,
+			url:    "/api/v1/users/me/totp/confirm",
+			body:   bytes.NewBufferString(`{"code":"123456"}`),
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().ConfirmTOTP(gomock.Any(), &schema.TOTP_ConfirmOpts{UserID: oid, Code: "123456"}).Return(service.ErrInvalidTOTPCode).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnprocessableEntity, `{"success":false,"error":[{"code":"InvalidCode","msg":"invalid verification code"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "step-up without code",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/step-up",
+			body:   bytes.NewBufferString(`{}`),
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			},
+		},
+		{
+			name:   "step-up with a recovery code",
+			method: http.MethodPost,
+			url:    "/api/v1/auth/step-up",
+			body:   bytes.NewBufferString(`{"recovery_code":"aaaa-bbbb-cccc-dddd"}`),
+			header: map[string]string{"Authorization": "Bearer " + userToken},
+			prepare: func(tt *TC) {
+				tri.userService.EXPECT().StepUp(gomock.Any(), &schema.TOTP_VerifyOpts{UserID: oid, RecoveryCode: "aaaa-bbbb-cccc-dddd"}).
+					Return(&schema.TOTP_StepUpResp{AccessToken: "access", TokenType: schema.TokenTypeBearer, ExpiresIn: 900}, nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":{"access_token":"access","token_type":"Bearer","expires_in":900}}`)
+			},
+		},
+		{
+			name:   "transfer without second factor",
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{"Authorization": "Bearer " + stepUpToken(time.Now(), schema.AMRPassword)},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, stepUpChallenge, resp.Header.Get("WWW-Authenticate"))
+				assertBody(t, resp, http.StatusUnauthorized, stepUpRequired)
+			},
+		},
+		{
+			name:   "transfer with an old second factor",
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{"Authorization": "Bearer " + stepUpToken(time.Now().Add(-10*time.Minute), schema.AMRPassword, schema.AMROTP)},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, stepUpChallenge, resp.Header.Get("WWW-Authenticate"))
+				assertBody(t, resp, http.StatusUnauthorized, stepUpRequired)
+			},
+		},
+		{
+			name:   "transfer with a recent second factor",
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{"Authorization": "Bearer " + stepUpToken(time.Now(), schema.AMRPassword, schema.AMROTP)},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			},
+		},
+		{
+			name:   "transfer of an api key",
+			method: http.MethodPost,
+			url:    "/api/v1/transfers",
+			body:   bytes.NewBufferString(transferBody),
+			header: map[string]string{router.HeaderAPIKey: "gak_key"},
+			prepare: func(tt *TC) {
+				tri.apiKeyService.EXPECT().Authenticate(gomock.Any(), "gak_key").
+					Return(&schema.APIKey_Get{ID: oid, Scopes: []string{schema.ScopeTransfersWrite}}, nil).Times(1)
+				tri.demoService.EXPECT().Transaction_Create(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			},
+		},
+		{
+			name:   "current user without token",
+			method: http.MethodGet,
+			url:    "/api/v1/users/me",
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusUnauthorized, `{"success":false,"error":[{"code":"Unauthorized","msg":"missing bearer token"}],"request_id":"test-request-id"}`)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Add("Content-Type", "application/json")
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
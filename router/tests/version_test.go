@@ -0,0 +1,159 @@
+package router_test
+
+import (
+	"bytes"
+	"go-app/internals/config"
+	"go-app/internals/logger"
+	"go-app/router"
+	"go-app/schema"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRouter_Versions(t *testing.T) {
+
+	tri := NewRouterTest(t)
+	defer tri.Clean()
+
+	r := router.NewRouter(&router.RouterOpts{
+		AbstractLogger: &logger.ApplicationLogger{},
+		DemoService:    tri.demoService,
+		RouterConfig: &config.RouterConfig{
+			DefaultAPIVersion: "v1",
+			Deprecations: []*config.DeprecationConfig{
+				{Version: "v1", Sunset: "2028-01-01"},
+				{Version: "v1", Method: "GET", Route: "/accounts/:id", DeprecatedAt: "2026-09-01", Sunset: "2027-03-01T00:00:00Z", Link: "https://example.com/migrate"},
+			},
+		},
+	})
+
+	oid, _ := primitive.ObjectIDFromHex("6602ef6e0dc2f69705594eb3")
+	account := func() *schema.Account_Get {
+		return &schema.Account_Get{ID: oid, UniqueAccountID: "acc-1", AccountHolderName: "Jane Doe", Balance: 25, Transactions: []schema.Transaction_Get{{TransactionID: "t-1"}}}
+	}
+	accountResp := func() *schema.Account_GetResp {
+		return &schema.Account_GetResp{ID: oid, UniqueAccountID: "acc-1", AccountHolderName: "Jane Doe", Balance: 25}
+	}
+
+	type TC struct {
+		name          string
+		url           string
+		method        string
+		body          io.Reader
+		header        http.Header
+		prepare       func(tt *TC)
+		checkResponse func(tt *TC, resp *http.Response)
+	}
+
+	tests := []TC{
+		{
+			name:   "default version",
+			url:    "/api/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Return(accountResp(), nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "v1", resp.Header.Get(router.HeaderAPIVersion))
+				assertBody(t, resp, http.StatusOK, `{"success":true,"payload":{"id":"6602ef6e0dc2f69705594eb3","account_id":"acc-1","account_holder_name":"Jane Doe","balance":25}}`)
+			},
+		},
+		{
+			name:   "negotiated version",
+			url:    "/api/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			header: http.Header{router.HeaderAcceptVersion: {"2"}},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccountDetailWithTransactions(gomock.Any(), gomock.Any()).Return(account(), nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, "v2", resp.Header.Get(router.HeaderAPIVersion))
+				assert.Equal(t, router.HeaderAcceptVersion, resp.Header.Get("Vary"))
+				assert.Empty(t, resp.Header.Get(router.HeaderDeprecation))
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				data, err := io.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Contains(t, string(data), `"balance":25,"transactions":[{"transaction_id":"t-1"`)
+			},
+		},
+		{
+			name:   "version in the path takes precedence",
+			url:    "/api/v2/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			header: http.Header{router.HeaderAcceptVersion: {"v1"}},
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccountDetailWithTransactions(gomock.Any(), gomock.Any()).Return(account(), nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "v2", resp.Header.Get(router.HeaderAPIVersion))
+			},
+		},
+		{
+			name:   "unsupported version",
+			url:    "/api/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			header: http.Header{router.HeaderAcceptVersion: {"v9"}},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assertBody(t, resp, http.StatusNotAcceptable, `{"success":false,"error":[{"code":"UnsupportedVersion","msg":"api version \"v9\" is not supported, supported versions are v1, v2"}],"request_id":"test-request-id"}`)
+			},
+		},
+		{
+			name:   "deprecated route",
+			url:    "/api/v1/accounts/6602ef6e0dc2f69705594eb3",
+			method: http.MethodGet,
+			prepare: func(tt *TC) {
+				tri.demoService.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Return(accountResp(), nil).Times(1)
+			},
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "@1788220800", resp.Header.Get(router.HeaderDeprecation))
+				assert.Equal(t, "Mon, 01 Mar 2027 00:00:00 GMT", resp.Header.Get(router.HeaderSunset))
+				assert.Equal(t, `<https://example.com/migrate>; rel="deprecation"; type="text/html"`, resp.Header.Get("Link"))
+			},
+		},
+		{
+			name:   "deprecated version",
+			url:    "/api/v1/transfers",
+			method: http.MethodPost,
+			body:   bytes.NewBufferString(`{}`),
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Empty(t, resp.Header.Get(router.HeaderDeprecation))
+				assert.Equal(t, "Sat, 01 Jan 2028 00:00:00 GMT", resp.Header.Get(router.HeaderSunset))
+			},
+		},
+		{
+			name:   "unknown route",
+			url:    "/api/v2/does-not-exist",
+			method: http.MethodGet,
+			checkResponse: func(tt *TC, resp *http.Response) {
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+				assert.Equal(t, "v2", resp.Header.Get(router.HeaderAPIVersion))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare(&tt)
+			}
+			req, err := http.NewRequest(tt.method, tt.url, tt.body)
+			assert.Nil(t, err)
+			req.Header.Set(fiber.HeaderXRequestID, testRequestID)
+			req.Header.Add("Content-Type", "application/json")
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := r.App.Test(req)
+			assert.Nil(t, err)
+			tt.checkResponse(&tt, resp)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"go-app/schema"
+	"go-app/service"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (r *Router) RegisterHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.User_RegisterOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	user, err := r.UserService.Register(ctx, s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(NewJSONResp(true, user))
+}
+
+func (r *Router) LoginHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.User_LoginOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	tokens, err := r.UserService.Login(ctx, s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	// the tokens must not be cached (RFC 6749 5.1)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(NewJSONResp(true, tokens))
+}
+
+func (r *Router) RefreshHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.User_RefreshOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	tokens, err := r.UserService.Refresh(ctx, s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(NewJSONResp(true, tokens))
+}
+
+func (r *Router) LogoutHandler(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	s := new(schema.User_LogoutOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	if err := r.UserService.Logout(ctx, s); err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.JSON(NewJSONResp(true, nil))
+}
+
+// currentUserID returns the user of the bearer token, or the error when there is none.
+// Requests authenticated by an api key have no user.
+func currentUserID(c *fiber.Ctx) (primitive.ObjectID, bool, error) {
+	claims, ok := schema.ClaimsFromContext(c.UserContext())
+	if !ok {
+		return primitive.NilObjectID, false, unauthorized(c, bearerChallenge("", ""), "missing bearer token")
+	}
+	// tokens of other issuers may have subjects which are not user ids
+	id, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return primitive.NilObjectID, false, service.ErrUserNotFound
+	}
+	return id, true, nil
+}
+
+func (r *Router) GetCurrentUserHandler(c *fiber.Ctx) error {
+	id, ok, err := currentUserID(c)
+	if !ok {
+		return err
+	}
+	user, err := r.UserService.GetUser(c.UserContext(), id)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.JSON(NewJSONResp(true, user))
+}
+
+func (r *Router) EnrollTOTPHandler(c *fiber.Ctx) error {
+	id, ok, err := currentUserID(c)
+	if !ok {
+		return err
+	}
+	resp, err := r.UserService.EnrollTOTP(c.UserContext(), id)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusCreated).JSON(NewJSONResp(true, resp))
+}
+
+func (r *Router) ConfirmTOTPHandler(c *fiber.Ctx) error {
+	id, ok, err := currentUserID(c)
+	if !ok {
+		return err
+	}
+	s := new(schema.TOTP_ConfirmOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	s.UserID = id
+	if err := r.UserService.ConfirmTOTP(c.UserContext(), s); err != nil {
+		return r.serviceErr(c, err)
+	}
+	return c.JSON(NewJSONResp(true, nil))
+}
+
+func (r *Router) StepUpHandler(c *fiber.Ctx) error {
+	id, ok, err := currentUserID(c)
+	if !ok {
+		return err
+	}
+	s := new(schema.TOTP_VerifyOpts)
+	if err := DecodeJSONBody(c, s); err != nil {
+		return err
+	}
+	if err := r.Validator.Validate(s); err != nil {
+		return ValidationErrs(err)
+	}
+	s.UserID = id
+	resp, err := r.UserService.StepUp(c.UserContext(), s)
+	if err != nil {
+		return r.serviceErr(c, err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(NewJSONResp(true, resp))
+}
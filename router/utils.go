@@ -2,13 +2,21 @@ package router
 
 import (
 	"bytes"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
+	"go-app/schema"
+	"go-app/service"
 	"io"
+	"net/http"
+	"runtime/debug"
 	"strings"
 
 	"github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ErrorResp struct {
@@ -21,10 +29,23 @@ func (er ErrorResp) Error() string {
 	return er.ErrMsg
 }
 
+// ValidationErrs are the errors of a request failing validation, the ErrorHandler renders them together.
+type ValidationErrs []ErrorResp
+
+func (ve ValidationErrs) Error() string {
+	msgs := make([]string, 0, len(ve))
+	for _, er := range ve {
+		msgs = append(msgs, er.ErrMsg)
+	}
+	return strings.Join(msgs, "; ")
+}
+
 type Response struct {
 	Success bool        `json:"success"`
 	Payload interface{} `json:"payload,omitempty"`
 	Error   []ErrorResp `json:"error,omitempty"`
+	// RequestID is set on the errors rendered by the ErrorHandler, it relates the response to the logs of the request.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func (r *Response) ToJSON() string {
@@ -53,12 +74,105 @@ func NewJSONResp(success bool, payload interface{}) *Response {
 	}
 }
 
+// ClientCertSubject returns the subject of the verified client certificate when the request came over mTLS.
+func ClientCertSubject(c *fiber.Ctx) (pkix.Name, bool) {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+	return state.VerifiedChains[0][0].Subject, true
+}
+
+// ErrorHandler renders every error returned by the handlers and the middlewares in the Response envelope, along with
+// the id of the request. This covers the panics turned into errors by the recover middleware and the errors raised by
+// fasthttp before a handler runs, such as oversized requests.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var resp *Response
+	status := fiber.StatusBadRequest
+	var ve ValidationErrs
+	if errors.As(err, &ve) {
+		resp = NewErrResponse(false, ve...)
+	} else {
+		var er ErrorResp
+		status, er = ErrResponse(c, err)
+		resp = NewErrResponse(false, er)
+	}
+	resp.RequestID, _ = c.Locals(schema.RequestIDKey).(string)
+	return c.Status(status).JSON(resp)
+}
+
+// RecoverPanics turns the panics of the handlers into errors, which the ErrorHandler renders as internal errors. The
+// panics are logged with their stack.
+func RecoverPanics(l *zerolog.Logger) fiber.Handler {
+	return recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, e interface{}) {
+			l.Error().Ctx(c.UserContext()).Str("stack", string(debug.Stack())).Msgf("panic: %v", e)
+		},
+	})
+}
+
+// ErrResponse maps an error to the response status and error.
+func ErrResponse(c *fiber.Ctx, err error) (int, ErrorResp) {
+	var er ErrorResp
+	if errors.As(err, &er) {
+		return DecodeErrStatus(er), er
+	}
+	var fe *fiber.Error
+	if !errors.As(err, &fe) {
+		return ServiceErrResponse(err)
+	}
+	switch fe.Code {
+	case fiber.StatusRequestEntityTooLarge:
+		msg := fmt.Sprintf("Request body must not be larger than %d bytes", c.App().Config().BodyLimit)
+		return fe.Code, NewErr("StatusRequestEntityTooLarge", msg)
+	case fiber.StatusRequestHeaderFieldsTooLarge:
+		return fe.Code, NewErr("StatusRequestHeaderFieldsTooLarge", "Request headers are too large")
+	case fiber.StatusInternalServerError:
+		// the message of an internal error may carry its details
+		return ServiceErrResponse(err)
+	default:
+		// e.g. NotFound or MethodNotAllowed
+		return fe.Code, NewErr(strings.ReplaceAll(http.StatusText(fe.Code), " ", ""), fe.Message)
+	}
+}
+
+// ServiceErrResponse maps an error returned by a service to the response status and error, see service.AsError.
+// Unknown errors are internal, their details are not sent to the client.
+func ServiceErrResponse(err error) (int, ErrorResp) {
+	e := service.AsError(err)
+	return e.Status, ErrorResp{ErrCode: e.Code, ErrMsg: e.Message, ErrField: e.Field}
+}
+
+// ParseObjectIDParam parses the route parameter name as an ObjectID.
+func ParseObjectIDParam(c *fiber.Ctx, name string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(c.Params(name))
+	if err != nil {
+		return primitive.NilObjectID, ErrorResp{ErrCode: "ValidationErr", ErrMsg: name + " must be a valid id", ErrField: name}
+	}
+	return id, nil
+}
+
+// DecodeErrStatus returns the response status for an error returned by DecodeJSONBody.
+func DecodeErrStatus(err ErrorResp) int {
+	if err.ErrCode == "StatusRequestEntityTooLarge" {
+		return fiber.StatusRequestEntityTooLarge
+	}
+	return fiber.StatusBadRequest
+}
+
 func DecodeJSONBody(c *fiber.Ctx, dst interface{}) error {
 	if c.Get("Content-Type") != "application/json" {
 		msg := "Content-Type header is not application/json"
 		return NewErr("StatusUnsupportedMediaType", msg)
 	}
 
+	// fasthttp rejects larger bodies while reading the request, this guards bodies which bypassed it (e.g. set by middlewares)
+	if limit := c.App().Config().BodyLimit; len(c.Body()) > limit {
+		msg := fmt.Sprintf("Request body must not be larger than %d bytes", limit)
+		return NewErr("StatusRequestEntityTooLarge", msg)
+	}
+
 	dec := json.NewDecoder(bytes.NewReader(c.Body()))
 	dec.DisallowUnknownFields()
 
@@ -95,12 +209,10 @@ func DecodeJSONBody(c *fiber.Ctx, dst interface{}) error {
 			msg := "Request body must not be empty"
 			return NewErr("StatusBadRequest", msg)
 
-		case err.Error() == "http: request body too large":
-			msg := "Request body must not be larger than 1MB"
-			return NewErr("StatusRequestEntityTooLarge", msg)
-
 		default:
-			return err
+			// e.g. values rejected by a json.Unmarshaler, such as a malformed ObjectID
+			msg := fmt.Sprintf("Request body contains an invalid value: %s", err.Error())
+			return NewErr("StatusBadRequest", msg)
 		}
 	}
 
@@ -0,0 +1,171 @@
+package router
+
+import (
+	"fmt"
+	"go-app/internals/config"
+	"go-app/service"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// APIPrefix is the prefix of the versioned api, e.g. /api/v1/accounts.
+	APIPrefix = "/api"
+
+	HeaderAcceptVersion = "Accept-Version"
+	// HeaderAPIVersion tells the client which version served the request.
+	HeaderAPIVersion  = "API-Version"
+	HeaderDeprecation = "Deprecation"
+	HeaderSunset      = "Sunset"
+)
+
+// APIVersions lists the served api versions, oldest first.
+var APIVersions = []string{"v1", "v2"}
+
+func isAPIVersion(v string) bool {
+	for _, av := range APIVersions {
+		if av == v {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeVersion accepts both "2" and "v2".
+func normalizeVersion(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	return v
+}
+
+// versionNegotiation routes the unversioned api paths, e.g. /api/accounts, to the version requested by the
+// Accept-Version header, or to the default version without it. A version in the path takes precedence.
+func (r *Router) versionNegotiation() fiber.Handler {
+	def := APIVersions[0]
+	if r.Config != nil && r.Config.DefaultAPIVersion != "" {
+		def = normalizeVersion(r.Config.DefaultAPIVersion)
+	}
+	return func(c *fiber.Ctx) error {
+		rest := strings.TrimPrefix(c.Path(), APIPrefix)
+		segment, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		if isAPIVersion(segment) {
+			c.Set(HeaderAPIVersion, segment)
+			return c.Next()
+		}
+
+		v := def
+		if h := c.Get(HeaderAcceptVersion); h != "" {
+			v = normalizeVersion(h)
+		}
+		if !isAPIVersion(v) {
+			msg := fmt.Sprintf("api version %q is not supported, supported versions are %s", v, strings.Join(APIVersions, ", "))
+			return service.ErrUnsupportedVersion.WithMessage(msg)
+		}
+		c.Set(HeaderAPIVersion, v)
+		c.Set(fiber.HeaderVary, HeaderAcceptVersion)
+		// the rewritten path is matched by the routes registered after this middleware
+		c.Path(APIPrefix + "/" + v + rest)
+		return c.Next()
+	}
+}
+
+// deprecation holds the rendered headers of a DeprecationConfig.
+type deprecation struct {
+	method      string
+	route       string
+	deprecation string
+	sunset      string
+	link        string
+}
+
+func (d *deprecation) matches(c *fiber.Ctx) bool {
+	if d.method != "" && d.method != c.Method() {
+		return false
+	}
+	return d.route == "" || d.route == c.Route().Path
+}
+
+// parseDeprecations renders the headers of the deprecations of version. Invalid dates are logged and left out.
+func (r *Router) parseDeprecations(version string) []*deprecation {
+	if r.Config == nil {
+		return nil
+	}
+	var ds []*deprecation
+	for _, dc := range r.Config.Deprecations {
+		if normalizeVersion(dc.Version) != version {
+			continue
+		}
+		d := deprecation{method: strings.ToUpper(dc.Method)}
+		if dc.Route != "" {
+			d.route = APIPrefix + "/" + version + dc.Route
+		}
+		if t, ok := r.parseDeprecationDate(dc, dc.DeprecatedAt); ok {
+			// RFC 9745 structured date
+			d.deprecation = fmt.Sprintf("@%d", t.Unix())
+		}
+		if t, ok := r.parseDeprecationDate(dc, dc.Sunset); ok {
+			// RFC 8594 HTTP-date
+			d.sunset = t.UTC().Format(http.TimeFormat)
+		}
+		if dc.Link != "" {
+			d.link = fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, dc.Link)
+		}
+		ds = append(ds, &d)
+	}
+	// the deprecation of a route takes precedence over the one of its version
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].route != "" && ds[j].route == ""
+	})
+	return ds
+}
+
+func (r *Router) parseDeprecationDate(dc *config.DeprecationConfig, value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	r.Logger.Error().Str("version", dc.Version).Str("route", dc.Route).Str("date", value).Msg("invalid deprecation date, the header is not sent")
+	return time.Time{}, false
+}
+
+// deprecationHeaders sets the headers of the matching deprecations once the route of the request is known.
+func (r *Router) deprecationHeaders(version string) fiber.Handler {
+	ds := r.parseDeprecations(version)
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if len(ds) == 0 {
+			return err
+		}
+		for _, d := range ds {
+			if !d.matches(c) {
+				continue
+			}
+			if d.deprecation != "" {
+				c.Set(HeaderDeprecation, d.deprecation)
+			}
+			if d.sunset != "" {
+				c.Set(HeaderSunset, d.sunset)
+			}
+			if d.link != "" {
+				c.Append(fiber.HeaderLink, d.link)
+			}
+			break
+		}
+		return err
+	}
+}
+
+// Version returns the route group of an api version, e.g. /api/v1.
+func (r *Router) Version(version string) fiber.Router {
+	return r.App.Group(APIPrefix+"/"+version, r.deprecationHeaders(version))
+}
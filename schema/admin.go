@@ -0,0 +1,9 @@
+package schema
+
+type LogLevel_UpdateOpts struct {
+	Level string `json:"level" validate:"required,oneof=trace debug info warn error fatal panic disabled"`
+}
+
+type LogLevel_Get struct {
+	Level string `json:"level"`
+}
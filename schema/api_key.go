@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The scopes granted to api keys.
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeAccountsWrite  = "accounts:write"
+	ScopeTransfersWrite = "transfers:write"
+)
+
+var Scopes = []string{ScopeAccountsRead, ScopeAccountsWrite, ScopeTransfersWrite}
+
+type APIKey_IssueOpts struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=accounts:read accounts:write transfers:write"`
+	// ExpiresAt is nil for keys which do not expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKey_IssueResp holds the key, it is only ever returned when the key is issued.
+type APIKey_IssueResp struct {
+	ID        primitive.ObjectID `json:"id"`
+	Key       string             `json:"key"`
+	Prefix    string             `json:"prefix"`
+	Scopes    []string           `json:"scopes"`
+	ExpiresAt *time.Time         `json:"expires_at,omitempty"`
+}
+
+type APIKey_RotateOpts struct {
+	ID primitive.ObjectID `json:"id"`
+	// GracePeriod keeps the rotated key valid while the callers switch to the new one.
+	GracePeriod time.Duration `json:"grace_period"`
+}
+
+type APIKey_Get struct {
+	ID          primitive.ObjectID  `json:"id"`
+	Name        string              `json:"name"`
+	Prefix      string              `json:"prefix"`
+	Scopes      []string            `json:"scopes"`
+	ExpiresAt   *time.Time          `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time          `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time          `json:"revoked_at,omitempty"`
+	RotatedFrom *primitive.ObjectID `json:"rotated_from,omitempty"`
+	RotatedTo   *primitive.ObjectID `json:"rotated_to,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// HasScopes reports whether the key was granted all the scopes.
+func (k *APIKey_Get) HasScopes(scopes ...string) bool {
+	for _, s := range scopes {
+		granted := false
+		for _, ks := range k.Scopes {
+			if ks == s {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Claims are the claims of the verified bearer token of a request.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// AuthTime is when the user last authenticated, AMR lists how (RFC 8176).
+	AuthTime int64    `json:"auth_time,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+}
+
+// The authentication methods of the amr claim.
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+)
+
+// HasAMR reports whether the user authenticated with method.
+func (c *Claims) HasAMR(method string) bool {
+	for _, m := range c.AMR {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Audience is the aud claim, tokens carry either a single audience or a list of them.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimsFromContext returns the claims of the authenticated request, ok is false for public routes.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*Claims)
+	return claims, ok
+}
+
+// Identity is the caller of an authenticated request, a user of a bearer token or an internal caller with an api key.
+type Identity struct {
+	// UserID is nil when the subject of the token is not a user id, e.g. for the tokens of other issuers.
+	UserID *primitive.ObjectID
+	Roles  []string
+	// APIKey is the api key of the internal callers, nil for the users.
+	APIKey *APIKey_Get
+}
+
+// HasRole reports whether the caller was granted one of roles.
+func (i *Identity) HasRole(roles ...string) bool {
+	for _, r := range roles {
+		for _, ir := range i.Roles {
+			if ir == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IdentityFromContext returns the caller of the authenticated request, ok is false for public routes and for the
+// calls made by the app itself.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	if key, ok := ctx.Value(APIKeyKey).(*APIKey_Get); ok {
+		return &Identity{APIKey: key}, true
+	}
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	id := &Identity{Roles: claims.Roles}
+	if oid, err := primitive.ObjectIDFromHex(claims.Subject); err == nil {
+		id.UserID = &oid
+	}
+	return id, true
+}
@@ -10,23 +10,39 @@ type InsertOneOpts struct {
 	Name string `json:"name" validate:"required,ne=LoremIpsumLoremIpsum,max=12"`
 }
 
+type InsertOneResp struct {
+	ID string `json:"id"`
+}
+
 type Account_CreateOpts struct {
-	AccountHolderName string `json:"account_holder_name"`
+	AccountHolderName string `json:"account_holder_name" validate:"required,max=100"`
+	// OwnerID is the user owning the account, the caller by default. Only staff open accounts for other users.
+	OwnerID *primitive.ObjectID `json:"owner_id,omitempty"`
 }
 
 type Account_CreateResp struct {
-	ID                primitive.ObjectID `json:"id"`
-	UniqueAccountID   string             `json:"account_id,omitempty"`
-	AccountHolderName string             `json:"account_holder_name"`
-	Balance           float32            `json:"balance"`
-	CreatedAt         time.Time          `json:"created_at"`
+	ID                primitive.ObjectID  `json:"id"`
+	UniqueAccountID   string              `json:"account_id,omitempty"`
+	AccountHolderName string              `json:"account_holder_name"`
+	OwnerID           *primitive.ObjectID `json:"owner_id,omitempty"`
+	Balance           float32             `json:"balance"`
+	CreatedAt         time.Time           `json:"created_at"`
 }
 
 type Transaction_CreateOpts struct {
-	TransactionID   string
-	CreditAccountID primitive.ObjectID `json:"credit_account_id"`
-	DebitAccountID  primitive.ObjectID `json:"debit_account_id"`
-	Amount          float32            `json:"amount,omitempty"`
+	// TransactionID is assigned by the service.
+	TransactionID   string             `json:"-"`
+	CreditAccountID primitive.ObjectID `json:"credit_account_id" validate:"required"`
+	DebitAccountID  primitive.ObjectID `json:"debit_account_id" validate:"required"`
+	Amount          float32            `json:"amount,omitempty" validate:"required,gt=0"`
+}
+
+type Transaction_CreateResp struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+type Account_GetOpts struct {
+	ID primitive.ObjectID `json:"id"`
 }
 
 type AccountTransaction_GetOpts struct {
@@ -34,11 +50,21 @@ type AccountTransaction_GetOpts struct {
 }
 
 type Account_Get struct {
-	ID                primitive.ObjectID `json:"id" bson:"_id"`
-	UniqueAccountID   string             `json:"account_id,omitempty" bson:"account_id,omitempty"`
-	AccountHolderName string             `json:"account_holder_name" bson:"account_holder_name"`
-	Balance           float32            `json:"balance" bson:"balance"`
-	Transactions      []Transaction_Get  `json:"transactions" bson:"transactions"`
+	ID                primitive.ObjectID  `json:"id" bson:"_id"`
+	UniqueAccountID   string              `json:"account_id,omitempty" bson:"account_id,omitempty"`
+	AccountHolderName string              `json:"account_holder_name" bson:"account_holder_name" encrypt:"deterministic"`
+	OwnerID           *primitive.ObjectID `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	Balance           float32             `json:"balance" bson:"balance"`
+	Transactions      []Transaction_Get   `json:"transactions" bson:"transactions"`
+}
+
+// Account_GetResp is the account without its transactions.
+type Account_GetResp struct {
+	ID                primitive.ObjectID  `json:"id"`
+	UniqueAccountID   string              `json:"account_id,omitempty"`
+	AccountHolderName string              `json:"account_holder_name"`
+	OwnerID           *primitive.ObjectID `json:"owner_id,omitempty"`
+	Balance           float32             `json:"balance"`
 }
 
 type Transaction_Get struct {
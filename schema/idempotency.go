@@ -0,0 +1,8 @@
+package schema
+
+// IdempotentResponse is the response of a request replayed to its retries with the same idempotency key.
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
@@ -2,6 +2,10 @@ package schema
 
 const (
 	RequestIDKey = "request-id"
+	// ClaimsKey holds the *Claims of the authenticated request in the request context.
+	ClaimsKey = "claims"
+	// APIKeyKey holds the *APIKey_Get of a request authenticated by an api key in the request context.
+	APIKeyKey = "api-key"
 
 	SentryExtraCtx = "extra"
 )
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The roles of the users, RoleCustomer is granted to the registered users. Tellers and admins are staff, their roles
+// are granted in the database.
+const (
+	RoleCustomer = "customer"
+	RoleTeller   = "teller"
+	RoleAdmin    = "admin"
+)
+
+// TokenTypeBearer is the type of the access tokens.
+const TokenTypeBearer = "Bearer"
+
+type User_RegisterOpts struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+	// Password is limited to 72 bytes, the longest password bcrypt hashes.
+	Password string `json:"password" validate:"required,min=12,max=72"`
+}
+
+type User_LoginOpts struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type User_RefreshOpts struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type User_LogoutOpts struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+	// All ends every session of the user rather than the one of the refresh token.
+	All bool `json:"all"`
+}
+
+type User_Get struct {
+	ID        primitive.ObjectID `json:"id"`
+	Email     string             `json:"email"`
+	Roles     []string           `json:"roles"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// User_TokenResp holds the tokens of a login or a refresh, ExpiresIn and RefreshExpiresIn are in seconds.
+type User_TokenResp struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+// TOTP_EnrollResp holds the secret of a second factor and its recovery codes, they are only returned at enrollment.
+type TOTP_EnrollResp struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TOTP_ConfirmOpts struct {
+	UserID primitive.ObjectID `json:"-"`
+	Code   string             `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TOTP_VerifyOpts holds either a code of the authenticator app or a recovery code.
+type TOTP_VerifyOpts struct {
+	UserID       primitive.ObjectID `json:"-"`
+	Code         string             `json:"code,omitempty" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string             `json:"recovery_code,omitempty" validate:"omitempty,max=32"`
+}
+
+// TOTP_StepUpResp holds an access token asserting the second factor, ExpiresIn is in seconds.
+type TOTP_StepUpResp struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
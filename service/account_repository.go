@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VersionConflictError is returned when a compare-and-swap update finds that the document was modified
+// after it was read.
+type VersionConflictError struct {
+	Collection string
+	ID         primitive.ObjectID
+	Version    int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict: %s %s is no longer at version %d", e.Collection, e.ID.Hex(), e.Version)
+}
+
+// Unwrap returns ErrVersionConflict, which every VersionConflictError matches (errors.Is).
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// AccountRepository provides versioned reads and writes of account documents.
+type AccountRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Account, error)
+	// UpdateVersioned applies update to acc only if the stored version still equals acc.Version.
+	// The version is incremented as part of the same update, acc.Version is bumped on success. The $inc of
+	// update, a bson.M, a map or a bson.D, is merged with the version increment.
+	// Returns a *VersionConflictError if the document changed in between.
+	UpdateVersioned(ctx context.Context, acc *model.Account, update bson.M) error
+}
+
+type AccountRepositoryImpl struct {
+	Collection mongodb.Collection
+}
+
+func NewAccountRepository(db mongodb.MongoDB) AccountRepository {
+	r := AccountRepositoryImpl{
+		Collection: db.Cli().Database(model.BankDB).Collection(model.AccountColl),
+	}
+	return &r
+}
+
+func (r *AccountRepositoryImpl) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Account, error) {
+	var acc model.Account
+	if err := r.Collection.FindOne(ctx, bson.M{"_id": id}).Decode(&acc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (r *AccountRepositoryImpl) UpdateVersioned(ctx context.Context, acc *model.Account, update bson.M) error {
+	u := bson.M{}
+	for k, v := range update {
+		u[k] = v
+	}
+	inc := bson.M{"version": 1}
+	switch existing := u["$inc"].(type) {
+	case nil:
+	case bson.M:
+		for k, v := range existing {
+			inc[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range existing {
+			inc[k] = v
+		}
+	case bson.D:
+		for _, e := range existing {
+			inc[e.Key] = e.Value
+		}
+	default:
+		return errors.Errorf("unsupported $inc of type %T", existing)
+	}
+	u["$inc"] = inc
+
+	res, err := r.Collection.UpdateOne(ctx, bson.M{"_id": acc.ID, "version": versionFilter(acc.Version)}, u)
+	if err != nil {
+		return errors.Wrap(err, "failed to update account")
+	}
+	if res.MatchedCount == 0 {
+		count, err := r.Collection.CountDocuments(ctx, bson.M{"_id": acc.ID})
+		if err != nil {
+			return errors.Wrap(err, "failed to update account")
+		}
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+		return &VersionConflictError{Collection: model.AccountColl, ID: acc.ID, Version: acc.Version}
+	}
+	acc.Version++
+	return nil
+}
+
+// versionFilter matches documents at version v. Documents written before versioning was introduced
+// have no version field and are treated as version 0.
+func versionFilter(v int64) interface{} {
+	if v == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return v
+}
+
+// RetryOnConflict runs fn until it returns something other than a version conflict, at most attempts times.
+// fn must re-read the documents it updates, as the conflict means its copy is stale.
+// Attempts are spaced with a small jittered backoff and stop early when ctx is done.
+func RetryOnConflict(ctx context.Context, attempts int, fn func(ctx context.Context) error) error {
+	var err error
+	backoff := 5 * time.Millisecond
+	for i := 0; i < attempts; i++ {
+		err = fn(ctx)
+		if !errors.Is(err, ErrVersionConflict) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff *= 2
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+//go:generate $GOPATH/bin/mockgen -destination=../mock/mock_api_key_service.go -package=mock go-app/service APIKeyService
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"go-app/schema"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyPrefix starts every api key, it makes leaked keys easy to spot.
+const APIKeyPrefix = "gak_"
+
+// lastUsedResolution bounds how often the last used time of a key is written.
+const lastUsedResolution = time.Minute
+
+type APIKeyService interface {
+	// Issue creates a key, the key itself is only part of the response.
+	Issue(ctx context.Context, opts *schema.APIKey_IssueOpts) (*schema.APIKey_IssueResp, error)
+	// Rotate issues a key with the name, scopes and expiry of a key, which stays valid for the grace period.
+	Rotate(ctx context.Context, opts *schema.APIKey_RotateOpts) (*schema.APIKey_IssueResp, error)
+	Revoke(ctx context.Context, id primitive.ObjectID) error
+	List(ctx context.Context) ([]schema.APIKey_Get, error)
+	// Authenticate returns the key matching key when it is neither expired nor revoked, and records its use.
+	Authenticate(ctx context.Context, key string) (*schema.APIKey_Get, error)
+}
+
+func (aks *APIKeyServiceImpl) collection() mongodb.Collection {
+	return aks.DB.MongoDB().Cli().Database(model.AuthDB).Collection(model.APIKeyColl)
+}
+
+func (aks *APIKeyServiceImpl) Issue(ctx context.Context, opts *schema.APIKey_IssueOpts) (*schema.APIKey_IssueResp, error) {
+	for _, s := range opts.Scopes {
+		if !isScope(s) {
+			return nil, ErrUnknownScope.WithMessage("unknown scope " + s)
+		}
+	}
+	return aks.issue(ctx, &model.APIKey{Name: opts.Name, Scopes: opts.Scopes, ExpiresAt: opts.ExpiresAt})
+}
+
+func (aks *APIKeyServiceImpl) issue(ctx context.Context, m *model.APIKey) (*schema.APIKey_IssueResp, error) {
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	m.ID = primitive.NewObjectID()
+	m.Prefix = prefix
+	m.Hash = hashToken(key)
+	m.CreatedAt = UTCNow()
+	if _, err := aks.collection().InsertOne(ctx, m); err != nil {
+		return nil, errors.Wrap(err, "failed to insert api key")
+	}
+	return &schema.APIKey_IssueResp{ID: m.ID, Key: key, Prefix: prefix, Scopes: m.Scopes, ExpiresAt: m.ExpiresAt}, nil
+}
+
+func (aks *APIKeyServiceImpl) Rotate(ctx context.Context, opts *schema.APIKey_RotateOpts) (*schema.APIKey_IssueResp, error) {
+	old, err := aks.find(ctx, bson.M{"_id": opts.ID})
+	if err != nil {
+		return nil, err
+	}
+	if old.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	resp, err := aks.issue(ctx, &model.APIKey{Name: old.Name, Scopes: old.Scopes, ExpiresAt: old.ExpiresAt, RotatedFrom: &old.ID})
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := UTCNow().Add(opts.GracePeriod)
+	if old.ExpiresAt != nil && old.ExpiresAt.Before(expiresAt) {
+		expiresAt = *old.ExpiresAt
+	}
+	update := bson.M{"$set": bson.M{"expires_at": expiresAt, "rotated_to": resp.ID}}
+	if _, err := aks.collection().UpdateOne(ctx, bson.M{"_id": old.ID}, update); err != nil {
+		return nil, errors.Wrap(err, "failed to expire the rotated api key")
+	}
+	return resp, nil
+}
+
+func (aks *APIKeyServiceImpl) Revoke(ctx context.Context, id primitive.ObjectID) error {
+	res, err := aks.collection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"revoked_at": UTCNow()}})
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke api key")
+	}
+	if res.MatchedCount == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (aks *APIKeyServiceImpl) List(ctx context.Context) ([]schema.APIKey_Get, error) {
+	cur, err := aks.collection().Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list api keys")
+	}
+	var keys []model.APIKey
+	if err := cur.All(ctx, &keys); err != nil {
+		return nil, errors.Wrap(err, "failed to decode api keys")
+	}
+	resp := make([]schema.APIKey_Get, 0, len(keys))
+	for i := range keys {
+		resp = append(resp, *toAPIKeyGet(&keys[i]))
+	}
+	return resp, nil
+}
+
+func (aks *APIKeyServiceImpl) Authenticate(ctx context.Context, key string) (*schema.APIKey_Get, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	m, err := aks.find(ctx, bson.M{"hash": hashToken(key)})
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := UTCNow()
+	if m.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if m.ExpiresAt != nil && !now.Before(*m.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+	if m.LastUsedAt == nil || now.Sub(*m.LastUsedAt) >= lastUsedResolution {
+		// the key is valid even if its use could not be recorded
+		if _, err := aks.collection().UpdateOne(ctx, bson.M{"_id": m.ID}, bson.M{"$set": bson.M{"last_used_at": now}}); err != nil {
+			aks.Logger.Err(err).Ctx(ctx).Str("api_key", m.Prefix).Msg("failed to record the use of the api key")
+		} else {
+			m.LastUsedAt = &now
+		}
+	}
+	return toAPIKeyGet(m), nil
+}
+
+func (aks *APIKeyServiceImpl) find(ctx context.Context, filter bson.M) (*model.APIKey, error) {
+	var m model.APIKey
+	if err := aks.collection().FindOne(ctx, filter).Decode(&m); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find api key")
+	}
+	return &m, nil
+}
+
+// newAPIKey returns a random key and the prefix identifying it, e.g. gak_1a2b3c4d5e6f_<secret>.
+func newAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 38)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "failed to generate api key")
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(b[:6])
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(b[6:]), prefix, nil
+}
+
+// hashToken hashes an api key or a refresh token for storage, they are random so a fast hash is enough.
+func hashToken(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func isScope(s string) bool {
+	for _, scope := range schema.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func toAPIKeyGet(m *model.APIKey) *schema.APIKey_Get {
+	return &schema.APIKey_Get{
+		ID:          m.ID,
+		Name:        m.Name,
+		Prefix:      m.Prefix,
+		Scopes:      m.Scopes,
+		ExpiresAt:   m.ExpiresAt,
+		LastUsedAt:  m.LastUsedAt,
+		RevokedAt:   m.RevokedAt,
+		RotatedFrom: m.RotatedFrom,
+		RotatedTo:   m.RotatedTo,
+		CreatedAt:   m.CreatedAt,
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"go-app/schema"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The actions authorized by the policies.
+const (
+	ActionAccountCreate = "account:create"
+	ActionAccountRead   = "account:read"
+	ActionTransfer      = "account:transfer"
+)
+
+// forbidden is returned when the caller may not perform action, it matches ErrForbidden (errors.Is).
+func forbidden(action string) error {
+	return ErrForbidden.WithMessage(action + " is not allowed")
+}
+
+// Resource is the target of an action, OwnerID is nil for the resources nobody owns.
+type Resource struct {
+	OwnerID *primitive.ObjectID
+}
+
+// Policy decides whether a caller may perform an action on a resource.
+type Policy interface {
+	// Authorize returns an error matching ErrForbidden when id may not perform action on res.
+	Authorize(id *schema.Identity, action string, res *Resource) error
+}
+
+// Rule grants an action to the owner of the resource and to roles on every resource. The api keys have no owner
+// nor roles, they are granted the action on every resource with all the Scopes, never when Scopes is empty.
+type Rule struct {
+	Owner  bool
+	Roles  []string
+	Scopes []string
+}
+
+// AccountRules let the customers use their own accounts, the tellers open and look up the accounts of everyone and
+// the admins do anything.
+var AccountRules = map[string]Rule{
+	ActionAccountCreate: {Owner: true, Roles: []string{schema.RoleTeller, schema.RoleAdmin}, Scopes: []string{schema.ScopeAccountsWrite}},
+	ActionAccountRead:   {Owner: true, Roles: []string{schema.RoleTeller, schema.RoleAdmin}, Scopes: []string{schema.ScopeAccountsRead}},
+	ActionTransfer:      {Owner: true, Roles: []string{schema.RoleAdmin}, Scopes: []string{schema.ScopeTransfersWrite}},
+}
+
+// RolePolicyImpl authorizes the users and the api keys with the rules of the actions, actions without a rule are
+// denied.
+type RolePolicyImpl struct {
+	Rules map[string]Rule
+}
+
+type RolePolicyOpts struct {
+	Rules map[string]Rule
+}
+
+func NewRolePolicy(opts *RolePolicyOpts) Policy {
+	return &RolePolicyImpl{Rules: opts.Rules}
+}
+
+func (p *RolePolicyImpl) Authorize(id *schema.Identity, action string, res *Resource) error {
+	rule, ok := p.Rules[action]
+	if !ok {
+		return forbidden(action)
+	}
+	if id.APIKey != nil {
+		if len(rule.Scopes) > 0 && id.APIKey.HasScopes(rule.Scopes...) {
+			return nil
+		}
+		return forbidden(action)
+	}
+	if id.HasRole(rule.Roles...) {
+		return nil
+	}
+	if rule.Owner && id.UserID != nil && res.OwnerID != nil && *id.UserID == *res.OwnerID {
+		return nil
+	}
+	return forbidden(action)
+}
+
+// authorize evaluates policy for the caller of ctx. Calls without a caller are made by the app itself or served
+// without authentication, they are not restricted.
+func authorize(ctx context.Context, policy Policy, action string, res *Resource) error {
+	id, ok := schema.IdentityFromContext(ctx)
+	if !ok || policy == nil {
+		return nil
+	}
+	return policy.Authorize(id, action, res)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is a key value store for read models. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{})
+	Delete(keys ...string)
+	Stats() CacheStats
+}
+
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	// Coalesced counts the misses that waited for a load already in flight instead of loading themselves.
+	Coalesced uint64 `json:"coalesced"`
+	Size      int    `json:"size"`
+}
+
+type lruEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// LRUCacheImpl is an in-process cache bounded by size, evicting the least recently used entry.
+// Entries expire TTL after they were set.
+type LRUCacheImpl struct {
+	Size int
+	TTL  time.Duration
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+	stats   CacheStats
+}
+
+type LRUCacheOpts struct {
+	Size int
+	TTL  time.Duration
+}
+
+func NewLRUCache(opts *LRUCacheOpts) Cache {
+	c := LRUCacheImpl{
+		Size:    opts.Size,
+		TTL:     opts.TTL,
+		ll:      list.New(),
+		entries: map[string]*list.Element{},
+		now:     time.Now,
+	}
+	if c.Size <= 0 {
+		c.Size = 1000
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Minute
+	}
+	return &c
+}
+
+func (c *LRUCacheImpl) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e.value, true
+}
+
+func (c *LRUCacheImpl) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.TTL)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expiresAt = value, expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.ll.Len() > c.Size {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRUCacheImpl) Delete(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *LRUCacheImpl) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.ll.Len()
+	return s
+}
+
+func (c *LRUCacheImpl) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
+
+// ReadThroughCache loads missing entries through a loader and stores them in Cache.
+// Concurrent misses of the same key are coalesced into a single load.
+type ReadThroughCache struct {
+	Cache Cache
+
+	group     singleflight.Group
+	coalesced atomic.Uint64
+	// generation is bumped by every invalidation, loads started before it are not stored.
+	generation atomic.Uint64
+}
+
+func NewReadThroughCache(c Cache) *ReadThroughCache {
+	return &ReadThroughCache{Cache: c}
+}
+
+// Get returns the cached value of key, or the value returned by load which is then cached.
+// Errors are returned to every waiting caller and are not cached.
+func (rt *ReadThroughCache) Get(ctx context.Context, key string, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if v, ok := rt.Cache.Get(key); ok {
+		return v, nil
+	}
+	loaded := false
+	v, err, _ := rt.group.Do(key, func() (interface{}, error) {
+		loaded = true
+		gen := rt.generation.Load()
+		// the load is shared, so it must not be cancelled along with the caller that happened to start it
+		v, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if rt.generation.Load() == gen {
+			rt.Cache.Set(key, v)
+		}
+		return v, nil
+	})
+	if !loaded {
+		rt.coalesced.Add(1)
+	}
+	return v, err
+}
+
+// Invalidate drops keys, including the result of loads of them currently in flight.
+func (rt *ReadThroughCache) Invalidate(keys ...string) {
+	rt.generation.Add(1)
+	rt.Cache.Delete(keys...)
+	for _, key := range keys {
+		rt.group.Forget(key)
+	}
+}
+
+func (rt *ReadThroughCache) Stats() CacheStats {
+	s := rt.Cache.Stats()
+	s.Coalesced = rt.coalesced.Load()
+	return s
+}
@@ -4,6 +4,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"go-app/internals/mongodb"
 	"go-app/model"
 	"go-app/schema"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
 )
 
 type DemoService interface {
@@ -27,7 +29,14 @@ type DemoService interface {
 	Account_Create(ctx context.Context, opts *schema.Account_CreateOpts) (*schema.Account_CreateResp, error)
 	Transaction_Create(ctx context.Context, opts *schema.Transaction_CreateOpts) error
 
+	// GetAccount returns the account without loading its transactions.
+	GetAccount(ctx context.Context, opts *schema.Account_GetOpts) (*schema.Account_GetResp, error)
 	GetAccountDetailWithTransactions(ctx context.Context, opts *schema.AccountTransaction_GetOpts) (*schema.Account_Get, error)
+	// AccountCacheStats returns the statistics of the account cache, zero when caching is disabled.
+	AccountCacheStats() CacheStats
+
+	// Change Stream Handlers
+	OnTransactionCreated(ctx context.Context, event *mongodb.ChangeEvent) error
 }
 
 func (dsi *DemoServiceImpl) DemoFunc(ctx context.Context) string {
@@ -58,10 +67,18 @@ func (dsi *DemoServiceImpl) InsertOne(ctx context.Context, opts *schema.InsertOn
 }
 
 func (dsi *DemoServiceImpl) Account_Create(ctx context.Context, opts *schema.Account_CreateOpts) (*schema.Account_CreateResp, error) {
+	owner := opts.OwnerID
+	if id, ok := schema.IdentityFromContext(ctx); ok && owner == nil {
+		owner = id.UserID
+	}
+	if err := authorize(ctx, dsi.Policy, ActionAccountCreate, &Resource{OwnerID: owner}); err != nil {
+		return nil, err
+	}
 	m := model.Account{
 		ID:                primitive.NewObjectID(),
 		UniqueAccountID:   uuid.New().String(),
 		AccountHolderName: opts.AccountHolderName,
+		OwnerID:           owner,
 		Balance:           0,
 		CreatedAt:         UTCNow(),
 	}
@@ -71,11 +88,14 @@ func (dsi *DemoServiceImpl) Account_Create(ctx context.Context, opts *schema.Acc
 		dsi.Logger.Err(err).Ctx(ctx).Interface("m", m).Msg(err.Error())
 		return nil, errors.Wrap(err, "failed to create account")
 	}
+	dsi.invalidateAccounts(m.ID)
+	dsi.Metrics.accountCreated()
 
 	resp := schema.Account_CreateResp{
 		ID:                res.(primitive.ObjectID),
 		UniqueAccountID:   m.UniqueAccountID,
 		AccountHolderName: m.AccountHolderName,
+		OwnerID:           m.OwnerID,
 		Balance:           m.Balance,
 		CreatedAt:         m.CreatedAt,
 	}
@@ -83,10 +103,25 @@ func (dsi *DemoServiceImpl) Account_Create(ctx context.Context, opts *schema.Acc
 	return &resp, nil
 }
 
+// maxConflictRetries bounds how many times a transfer is retried when an account changed underneath it.
+const maxConflictRetries = 5
+
 func (dsi *DemoServiceImpl) Transaction_Create(ctx context.Context, opts *schema.Transaction_CreateOpts) error {
 	opts.TransactionID = uuid.New().String()
-	err := dsi.registerTransaction(ctx, opts)
-	return err
+	err := RetryOnConflict(ctx, maxConflictRetries, func(ctx context.Context) error {
+		return dsi.registerTransaction(ctx, opts)
+	})
+	if err != nil {
+		dsi.Metrics.transferFailed(err)
+		return err
+	}
+	dsi.invalidateAccounts(opts.CreditAccountID, opts.DebitAccountID)
+	dsi.Metrics.transferSucceeded(opts.Amount)
+	return nil
+}
+
+func (dsi *DemoServiceImpl) accountRepository() AccountRepository {
+	return NewAccountRepository(dsi.Service.MongoDB())
 }
 
 func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schema.Transaction_CreateOpts) error {
@@ -100,21 +135,27 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 	// Defers ending the session after the transaction is committed or ended
 	defer session.EndSession(ctx)
 
+	accounts := dsi.accountRepository()
+
 	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
 
-		var creditAccount model.Account
-		res := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).FindOne(
-			sessionContext,
-			bson.M{"_id": opts.CreditAccountID},
-		)
+		creditAccount, err := accounts.FindByID(sessionContext, opts.CreditAccountID)
+		if err != nil {
+			dsi.Logger.Err(err).Ctx(ctx).Interface("opts", opts).Msg("failed to get credit account")
+			// only a missing account is the fault of the client, timeouts and outages are not
+			if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, ErrAccountNotFound) {
+				return nil, ErrInvalidCreditAccount.Wrap(err)
+			}
+			return nil, AsError(errors.Wrap(err, "failed to get credit account"))
+		}
 
-		if err := res.Decode(&creditAccount); err != nil {
-			dsi.Logger.Err(err).Ctx(ctx).Interface("opts", opts).Msg("failed to credit get account")
-			return nil, errors.New("invalid credit account")
+		// the money leaves the credit account, only its owner may move it
+		if err := authorize(ctx, dsi.Policy, ActionTransfer, &Resource{OwnerID: creditAccount.OwnerID}); err != nil {
+			return nil, err
 		}
 
 		if creditAccount.Balance-opts.Amount < 0 {
-			return nil, errors.New("insufficient balance")
+			return nil, ErrInsufficientBalance
 		}
 
 		// creating transaction
@@ -128,7 +169,7 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 			ClosingBalance:  creditAccount.Balance - opts.Amount,
 			CreatedAt:       UTCNow(),
 		}
-		_, err := dsi.Service.MongoDB().
+		_, err = dsi.Service.MongoDB().
 			Cli().
 			Database(model.BankDB).
 			Collection(model.TransactionColl).
@@ -137,7 +178,7 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 			return nil, errors.Wrap(err, "failed to create transaction")
 		}
 
-		// updating balance
+		// updating balance, only if the account was not modified since it was read
 		tcUpdate := bson.M{
 			"$set": bson.M{
 				"balance":    tc.ClosingBalance,
@@ -145,18 +186,23 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 			},
 		}
 
-		if _, err := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).UpdateOne(sessionContext, bson.M{"_id": creditAccount.ID}, tcUpdate); err != nil {
+		if err := accounts.UpdateVersioned(sessionContext, creditAccount, tcUpdate); err != nil {
+			switch {
+			case errors.Is(err, ErrVersionConflict):
+				return nil, err
+			case errors.Is(err, mongo.ErrNoDocuments):
+				return nil, ErrInvalidCreditAccount.Wrap(err)
+			}
 			return nil, errors.Wrap(err, "failed to update account balance")
 		}
 
-		var debitAccount model.Account
-		res = dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).FindOne(
-			sessionContext,
-			bson.M{"_id": opts.DebitAccountID},
-		)
-		if err := res.Decode(&debitAccount); err != nil {
-			dsi.Logger.Err(err).Ctx(ctx).Interface("opts", opts).Msg("failed to get account")
-			return nil, errors.Wrap(err, "failed to get debit account")
+		debitAccount, err := accounts.FindByID(sessionContext, opts.DebitAccountID)
+		if err != nil {
+			dsi.Logger.Err(err).Ctx(ctx).Interface("opts", opts).Msg("failed to get debit account")
+			if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, ErrAccountNotFound) {
+				return nil, ErrInvalidDebitAccount.Wrap(err)
+			}
+			return nil, AsError(errors.Wrap(err, "failed to get debit account"))
 		}
 
 		// creating transaction
@@ -179,7 +225,7 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 			return nil, errors.Wrap(err, "failed to create transaction")
 		}
 
-		// updating balance
+		// updating balance, only if the account was not modified since it was read
 		tdUpdate := bson.M{
 			"$set": bson.M{
 				"balance":    td.ClosingBalance,
@@ -187,7 +233,13 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 			},
 		}
 
-		if _, err := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).UpdateOne(sessionContext, bson.M{"_id": debitAccount.ID}, tdUpdate); err != nil {
+		if err := accounts.UpdateVersioned(sessionContext, debitAccount, tdUpdate); err != nil {
+			switch {
+			case errors.Is(err, ErrVersionConflict):
+				return nil, err
+			case errors.Is(err, mongo.ErrNoDocuments):
+				return nil, ErrInvalidDebitAccount.Wrap(err)
+			}
 			return nil, errors.Wrap(err, "failed to update account balance")
 		}
 
@@ -197,16 +249,94 @@ func (dsi *DemoServiceImpl) registerTransaction(ctx context.Context, opts *schem
 	return err
 }
 
+// GetAccount reads the account only, the account cache holds the accounts with their transactions so it is not used.
+func (dsi *DemoServiceImpl) GetAccount(ctx context.Context, opts *schema.Account_GetOpts) (*schema.Account_GetResp, error) {
+	account, err := dsi.getAccount(ctx, opts.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, dsi.Policy, ActionAccountRead, &Resource{OwnerID: account.OwnerID}); err != nil {
+		return nil, err
+	}
+	return &schema.Account_GetResp{
+		ID:                account.ID,
+		UniqueAccountID:   account.UniqueAccountID,
+		AccountHolderName: account.AccountHolderName,
+		OwnerID:           account.OwnerID,
+		Balance:           account.Balance,
+	}, nil
+}
+
+// GetAccountDetailWithTransactions returns the account with its transactions, served from the account cache
+// when it is enabled.
 func (dsi *DemoServiceImpl) GetAccountDetailWithTransactions(ctx context.Context, opts *schema.AccountTransaction_GetOpts) (*schema.Account_Get, error) {
+	if dsi.AccountCache == nil {
+		account, err := dsi.getAccountDetailWithTransactions(ctx, opts.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := authorize(ctx, dsi.Policy, ActionAccountRead, &Resource{OwnerID: account.OwnerID}); err != nil {
+			return nil, err
+		}
+		return account, nil
+	}
+	v, err := dsi.AccountCache.Get(ctx, opts.ID.Hex(), func(ctx context.Context) (interface{}, error) {
+		return dsi.getAccountDetailWithTransactions(ctx, opts.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the cache is shared by all the callers, each of them is authorized
+	cached := v.(*schema.Account_Get)
+	if err := authorize(ctx, dsi.Policy, ActionAccountRead, &Resource{OwnerID: cached.OwnerID}); err != nil {
+		return nil, err
+	}
+	// cached values are shared, callers get their own copy
+	resp := *cached
+	resp.Transactions = append([]schema.Transaction_Get(nil), resp.Transactions...)
+	return &resp, nil
+}
+
+func (dsi *DemoServiceImpl) AccountCacheStats() CacheStats {
+	if dsi.AccountCache == nil {
+		return CacheStats{}
+	}
+	return dsi.AccountCache.Stats()
+}
 
-	var accountResp schema.Account_Get
-	res := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).FindOne(ctx, bson.M{"_id": opts.ID})
+// invalidateAccounts drops the cached details of the given accounts.
+func (dsi *DemoServiceImpl) invalidateAccounts(ids ...primitive.ObjectID) {
+	if dsi.AccountCache == nil {
+		return
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, id.Hex())
+	}
+	dsi.AccountCache.Invalidate(keys...)
+}
 
-	if err := res.Decode(&accountResp); err != nil {
+func (dsi *DemoServiceImpl) getAccount(ctx context.Context, id primitive.ObjectID) (*schema.Account_Get, error) {
+	var account schema.Account_Get
+	// balance must reflect majority committed writes irrespective of the collection defaults
+	res := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl).FindOne(
+		mongodb.WithReadConcern(ctx, readconcern.Majority()),
+		bson.M{"_id": id},
+	)
+	if err := res.Decode(&account); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("no account found")
+			return nil, ErrAccountNotFound
 		}
-		return nil, errors.New("failed to get account")
+		return nil, errors.Wrap(err, "failed to get account")
+	}
+	return &account, nil
+}
+
+func (dsi *DemoServiceImpl) getAccountDetailWithTransactions(ctx context.Context, id primitive.ObjectID) (*schema.Account_Get, error) {
+
+	accountResp, err := dsi.getAccount(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
 	var transactions []schema.Transaction_Get
@@ -214,31 +344,50 @@ func (dsi *DemoServiceImpl) GetAccountDetailWithTransactions(ctx context.Context
 	cur, err := dsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.TransactionColl).Find(ctx, bson.M{
 		"$or": bson.A{
 			bson.M{
-				"credit_account_id": opts.ID,
+				"credit_account_id": id,
 			},
 			bson.M{
-				"debit_account_id": opts.ID,
+				"debit_account_id": id,
 			},
 		},
 	})
 
 	if err != nil {
-		return nil, errors.New("failed to prepare query")
+		return nil, errors.Wrap(err, "failed to prepare query")
 	}
 
 	if err := cur.All(ctx, &transactions); err != nil {
-		return nil, errors.New("failed to get transactions")
+		return nil, errors.Wrap(err, "failed to get transactions")
 	}
 
 	accountResp.Transactions = transactions
 
-	return &accountResp, nil
+	return accountResp, nil
+}
+
+// OnTransactionCreated is invoked for every transaction inserted into the transaction collection,
+// including the ones inserted by other instances of the app.
+func (dsi *DemoServiceImpl) OnTransactionCreated(ctx context.Context, event *mongodb.ChangeEvent) error {
+	var t model.Transaction
+	if err := event.DecodeFullDocument(&t); err != nil {
+		dsi.Logger.Err(err).Ctx(ctx).Msg("failed to decode transaction event")
+		return nil
+	}
+	dsi.Logger.Debug().Ctx(ctx).
+		Str("transaction_id", t.TransactionID).
+		Str("type", t.Type).
+		Str("account_id", t.CreditAccountID.Hex()).
+		Float32("closing_balance", t.ClosingBalance).
+		Msg("transaction created")
+	// transfers made by other instances of the app change the balances cached here
+	dsi.invalidateAccounts(t.CreditAccountID, t.DebitAccountID)
+	return nil
 }
 
 func (dsi *DemoServiceImpl) CallAPIForMock(ctx context.Context, url string) (bool, error) {
 	print(dsi.DemoFunc(ctx))
 
-	resp, err := dsi.Service.GetHTTPService().Get(url)
+	resp, err := dsi.Service.GetHTTPService().Get(ctx, url)
 	if err != nil {
 		return false, err
 	}
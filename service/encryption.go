@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"go-app/model"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedCollections are the collections whose models have encrypted fields, with a value of the model.
+var encryptedCollections = []struct {
+	DB    string
+	Coll  string
+	Model interface{}
+}{
+	{DB: model.BankDB, Coll: model.AccountColl, Model: model.Account{}},
+	{DB: model.AuthDB, Coll: model.UserColl, Model: model.User{}},
+}
+
+// RotateEncryptedFields re-encrypts with the active key of keyring the encrypted fields of every collection, see
+// mongodb.Keyring.RotateEncryptedFields. Returns the number of documents updated by namespace.
+func RotateEncryptedFields(ctx context.Context, db mongodb.MongoDB, keyring *mongodb.Keyring) (map[string]int64, error) {
+	updated := map[string]int64{}
+	for _, ec := range encryptedCollections {
+		ns := ec.DB + "." + ec.Coll
+		n, err := keyring.RotateEncryptedFields(ctx, db.Cli().Database(ec.DB).Collection(ec.Coll), ec.Model)
+		updated[ns] = n
+		if err != nil {
+			return updated, errors.Wrapf(err, "failed to rotate the encrypted fields of %s", ns)
+		}
+	}
+	return updated, nil
+}
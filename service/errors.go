@@ -0,0 +1,122 @@
+package service
+
+import (
+	"go-app/internals/mongodb"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Error is an error of the catalog below. Code and Status are those of the responses rendering it, Message is safe to
+// send to the clients and Field names the field of the request at fault, if any. Cause is the underlying error, it is
+// logged but never sent to the clients.
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	Field   string
+	Cause   error
+
+	// entry is the error of the catalog this one derives from, nil for the errors of the catalog.
+	entry *Error
+}
+
+func newError(status int, code, msg string) *Error {
+	return &Error{Code: code, Status: status, Message: msg}
+}
+
+func (e *Error) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches the errors deriving from the same error of the catalog, whatever their message or cause.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t == e.catalogEntry()
+}
+
+func (e *Error) catalogEntry() *Error {
+	if e.entry == nil {
+		return e
+	}
+	return e.entry
+}
+
+// Wrap returns a copy of e caused by cause.
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.Cause = cause
+	c.entry = e.catalogEntry()
+	return &c
+}
+
+// WithMessage returns a copy of e with a more specific message, which must be safe to send to the clients.
+func (e *Error) WithMessage(msg string) *Error {
+	c := *e
+	c.Message = msg
+	c.entry = e.catalogEntry()
+	return &c
+}
+
+// The catalog of the errors returned by the services. The services return them, or derive from them with Wrap and
+// WithMessage, whenever the error is meant for the client. The router returns them too for the requests it rejects
+// before they reach the services.
+var (
+	ErrInternal     = newError(http.StatusInternalServerError, "InternalServerErr", "oops something went wrong")
+	ErrTimeout      = newError(http.StatusGatewayTimeout, "Timeout", "the request timed out")
+	ErrBadRequest   = newError(http.StatusBadRequest, "BadRequest", "request failed")
+	ErrUnauthorized = newError(http.StatusUnauthorized, "Unauthorized", "unauthorized")
+	ErrForbidden    = newError(http.StatusForbidden, "Forbidden", "forbidden")
+
+	ErrStepUpRequired     = newError(http.StatusUnauthorized, "StepUpRequired", "a recent second factor is required")
+	ErrTooManyRequests    = newError(http.StatusTooManyRequests, "TooManyRequests", "rate limit exceeded")
+	ErrUnsupportedVersion = newError(http.StatusNotAcceptable, "UnsupportedVersion", "api version is not supported")
+
+	ErrAccountNotFound      = newError(http.StatusNotFound, "AccountNotFound", "account not found")
+	ErrInvalidCreditAccount = &Error{Code: "AccountNotFound", Status: http.StatusNotFound, Message: "credit account not found", Field: "credit_account_id"}
+	ErrInvalidDebitAccount  = &Error{Code: "AccountNotFound", Status: http.StatusNotFound, Message: "debit account not found", Field: "debit_account_id"}
+	ErrInsufficientBalance  = newError(http.StatusUnprocessableEntity, "InsufficientBalance", "insufficient balance")
+	ErrVersionConflict      = newError(http.StatusConflict, "Conflict", "the account was modified concurrently, retry the request")
+
+	ErrEmailTaken          = &Error{Code: "EmailTaken", Status: http.StatusConflict, Message: "email is already registered", Field: "email"}
+	ErrInvalidCredentials  = newError(http.StatusUnauthorized, "InvalidCredentials", "invalid email or password")
+	ErrInvalidRefreshToken = newError(http.StatusUnauthorized, "InvalidRefreshToken", "invalid refresh token")
+	ErrRefreshTokenExpired = newError(http.StatusUnauthorized, "InvalidRefreshToken", "refresh token is expired")
+	ErrRefreshTokenReused  = newError(http.StatusUnauthorized, "InvalidRefreshToken", "refresh token was already used, the session is revoked")
+	ErrUserNotFound        = newError(http.StatusNotFound, "UserNotFound", "user not found")
+	ErrTOTPNotEnabled      = newError(http.StatusConflict, "TOTPNotEnabled", "second factor is not enabled")
+	ErrTOTPAlreadyEnabled  = newError(http.StatusConflict, "TOTPAlreadyEnabled", "second factor is already enabled")
+	ErrInvalidTOTPCode     = newError(http.StatusUnprocessableEntity, "InvalidCode", "invalid verification code")
+	ErrTOTPLocked          = newError(http.StatusTooManyRequests, "TooManyAttempts", "too many invalid verification codes, retry later")
+
+	ErrInvalidAPIKey  = newError(http.StatusUnauthorized, "Unauthorized", "invalid api key")
+	ErrAPIKeyExpired  = newError(http.StatusUnauthorized, "Unauthorized", "api key is expired")
+	ErrAPIKeyRevoked  = newError(http.StatusUnauthorized, "Unauthorized", "api key is revoked")
+	ErrAPIKeyNotFound = newError(http.StatusNotFound, "APIKeyNotFound", "no api key found")
+	ErrUnknownScope   = &Error{Code: "ValidationErr", Status: http.StatusBadRequest, Message: "unknown scope", Field: "scopes"}
+
+	ErrIdempotencyKeyMismatch = newError(http.StatusConflict, "IdempotencyKeyMismatch", "idempotency key was used for another request")
+	ErrIdempotencyKeyInUse    = newError(http.StatusConflict, "IdempotencyKeyInUse", "a request with the idempotency key is in progress")
+)
+
+// AsError returns the error of the catalog err derives from. The timeouts of mongodb are ErrTimeout, the other errors
+// are ErrInternal, including the missing documents: what is missing is only known where the document is read, which
+// maps them to the error of the catalog. The errors which are not part of the catalog are kept as cause.
+func AsError(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case mongodb.IsTimeout(err):
+		return ErrTimeout.Wrap(err)
+	default:
+		return ErrInternal.Wrap(err)
+	}
+}
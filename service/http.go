@@ -1,12 +1,20 @@
 //go:generate $GOPATH/bin/mockgen -destination=../mock/mock_http_service.go -package=mock go-app/service HTTP
 package service
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 type HTTP interface {
-	Get(url string) (resp *http.Response, err error)
+	// Get is bound to ctx, which also carries the trace context to the called service.
+	Get(ctx context.Context, url string) (resp *http.Response, err error)
 }
 
-func (h *HTTPImpl) Get(url string) (resp *http.Response, err error) {
-	return http.Get(url)
+func (h *HTTPImpl) Get(ctx context.Context, url string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return h.Client.Do(req)
 }
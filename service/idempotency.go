@@ -0,0 +1,160 @@
+//go:generate $GOPATH/bin/mockgen -destination=../mock/mock_idempotency_store.go -package=mock go-app/service IdempotencyStore
+package service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/db"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"go-app/schema"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The lifetimes of the idempotency keys used when they are not configured.
+const (
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyLockTimeout = time.Minute
+)
+
+// maxIdempotencyRetries bounds the attempts to claim a key expiring or handed over concurrently.
+const maxIdempotencyRetries = 3
+
+type IdempotencyStore interface {
+	// Begin claims key for the request of fingerprint. It returns the response of the request when it completed
+	// before, nil when the caller processes the request and then calls Complete or Release.
+	// ErrIdempotencyKeyMismatch is returned when the key was used by a request of another fingerprint,
+	// ErrIdempotencyKeyInUse while the request of the key is in progress.
+	Begin(ctx context.Context, key, fingerprint string) (*schema.IdempotentResponse, error)
+	// Complete stores the response of the request of key and fingerprint, it is replayed until the key expires.
+	Complete(ctx context.Context, key, fingerprint string, resp *schema.IdempotentResponse) error
+	// Release frees key when its request failed without side effects, so that it is processed again when retried.
+	Release(ctx context.Context, key, fingerprint string) error
+}
+
+type IdempotencyStoreImpl struct {
+	DB     db.DB
+	Config *config.IdempotencyConfig
+	now    func() time.Time
+}
+
+type IdempotencyStoreOpts struct {
+	DB     db.DB
+	Config *config.IdempotencyConfig
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// NewIdempotencyStore keeps the idempotency keys in mongodb. The expired keys are dropped by a TTL index on
+// expires_at, see Service.EnsureIndexes.
+func NewIdempotencyStore(opts *IdempotencyStoreOpts) IdempotencyStore {
+	c := config.IdempotencyConfig{}
+	if opts.Config != nil {
+		c = *opts.Config
+	}
+	if c.TTL <= 0 {
+		c.TTL = defaultIdempotencyTTL
+	}
+	if c.LockTimeout <= 0 {
+		c.LockTimeout = defaultIdempotencyLockTimeout
+	}
+	s := IdempotencyStoreImpl{
+		DB:     opts.DB,
+		Config: &c,
+		now:    opts.Now,
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return &s
+}
+
+func (s *IdempotencyStoreImpl) collection() mongodb.Collection {
+	return s.DB.MongoDB().Cli().Database(model.AuthDB).Collection(model.IdempotencyColl)
+}
+
+func (s *IdempotencyStoreImpl) Begin(ctx context.Context, key, fingerprint string) (*schema.IdempotentResponse, error) {
+	for i := 0; i < maxIdempotencyRetries; i++ {
+		now := s.now()
+		_, err := s.collection().InsertOne(ctx, model.IdempotencyKey{
+			ID:          key,
+			Fingerprint: fingerprint,
+			LockedUntil: now.Add(s.Config.LockTimeout),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.Config.TTL),
+		})
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, errors.Wrap(err, "failed to create idempotency key")
+		}
+
+		var m model.IdempotencyKey
+		err = s.collection().FindOne(ctx, bson.M{"_id": key}).Decode(&m)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// dropped meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get idempotency key")
+		}
+
+		// the TTL monitor drops the expired keys in the background, they may still be found
+		expired := !now.Before(m.ExpiresAt)
+		if !expired && m.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyMismatch
+		}
+		if !expired && m.Response != nil {
+			return &schema.IdempotentResponse{Status: m.Response.Status, ContentType: m.Response.ContentType, Body: m.Response.Body}, nil
+		}
+		if !expired && now.Before(m.LockedUntil) {
+			return nil, ErrIdempotencyKeyInUse
+		}
+
+		// the key is expired or its request was abandoned, e.g. the instance processing it stopped
+		update := bson.M{
+			"$set": bson.M{
+				"fingerprint":  fingerprint,
+				"locked_until": now.Add(s.Config.LockTimeout),
+				"created_at":   now,
+				"expires_at":   now.Add(s.Config.TTL),
+			},
+			"$unset": bson.M{"response": ""},
+			"$inc":   bson.M{"version": 1},
+		}
+		ur, err := s.collection().UpdateOne(ctx, bson.M{"_id": key, "version": m.Version}, update)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to claim idempotency key")
+		}
+		if ur.MatchedCount == 1 {
+			return nil, nil
+		}
+	}
+	return nil, ErrIdempotencyKeyInUse
+}
+
+func (s *IdempotencyStoreImpl) Complete(ctx context.Context, key, fingerprint string, resp *schema.IdempotentResponse) error {
+	update := bson.M{"$set": bson.M{
+		"response":   model.IdempotencyResponse{Status: resp.Status, ContentType: resp.ContentType, Body: resp.Body},
+		"expires_at": s.now().Add(s.Config.TTL),
+	}}
+	// a request completing after its key was handed over does not replace the response of another request
+	filter := bson.M{"_id": key, "fingerprint": fingerprint, "response": bson.M{"$exists": false}}
+	if _, err := s.collection().UpdateOne(ctx, filter, update); err != nil {
+		return errors.Wrap(err, "failed to store idempotent response")
+	}
+	return nil
+}
+
+func (s *IdempotencyStoreImpl) Release(ctx context.Context, key, fingerprint string) error {
+	filter := bson.M{"_id": key, "fingerprint": fingerprint, "response": bson.M{"$exists": false}}
+	if _, err := s.collection().DeleteOne(ctx, filter); err != nil {
+		return errors.Wrap(err, "failed to release idempotency key")
+	}
+	return nil
+}
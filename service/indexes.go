@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"go-app/model"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes are the indexes the services rely on, by collection.
+var collectionIndexes = []struct {
+	DB     string
+	Coll   string
+	Models []mongo.IndexModel
+}{
+	{DB: model.AuthDB, Coll: model.IdempotencyColl, Models: []mongo.IndexModel{ttlIndex("expires_at")}},
+	{DB: model.AuthDB, Coll: model.RateLimitColl, Models: []mongo.IndexModel{ttlIndex("expires_at")}},
+	{DB: model.AuthDB, Coll: model.APIKeyColl, Models: []mongo.IndexModel{uniqueIndex("hash")}},
+	{DB: model.AuthDB, Coll: model.UserColl, Models: []mongo.IndexModel{uniqueIndex("email")}},
+	{DB: model.AuthDB, Coll: model.RefreshTokenColl, Models: []mongo.IndexModel{uniqueIndex("hash"), ttlIndex("expires_at")}},
+}
+
+// ttlIndex drops the documents once the time in field is past.
+func ttlIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+}
+
+// uniqueIndex rejects the documents whose field has the value of another document.
+func uniqueIndex(field string) mongo.IndexModel {
+	return mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}, Options: options.Index().SetUnique(true)}
+}
+
+// EnsureIndexes creates the indexes of the collections, the existing ones are left as is.
+func (si *ServiceImpl) EnsureIndexes(ctx context.Context) error {
+	for _, ci := range collectionIndexes {
+		coll := si.MongoDB().Cli().Database(ci.DB).Collection(ci.Coll)
+		if _, err := coll.CreateIndexes(ctx, ci.Models); err != nil {
+			return errors.Wrapf(err, "failed to create the indexes of %s.%s", ci.DB, ci.Coll)
+		}
+	}
+	return nil
+}
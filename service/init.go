@@ -3,18 +3,33 @@ package service
 
 import (
 	"context"
+	"go-app/internals/auth"
 	"go-app/internals/config"
 	"go-app/internals/db"
+	"go-app/internals/health"
 	"go-app/internals/logger"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"net/http"
 	"sync"
+	"sync/atomic"
 
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Service interface {
 	Close() error
 	GetDemoService() DemoService
 	GetHTTPService() HTTP
+	GetAPIKeyService() APIKeyService
+	GetUserService() UserService
+	HealthChecks() []*health.Check
+	// EnsureIndexes creates the indexes the services rely on, it is called once at startup.
+	EnsureIndexes(ctx context.Context) error
 
 	db.DB
 }
@@ -27,8 +42,12 @@ type ServiceImpl struct {
 	Sync           *sync.WaitGroup
 
 	db.DB
-	DemoService DemoService
-	HTTPService HTTP
+	DemoService   DemoService
+	HTTPService   HTTP
+	APIKeyService APIKeyService
+	UserService   UserService
+
+	closed atomic.Bool
 }
 
 type ServiceOpts struct {
@@ -38,6 +57,14 @@ type ServiceOpts struct {
 	Logger         *zerolog.Logger
 	DB             db.DB
 	Sync           *sync.WaitGroup
+	// Metrics registers the collectors of the services, may be nil.
+	Metrics prometheus.Registerer
+	// HTTPTransport wraps the outbound requests of the HTTP service, may be nil.
+	HTTPTransport http.RoundTripper
+	// JWT signs the access tokens of the users, they cannot log in when it is nil.
+	JWT auth.JWT
+	// Passwords hashes the passwords of the users.
+	Passwords auth.PasswordHasher
 }
 
 func NewService(opts *ServiceOpts) Service {
@@ -69,10 +96,26 @@ func NewService(opts *ServiceOpts) Service {
 }
 
 func (si *ServiceImpl) Close() error {
+	si.closed.Store(true)
 	si.Logger.Debug().Msg("services closed")
 	return nil
 }
 
+// HealthChecks fails once the services are closed. It only fails readiness, the services are closed during a
+// graceful shutdown and liveness must keep passing until the process exits.
+func (si *ServiceImpl) HealthChecks() []*health.Check {
+	return []*health.Check{{
+		Name: "service",
+		Func: func(ctx context.Context) error {
+			if si.closed.Load() {
+				return errors.New("services are closed")
+			}
+			return nil
+		},
+		Critical: true,
+	}}
+}
+
 func (si *ServiceImpl) GetDemoService() DemoService {
 	return si.DemoService
 }
@@ -81,12 +124,51 @@ func (si *ServiceImpl) GetHTTPService() HTTP {
 	return si.HTTPService
 }
 
+func (si *ServiceImpl) GetAPIKeyService() APIKeyService {
+	return si.APIKeyService
+}
+
+func (si *ServiceImpl) GetUserService() UserService {
+	return si.UserService
+}
+
 func (si *ServiceImpl) setup(opts *ServiceOpts) {
 	si.DemoService = NewDemoService(&DemoServiceOpts{
 		Config:  opts.Config.DemoServiceConfig,
 		Logger:  si.AbstractLogger.CreateSubLogger(si.Logger, "demo-service"),
 		Service: si,
+		Metrics: opts.Metrics,
 	})
 
-	si.HTTPService = NewHttp()
+	si.HTTPService = NewHttp(&HTTPOpts{Transport: opts.HTTPTransport})
+
+	si.APIKeyService = NewAPIKeyService(&APIKeyServiceOpts{
+		Logger: si.AbstractLogger.CreateSubLogger(si.Logger, "api-key-service"),
+		DB:     si,
+	})
+
+	si.UserService = NewUserService(&UserServiceOpts{
+		Logger:    si.AbstractLogger.CreateSubLogger(si.Logger, "user-service"),
+		Config:    opts.Config.UserServiceConfig,
+		DB:        si,
+		JWT:       opts.JWT,
+		Passwords: opts.Passwords,
+	})
+
+	si.setupWatchers(opts)
+}
+
+// setupWatchers subscribes the services to the change streams they are interested in.
+func (si *ServiceImpl) setupWatchers(opts *ServiceOpts) {
+	if opts.Config.DemoServiceConfig.WatchTransactions {
+		c := si.MongoDB().ChangeStream(&mongodb.ChangeStreamConsumerOpts{
+			Name:       "demo-service-transactions",
+			Collection: si.MongoDB().Cli().Database(model.BankDB).Collection(model.TransactionColl),
+			Pipeline: mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"operationType": "insert"}}},
+			},
+			Handlers: []mongodb.ChangeHandler{si.DemoService.OnTransactionCreated},
+		})
+		c.Start()
+	}
 }
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"go-app/internals/mongodb"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons of failed transfers, used as the reason label of the transfers counter.
+const (
+	TransferReasonInsufficientBalance = "insufficient_balance"
+	TransferReasonAccountNotFound     = "account_not_found"
+	TransferReasonForbidden           = "forbidden"
+	TransferReasonConflict            = "conflict"
+	TransferReasonTimeout             = "timeout"
+	TransferReasonInternal            = "internal"
+)
+
+// DemoServiceMetrics holds the business counters of DemoService.
+type DemoServiceMetrics struct {
+	AccountsCreated   prometheus.Counter
+	Transfers         *prometheus.CounterVec
+	AmountTransferred prometheus.Counter
+}
+
+// NewDemoServiceMetrics creates the counters and registers them on reg. With a nil reg the counters
+// still work but are not exported.
+func NewDemoServiceMetrics(reg prometheus.Registerer) *DemoServiceMetrics {
+	f := promauto.With(reg)
+	return &DemoServiceMetrics{
+		AccountsCreated: f.NewCounter(prometheus.CounterOpts{
+			Name: "demo_accounts_created_total",
+			Help: "Accounts created.",
+		}),
+		Transfers: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "demo_transfers_total",
+			Help: "Transfers by result (succeeded or failed) and failure reason.",
+		}, []string{"result", "reason"}),
+		AmountTransferred: f.NewCounter(prometheus.CounterOpts{
+			Name: "demo_transferred_amount_total",
+			Help: "Sum of the amounts of succeeded transfers.",
+		}),
+	}
+}
+
+func (m *DemoServiceMetrics) accountCreated() {
+	if m == nil {
+		return
+	}
+	m.AccountsCreated.Inc()
+}
+
+func (m *DemoServiceMetrics) transferSucceeded(amount float32) {
+	if m == nil {
+		return
+	}
+	m.Transfers.WithLabelValues("succeeded", "").Inc()
+	m.AmountTransferred.Add(float64(amount))
+}
+
+func (m *DemoServiceMetrics) transferFailed(err error) {
+	if m == nil {
+		return
+	}
+	m.Transfers.WithLabelValues("failed", transferFailureReason(err)).Inc()
+}
+
+func transferFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInsufficientBalance):
+		return TransferReasonInsufficientBalance
+	case errors.Is(err, ErrInvalidCreditAccount), errors.Is(err, ErrInvalidDebitAccount):
+		return TransferReasonAccountNotFound
+	case errors.Is(err, ErrForbidden):
+		return TransferReasonForbidden
+	case errors.Is(err, ErrVersionConflict):
+		return TransferReasonConflict
+	case mongodb.IsTimeout(err):
+		return TransferReasonTimeout
+	default:
+		return TransferReasonInternal
+	}
+}
+
+// cacheCollector exports the statistics of a cache, read once per scrape.
+type cacheCollector struct {
+	stats func() CacheStats
+
+	hits, misses, evictions, expirations, coalesced, size *prometheus.Desc
+}
+
+func newCacheCollector(name string, stats func() CacheStats) prometheus.Collector {
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc("cache_"+metric, help, nil, prometheus.Labels{"cache": name})
+	}
+	return &cacheCollector{
+		stats:       stats,
+		hits:        desc("hits_total", "Cache hits."),
+		misses:      desc("misses_total", "Cache misses."),
+		evictions:   desc("evictions_total", "Entries evicted to make room."),
+		expirations: desc("expirations_total", "Entries dropped after their TTL."),
+		coalesced:   desc("coalesced_total", "Misses served by a load already in flight."),
+		size:        desc("entries", "Entries currently cached."),
+	}
+}
+
+func (cc *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{cc.hits, cc.misses, cc.evictions, cc.expirations, cc.coalesced, cc.size} {
+		ch <- d
+	}
+}
+
+func (cc *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := cc.stats()
+	ch <- prometheus.MustNewConstMetric(cc.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(cc.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(cc.evictions, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(cc.expirations, prometheus.CounterValue, float64(s.Expirations))
+	ch <- prometheus.MustNewConstMetric(cc.coalesced, prometheus.CounterValue, float64(s.Coalesced))
+	ch <- prometheus.MustNewConstMetric(cc.size, prometheus.GaugeValue, float64(s.Size))
+}
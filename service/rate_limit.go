@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"go-app/internals/db"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The stores of the rate limits.
+const (
+	RateLimitStoreMemory  = "memory"
+	RateLimitStoreMongoDB = "mongodb"
+)
+
+// RateLimitResult is the state of a token bucket after a request took a token from it.
+type RateLimitResult struct {
+	Allowed bool
+	Limit   int
+	// Remaining is the number of requests allowed right now.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when Allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the token buckets of the rate limits. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, which holds up to limit tokens and is refilled with limit tokens per
+	// period. Buckets start full.
+	Take(ctx context.Context, key string, limit int, period time.Duration) (*RateLimitResult, error)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// fullAt is when the bucket is full again, the bucket can be dropped from then on.
+	fullAt time.Time
+}
+
+func newTokenBucket(now time.Time, limit int) *tokenBucket {
+	return &tokenBucket{tokens: float64(limit), updatedAt: now, fullAt: now}
+}
+
+// take refills the bucket for the time elapsed since its last update and takes a token when there is one.
+func (b *tokenBucket) take(now time.Time, limit int, period time.Duration) *RateLimitResult {
+	rate := float64(limit) / period.Seconds()
+	// the clocks of the instances sharing a bucket may disagree, it is never refilled backwards
+	if now.After(b.updatedAt) {
+		b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+		b.updatedAt = now
+	}
+	res := &RateLimitResult{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit) - b.tokens) / rate)
+	b.fullAt = b.updatedAt.Add(res.Reset)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// pruneEvery is the number of takes between two sweeps of the full buckets of the memory store.
+const pruneEvery = 1024
+
+// MemoryRateLimitStoreImpl keeps the buckets in process, each instance of the app limits the requests it serves.
+type MemoryRateLimitStoreImpl struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+	now     func() time.Time
+}
+
+type MemoryRateLimitStoreOpts struct {
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+func NewMemoryRateLimitStore(opts *MemoryRateLimitStoreOpts) RateLimitStore {
+	s := MemoryRateLimitStoreImpl{
+		buckets: map[string]*tokenBucket{},
+		now:     opts.Now,
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return &s
+}
+
+func (s *MemoryRateLimitStoreImpl) Take(ctx context.Context, key string, limit int, period time.Duration) (*RateLimitResult, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.takes++
+	if s.takes%pruneEvery == 0 {
+		// full buckets are the same as missing ones
+		for k, b := range s.buckets {
+			if !now.Before(b.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = newTokenBucket(now, limit)
+		s.buckets[key] = b
+	}
+	return b.take(now, limit, period), nil
+}
+
+// maxRateLimitRetries bounds the compare-and-swap attempts on a bucket updated concurrently.
+const maxRateLimitRetries = 5
+
+// MongoRateLimitStoreImpl keeps the buckets in mongodb, the instances of the app share them. The idle buckets are
+// dropped by a TTL index on expires_at, see Service.EnsureIndexes.
+type MongoRateLimitStoreImpl struct {
+	DB  db.DB
+	now func() time.Time
+}
+
+type MongoRateLimitStoreOpts struct {
+	DB db.DB
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+func NewMongoRateLimitStore(opts *MongoRateLimitStoreOpts) RateLimitStore {
+	s := MongoRateLimitStoreImpl{
+		DB:  opts.DB,
+		now: opts.Now,
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return &s
+}
+
+func (s *MongoRateLimitStoreImpl) collection() mongodb.Collection {
+	return s.DB.MongoDB().Cli().Database(model.AuthDB).Collection(model.RateLimitColl)
+}
+
+func (s *MongoRateLimitStoreImpl) Take(ctx context.Context, key string, limit int, period time.Duration) (*RateLimitResult, error) {
+	for i := 0; i < maxRateLimitRetries; i++ {
+		now := s.now()
+		var m model.RateLimitBucket
+		err := s.collection().FindOne(ctx, bson.M{"_id": key}).Decode(&m)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			b := newTokenBucket(now, limit)
+			res := b.take(now, limit, period)
+			_, err := s.collection().InsertOne(ctx, model.RateLimitBucket{ID: key, Tokens: b.tokens, UpdatedAt: b.updatedAt, ExpiresAt: b.fullAt})
+			if mongo.IsDuplicateKeyError(err) {
+				// created concurrently
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create rate limit bucket")
+			}
+			return res, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get rate limit bucket")
+		}
+
+		b := &tokenBucket{tokens: m.Tokens, updatedAt: m.UpdatedAt}
+		res := b.take(now, limit, period)
+		if !res.Allowed {
+			// no token was taken, the refill is computed again by the next request
+			return res, nil
+		}
+		update := bson.M{
+			"$set": bson.M{"tokens": b.tokens, "updated_at": b.updatedAt, "expires_at": b.fullAt},
+			"$inc": bson.M{"version": 1},
+		}
+		ur, err := s.collection().UpdateOne(ctx, bson.M{"_id": key, "version": m.Version}, update)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to update rate limit bucket")
+		}
+		if ur.MatchedCount == 1 {
+			return res, nil
+		}
+	}
+	// the request is rejected rather than letting the contention on the bucket bypass the limit
+	return &RateLimitResult{Limit: limit, RetryAfter: period / time.Duration(limit), Reset: period}, nil
+}
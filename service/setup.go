@@ -2,8 +2,14 @@ package service
 
 import (
 	"context"
+	"go-app/internals/auth"
 	"go-app/internals/config"
+	"go-app/internals/db"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 )
 
@@ -12,6 +18,12 @@ type DemoServiceImpl struct {
 	Logger  *zerolog.Logger
 	Config  *config.DemoServiceConfig
 	Service Service
+	// AccountCache caches account details by account id, nil when caching is disabled.
+	AccountCache *ReadThroughCache
+	// Metrics holds the business counters, nil disables them.
+	Metrics *DemoServiceMetrics
+	// Policy authorizes the callers on the accounts.
+	Policy Policy
 }
 
 type DemoServiceOpts struct {
@@ -19,6 +31,10 @@ type DemoServiceOpts struct {
 	Logger  *zerolog.Logger
 	Config  *config.DemoServiceConfig
 	Service Service
+	// Metrics registers the business counters, they are not exported when nil.
+	Metrics prometheus.Registerer
+	// Policy authorizes the callers on the accounts, nil uses the AccountRules.
+	Policy Policy
 }
 
 func NewDemoService(opts *DemoServiceOpts) DemoService {
@@ -28,13 +44,122 @@ func NewDemoService(opts *DemoServiceOpts) DemoService {
 		Logger:  opts.Logger,
 		Config:  opts.Config,
 		Service: opts.Service,
+		Metrics: NewDemoServiceMetrics(opts.Metrics),
+		Policy:  opts.Policy,
+	}
+	if ds.Policy == nil {
+		ds.Policy = NewRolePolicy(&RolePolicyOpts{Rules: AccountRules})
+	}
+	if c := opts.Config.AccountCacheConfig; c != nil && c.Enabled {
+		ds.AccountCache = NewReadThroughCache(NewLRUCache(&LRUCacheOpts{Size: c.Size, TTL: c.TTL}))
+		if opts.Metrics != nil {
+			opts.Metrics.MustRegister(newCacheCollector("account", ds.AccountCacheStats))
+		}
 	}
 	return &ds
 }
 
-type HTTPImpl struct{}
+type HTTPImpl struct {
+	Client *http.Client
+}
+
+type HTTPOpts struct {
+	// Transport wraps the outbound requests, e.g. to trace them. nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+}
 
-func NewHttp() HTTP {
-	h := HTTPImpl{}
+func NewHttp(opts *HTTPOpts) HTTP {
+	h := HTTPImpl{
+		Client: &http.Client{Transport: opts.Transport},
+	}
 	return &h
 }
+
+type APIKeyServiceImpl struct {
+	Logger *zerolog.Logger
+	DB     db.DB
+}
+
+type APIKeyServiceOpts struct {
+	Logger *zerolog.Logger
+	// DB holds the api keys, the api key command uses it without the other services.
+	DB db.DB
+}
+
+func NewAPIKeyService(opts *APIKeyServiceOpts) APIKeyService {
+	aks := APIKeyServiceImpl{
+		Logger: opts.Logger,
+		DB:     opts.DB,
+	}
+	return &aks
+}
+
+// The token lifetimes and the second factor settings used when they are not configured.
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	defaultTOTPIssuer      = "go-app"
+	defaultTOTPSkew        = 1
+	defaultRecoveryCodes   = 10
+	defaultTOTPMaxAttempts = 5
+	defaultTOTPLockout     = 15 * time.Minute
+)
+
+type UserServiceImpl struct {
+	Logger *zerolog.Logger
+	Config *config.UserServiceConfig
+	DB     db.DB
+	// JWT signs the access tokens, the users cannot log in when it is nil.
+	JWT       auth.JWT
+	Passwords auth.PasswordHasher
+
+	// dummy is verified for unknown emails, it is hashed on the first login.
+	dummy     string
+	dummyOnce sync.Once
+}
+
+type UserServiceOpts struct {
+	Logger    *zerolog.Logger
+	Config    *config.UserServiceConfig
+	DB        db.DB
+	JWT       auth.JWT
+	Passwords auth.PasswordHasher
+}
+
+func NewUserService(opts *UserServiceOpts) UserService {
+	c := config.UserServiceConfig{}
+	if opts.Config != nil {
+		c = *opts.Config
+	}
+	if c.AccessTokenTTL <= 0 {
+		c.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if c.RefreshTokenTTL <= 0 {
+		c.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+	totp := config.TOTPConfig{Skew: defaultTOTPSkew}
+	if c.TOTP != nil {
+		totp = *c.TOTP
+	}
+	if totp.Issuer == "" {
+		totp.Issuer = defaultTOTPIssuer
+	}
+	if totp.RecoveryCodes <= 0 {
+		totp.RecoveryCodes = defaultRecoveryCodes
+	}
+	if totp.MaxAttempts <= 0 {
+		totp.MaxAttempts = defaultTOTPMaxAttempts
+	}
+	if totp.Lockout <= 0 {
+		totp.Lockout = defaultTOTPLockout
+	}
+	c.TOTP = &totp
+	us := UserServiceImpl{
+		Logger:    opts.Logger,
+		Config:    &c,
+		DB:        opts.DB,
+		JWT:       opts.JWT,
+		Passwords: opts.Passwords,
+	}
+	return &us
+}
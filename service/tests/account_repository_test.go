@@ -0,0 +1,221 @@
+package test_service
+
+import (
+	"context"
+	"go-app/model"
+	"go-app/service"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAccountRepositoryImpl_UpdateVersioned(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+
+	type args struct {
+		ctx    context.Context
+		acc    *model.Account
+		update bson.M
+	}
+
+	type TC struct {
+		name     string
+		args     args
+		wantErr  bool
+		err      error
+		prepare  func(tt *TC)
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "success",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$set": bson.M{"balance": 50}},
+			},
+			wantErr: false,
+			prepare: func(tt *TC) {
+				tt.args.acc = CreateDemoAccountWithBalance(t, accountColl, 100)
+			},
+			validate: func(tt *TC) {
+				assert.EqualValues(t, 1, tt.args.acc.Version)
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.EqualValues(t, 1, doc.Version)
+				assert.Equal(t, float32(50), doc.Balance)
+			},
+		},
+		{
+			name: "success for document without version field",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$set": bson.M{"balance": 10}},
+			},
+			wantErr: false,
+			prepare: func(tt *TC) {
+				id := primitive.NewObjectID()
+				_, err := accountColl.InsertOne(context.TODO(), bson.M{"_id": id, "account_holder_name": gofakeit.Name(), "balance": 20})
+				assert.Nil(t, err)
+				tt.args.acc = &model.Account{ID: id}
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.EqualValues(t, 1, doc.Version)
+				assert.Equal(t, float32(10), doc.Balance)
+			},
+		},
+		{
+			name: "success with $inc as bson.D",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$inc": bson.D{{Key: "balance", Value: -30}}},
+			},
+			wantErr: false,
+			prepare: func(tt *TC) {
+				tt.args.acc = CreateDemoAccountWithBalance(t, accountColl, 100)
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.EqualValues(t, 1, doc.Version)
+				assert.Equal(t, float32(70), doc.Balance)
+			},
+		},
+		{
+			name: "success with $inc as a map",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$inc": map[string]interface{}{"balance": 5}},
+			},
+			wantErr: false,
+			prepare: func(tt *TC) {
+				tt.args.acc = CreateDemoAccountWithBalance(t, accountColl, 100)
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.EqualValues(t, 1, doc.Version)
+				assert.Equal(t, float32(105), doc.Balance)
+			},
+		},
+		{
+			name: "unsupported $inc",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$inc": "balance"},
+			},
+			wantErr: true,
+			prepare: func(tt *TC) {
+				tt.args.acc = CreateDemoAccountWithBalance(t, accountColl, 100)
+			},
+			validate: func(tt *TC) {
+				assert.EqualValues(t, 0, tt.args.acc.Version)
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.EqualValues(t, 0, doc.Version)
+				assert.Equal(t, float32(100), doc.Balance)
+			},
+		},
+		{
+			name: "conflict on stale version",
+			args: args{
+				ctx:    context.TODO(),
+				update: bson.M{"$set": bson.M{"balance": 0}},
+			},
+			wantErr: true,
+			err:     service.ErrVersionConflict,
+			prepare: func(tt *TC) {
+				acc := CreateDemoAccountWithBalance(t, accountColl, 100)
+				// concurrent writer bumps the version after acc was read
+				_, err := accountColl.UpdateOne(context.TODO(), bson.M{"_id": acc.ID}, bson.M{"$inc": bson.M{"version": 1}})
+				assert.Nil(t, err)
+				tt.args.acc = acc
+			},
+			validate: func(tt *TC) {
+				assert.EqualValues(t, 0, tt.args.acc.Version)
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.args.acc.ID}, &doc))
+				assert.Equal(t, float32(100), doc.Balance)
+			},
+		},
+		{
+			name: "account does not exist",
+			args: args{
+				ctx:    context.TODO(),
+				acc:    &model.Account{ID: primitive.NewObjectID()},
+				update: bson.M{"$set": bson.M{"balance": 0}},
+			},
+			wantErr:  true,
+			err:      mongo.ErrNoDocuments,
+			prepare:  func(tt *TC) {},
+			validate: func(tt *TC) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			r := service.NewAccountRepository(tsi.Service.MongoDB())
+			err := r.UpdateVersioned(tt.args.ctx, tt.args.acc, tt.args.update)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AccountRepositoryImpl.UpdateVersioned() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
+			}
+			tt.validate(&tt)
+		})
+	}
+}
+
+func TestRetryOnConflict(t *testing.T) {
+	t.Parallel()
+
+	conflict := &service.VersionConflictError{Collection: model.AccountColl, ID: primitive.NewObjectID()}
+
+	type TC struct {
+		name      string
+		attempts  int
+		failures  int
+		failWith  error
+		wantCalls int
+		wantErr   error
+	}
+
+	tests := []TC{
+		{name: "success on first attempt", attempts: 3, failures: 0, failWith: conflict, wantCalls: 1, wantErr: nil},
+		{name: "success after conflicts", attempts: 3, failures: 2, failWith: conflict, wantCalls: 3, wantErr: nil},
+		{name: "gives up after attempts", attempts: 3, failures: 5, failWith: conflict, wantCalls: 3, wantErr: service.ErrVersionConflict},
+		{name: "other errors are not retried", attempts: 3, failures: 5, failWith: mongo.ErrNoDocuments, wantCalls: 1, wantErr: mongo.ErrNoDocuments},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := service.RetryOnConflict(context.TODO(), tt.attempts, func(ctx context.Context) error {
+				calls++
+				if calls <= tt.failures {
+					return tt.failWith
+				}
+				return nil
+			})
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.wantErr))
+			}
+		})
+	}
+}
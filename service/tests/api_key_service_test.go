@@ -0,0 +1,252 @@
+package test_service
+
+import (
+	"context"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newAPIKeyService(tsi *TestService) service.APIKeyService {
+	return service.NewAPIKeyService(&service.APIKeyServiceOpts{Logger: &zerolog.Logger{}, DB: tsi.Service})
+}
+
+func TestAPIKeyServiceImpl_Issue(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	keyColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.APIKeyColl)
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Millisecond)
+
+	type TC struct {
+		name     string
+		opts     *schema.APIKey_IssueOpts
+		wantErr  bool
+		err      error
+		validate func(tt *TC, resp *schema.APIKey_IssueResp)
+	}
+
+	tests := []TC{
+		{
+			name: "success",
+			opts: &schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{schema.ScopeAccountsRead}, ExpiresAt: &expiresAt},
+			validate: func(tt *TC, resp *schema.APIKey_IssueResp) {
+				assert.True(t, strings.HasPrefix(resp.Key, resp.Prefix+"_"))
+				assert.True(t, strings.HasPrefix(resp.Prefix, service.APIKeyPrefix))
+				var doc model.APIKey
+				assert.Nil(t, Get_DocByFilter(keyColl, bson.M{"_id": resp.ID}, &doc))
+				assert.Equal(t, "billing", doc.Name)
+				assert.Equal(t, []string{schema.ScopeAccountsRead}, doc.Scopes)
+				assert.True(t, expiresAt.Equal(*doc.ExpiresAt))
+				// only the hash of the key is stored
+				assert.Len(t, doc.Hash, 64)
+				assert.NotContains(t, doc.Hash, resp.Key)
+			},
+		},
+		{
+			name:    "unknown scope",
+			opts:    &schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{"accounts:delete"}},
+			wantErr: true,
+			err:     service.ErrUnknownScope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newAPIKeyService(tsi).Issue(context.TODO(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("APIKeyServiceImpl.Issue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, resp)
+		})
+	}
+}
+
+func TestAPIKeyServiceImpl_Authenticate(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	keyColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.APIKeyColl)
+	s := newAPIKeyService(tsi)
+	issue := func(opts *schema.APIKey_IssueOpts) *schema.APIKey_IssueResp {
+		resp, err := s.Issue(context.TODO(), opts)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	type TC struct {
+		name     string
+		key      string
+		wantErr  bool
+		err      error
+		prepare  func(tt *TC)
+		validate func(tt *TC, key *schema.APIKey_Get)
+	}
+
+	tests := []TC{
+		{
+			name: "valid key records its use",
+			prepare: func(tt *TC) {
+				tt.key = issue(&schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{schema.ScopeTransfersWrite}}).Key
+			},
+			validate: func(tt *TC, key *schema.APIKey_Get) {
+				assert.Equal(t, "billing", key.Name)
+				assert.True(t, key.HasScopes(schema.ScopeTransfersWrite))
+				assert.False(t, key.HasScopes(schema.ScopeAccountsRead))
+				var doc model.APIKey
+				assert.Nil(t, Get_DocByFilter(keyColl, bson.M{"_id": key.ID}, &doc))
+				assert.NotNil(t, doc.LastUsedAt)
+			},
+		},
+		{
+			name:    "unknown key",
+			key:     service.APIKeyPrefix + "000000000000_secret",
+			wantErr: true,
+			err:     service.ErrInvalidAPIKey,
+			prepare: func(tt *TC) {},
+		},
+		{
+			name:    "malformed key",
+			key:     "secret",
+			wantErr: true,
+			err:     service.ErrInvalidAPIKey,
+			prepare: func(tt *TC) {},
+		},
+		{
+			name:    "expired key",
+			wantErr: true,
+			err:     service.ErrAPIKeyExpired,
+			prepare: func(tt *TC) {
+				expiresAt := time.Now().Add(-time.Minute)
+				tt.key = issue(&schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{schema.ScopeAccountsRead}, ExpiresAt: &expiresAt}).Key
+			},
+		},
+		{
+			name:    "revoked key",
+			wantErr: true,
+			err:     service.ErrAPIKeyRevoked,
+			prepare: func(tt *TC) {
+				resp := issue(&schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{schema.ScopeAccountsRead}})
+				assert.Nil(t, s.Revoke(context.TODO(), resp.ID))
+				tt.key = resp.Key
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			key, err := s.Authenticate(context.TODO(), tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("APIKeyServiceImpl.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, key)
+		})
+	}
+}
+
+func TestAPIKeyServiceImpl_Rotate(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newAPIKeyService(tsi)
+
+	type TC struct {
+		name     string
+		grace    time.Duration
+		wantErr  bool
+		err      error
+		prepare  func(tt *TC) primitive.ObjectID
+		validate func(tt *TC, old string, resp *schema.APIKey_IssueResp)
+	}
+
+	var oldKey string
+	issue := func(tt *TC) primitive.ObjectID {
+		resp, err := s.Issue(context.TODO(), &schema.APIKey_IssueOpts{Name: "billing", Scopes: []string{schema.ScopeAccountsRead, schema.ScopeTransfersWrite}})
+		assert.Nil(t, err)
+		oldKey = resp.Key
+		return resp.ID
+	}
+
+	tests := []TC{
+		{
+			name:    "old key stays valid during the grace period",
+			grace:   time.Hour,
+			prepare: issue,
+			validate: func(tt *TC, old string, resp *schema.APIKey_IssueResp) {
+				assert.Equal(t, []string{schema.ScopeAccountsRead, schema.ScopeTransfersWrite}, resp.Scopes)
+				key, err := s.Authenticate(context.TODO(), resp.Key)
+				assert.Nil(t, err)
+				assert.NotNil(t, key.RotatedFrom)
+				oldKey, err := s.Authenticate(context.TODO(), old)
+				assert.Nil(t, err)
+				assert.Equal(t, resp.ID, *oldKey.RotatedTo)
+				assert.NotNil(t, oldKey.ExpiresAt)
+			},
+		},
+		{
+			name:    "old key expires without grace period",
+			prepare: issue,
+			validate: func(tt *TC, old string, resp *schema.APIKey_IssueResp) {
+				_, err := s.Authenticate(context.TODO(), old)
+				assert.True(t, errors.Is(err, service.ErrAPIKeyExpired))
+			},
+		},
+		{
+			name:    "revoked key",
+			wantErr: true,
+			err:     service.ErrAPIKeyRevoked,
+			prepare: func(tt *TC) primitive.ObjectID {
+				id := issue(tt)
+				assert.Nil(t, s.Revoke(context.TODO(), id))
+				return id
+			},
+		},
+		{
+			name:    "unknown key",
+			wantErr: true,
+			err:     service.ErrAPIKeyNotFound,
+			prepare: func(tt *TC) primitive.ObjectID {
+				return primitive.NewObjectID()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := tt.prepare(&tt)
+			resp, err := s.Rotate(context.TODO(), &schema.APIKey_RotateOpts{ID: id, GracePeriod: tt.grace})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("APIKeyServiceImpl.Rotate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, oldKey, resp)
+		})
+	}
+}
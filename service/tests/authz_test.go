@@ -0,0 +1,257 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userContext returns the context of a request authenticated by a bearer token of the user id.
+func userContext(id primitive.ObjectID, roles ...string) context.Context {
+	return context.WithValue(context.TODO(), schema.ClaimsKey, &schema.Claims{Subject: id.Hex(), Roles: roles})
+}
+
+func TestRolePolicyImpl_Authorize(t *testing.T) {
+
+	p := service.NewRolePolicy(&service.RolePolicyOpts{Rules: service.AccountRules})
+	owner := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	type TC struct {
+		name    string
+		id      *schema.Identity
+		action  string
+		res     *service.Resource
+		wantErr bool
+	}
+
+	tests := []TC{
+		{
+			name:   "owner reads the account",
+			id:     &schema.Identity{UserID: &owner, Roles: []string{schema.RoleCustomer}},
+			action: service.ActionAccountRead,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:    "customer reads the account of another user",
+			id:      &schema.Identity{UserID: &other, Roles: []string{schema.RoleCustomer}},
+			action:  service.ActionAccountRead,
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+		{
+			name:    "customer reads an account without owner",
+			id:      &schema.Identity{UserID: &owner, Roles: []string{schema.RoleCustomer}},
+			action:  service.ActionAccountRead,
+			res:     &service.Resource{},
+			wantErr: true,
+		},
+		{
+			name:    "token without user reads an account",
+			id:      &schema.Identity{Roles: []string{schema.RoleCustomer}},
+			action:  service.ActionAccountRead,
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+		{
+			name:   "teller reads the account of a customer",
+			id:     &schema.Identity{UserID: &other, Roles: []string{schema.RoleTeller}},
+			action: service.ActionAccountRead,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:   "teller opens an account for a customer",
+			id:     &schema.Identity{UserID: &other, Roles: []string{schema.RoleTeller}},
+			action: service.ActionAccountCreate,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:    "teller transfers from the account of a customer",
+			id:      &schema.Identity{UserID: &other, Roles: []string{schema.RoleTeller}},
+			action:  service.ActionTransfer,
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+		{
+			name:   "admin transfers from the account of a customer",
+			id:     &schema.Identity{UserID: &other, Roles: []string{schema.RoleAdmin}},
+			action: service.ActionTransfer,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:   "api key with the scope of the action",
+			id:     &schema.Identity{APIKey: &schema.APIKey_Get{ID: other, Scopes: []string{schema.ScopeTransfersWrite}}},
+			action: service.ActionTransfer,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:    "api key without the scope of the action",
+			id:      &schema.Identity{APIKey: &schema.APIKey_Get{ID: other, Scopes: []string{schema.ScopeAccountsRead}}},
+			action:  service.ActionTransfer,
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+		{
+			name:   "api key reads an account",
+			id:     &schema.Identity{APIKey: &schema.APIKey_Get{ID: other, Scopes: []string{schema.ScopeAccountsRead}}},
+			action: service.ActionAccountRead,
+			res:    &service.Resource{OwnerID: &owner},
+		},
+		{
+			name:    "api key on an action without rule",
+			id:      &schema.Identity{APIKey: &schema.APIKey_Get{ID: other, Scopes: schema.Scopes}},
+			action:  "account:close",
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+		{
+			name:    "action without rule",
+			id:      &schema.Identity{UserID: &owner, Roles: []string{schema.RoleAdmin}},
+			action:  "account:close",
+			res:     &service.Resource{OwnerID: &owner},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Authorize(tt.id, tt.action, tt.res)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RolePolicyImpl.Authorize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, service.ErrForbidden))
+				assert.Equal(t, tt.action+" is not allowed", err.Error())
+			}
+		})
+	}
+}
+
+func TestDemoServiceImpl_Authorization(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+	// the cache is shared by the callers, they are authorized on every read
+	dsi := service.NewDemoService(&service.DemoServiceOpts{
+		Ctx:     context.TODO(),
+		Logger:  &zerolog.Logger{},
+		Config:  &config.DemoServiceConfig{AccountCacheConfig: &config.CacheConfig{Enabled: true}},
+		Service: tsi.Service,
+	})
+
+	jane := primitive.NewObjectID()
+	john := primitive.NewObjectID()
+	teller := primitive.NewObjectID()
+	account, err := dsi.Account_Create(userContext(jane, schema.RoleCustomer), &schema.Account_CreateOpts{AccountHolderName: "Jane Doe"})
+	assert.Nil(t, err)
+	_, err = accountColl.UpdateOne(context.TODO(), bson.M{"_id": account.ID}, bson.M{"$set": bson.M{"balance": 100}})
+	assert.Nil(t, err)
+	other := CreateDemoAccountWithZeroBalance(t, accountColl)
+
+	type TC struct {
+		name     string
+		run      func(tt *TC) error
+		wantErr  bool
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "account is owned by its creator",
+			run: func(tt *TC) error {
+				_, err := dsi.GetAccountDetailWithTransactions(userContext(jane, schema.RoleCustomer), &schema.AccountTransaction_GetOpts{ID: account.ID})
+				return err
+			},
+			validate: func(tt *TC) {
+				assert.Equal(t, jane, *account.OwnerID)
+			},
+		},
+		{
+			name: "customer reads the account of another user",
+			run: func(tt *TC) error {
+				_, err := dsi.GetAccountDetailWithTransactions(userContext(john, schema.RoleCustomer), &schema.AccountTransaction_GetOpts{ID: account.ID})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "teller reads the account of a customer",
+			run: func(tt *TC) error {
+				resp, err := dsi.GetAccountDetailWithTransactions(userContext(teller, schema.RoleTeller), &schema.AccountTransaction_GetOpts{ID: account.ID})
+				if err == nil {
+					assert.Equal(t, jane, *resp.OwnerID)
+				}
+				return err
+			},
+		},
+		{
+			name: "customer opens an account for another user",
+			run: func(tt *TC) error {
+				_, err := dsi.Account_Create(userContext(john, schema.RoleCustomer), &schema.Account_CreateOpts{AccountHolderName: "Jane Doe", OwnerID: &jane})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "teller opens an account for a customer",
+			run: func(tt *TC) error {
+				resp, err := dsi.Account_Create(userContext(teller, schema.RoleTeller), &schema.Account_CreateOpts{AccountHolderName: "John Doe", OwnerID: &john})
+				if err == nil {
+					assert.Equal(t, john, *resp.OwnerID)
+				}
+				return err
+			},
+		},
+		{
+			name: "customer transfers from the account of another user",
+			run: func(tt *TC) error {
+				return dsi.Transaction_Create(userContext(john, schema.RoleCustomer), &schema.Transaction_CreateOpts{CreditAccountID: account.ID, DebitAccountID: other.ID, Amount: 10})
+			},
+			wantErr: true,
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": account.ID}, &doc))
+				assert.Equal(t, float32(100), doc.Balance)
+			},
+		},
+		{
+			name: "owner transfers from the account",
+			run: func(tt *TC) error {
+				return dsi.Transaction_Create(userContext(jane, schema.RoleCustomer), &schema.Transaction_CreateOpts{CreditAccountID: account.ID, DebitAccountID: other.ID, Amount: 10})
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": other.ID}, &doc))
+				assert.Equal(t, float32(10), doc.Balance)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(&tt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DemoServiceImpl error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, service.ErrForbidden))
+			}
+			if tt.validate != nil {
+				tt.validate(&tt)
+			}
+		})
+	}
+}
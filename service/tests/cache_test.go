@@ -0,0 +1,202 @@
+package test_service
+
+import (
+	"context"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheImpl(t *testing.T) {
+	t.Parallel()
+
+	type TC struct {
+		name     string
+		opts     *service.LRUCacheOpts
+		run      func(c service.Cache)
+		validate func(c service.Cache)
+	}
+
+	tests := []TC{
+		{
+			name: "hit and miss",
+			opts: &service.LRUCacheOpts{Size: 2, TTL: time.Minute},
+			run: func(c service.Cache) {
+				c.Set("a", 1)
+				v, ok := c.Get("a")
+				assert.True(t, ok)
+				assert.Equal(t, 1, v)
+				_, ok = c.Get("b")
+				assert.False(t, ok)
+			},
+			validate: func(c service.Cache) {
+				assert.Equal(t, service.CacheStats{Hits: 1, Misses: 1, Size: 1}, c.Stats())
+			},
+		},
+		{
+			name: "evicts least recently used",
+			opts: &service.LRUCacheOpts{Size: 2, TTL: time.Minute},
+			run: func(c service.Cache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Get("a")
+				c.Set("c", 3)
+			},
+			validate: func(c service.Cache) {
+				_, ok := c.Get("b")
+				assert.False(t, ok)
+				_, ok = c.Get("a")
+				assert.True(t, ok)
+				_, ok = c.Get("c")
+				assert.True(t, ok)
+				assert.EqualValues(t, 1, c.Stats().Evictions)
+				assert.Equal(t, 2, c.Stats().Size)
+			},
+		},
+		{
+			name: "expires entries after ttl",
+			opts: &service.LRUCacheOpts{Size: 2, TTL: 10 * time.Millisecond},
+			run: func(c service.Cache) {
+				c.Set("a", 1)
+				time.Sleep(20 * time.Millisecond)
+			},
+			validate: func(c service.Cache) {
+				_, ok := c.Get("a")
+				assert.False(t, ok)
+				assert.EqualValues(t, 1, c.Stats().Expirations)
+				assert.Equal(t, 0, c.Stats().Size)
+			},
+		},
+		{
+			name: "delete",
+			opts: &service.LRUCacheOpts{Size: 2, TTL: time.Minute},
+			run: func(c service.Cache) {
+				c.Set("a", 1)
+				c.Set("b", 2)
+				c.Delete("a", "b", "c")
+			},
+			validate: func(c service.Cache) {
+				assert.Equal(t, 0, c.Stats().Size)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := service.NewLRUCache(tt.opts)
+			tt.run(c)
+			tt.validate(c)
+		})
+	}
+}
+
+func TestReadThroughCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("coalesces concurrent misses", func(t *testing.T) {
+		rt := service.NewReadThroughCache(service.NewLRUCache(&service.LRUCacheOpts{}))
+		release := make(chan struct{})
+		loads := 0
+		load := func(ctx context.Context) (interface{}, error) {
+			loads++
+			<-release
+			return "value", nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := rt.Get(context.TODO(), "key", load)
+				assert.Nil(t, err)
+				assert.Equal(t, "value", v)
+			}()
+		}
+		// let every caller reach the in-flight load
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, 1, loads)
+		assert.EqualValues(t, 9, rt.Stats().Coalesced)
+
+		v, err := rt.Get(context.TODO(), "key", load)
+		assert.Nil(t, err)
+		assert.Equal(t, "value", v)
+		assert.Equal(t, 1, loads)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		rt := service.NewReadThroughCache(service.NewLRUCache(&service.LRUCacheOpts{}))
+		_, err := rt.Get(context.TODO(), "key", func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("failed")
+		})
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, rt.Stats().Size)
+	})
+
+	t.Run("invalidation discards in-flight loads", func(t *testing.T) {
+		rt := service.NewReadThroughCache(service.NewLRUCache(&service.LRUCacheOpts{}))
+		v, err := rt.Get(context.TODO(), "key", func(ctx context.Context) (interface{}, error) {
+			rt.Invalidate("key")
+			return "stale", nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "stale", v)
+		assert.Equal(t, 0, rt.Stats().Size)
+	})
+}
+
+func TestDemoServiceImpl_GetAccountDetailWithTransactions_Cache(t *testing.T) {
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+	creditAccount := CreateDemoAccountWithBalance(t, accountColl, 100)
+	debitAccount := CreateDemoAccountWithZeroBalance(t, accountColl)
+
+	dsi := &service.DemoServiceImpl{
+		Ctx:          context.TODO(),
+		Logger:       &zerolog.Logger{},
+		Service:      tsi.Service,
+		AccountCache: service.NewReadThroughCache(service.NewLRUCache(&service.LRUCacheOpts{Size: 10, TTL: time.Minute})),
+	}
+	opts := &schema.AccountTransaction_GetOpts{ID: creditAccount.ID}
+
+	got, err := dsi.GetAccountDetailWithTransactions(context.TODO(), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(100), got.Balance)
+	assert.Len(t, got.Transactions, 0)
+
+	// callers get their own copy of the cached value
+	got.Balance = -1
+	got, err = dsi.GetAccountDetailWithTransactions(context.TODO(), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(100), got.Balance)
+	assert.Equal(t, service.CacheStats{Hits: 1, Misses: 1, Size: 1}, dsi.AccountCacheStats())
+
+	err = dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{
+		CreditAccountID: creditAccount.ID,
+		DebitAccountID:  debitAccount.ID,
+		Amount:          40,
+	})
+	assert.Nil(t, err)
+
+	got, err = dsi.GetAccountDetailWithTransactions(context.TODO(), opts)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(60), got.Balance)
+	assert.Len(t, got.Transactions, 2)
+	assert.EqualValues(t, 2, dsi.AccountCacheStats().Misses)
+
+	_, err = dsi.GetAccountDetailWithTransactions(context.TODO(), &schema.AccountTransaction_GetOpts{ID: debitAccount.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, dsi.AccountCacheStats().Size)
+}
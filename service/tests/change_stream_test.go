@@ -0,0 +1,368 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeChangeStream delivers events, then fails with err, or blocks until its context is done when err is nil.
+type fakeChangeStream struct {
+	events []bson.Raw
+	err    error
+
+	mu     sync.Mutex
+	cur    bson.Raw
+	closed bool
+}
+
+func (s *fakeChangeStream) Next(ctx context.Context) bool {
+	s.mu.Lock()
+	if len(s.events) > 0 {
+		s.cur, s.events = s.events[0], s.events[1:]
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+	if s.err == nil {
+		<-ctx.Done()
+	}
+	return false
+}
+
+func (s *fakeChangeStream) Decode(v interface{}) error {
+	return bson.Unmarshal(s.cur, v)
+}
+
+func (s *fakeChangeStream) ResumeToken() bson.Raw {
+	return s.cur.Lookup("_id").Document()
+}
+
+func (s *fakeChangeStream) Err() error {
+	return s.err
+}
+
+func (s *fakeChangeStream) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func changeEvent(t *testing.T, token string, doc bson.M) bson.Raw {
+	raw, err := bson.Marshal(bson.M{
+		"_id":           bson.M{"_data": token},
+		"operationType": "insert",
+		"ns":            bson.M{"db": "bank", "coll": "transactions"},
+		"fullDocument":  doc,
+	})
+	assert.Nil(t, err)
+	return raw
+}
+
+// fakeOpener opens the streams in order, once they are all opened the next ones block until closed.
+type fakeOpener struct {
+	mu      sync.Mutex
+	streams []*fakeChangeStream
+	errs    []error
+	// opened receives the time and the resume token of every opening.
+	opened chan openCall
+}
+
+type openCall struct {
+	at         time.Time
+	startAfter interface{}
+}
+
+func newFakeOpener(errs []error, streams ...*fakeChangeStream) *fakeOpener {
+	return &fakeOpener{streams: streams, errs: errs, opened: make(chan openCall, 100)}
+}
+
+func (o *fakeOpener) Open(ctx context.Context, pipeline interface{}, opts *options.ChangeStreamOptions) (mongodb.ChangeStream, error) {
+	o.opened <- openCall{at: time.Now(), startAfter: opts.StartAfter}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.errs) > 0 {
+		err := o.errs[0]
+		o.errs = o.errs[1:]
+		return nil, err
+	}
+	if len(o.streams) > 0 {
+		s := o.streams[0]
+		o.streams = o.streams[1:]
+		return s, nil
+	}
+	return &fakeChangeStream{}, nil
+}
+
+func (o *fakeOpener) next(t *testing.T) openCall {
+	select {
+	case c := <-o.opened:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("change stream was not opened")
+		return openCall{}
+	}
+}
+
+// recorder is a handler recording the resume token of the events it handles.
+type recorder struct {
+	mu     sync.Mutex
+	tokens []string
+	fail   map[string]int
+	seen   chan string
+}
+
+func newRecorder() *recorder {
+	return &recorder{fail: map[string]int{}, seen: make(chan string, 100)}
+}
+
+func (r *recorder) Handle(ctx context.Context, event *mongodb.ChangeEvent) error {
+	token := event.ID.Lookup("_data").StringValue()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = append(r.tokens, token)
+	r.seen <- token
+	if r.fail[token] > 0 {
+		r.fail[token]--
+		return errors.New("handler failed")
+	}
+	return nil
+}
+
+func (r *recorder) handled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.tokens...)
+}
+
+func (r *recorder) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.seen:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("handled %d events, want %d", i, n)
+		}
+	}
+}
+
+func TestChangeStreamConsumerImpl(t *testing.T) {
+
+	newStore := func() mongodb.ResumeTokenStore {
+		m := mongodb.NewMemoryMongoDB(&mongodb.MemoryMongoDBOpts{})
+		return mongodb.NewResumeTokenStore(m.Cli().Database(mongodb.DefaultResumeTokenDB).Collection(mongodb.DefaultResumeTokenColl))
+	}
+
+	type TC struct {
+		name string
+		run  func(t *testing.T)
+	}
+
+	tests := []TC{
+		{
+			name: "restarts with exponential backoff",
+			run: func(t *testing.T) {
+				failure := errors.New("connection refused")
+				opener := newFakeOpener([]error{failure, failure, failure})
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{
+					Name:       "backoff",
+					Store:      newStore(),
+					MinBackoff: 20 * time.Millisecond,
+					MaxBackoff: 40 * time.Millisecond,
+					Opener:     opener.Open,
+				})
+				c.Start()
+				defer c.Close()
+
+				calls := []openCall{opener.next(t), opener.next(t), opener.next(t), opener.next(t)}
+				assert.GreaterOrEqual(t, calls[1].at.Sub(calls[0].at), 20*time.Millisecond)
+				assert.GreaterOrEqual(t, calls[2].at.Sub(calls[1].at), 40*time.Millisecond)
+				// capped by the max backoff
+				assert.GreaterOrEqual(t, calls[3].at.Sub(calls[2].at), 40*time.Millisecond)
+				assert.Less(t, calls[3].at.Sub(calls[2].at), 500*time.Millisecond)
+			},
+		},
+		{
+			name: "resumes after the last handled event",
+			run: func(t *testing.T) {
+				store := newStore()
+				first := &fakeChangeStream{
+					events: []bson.Raw{changeEvent(t, "1", bson.M{"n": 1}), changeEvent(t, "2", bson.M{"n": 2})},
+					err:    errors.New("stream interrupted"),
+				}
+				second := &fakeChangeStream{events: []bson.Raw{changeEvent(t, "3", bson.M{"n": 3})}}
+				opener := newFakeOpener(nil, first, second)
+				r := newRecorder()
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{
+					Name:       "resume",
+					Store:      store,
+					Handlers:   []mongodb.ChangeHandler{r.Handle},
+					MinBackoff: time.Millisecond,
+					Opener:     opener.Open,
+				})
+				c.Start()
+
+				assert.Nil(t, opener.next(t).startAfter)
+				r.wait(t, 3)
+				resumed := opener.next(t)
+				assert.Nil(t, c.Close())
+
+				assert.Equal(t, []string{"1", "2", "3"}, r.handled())
+				token, ok := resumed.startAfter.(bson.Raw)
+				assert.True(t, ok)
+				assert.Equal(t, "2", token.Lookup("_data").StringValue())
+				assert.True(t, first.closed)
+
+				saved, err := store.Load(context.TODO(), "resume")
+				assert.Nil(t, err)
+				assert.Equal(t, "3", saved.Lookup("_data").StringValue())
+			},
+		},
+		{
+			name: "resumes from the persisted token on start",
+			run: func(t *testing.T) {
+				store := newStore()
+				token, err := bson.Marshal(bson.M{"_data": "41"})
+				assert.Nil(t, err)
+				assert.Nil(t, store.Save(context.TODO(), "restart", token))
+
+				opener := newFakeOpener(nil)
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{Name: "restart", Store: store, Opener: opener.Open})
+				c.Start()
+				startAfter := opener.next(t).startAfter
+				assert.Nil(t, c.Close())
+
+				assert.Equal(t, bson.Raw(token), startAfter)
+			},
+		},
+		{
+			name: "fans out events to every handler in order",
+			run: func(t *testing.T) {
+				stream := &fakeChangeStream{events: []bson.Raw{changeEvent(t, "1", bson.M{"n": 1})}}
+				var mu sync.Mutex
+				var order []string
+				handler := func(name string) mongodb.ChangeHandler {
+					return func(ctx context.Context, event *mongodb.ChangeEvent) error {
+						var doc struct {
+							N int `bson:"n"`
+						}
+						assert.Nil(t, event.DecodeFullDocument(&doc))
+						assert.Equal(t, 1, doc.N)
+						mu.Lock()
+						defer mu.Unlock()
+						order = append(order, name)
+						return nil
+					}
+				}
+				r := newRecorder()
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{
+					Name:     "fan-out",
+					Store:    newStore(),
+					Handlers: []mongodb.ChangeHandler{handler("first"), handler("second")},
+					Opener:   newFakeOpener(nil, stream).Open,
+				})
+				// registered last, it is the last one called
+				c.Register(r.Handle)
+				c.Start()
+				r.wait(t, 1)
+				assert.Nil(t, c.Close())
+
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, []string{"first", "second"}, order)
+			},
+		},
+		{
+			name: "failed handler redelivers the event",
+			run: func(t *testing.T) {
+				store := newStore()
+				first := &fakeChangeStream{events: []bson.Raw{changeEvent(t, "1", bson.M{"n": 1}), changeEvent(t, "2", bson.M{"n": 2})}}
+				second := &fakeChangeStream{events: []bson.Raw{changeEvent(t, "2", bson.M{"n": 2})}}
+				opener := newFakeOpener(nil, first, second)
+				r := newRecorder()
+				r.fail["2"] = 1
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{
+					Name:       "redeliver",
+					Store:      store,
+					Handlers:   []mongodb.ChangeHandler{r.Handle},
+					MinBackoff: time.Millisecond,
+					Opener:     opener.Open,
+				})
+				c.Start()
+				r.wait(t, 3)
+				opener.next(t)
+				resumed := opener.next(t)
+				assert.Nil(t, c.Close())
+
+				assert.Equal(t, []string{"1", "2", "2"}, r.handled())
+				// the failed event was not acknowledged
+				assert.Equal(t, "1", resumed.startAfter.(bson.Raw).Lookup("_data").StringValue())
+			},
+		},
+		{
+			name: "close waits for the in-flight event and stops the consumer",
+			run: func(t *testing.T) {
+				stream := &fakeChangeStream{events: []bson.Raw{changeEvent(t, "1", bson.M{"n": 1})}}
+				opener := newFakeOpener(nil, stream)
+				started, release := make(chan struct{}), make(chan struct{})
+				var handled bool
+				worker := &sync.WaitGroup{}
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{
+					Name:   "close",
+					Store:  newStore(),
+					Worker: worker,
+					Handlers: []mongodb.ChangeHandler{func(ctx context.Context, event *mongodb.ChangeEvent) error {
+						close(started)
+						<-release
+						handled = true
+						return nil
+					}},
+					Opener: opener.Open,
+				})
+				c.Start()
+				opener.next(t)
+				<-started
+
+				closed := make(chan struct{})
+				go func() {
+					assert.Nil(t, c.Close())
+					close(closed)
+				}()
+				select {
+				case <-closed:
+					t.Fatal("close returned before the in-flight event was handled")
+				case <-time.After(50 * time.Millisecond):
+				}
+				close(release)
+				<-closed
+
+				assert.True(t, handled)
+				assert.True(t, stream.closed)
+				worker.Wait()
+				select {
+				case <-opener.opened:
+					t.Fatal("change stream was reopened after close")
+				default:
+				}
+			},
+		},
+		{
+			name: "close before start",
+			run: func(t *testing.T) {
+				c := mongodb.NewChangeStreamConsumer(&mongodb.ChangeStreamConsumerOpts{Name: "idle", Opener: newFakeOpener(nil).Open})
+				assert.Nil(t, c.Close())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
@@ -234,7 +234,7 @@ func TestDemoServiceImpl_Transaction_Create(t *testing.T) {
 				},
 			},
 			wantErr: true,
-			err:     errors.New("invalid credit account"),
+			err:     errors.New("credit account not found: mongo: no documents in result"),
 			prepare: func(tt *TC) {},
 			validate: func(tt *TC) {
 				tranColl := tt.fields.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.TransactionColl)
@@ -312,7 +312,7 @@ func TestDemoServiceImpl_Transaction_Create(t *testing.T) {
 				},
 			},
 			wantErr: true,
-			err:     errors.New("failed to get debit account: mongo: no documents in result"),
+			err:     errors.New("debit account not found: mongo: no documents in result"),
 			prepare: func(tt *TC) {
 				accountColl := tt.fields.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
 				demoAccount := CreateDemoAccountWithBalance(t, accountColl, 100)
@@ -473,6 +473,34 @@ func TestDemoServiceImpl_Transaction_Create(t *testing.T) {
 	}
 }
 
+func TestDemoServiceImpl_Transaction_Create_LookupFailure(t *testing.T) {
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	// the balance cannot be decoded, reading the credit account fails although it exists
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+	creditAccountID := primitive.NewObjectID()
+	_, err := accountColl.InsertOne(context.TODO(), bson.M{"_id": creditAccountID, "balance": "plenty"})
+	assert.Nil(t, err)
+
+	dsi := &service.DemoServiceImpl{
+		Ctx:     context.TODO(),
+		Logger:  &zerolog.Logger{},
+		Config:  config.GetTestConfigFromFile().AppConfig.ServiceConfig.DemoServiceConfig,
+		Service: tsi.Service,
+	}
+	err = dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{
+		CreditAccountID: creditAccountID,
+		DebitAccountID:  primitive.NewObjectID(),
+		Amount:          100,
+	})
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, service.ErrInvalidCreditAccount))
+	assert.True(t, errors.Is(err, service.ErrInternal))
+	assert.Contains(t, err.Error(), "failed to get credit account")
+	Assert_DocCount(t, tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.TransactionColl), bson.M{}, 0)
+}
+
 func TestDemoServiceImpl_Transaction_Create_ACID(t *testing.T) {
 	t.Parallel()
 	tsi := NewTestService(t)
@@ -1044,6 +1072,74 @@ func TestDemoServiceImpl_Transaction_Create_ACID_2(t *testing.T) {
 	assert.Equal(t, float32(max_amount), updatedDemoDebitAccount.Balance)
 }
 
+func TestDemoServiceImpl_GetAccount(t *testing.T) {
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	type TC struct {
+		name     string
+		opts     *schema.Account_GetOpts
+		wantErr  bool
+		err      error
+		prepare  func(tt *TC)
+		validate func(tt *TC, got *schema.Account_GetResp)
+	}
+
+	tests := []TC{
+		{
+			name:     "no account exists",
+			opts:     &schema.Account_GetOpts{ID: primitive.NewObjectID()},
+			wantErr:  true,
+			err:      service.ErrAccountNotFound,
+			prepare:  func(tt *TC) {},
+			validate: func(tt *TC, got *schema.Account_GetResp) {},
+		},
+		{
+			name: "account without its transactions",
+			opts: &schema.Account_GetOpts{},
+			prepare: func(tt *TC) {
+				accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+				transColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.TransactionColl)
+				creditAccount := CreateDemoAccountWithBalance(t, accountColl, 1000)
+				debitAccount := CreateDemoAccountWithZeroBalance(t, accountColl)
+				tt.opts.ID = creditAccount.ID
+				CreateDemoTransactions(t, transColl, *creditAccount, *debitAccount, 10)
+			},
+			validate: func(tt *TC, got *schema.Account_GetResp) {
+				var account model.Account
+				accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.opts.ID}, &account))
+				assert.Equal(t, &schema.Account_GetResp{
+					ID:                account.ID,
+					UniqueAccountID:   account.UniqueAccountID,
+					AccountHolderName: account.AccountHolderName,
+					Balance:           1000,
+				}, got)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			dsi := &service.DemoServiceImpl{
+				Ctx:     context.TODO(),
+				Logger:  &zerolog.Logger{},
+				Config:  config.GetTestConfigFromFile().AppConfig.ServiceConfig.DemoServiceConfig,
+				Service: tsi.Service,
+			}
+			got, err := dsi.GetAccount(context.TODO(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DemoServiceImpl.GetAccount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				assert.Equal(t, tt.err.Error(), err.Error())
+			}
+			tt.validate(&tt, got)
+		})
+	}
+}
+
 func TestDemoServiceImpl_GetAccountDetailWithTransactions(t *testing.T) {
 	tsi := NewTestService(t)
 	defer tsi.Clean()
@@ -1087,7 +1183,7 @@ func TestDemoServiceImpl_GetAccountDetailWithTransactions(t *testing.T) {
 				},
 			},
 			wantErr: true,
-			err:     errors.New("no account found"),
+			err:     service.ErrAccountNotFound,
 			prepare: func(tt *TC) {},
 			validate: func(tt *TC, got *schema.Account_Get) {
 
@@ -1185,7 +1281,7 @@ func TestDemoServiceImpl_CallAPIForMock(t *testing.T) {
 			want:    true,
 			prepare: func(tt *TC) {
 				mockHttpService := tt.fields.Service.GetHTTPService().(*mock.MockHTTP)
-				mockHttpService.EXPECT().Get(tt.args.url).Return(
+				mockHttpService.EXPECT().Get(tt.args.ctx, tt.args.url).Return(
 					&http.Response{Status: "200 OK",
 						StatusCode:    200,
 						Proto:         "HTTP/1.1",
@@ -0,0 +1,188 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"go-app/service"
+	"testing"
+
+	"github.com/brianvoe/gofakeit"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getRawDoc(t *testing.T, coll mongodb.Collection, id primitive.ObjectID) bson.Raw {
+	var raw bson.Raw
+	assert.Nil(t, coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&raw))
+	return raw
+}
+
+func TestFieldLevelEncryption(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+
+	type TC struct {
+		name     string
+		acc      *model.Account
+		prepare  func(tt *TC)
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "field is stored encrypted and decoded in plaintext",
+			prepare: func(tt *TC) {
+				tt.acc = CreateDemoAccountWithBalance(t, accountColl, 10)
+			},
+			validate: func(tt *TC) {
+				subtype, _, ok := getRawDoc(t, accountColl, tt.acc.ID).Lookup("account_holder_name").BinaryOK()
+				assert.True(t, ok)
+				assert.Equal(t, mongodb.BinaryEncrypted, subtype)
+
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.acc.ID}, &doc))
+				assert.NotEmpty(t, doc.AccountHolderName)
+				assert.Equal(t, tt.acc.AccountHolderName, doc.AccountHolderName)
+			},
+		},
+		{
+			name: "deterministic field supports equality lookups",
+			prepare: func(tt *TC) {
+				tt.acc = CreateDemoAccountWithBalance(t, accountColl, 10)
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				err := accountColl.FindOne(context.TODO(), bson.M{"account_holder_name": mongodb.EncryptedEq(tt.acc.AccountHolderName)}).Decode(&doc)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.acc.ID, doc.ID)
+
+				count, err := accountColl.CountDocuments(context.TODO(), bson.M{"account_holder_name": mongodb.EncryptedEq(gofakeit.UUID())})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 0, count)
+
+				// plaintext never matches the stored ciphertext
+				count, err = accountColl.CountDocuments(context.TODO(), bson.M{"account_holder_name": tt.acc.AccountHolderName})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 0, count)
+			},
+		},
+		{
+			name: "rotation re-encrypts documents with the new key",
+			prepare: func(tt *TC) {
+				tt.acc = CreateDemoAccountWithBalance(t, accountColl, 10)
+			},
+			validate: func(tt *TC) {
+				newKeyOnly := mongodb.NewRegistry(NewTestKeyring(t, "new-key", "new-key"))
+				var doc model.Account
+				err := bson.UnmarshalWithRegistry(newKeyOnly, getRawDoc(t, accountColl, tt.acc.ID), &doc)
+				assert.True(t, errors.Is(err, mongodb.ErrDecrypt))
+
+				rotated := NewTestKeyring(t, "new-key", testKeyID, "new-key")
+				n, err := rotated.RotateEncryptedFields(context.TODO(), accountColl, model.Account{})
+				assert.Nil(t, err)
+				assert.True(t, n > 0)
+
+				doc = model.Account{}
+				assert.Nil(t, bson.UnmarshalWithRegistry(newKeyOnly, getRawDoc(t, accountColl, tt.acc.ID), &doc))
+				assert.Equal(t, tt.acc.AccountHolderName, doc.AccountHolderName)
+
+				// nothing left to rotate
+				n, err = rotated.RotateEncryptedFields(context.TODO(), accountColl, model.Account{})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 0, n)
+			},
+		},
+		{
+			name: "rotation encrypts documents written in plaintext",
+			prepare: func(tt *TC) {
+				id := primitive.NewObjectID()
+				_, err := accountColl.InsertOne(context.TODO(), bson.M{"_id": id, "account_holder_name": "legacy holder", "balance": 0})
+				assert.Nil(t, err)
+				tt.acc = &model.Account{ID: id, AccountHolderName: "legacy holder"}
+			},
+			validate: func(tt *TC) {
+				var doc model.Account
+				assert.Nil(t, Get_DocByFilter(accountColl, bson.M{"_id": tt.acc.ID}, &doc))
+				assert.Equal(t, tt.acc.AccountHolderName, doc.AccountHolderName)
+
+				// also rotates back the documents moved to new-key by the previous case
+				keyring := NewTestKeyring(t, testKeyID, testKeyID, "new-key")
+				n, err := keyring.RotateEncryptedFields(context.TODO(), accountColl, model.Account{})
+				assert.Nil(t, err)
+				assert.True(t, n > 0)
+
+				_, _, ok := getRawDoc(t, accountColl, tt.acc.ID).Lookup("account_holder_name").BinaryOK()
+				assert.True(t, ok)
+				count, err := accountColl.CountDocuments(context.TODO(), bson.M{"account_holder_name": mongodb.EncryptedEq(tt.acc.AccountHolderName)})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 1, count)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			tt.validate(&tt)
+		})
+	}
+}
+
+func TestRotateEncryptedFields(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+	userColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.UserColl)
+
+	acc := CreateDemoAccountWithBalance(t, accountColl, 10)
+	user := model.User{ID: primitive.NewObjectID(), Email: gofakeit.Email(), TOTP: &model.UserTOTP{Secret: "JBSWY3DPEHPK3PXP"}}
+	_, err := userColl.InsertOne(context.TODO(), user)
+	assert.Nil(t, err)
+	// a user without second factor has nothing to rotate
+	_, err = userColl.InsertOne(context.TODO(), model.User{ID: primitive.NewObjectID(), Email: gofakeit.Email()})
+	assert.Nil(t, err)
+
+	newKeyOnly := mongodb.NewRegistry(NewTestKeyring(t, "new-key", "new-key"))
+	rotated := NewTestKeyring(t, "new-key", testKeyID, "new-key")
+
+	type TC struct {
+		name    string
+		updated map[string]int64
+	}
+
+	tests := []TC{
+		{
+			name:    "fields encrypted with the old key, nested ones included",
+			updated: map[string]int64{"demo_bank.account": 1, "demo_auth.user": 1},
+		},
+		{
+			name:    "nothing left to rotate",
+			updated: map[string]int64{"demo_bank.account": 0, "demo_auth.user": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := service.RotateEncryptedFields(context.TODO(), tsi.Service.MongoDB(), rotated)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.updated, updated)
+
+			var gotAcc model.Account
+			assert.Nil(t, bson.UnmarshalWithRegistry(newKeyOnly, getRawDoc(t, accountColl, acc.ID), &gotAcc))
+			assert.Equal(t, acc.AccountHolderName, gotAcc.AccountHolderName)
+			var gotUser model.User
+			assert.Nil(t, bson.UnmarshalWithRegistry(newKeyOnly, getRawDoc(t, userColl, user.ID), &gotUser))
+			if assert.NotNil(t, gotUser.TOTP) {
+				assert.Equal(t, user.TOTP.Secret, gotUser.TOTP.Secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package test_service
+
+import (
+	"go-app/internals/mongodb"
+	"go-app/service"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestError(t *testing.T) {
+
+	cause := errors.New("connection reset")
+
+	type TC struct {
+		name    string
+		err     error
+		is      error
+		isNot   error
+		want    *service.Error
+		wantMsg string
+	}
+
+	tests := []TC{
+		{
+			name:    "error of the catalog",
+			err:     service.ErrInsufficientBalance,
+			is:      service.ErrInsufficientBalance,
+			isNot:   service.ErrAccountNotFound,
+			want:    service.ErrInsufficientBalance,
+			wantMsg: "insufficient balance",
+		},
+		{
+			name:    "wrapped cause",
+			err:     service.ErrInvalidCreditAccount.Wrap(cause),
+			is:      service.ErrInvalidCreditAccount,
+			isNot:   service.ErrAccountNotFound,
+			want:    &service.Error{Code: "AccountNotFound", Status: http.StatusNotFound, Message: "credit account not found", Field: "credit_account_id"},
+			wantMsg: "credit account not found: connection reset",
+		},
+		{
+			name:    "specific message",
+			err:     errors.Wrap(service.ErrForbidden.WithMessage("account:read is not allowed"), "failed to get account"),
+			is:      service.ErrForbidden,
+			want:    &service.Error{Code: "Forbidden", Status: http.StatusForbidden, Message: "account:read is not allowed"},
+			wantMsg: "failed to get account: account:read is not allowed",
+		},
+		{
+			name:    "missing document",
+			err:     errors.Wrap(mongo.ErrNoDocuments, "failed to get api key"),
+			isNot:   service.ErrAccountNotFound,
+			want:    &service.Error{Code: "InternalServerErr", Status: http.StatusInternalServerError, Message: "oops something went wrong"},
+			wantMsg: "failed to get api key: mongo: no documents in result",
+		},
+		{
+			name:    "missing document mapped where it is read",
+			err:     service.ErrInvalidDebitAccount.Wrap(mongo.ErrNoDocuments),
+			is:      service.ErrInvalidDebitAccount,
+			isNot:   service.ErrInvalidCreditAccount,
+			want:    &service.Error{Code: "AccountNotFound", Status: http.StatusNotFound, Message: "debit account not found", Field: "debit_account_id"},
+			wantMsg: "debit account not found: mongo: no documents in result",
+		},
+		{
+			name:    "api key error",
+			err:     service.ErrAPIKeyExpired,
+			is:      service.ErrAPIKeyExpired,
+			isNot:   service.ErrAPIKeyRevoked,
+			want:    &service.Error{Code: "Unauthorized", Status: http.StatusUnauthorized, Message: "api key is expired"},
+			wantMsg: "api key is expired",
+		},
+		{
+			name:    "unknown scope",
+			err:     service.ErrUnknownScope.WithMessage("unknown scope accounts:delete"),
+			is:      service.ErrUnknownScope,
+			want:    &service.Error{Code: "ValidationErr", Status: http.StatusBadRequest, Message: "unknown scope accounts:delete", Field: "scopes"},
+			wantMsg: "unknown scope accounts:delete",
+		},
+		{
+			name:    "timeout",
+			err:     errors.Wrap(mongodb.ErrTimeout, "failed to get account"),
+			want:    &service.Error{Code: "Timeout", Status: http.StatusGatewayTimeout, Message: "the request timed out"},
+			wantMsg: "failed to get account: mongodb operation timed out",
+		},
+		{
+			name:    "unknown error",
+			err:     cause,
+			isNot:   service.ErrInternal,
+			want:    &service.Error{Code: "InternalServerErr", Status: http.StatusInternalServerError, Message: "oops something went wrong"},
+			wantMsg: "connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMsg, tt.err.Error())
+			if tt.is != nil {
+				assert.True(t, errors.Is(tt.err, tt.is))
+			}
+			if tt.isNot != nil {
+				assert.False(t, errors.Is(tt.err, tt.isNot))
+			}
+			got := service.AsError(tt.err)
+			assert.Equal(t, tt.want.Code, got.Code)
+			assert.Equal(t, tt.want.Status, got.Status)
+			assert.Equal(t, tt.want.Message, got.Message)
+			assert.Equal(t, tt.want.Field, got.Field)
+		})
+	}
+}
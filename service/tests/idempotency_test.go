@@ -0,0 +1,154 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIdempotencyStoreImpl(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := service.NewIdempotencyStore(&service.IdempotencyStoreOpts{
+		DB:     tsi.Service,
+		Config: &config.IdempotencyConfig{TTL: time.Hour, LockTimeout: time.Minute},
+		Now:    func() time.Time { return now },
+	})
+	keyColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.IdempotencyColl)
+	stored := &schema.IdempotentResponse{Status: 201, ContentType: "application/json", Body: []byte(`{"success":true}`)}
+
+	type TC struct {
+		name     string
+		advance  time.Duration
+		run      func(tt *TC) (*schema.IdempotentResponse, error)
+		want     *schema.IdempotentResponse
+		wantErr  error
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "new key",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-1")
+			},
+		},
+		{
+			name: "retry in progress",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-1")
+			},
+			wantErr: service.ErrIdempotencyKeyInUse,
+		},
+		{
+			name: "key of another request",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-2")
+			},
+			wantErr: service.ErrIdempotencyKeyMismatch,
+		},
+		{
+			name: "completion of another request is ignored",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return nil, s.Complete(context.TODO(), "key:1:a", "fp-2", &schema.IdempotentResponse{Status: 200})
+			},
+			validate: func(tt *TC) {
+				var doc model.IdempotencyKey
+				assert.Nil(t, Get_DocByFilter(keyColl, bson.M{"_id": "key:1:a"}, &doc))
+				assert.Nil(t, doc.Response)
+			},
+		},
+		{
+			name: "complete",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return nil, s.Complete(context.TODO(), "key:1:a", "fp-1", stored)
+			},
+		},
+		{
+			name:    "retry is replayed",
+			advance: 30 * time.Minute,
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-1")
+			},
+			want: stored,
+		},
+		{
+			name: "completed key of another request",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-2")
+			},
+			wantErr: service.ErrIdempotencyKeyMismatch,
+		},
+		{
+			name:    "expired key is reused",
+			advance: time.Hour,
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-2")
+			},
+			validate: func(tt *TC) {
+				var doc model.IdempotencyKey
+				assert.Nil(t, Get_DocByFilter(keyColl, bson.M{"_id": "key:1:a"}, &doc))
+				assert.Equal(t, "fp-2", doc.Fingerprint)
+				assert.Nil(t, doc.Response)
+				assert.Equal(t, int64(1), doc.Version)
+			},
+		},
+		{
+			name:    "abandoned request is processed again",
+			advance: time.Minute,
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-2")
+			},
+			validate: func(tt *TC) {
+				var doc model.IdempotencyKey
+				assert.Nil(t, Get_DocByFilter(keyColl, bson.M{"_id": "key:1:a"}, &doc))
+				assert.Equal(t, int64(2), doc.Version)
+				assert.True(t, now.Add(time.Minute).Equal(doc.LockedUntil))
+			},
+		},
+		{
+			name: "release",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return nil, s.Release(context.TODO(), "key:1:a", "fp-2")
+			},
+			validate: func(tt *TC) {
+				n, err := keyColl.CountDocuments(context.TODO(), bson.M{"_id": "key:1:a"})
+				assert.Nil(t, err)
+				assert.Equal(t, int64(0), n)
+			},
+		},
+		{
+			name: "released key is reused",
+			run: func(tt *TC) (*schema.IdempotentResponse, error) {
+				return s.Begin(context.TODO(), "key:1:a", "fp-1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			got, err := tt.run(&tt)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "error = %v, want %v", err, tt.wantErr)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+			if tt.validate != nil {
+				tt.validate(&tt)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestServiceImpl_EnsureIndexes(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	// creating the indexes again, like every start of the app does, keeps them as they are
+	assert.Nil(t, tsi.Service.EnsureIndexes(context.TODO()))
+	assert.Nil(t, tsi.Service.EnsureIndexes(context.TODO()))
+
+	type TC struct {
+		name   string
+		db     string
+		coll   string
+		field  string
+		ttl    bool
+		unique bool
+	}
+
+	tests := []TC{
+		{name: "idempotency keys expire", db: model.AuthDB, coll: model.IdempotencyColl, field: "expires_at", ttl: true},
+		{name: "idle rate limit buckets expire", db: model.AuthDB, coll: model.RateLimitColl, field: "expires_at", ttl: true},
+		{name: "api keys are looked up by unique hash", db: model.AuthDB, coll: model.APIKeyColl, field: "hash", unique: true},
+		{name: "users are looked up by unique email", db: model.AuthDB, coll: model.UserColl, field: "email", unique: true},
+		{name: "refresh tokens are looked up by unique hash", db: model.AuthDB, coll: model.RefreshTokenColl, field: "hash", unique: true},
+		{name: "refresh tokens expire", db: model.AuthDB, coll: model.RefreshTokenColl, field: "expires_at", ttl: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specs, err := tsi.Service.MongoDB().Cli().Database(tt.db).Collection(tt.coll).ListIndexSpecifications(context.TODO())
+			assert.Nil(t, err)
+			for _, s := range specs {
+				var keys bson.D
+				assert.Nil(t, bson.Unmarshal(s.KeysDocument, &keys))
+				if len(keys) != 1 || keys[0].Key != tt.field {
+					continue
+				}
+				if tt.ttl && assert.NotNil(t, s.ExpireAfterSeconds, "index %s is not a TTL index", s.Name) {
+					assert.EqualValues(t, 0, *s.ExpireAfterSeconds)
+				}
+				if tt.unique {
+					assert.True(t, s.Unique != nil && *s.Unique, "index %s is not unique", s.Name)
+				}
+				return
+			}
+			t.Errorf("no index on %s", tt.field)
+		})
+	}
+}
+
+func TestMemoryMongoDB_Indexes(t *testing.T) {
+
+	ttl := mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)}
+
+	type TC struct {
+		name      string
+		models    []mongo.IndexModel
+		wantNames []string
+		wantErr   bool
+		wantSpecs []string
+	}
+
+	tests := []TC{
+		{
+			name:      "generated name",
+			models:    []mongo.IndexModel{ttl},
+			wantNames: []string{"expires_at_1"},
+			wantSpecs: []string{"_id_", "expires_at_1"},
+		},
+		{
+			name:      "existing index is a no-op",
+			models:    []mongo.IndexModel{ttl, ttl},
+			wantNames: []string{"expires_at_1", "expires_at_1"},
+			wantSpecs: []string{"_id_", "expires_at_1"},
+		},
+		{
+			name: "explicit name and compound keys",
+			models: []mongo.IndexModel{
+				{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+				{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("by_email").SetUnique(true)},
+			},
+			wantNames: []string{"owner_1_created_at_-1", "by_email"},
+			wantSpecs: []string{"_id_", "owner_1_created_at_-1", "by_email"},
+		},
+		{
+			name:      "same name with other options",
+			models:    []mongo.IndexModel{ttl, {Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expires_at_1")}},
+			wantErr:   true,
+			wantSpecs: []string{},
+		},
+		{
+			name:      "same keys with another name",
+			models:    []mongo.IndexModel{ttl, {Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expiry")}},
+			wantErr:   true,
+			wantSpecs: []string{},
+		},
+		{
+			name:      "reserved name",
+			models:    []mongo.IndexModel{{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetName("_id_")}},
+			wantErr:   true,
+			wantSpecs: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coll := mongodb.NewMemoryMongoDB(&mongodb.MemoryMongoDBOpts{}).Cli().Database("test").Collection("docs")
+			names, err := coll.CreateIndexes(context.TODO(), tt.models)
+			if tt.wantErr {
+				var ce mongo.CommandError
+				assert.True(t, errors.As(err, &ce))
+				assert.EqualValues(t, 85, ce.Code)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantNames, names)
+			}
+
+			specs, err := coll.ListIndexSpecifications(context.TODO())
+			assert.Nil(t, err)
+			got := []string{}
+			for _, s := range specs {
+				got = append(got, s.Name)
+				assert.Equal(t, "test.docs", s.Namespace)
+			}
+			assert.Equal(t, tt.wantSpecs, got)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package test_service
 
 import (
+	"bytes"
 	"context"
 	"go-app/internals/config"
 	"go-app/internals/db"
@@ -28,7 +29,16 @@ type TestService struct {
 
 func (ts *TestService) Clean() {
 	ts.Ctrl.Finish()
-	ts.MongoDBServer.Stop()
+	if ts.MongoDBServer != nil {
+		ts.MongoDBServer.Stop()
+	}
+}
+
+// useMemoryMongoDB reports whether tests run against the in-memory mongodb implementation, which is the default
+// as it needs no network. Set TEST_MONGODB=memongo to run them against a memongo server, which downloads a
+// mongodb binary on its first run.
+func useMemoryMongoDB() bool {
+	return os.Getenv("TEST_MONGODB") != "memongo"
 }
 
 func NewTestService(t *testing.T) *TestService {
@@ -46,11 +56,19 @@ func NewTestService(t *testing.T) *TestService {
 	s.DemoService = mock.NewMockDemoService(ctrl)
 	s.HTTPService = mock.NewMockHTTP(ctrl)
 
-	mongoDBServer := NewMockMongoDB()
-	mockMongoDB, err := mongodb.NewMockMongoDB(mongoDBServer.URI())
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	var mongoDBServer *memongo.Server
+	var mockMongoDB mongodb.MongoDB
+	keyring := NewTestKeyring(t, testKeyID, testKeyID)
+	if useMemoryMongoDB() {
+		mockMongoDB = mongodb.NewMemoryMongoDB(&mongodb.MemoryMongoDBOpts{Keyring: keyring})
+	} else {
+		mongoDBServer = NewMockMongoDB()
+		m, err := mongodb.NewMockMongoDB(mongoDBServer.URI(), keyring)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		mockMongoDB = m
 	}
 
 	s.DB = db.NewDB(&db.DBOpts{MongoDB: mockMongoDB})
@@ -61,6 +79,21 @@ func NewTestService(t *testing.T) *TestService {
 	}
 }
 
+const testKeyID = "test-key"
+
+// NewTestKeyring returns a keyring with a deterministic data key for each of ids, active is the active key.
+func NewTestKeyring(t *testing.T, active string, ids ...string) *mongodb.Keyring {
+	keys := map[string][]byte{}
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id), mongodb.DataKeySize)[:mongodb.DataKeySize]
+	}
+	keyring, err := mongodb.NewKeyring(active, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
 func NewMockMongoDB() *memongo.Server {
 	opts := memongo.Options{
 		ShouldUseReplica: true,
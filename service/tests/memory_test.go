@@ -0,0 +1,487 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newMemoryCollection() (mongodb.Client, mongodb.Collection) {
+	client := mongodb.NewMemoryMongoDB(&mongodb.MemoryMongoDBOpts{}).Cli()
+	return client, client.Database("test").Collection("docs")
+}
+
+func findIDs(t *testing.T, coll mongodb.Collection, ctx context.Context, filter interface{}, opts ...*options.FindOptions) []int32 {
+	cur, err := coll.Find(ctx, filter, opts...)
+	assert.Nil(t, err)
+	if err != nil {
+		return nil
+	}
+	var docs []struct {
+		ID int32 `bson:"_id"`
+	}
+	assert.Nil(t, cur.All(ctx, &docs))
+	ids := []int32{}
+	for _, d := range docs {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func isTransient(err error) bool {
+	var le mongo.LabeledError
+	return errors.As(err, &le) && le.HasErrorLabel("TransientTransactionError")
+}
+
+func TestMemoryMongoDB_Query(t *testing.T) {
+
+	_, coll := newMemoryCollection()
+	_, err := coll.InsertMany(context.TODO(), []interface{}{
+		bson.M{"_id": int32(1), "name": "alice", "age": int32(30), "tags": bson.A{"a", "b"}, "address": bson.M{"city": "paris"}},
+		bson.M{"_id": int32(2), "name": "bob", "age": int64(25), "tags": bson.A{"b"}, "address": bson.M{"city": "berlin"}},
+		bson.M{"_id": int32(3), "name": "carol", "age": 41.5, "nickname": nil},
+		bson.M{"_id": int32(4), "name": "dave", "age": "unknown", "items": bson.A{bson.M{"sku": "x"}, bson.M{"sku": "y"}}},
+	})
+	assert.Nil(t, err)
+
+	type TC struct {
+		name    string
+		filter  interface{}
+		opts    *options.FindOptions
+		want    []int32
+		wantErr bool
+	}
+
+	sortByID := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	tests := []TC{
+		{name: "empty filter", filter: bson.M{}, want: []int32{1, 2, 3, 4}},
+		{name: "implicit equality", filter: bson.M{"name": "bob"}, want: []int32{2}},
+		{name: "numbers of different types are equal", filter: bson.M{"age": 25}, want: []int32{2}},
+		{name: "dotted path", filter: bson.M{"address.city": "paris"}, want: []int32{1}},
+		{name: "path through an array", filter: bson.M{"items.sku": "y"}, want: []int32{4}},
+		{name: "scalar matches arrays containing it", filter: bson.M{"tags": "b"}, want: []int32{1, 2}},
+		{name: "null matches missing and null fields", filter: bson.M{"nickname": nil}, want: []int32{1, 2, 3, 4}},
+		{name: "$eq", filter: bson.M{"name": bson.M{"$eq": "carol"}}, want: []int32{3}},
+		{name: "$ne", filter: bson.M{"name": bson.M{"$ne": "carol"}}, want: []int32{1, 2, 4}},
+		{name: "$gt only matches the same type class", filter: bson.M{"age": bson.M{"$gt": 25}}, want: []int32{1, 3}},
+		{name: "$gte", filter: bson.M{"age": bson.M{"$gte": 30}}, want: []int32{1, 3}},
+		{name: "$lt", filter: bson.M{"age": bson.M{"$lt": 30}}, want: []int32{2}},
+		{name: "$lte and $gte range", filter: bson.M{"age": bson.M{"$gte": 25, "$lte": 30}}, want: []int32{1, 2}},
+		{name: "string comparison", filter: bson.M{"name": bson.M{"$gt": "bob"}}, want: []int32{3, 4}},
+		{name: "$in", filter: bson.M{"name": bson.M{"$in": bson.A{"alice", "dave", "erin"}}}, want: []int32{1, 4}},
+		{name: "$in on arrays", filter: bson.M{"tags": bson.M{"$in": bson.A{"a"}}}, want: []int32{1}},
+		{name: "$nin", filter: bson.M{"name": bson.M{"$nin": bson.A{"alice", "dave"}}}, want: []int32{2, 3}},
+		{name: "$exists", filter: bson.M{"nickname": bson.M{"$exists": true}}, want: []int32{3}},
+		{name: "$exists false", filter: bson.M{"tags": bson.M{"$exists": false}}, want: []int32{3, 4}},
+		{name: "$not", filter: bson.M{"age": bson.M{"$not": bson.M{"$gt": 25}}}, want: []int32{2, 4}},
+		{name: "$and", filter: bson.M{"$and": bson.A{bson.M{"tags": "b"}, bson.M{"age": bson.M{"$gt": 26}}}}, want: []int32{1}},
+		{name: "$or", filter: bson.M{"$or": bson.A{bson.M{"name": "alice"}, bson.M{"age": "unknown"}}}, want: []int32{1, 4}},
+		{name: "$nor", filter: bson.M{"$nor": bson.A{bson.M{"name": "alice"}, bson.M{"age": "unknown"}}}, want: []int32{2, 3}},
+		{name: "sort descending", filter: bson.M{}, opts: options.Find().SetSort(bson.D{{Key: "name", Value: -1}}), want: []int32{4, 3, 2, 1}},
+		{name: "sort by mixed types follows the bson order", filter: bson.M{}, opts: options.Find().SetSort(bson.D{{Key: "age", Value: 1}}), want: []int32{2, 1, 3, 4}},
+		{name: "skip and limit", filter: bson.M{}, opts: options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(1).SetLimit(2), want: []int32{2, 3}},
+		{name: "skip past the end", filter: bson.M{}, opts: options.Find().SetSkip(10), want: []int32{}},
+		{name: "unknown operator", filter: bson.M{"name": bson.M{"$regex": "^a"}}, wantErr: true},
+		{name: "unknown top level operator", filter: bson.M{"$where": "true"}, wantErr: true},
+		{name: "$in needs an array", filter: bson.M{"name": bson.M{"$in": "alice"}}, wantErr: true},
+		{name: "$or needs a nonempty array", filter: bson.M{"$or": bson.A{}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts == nil {
+				opts = sortByID
+			}
+			if tt.wantErr {
+				_, err := coll.Find(context.TODO(), tt.filter, opts)
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Equal(t, tt.want, findIDs(t, coll, context.TODO(), tt.filter, opts))
+		})
+	}
+
+	t.Run("count", func(t *testing.T) {
+		n, err := coll.CountDocuments(context.TODO(), bson.M{"tags": "b"})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, n)
+	})
+
+	t.Run("aggregate", func(t *testing.T) {
+		cur, err := coll.Aggregate(context.TODO(), mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"name": bson.M{"$ne": "alice"}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "name", Value: -1}}}},
+			{{Key: "$skip", Value: 1}},
+			{{Key: "$limit", Value: 1}},
+		})
+		assert.Nil(t, err)
+		var docs []bson.M
+		assert.Nil(t, cur.All(context.TODO(), &docs))
+		assert.Len(t, docs, 1)
+		assert.Equal(t, "carol", docs[0]["name"])
+
+		cur, err = coll.Aggregate(context.TODO(), mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"tags": "b"}}},
+			{{Key: "$count", Value: "total"}},
+		})
+		assert.Nil(t, err)
+		docs = nil
+		assert.Nil(t, cur.All(context.TODO(), &docs))
+		assert.Equal(t, []bson.M{{"total": int32(2)}}, docs)
+
+		_, err = coll.Aggregate(context.TODO(), mongo.Pipeline{{{Key: "$group", Value: bson.M{"_id": "$name"}}}})
+		assert.True(t, errors.Is(err, mongodb.ErrNotSupported))
+	})
+}
+
+func TestMemoryMongoDB_Update(t *testing.T) {
+
+	type TC struct {
+		name    string
+		doc     bson.M
+		filter  bson.M
+		update  interface{}
+		upsert  bool
+		want    bson.M
+		matched int64
+		// modified is the expected modified count, it is matched when not set.
+		modified *int64
+		wantErr  error
+	}
+
+	zero := int64(0)
+	tests := []TC{
+		{
+			name:   "$set creates nested documents",
+			doc:    bson.M{"_id": 1, "name": "alice"},
+			update: bson.M{"$set": bson.M{"name": "alicia", "address.city": "paris"}},
+			want:   bson.M{"_id": int32(1), "name": "alicia", "address": bson.M{"city": "paris"}},
+		},
+		{
+			name:   "$unset",
+			doc:    bson.M{"_id": 1, "name": "alice", "address": bson.M{"city": "paris", "zip": "75001"}},
+			update: bson.M{"$unset": bson.M{"name": "", "address.zip": "", "missing.field": ""}},
+			want:   bson.M{"_id": int32(1), "address": bson.M{"city": "paris"}},
+		},
+		{
+			name:   "$inc keeps int32",
+			doc:    bson.M{"_id": 1, "n": int32(1)},
+			update: bson.M{"$inc": bson.M{"n": int32(2), "missing": int32(5)}},
+			want:   bson.M{"_id": int32(1), "n": int32(3), "missing": int32(5)},
+		},
+		{
+			name:   "$inc promotes to int64 and double",
+			doc:    bson.M{"_id": 1, "a": int32(1), "b": int64(1)},
+			update: bson.M{"$inc": bson.M{"a": int64(1), "b": 0.5}},
+			want:   bson.M{"_id": int32(1), "a": int64(2), "b": 1.5},
+		},
+		{
+			name:    "$inc of a non numeric value",
+			doc:     bson.M{"_id": 1, "name": "alice"},
+			update:  bson.M{"$inc": bson.M{"name": 1}},
+			wantErr: errors.New("cannot apply $inc"),
+		},
+		{
+			name:   "$push and $push $each",
+			doc:    bson.M{"_id": 1, "tags": bson.A{"a"}},
+			update: bson.M{"$push": bson.M{"tags": "b", "more": bson.M{"$each": bson.A{"x", "y"}}}},
+			want:   bson.M{"_id": int32(1), "tags": bson.A{"a", "b"}, "more": bson.A{"x", "y"}},
+		},
+		{
+			name:   "$pull",
+			doc:    bson.M{"_id": 1, "tags": bson.A{"a", "b", "a"}},
+			update: bson.M{"$pull": bson.M{"tags": "a"}},
+			want:   bson.M{"_id": int32(1), "tags": bson.A{"b"}},
+		},
+		{
+			name:     "no-op update is not a modification",
+			doc:      bson.M{"_id": 1, "name": "alice"},
+			update:   bson.M{"$set": bson.M{"name": "alice"}},
+			want:     bson.M{"_id": int32(1), "name": "alice"},
+			modified: &zero,
+		},
+		{
+			name:     "$setOnInsert is ignored by updates",
+			doc:      bson.M{"_id": 1, "name": "alice"},
+			update:   bson.M{"$setOnInsert": bson.M{"created": true}},
+			upsert:   true,
+			want:     bson.M{"_id": int32(1), "name": "alice"},
+			modified: &zero,
+		},
+		{
+			name:    "upsert seeds the document from the filter",
+			filter:  bson.M{"_id": 7, "kind": bson.M{"$eq": "user"}, "age": bson.M{"$gt": 1}},
+			update:  bson.M{"$set": bson.M{"name": "erin"}, "$setOnInsert": bson.M{"created": true}},
+			upsert:  true,
+			want:    bson.M{"_id": int32(7), "kind": "user", "name": "erin", "created": true},
+			matched: 0,
+		},
+		{
+			name:    "_id is immutable",
+			doc:     bson.M{"_id": 1},
+			update:  bson.M{"$set": bson.M{"_id": 2}},
+			wantErr: errors.New("immutable field '_id'"),
+		},
+		{
+			name:    "replacement documents are rejected",
+			doc:     bson.M{"_id": 1},
+			update:  bson.M{"name": "alice"},
+			wantErr: errors.New("only atomic operators"),
+		},
+		{
+			name:    "unsupported operator",
+			doc:     bson.M{"_id": 1},
+			update:  bson.M{"$rename": bson.M{"a": "b"}},
+			wantErr: mongodb.ErrNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, coll := newMemoryCollection()
+			filter := tt.filter
+			if tt.doc != nil {
+				_, err := coll.InsertOne(context.TODO(), tt.doc)
+				assert.Nil(t, err)
+				tt.matched = 1
+				if filter == nil {
+					filter = bson.M{"_id": tt.doc["_id"]}
+				}
+			}
+
+			res, err := coll.UpdateOne(context.TODO(), filter, tt.update, options.Update().SetUpsert(tt.upsert))
+			if tt.wantErr != nil {
+				assert.NotNil(t, err)
+				if err != nil && !errors.Is(err, tt.wantErr) {
+					assert.Contains(t, err.Error(), tt.wantErr.Error())
+				}
+				if tt.doc != nil {
+					// nothing was written
+					var doc bson.M
+					assert.Nil(t, coll.FindOne(context.TODO(), bson.M{}).Decode(&doc))
+					assert.EqualValues(t, tt.doc["_id"], doc["_id"])
+					assert.Len(t, doc, len(tt.doc))
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.matched, res.MatchedCount)
+			modified := tt.matched
+			if tt.modified != nil {
+				modified = *tt.modified
+			}
+			assert.Equal(t, modified, res.ModifiedCount)
+			if tt.doc == nil {
+				assert.EqualValues(t, 1, res.UpsertedCount)
+			}
+
+			var doc bson.M
+			assert.Nil(t, coll.FindOne(context.TODO(), bson.M{"_id": tt.want["_id"]}).Decode(&doc))
+			assert.Equal(t, tt.want, doc)
+		})
+	}
+
+	t.Run("update many and delete one", func(t *testing.T) {
+		_, coll := newMemoryCollection()
+		_, err := coll.InsertMany(context.TODO(), []interface{}{bson.M{"_id": 1, "n": 1}, bson.M{"_id": 2, "n": 1}, bson.M{"_id": 3, "n": 2}})
+		assert.Nil(t, err)
+
+		res, err := coll.UpdateMany(context.TODO(), bson.M{"n": 1}, bson.M{"$inc": bson.M{"n": 10}})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, res.MatchedCount)
+		assert.Equal(t, []int32{1, 2}, findIDs(t, coll, context.TODO(), bson.M{"n": 11}))
+
+		n, err := coll.DeleteOne(context.TODO(), bson.M{"n": 11})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 1, n)
+		n, err = coll.DeleteOne(context.TODO(), bson.M{"n": 99})
+		assert.Nil(t, err)
+		assert.EqualValues(t, 0, n)
+		Assert_DocCount(t, coll, bson.M{}, 2)
+	})
+
+	t.Run("duplicate keys", func(t *testing.T) {
+		_, coll := newMemoryCollection()
+		_, err := coll.InsertOne(context.TODO(), bson.M{"_id": 1})
+		assert.Nil(t, err)
+		_, err = coll.InsertOne(context.TODO(), bson.M{"_id": 1})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+
+		_, err = coll.InsertMany(context.TODO(), []interface{}{bson.M{"_id": 2}, bson.M{"_id": 1}})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+		var bwe mongo.BulkWriteException
+		assert.True(t, errors.As(err, &bwe))
+		assert.Equal(t, 1, bwe.WriteErrors[0].Index)
+	})
+}
+
+func TestMemoryMongoDB_Transactions(t *testing.T) {
+
+	type TC struct {
+		name string
+		run  func(t *testing.T, client mongodb.Client, coll mongodb.Collection)
+	}
+
+	balance := func(t *testing.T, ctx context.Context, coll mongodb.Collection, id int) int32 {
+		var doc struct {
+			Balance int32 `bson:"balance"`
+		}
+		assert.Nil(t, coll.FindOne(ctx, bson.M{"_id": id}).Decode(&doc))
+		return doc.Balance
+	}
+	setBalance := func(ctx context.Context, coll mongodb.Collection, id int, b int32) error {
+		_, err := coll.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"balance": b}})
+		return err
+	}
+	startTxn := func(t *testing.T, client mongodb.Client) (mongo.Session, mongo.SessionContext) {
+		sess, err := client.StartSession()
+		assert.Nil(t, err)
+		assert.Nil(t, sess.StartTransaction())
+		return sess, mongo.NewSessionContext(context.TODO(), sess)
+	}
+
+	tests := []TC{
+		{
+			name: "reads see the snapshot of the transaction",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, sctx := startTxn(t, client)
+				defer sess.EndSession(context.TODO())
+
+				assert.Nil(t, setBalance(context.TODO(), coll, 1, 50))
+				_, err := coll.InsertOne(context.TODO(), bson.M{"_id": 2, "balance": 1})
+				assert.Nil(t, err)
+
+				assert.EqualValues(t, 100, balance(t, sctx, coll, 1))
+				Assert_DocCount(t, coll, bson.M{}, 2)
+				n, err := coll.CountDocuments(sctx, bson.M{})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 1, n)
+			},
+		},
+		{
+			name: "writes are visible once committed",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, sctx := startTxn(t, client)
+				defer sess.EndSession(context.TODO())
+
+				assert.Nil(t, setBalance(sctx, coll, 1, 10))
+				_, err := coll.InsertOne(sctx, bson.M{"_id": 2, "balance": 20})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 10, balance(t, sctx, coll, 1))
+				assert.EqualValues(t, 100, balance(t, context.TODO(), coll, 1))
+				Assert_DocCount(t, coll, bson.M{}, 1)
+
+				assert.Nil(t, sess.CommitTransaction(context.TODO()))
+				assert.EqualValues(t, 10, balance(t, context.TODO(), coll, 1))
+				assert.EqualValues(t, 20, balance(t, context.TODO(), coll, 2))
+			},
+		},
+		{
+			name: "aborted writes are discarded",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, sctx := startTxn(t, client)
+				defer sess.EndSession(context.TODO())
+
+				assert.Nil(t, setBalance(sctx, coll, 1, 10))
+				n, err := coll.DeleteOne(sctx, bson.M{"_id": 1})
+				assert.Nil(t, err)
+				assert.EqualValues(t, 1, n)
+				assert.Nil(t, sess.AbortTransaction(context.TODO()))
+
+				assert.EqualValues(t, 100, balance(t, context.TODO(), coll, 1))
+				assert.NotNil(t, sess.CommitTransaction(context.TODO()))
+			},
+		},
+		{
+			name: "write after a concurrent commit conflicts",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, sctx := startTxn(t, client)
+				defer sess.EndSession(context.TODO())
+
+				assert.Nil(t, setBalance(context.TODO(), coll, 1, 50))
+				err := setBalance(sctx, coll, 1, 10)
+				assert.True(t, isTransient(err))
+
+				// inserting a key committed since the snapshot conflicts too
+				_, err = coll.InsertOne(context.TODO(), bson.M{"_id": 2})
+				assert.Nil(t, err)
+				_, err = coll.InsertOne(sctx, bson.M{"_id": 2})
+				assert.True(t, isTransient(err))
+				assert.False(t, mongo.IsDuplicateKeyError(err))
+			},
+		},
+		{
+			name: "commit after a concurrent commit conflicts",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				first, firstCtx := startTxn(t, client)
+				defer first.EndSession(context.TODO())
+				second, secondCtx := startTxn(t, client)
+				defer second.EndSession(context.TODO())
+
+				assert.Nil(t, setBalance(firstCtx, coll, 1, 10))
+				assert.Nil(t, setBalance(secondCtx, coll, 1, 20))
+				assert.Nil(t, first.CommitTransaction(context.TODO()))
+				assert.True(t, isTransient(second.CommitTransaction(context.TODO())))
+
+				assert.EqualValues(t, 10, balance(t, context.TODO(), coll, 1))
+			},
+		},
+		{
+			name: "with transaction retries the conflicts",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, err := client.StartSession()
+				assert.Nil(t, err)
+				defer sess.EndSession(context.TODO())
+
+				attempts := 0
+				_, err = sess.WithTransaction(context.TODO(), func(sctx mongo.SessionContext) (interface{}, error) {
+					attempts++
+					b := balance(t, sctx, coll, 1)
+					if attempts == 1 {
+						// a concurrent transfer commits first
+						assert.Nil(t, setBalance(context.TODO(), coll, 1, b+5))
+					}
+					return nil, setBalance(sctx, coll, 1, b+1)
+				})
+				assert.Nil(t, err)
+				assert.Equal(t, 2, attempts)
+				assert.EqualValues(t, 106, balance(t, context.TODO(), coll, 1))
+			},
+		},
+		{
+			name: "with transaction does not retry other errors",
+			run: func(t *testing.T, client mongodb.Client, coll mongodb.Collection) {
+				sess, err := client.StartSession()
+				assert.Nil(t, err)
+				defer sess.EndSession(context.TODO())
+
+				failure := errors.New("insufficient balance")
+				attempts := 0
+				_, err = sess.WithTransaction(context.TODO(), func(sctx mongo.SessionContext) (interface{}, error) {
+					attempts++
+					assert.Nil(t, setBalance(sctx, coll, 1, 0))
+					return nil, failure
+				})
+				assert.Equal(t, failure, err)
+				assert.Equal(t, 1, attempts)
+				assert.EqualValues(t, 100, balance(t, context.TODO(), coll, 1))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, coll := newMemoryCollection()
+			_, err := coll.InsertOne(context.TODO(), bson.M{"_id": 1, "balance": int32(100)})
+			assert.Nil(t, err)
+			tt.run(t, client, coll)
+		})
+	}
+}
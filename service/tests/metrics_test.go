@@ -0,0 +1,111 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDemoServiceMetrics(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	accountColl := tsi.Service.MongoDB().Cli().Database(model.BankDB).Collection(model.AccountColl)
+	reg := prometheus.NewRegistry()
+	dsi := service.NewDemoService(&service.DemoServiceOpts{
+		Ctx:     context.TODO(),
+		Logger:  &zerolog.Logger{},
+		Config:  &config.DemoServiceConfig{AccountCacheConfig: &config.CacheConfig{Enabled: true}},
+		Service: tsi.Service,
+		Metrics: reg,
+	}).(*service.DemoServiceImpl)
+
+	type TC struct {
+		name     string
+		run      func(tt *TC)
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "accounts created",
+			run: func(tt *TC) {
+				_, err := dsi.Account_Create(context.TODO(), &schema.Account_CreateOpts{AccountHolderName: "holder"})
+				assert.Nil(t, err)
+			},
+			validate: func(tt *TC) {
+				assert.Equal(t, float64(1), testutil.ToFloat64(dsi.Metrics.AccountsCreated))
+			},
+		},
+		{
+			name: "succeeded transfer",
+			run: func(tt *TC) {
+				credit := CreateDemoAccountWithBalance(t, accountColl, 100)
+				debit := CreateDemoAccountWithZeroBalance(t, accountColl)
+				err := dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{CreditAccountID: credit.ID, DebitAccountID: debit.ID, Amount: 40})
+				assert.Nil(t, err)
+			},
+			validate: func(tt *TC) {
+				assert.Equal(t, float64(1), testutil.ToFloat64(dsi.Metrics.Transfers.WithLabelValues("succeeded", "")))
+				assert.Equal(t, float64(40), testutil.ToFloat64(dsi.Metrics.AmountTransferred))
+			},
+		},
+		{
+			name: "failed transfers by reason",
+			run: func(tt *TC) {
+				credit := CreateDemoAccountWithBalance(t, accountColl, 10)
+				debit := CreateDemoAccountWithZeroBalance(t, accountColl)
+				err := dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{CreditAccountID: credit.ID, DebitAccountID: debit.ID, Amount: 40})
+				assert.NotNil(t, err)
+				err = dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{CreditAccountID: primitive.NewObjectID(), DebitAccountID: debit.ID, Amount: 1})
+				assert.NotNil(t, err)
+				err = dsi.Transaction_Create(context.TODO(), &schema.Transaction_CreateOpts{CreditAccountID: credit.ID, DebitAccountID: primitive.NewObjectID(), Amount: 1})
+				assert.NotNil(t, err)
+			},
+			validate: func(tt *TC) {
+				assert.Equal(t, float64(1), testutil.ToFloat64(dsi.Metrics.Transfers.WithLabelValues("failed", service.TransferReasonInsufficientBalance)))
+				assert.Equal(t, float64(2), testutil.ToFloat64(dsi.Metrics.Transfers.WithLabelValues("failed", service.TransferReasonAccountNotFound)))
+				assert.Equal(t, float64(40), testutil.ToFloat64(dsi.Metrics.AmountTransferred))
+			},
+		},
+		{
+			name: "account cache statistics",
+			run: func(tt *TC) {
+				acc := CreateDemoAccountWithBalance(t, accountColl, 10)
+				for i := 0; i < 2; i++ {
+					_, err := dsi.GetAccountDetailWithTransactions(context.TODO(), &schema.AccountTransaction_GetOpts{ID: acc.ID})
+					assert.Nil(t, err)
+				}
+			},
+			validate: func(tt *TC) {
+				expected := `
+# HELP cache_hits_total Cache hits.
+# TYPE cache_hits_total counter
+cache_hits_total{cache="account"} 1
+# HELP cache_misses_total Cache misses.
+# TYPE cache_misses_total counter
+cache_misses_total{cache="account"} 1
+`
+				assert.Nil(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "cache_hits_total", "cache_misses_total"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(&tt)
+			tt.validate(&tt)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// policyValues flattens a policy for comparisons, unset fields are empty.
+func policyValues(p *mongodb.Policy) (string, string, interface{}) {
+	var rp, rc string
+	var wc interface{}
+	if p.ReadPref != nil {
+		rp = p.ReadPref.Mode().String()
+	}
+	if p.ReadConcern != nil {
+		rc = p.ReadConcern.Level
+	}
+	if p.WriteConcern != nil {
+		wc = p.WriteConcern.W
+	}
+	return rp, rc, wc
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+
+	type TC struct {
+		name    string
+		config  *config.MongoDBPolicyConfig
+		wantErr bool
+		rp      string
+		rc      string
+		wc      interface{}
+	}
+
+	tests := []TC{
+		{
+			name:   "nil config inherits everything",
+			config: nil,
+		},
+		{
+			name:   "empty values inherit",
+			config: &config.MongoDBPolicyConfig{},
+		},
+		{
+			name:   "every field",
+			config: &config.MongoDBPolicyConfig{ReadPref: "secondaryPreferred", ReadConcern: "majority", WriteConcern: "majority"},
+			rp:     "secondaryPreferred",
+			rc:     "majority",
+			wc:     "majority",
+		},
+		{
+			name:   "number of nodes",
+			config: &config.MongoDBPolicyConfig{WriteConcern: "2"},
+			wc:     2,
+		},
+		{
+			name:   "custom tag",
+			config: &config.MongoDBPolicyConfig{WriteConcern: "multiRegion"},
+			wc:     "multiRegion",
+		},
+		{
+			name:    "invalid read preference",
+			config:  &config.MongoDBPolicyConfig{ReadPref: "fastest"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid read concern",
+			config:  &config.MongoDBPolicyConfig{ReadConcern: "eventual"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := mongodb.PolicyFromConfig(tt.config)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			rp, rc, wc := policyValues(p)
+			assert.Equal(t, tt.rp, rp)
+			assert.Equal(t, tt.rc, rc)
+			assert.Equal(t, tt.wc, wc)
+		})
+	}
+}
+
+func TestCollectionPolicy(t *testing.T) {
+
+	// the driver connects lazily, no server is needed to resolve the policies
+	client, err := mongodb.NewClient(&mongodb.MongoDBOpts{Config: &config.MongoDBConfig{
+		Scheme:              "mongodb",
+		Host:                "127.0.0.1:1",
+		MongoDBPolicyConfig: config.MongoDBPolicyConfig{ReadPref: "secondaryPreferred", ReadConcern: "local", WriteConcern: "1"},
+		Databases: map[string]*config.MongoDBDatabaseConfig{
+			"bank": {
+				MongoDBPolicyConfig: config.MongoDBPolicyConfig{ReadConcern: "majority"},
+				Collections: map[string]*config.MongoDBPolicyConfig{
+					"accounts": {ReadPref: "primary", WriteConcern: "majority"},
+				},
+			},
+		},
+	}}, nil)
+	assert.Nil(t, err)
+	defer client.Disconnect(context.TODO())
+
+	type TC struct {
+		name    string
+		ctx     context.Context
+		coll    mongodb.Collection
+		wantErr error
+		rp      string
+		rc      string
+		wc      interface{}
+	}
+
+	tests := []TC{
+		{
+			name: "client policy",
+			ctx:  context.TODO(),
+			coll: client.Database("reports").Collection("daily"),
+			rp:   "secondaryPreferred",
+			rc:   "local",
+			wc:   1,
+		},
+		{
+			name: "database policy overrides the client",
+			ctx:  context.TODO(),
+			coll: client.Database("bank").Collection("transactions"),
+			rp:   "secondaryPreferred",
+			rc:   "majority",
+			wc:   1,
+		},
+		{
+			name: "collection policy overrides the database",
+			ctx:  context.TODO(),
+			coll: client.Database("bank").Collection("accounts"),
+			rp:   "primary",
+			rc:   "majority",
+			wc:   "majority",
+		},
+		{
+			name: "explicit options override the config",
+			ctx:  context.TODO(),
+			coll: client.Database("bank").Collection("accounts", options.Collection().SetWriteConcern(writeconcern.W1())),
+			rp:   "primary",
+			rc:   "majority",
+			wc:   1,
+		},
+		{
+			name: "call policy overrides the collection",
+			ctx:  mongodb.WithReadPref(context.TODO(), readpref.Nearest()),
+			coll: client.Database("bank").Collection("accounts"),
+			rp:   "nearest",
+			rc:   "majority",
+			wc:   "majority",
+		},
+		{
+			name: "call policies stack",
+			ctx: mongodb.WithWriteConcern(
+				mongodb.WithReadConcern(mongodb.WithReadPref(context.TODO(), readpref.Nearest()), readconcern.Local()),
+				writeconcern.Journaled(),
+			),
+			coll: client.Database("bank").Collection("transactions"),
+			rp:   "nearest",
+			rc:   "local",
+		},
+		{
+			name: "innermost call policy wins",
+			ctx: mongodb.WithPolicy(
+				mongodb.WithReadPref(context.TODO(), readpref.Nearest()),
+				&mongodb.Policy{ReadPref: readpref.Secondary()},
+			),
+			coll: client.Database("bank").Collection("accounts"),
+			rp:   "secondary",
+			rc:   "majority",
+			wc:   "majority",
+		},
+		{
+			name:    "in-memory collection",
+			ctx:     context.TODO(),
+			coll:    mongodb.NewMemoryMongoDB(&mongodb.MemoryMongoDBOpts{}).Cli().Database("bank").Collection("accounts"),
+			wantErr: mongodb.ErrNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := mongodb.CollectionPolicy(tt.ctx, tt.coll)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr))
+				return
+			}
+			assert.Nil(t, err)
+			rp, rc, wc := policyValues(p)
+			assert.Equal(t, tt.rp, rp)
+			assert.Equal(t, tt.rc, rc)
+			assert.Equal(t, tt.wc, wc)
+		})
+	}
+}
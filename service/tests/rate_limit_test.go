@@ -0,0 +1,87 @@
+package test_service
+
+import (
+	"context"
+	"go-app/model"
+	"go-app/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRateLimitStore_Take(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { return now }
+	stores := map[string]service.RateLimitStore{
+		service.RateLimitStoreMemory:  service.NewMemoryRateLimitStore(&service.MemoryRateLimitStoreOpts{Now: clock}),
+		service.RateLimitStoreMongoDB: service.NewMongoRateLimitStore(&service.MongoRateLimitStoreOpts{DB: tsi.Service, Now: clock}),
+	}
+	bucketColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.RateLimitColl)
+
+	type TC struct {
+		name    string
+		key     string
+		advance time.Duration
+		want    service.RateLimitResult
+	}
+
+	// the bucket of key holds 2 tokens and gets a token every 500ms
+	tests := []TC{
+		{
+			name: "bucket starts full",
+			key:  "ip:10.0.0.1",
+			want: service.RateLimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond},
+		},
+		{
+			name: "last token",
+			key:  "ip:10.0.0.1",
+			want: service.RateLimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second},
+		},
+		{
+			name:    "empty bucket",
+			key:     "ip:10.0.0.1",
+			advance: 250 * time.Millisecond,
+			want:    service.RateLimitResult{Limit: 2, Remaining: 0, Reset: 750 * time.Millisecond, RetryAfter: 250 * time.Millisecond},
+		},
+		{
+			name: "other key",
+			key:  "ip:10.0.0.2",
+			want: service.RateLimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond},
+		},
+		{
+			name:    "refilled token",
+			key:     "ip:10.0.0.1",
+			advance: 250 * time.Millisecond,
+			want:    service.RateLimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second},
+		},
+		{
+			name:    "bucket is not refilled beyond its limit",
+			key:     "ip:10.0.0.1",
+			advance: time.Hour,
+			want:    service.RateLimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond},
+		},
+	}
+
+	for name, store := range stores {
+		now = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				now = now.Add(tt.advance)
+				res, err := store.Take(context.TODO(), tt.key, 2, time.Second)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, *res)
+			})
+		}
+	}
+
+	var bucket model.RateLimitBucket
+	assert.Nil(t, Get_DocByFilter(bucketColl, bson.M{"_id": "ip:10.0.0.1"}, &bucket))
+	assert.Equal(t, int64(3), bucket.Version)
+	assert.True(t, now.Add(500*time.Millisecond).Equal(bucket.ExpiresAt))
+}
@@ -0,0 +1,264 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"go-app/service"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errIntercepted stops the operations before they reach the driver.
+var errIntercepted = errors.New("intercepted")
+
+func TestTimeouts_Deadlines(t *testing.T) {
+
+	type call struct {
+		op       mongodb.Operation
+		deadline time.Duration
+		ok       bool
+	}
+	var calls []call
+	record := func(ctx context.Context, op mongodb.Operation, next func(ctx context.Context) error) error {
+		if op.Name == "connect" {
+			return next(ctx)
+		}
+		c := call{op: op}
+		if deadline, ok := ctx.Deadline(); ok {
+			c.deadline, c.ok = time.Until(deadline), true
+		}
+		calls = append(calls, c)
+		return errIntercepted
+	}
+	newClient := func(tc *config.MongoDBTimeoutConfig) mongodb.Client {
+		// the driver connects lazily, the operations are intercepted before they need a server
+		client, err := mongodb.NewClient(&mongodb.MongoDBOpts{
+			Config:       &config.MongoDBConfig{Scheme: "mongodb", Host: "127.0.0.1:1", TimeoutConfig: tc},
+			Interceptors: []mongodb.OperationInterceptor{record},
+		}, nil)
+		assert.Nil(t, err)
+		return client
+	}
+
+	client := newClient(&config.MongoDBTimeoutConfig{Read: time.Second, Write: 2 * time.Second, Transaction: 3 * time.Second, Admin: 4 * time.Second})
+	defer client.Disconnect(context.TODO())
+	coll := client.Database("bank").Collection("accounts")
+	disabled := newClient(&config.MongoDBTimeoutConfig{Read: -1})
+	defer disabled.Disconnect(context.TODO())
+
+	withTimeout := func(d time.Duration) context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	type TC struct {
+		name     string
+		run      func(ctx context.Context) error
+		ctx      context.Context
+		class    mongodb.OperationClass
+		deadline time.Duration
+		// noDeadline is set when no deadline is applied.
+		noDeadline bool
+	}
+
+	tests := []TC{
+		{
+			name:     "read deadline",
+			ctx:      context.Background(),
+			run:      func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			class:    mongodb.ReadOperation,
+			deadline: time.Second,
+		},
+		{
+			name: "write deadline",
+			ctx:  context.Background(),
+			run: func(ctx context.Context) error {
+				_, err := coll.UpdateOne(ctx, bson.M{}, bson.M{"$set": bson.M{"balance": 1}})
+				return err
+			},
+			class:    mongodb.WriteOperation,
+			deadline: 2 * time.Second,
+		},
+		{
+			name: "transaction deadline bounds the whole session",
+			ctx:  context.Background(),
+			run: func(ctx context.Context) error {
+				return client.UseSession(ctx, func(sc mongo.SessionContext) error { return nil })
+			},
+			class:    mongodb.TransactionOperation,
+			deadline: 3 * time.Second,
+		},
+		{
+			name:     "admin deadline",
+			ctx:      context.Background(),
+			run:      client.Ping,
+			class:    mongodb.AdminOperation,
+			deadline: 4 * time.Second,
+		},
+		{
+			name:     "tighter caller deadline wins",
+			ctx:      withTimeout(200 * time.Millisecond),
+			run:      func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			class:    mongodb.ReadOperation,
+			deadline: 200 * time.Millisecond,
+		},
+		{
+			name:     "looser caller deadline is bounded by the class",
+			ctx:      withTimeout(time.Hour),
+			run:      func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			class:    mongodb.ReadOperation,
+			deadline: time.Second,
+		},
+		{
+			name:     "operation timeout overrides the class",
+			ctx:      mongodb.WithOperationTimeout(context.Background(), time.Minute),
+			run:      func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			class:    mongodb.ReadOperation,
+			deadline: time.Minute,
+		},
+		{
+			name:     "operation timeout applies to every class",
+			ctx:      mongodb.WithOperationTimeout(context.Background(), 500*time.Millisecond),
+			run:      client.Ping,
+			class:    mongodb.AdminOperation,
+			deadline: 500 * time.Millisecond,
+		},
+		{
+			name:     "tighter caller deadline wins over the operation timeout",
+			ctx:      mongodb.WithOperationTimeout(withTimeout(200*time.Millisecond), time.Minute),
+			run:      func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			class:    mongodb.ReadOperation,
+			deadline: 200 * time.Millisecond,
+		},
+		{
+			name: "disabled deadline",
+			ctx:  context.Background(),
+			run: func(ctx context.Context) error {
+				return disabled.Database("bank").Collection("accounts").FindOne(ctx, bson.M{}).Err()
+			},
+			class:      mongodb.ReadOperation,
+			noDeadline: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			err := tt.run(tt.ctx)
+			assert.True(t, errors.Is(err, errIntercepted))
+			assert.Len(t, calls, 1)
+			if len(calls) != 1 {
+				return
+			}
+			assert.Equal(t, tt.class, calls[0].op.Class)
+			if tt.noDeadline {
+				assert.False(t, calls[0].ok)
+				return
+			}
+			assert.True(t, calls[0].ok)
+			assert.InDelta(t, tt.deadline, calls[0].deadline, float64(100*time.Millisecond))
+		})
+	}
+}
+
+func TestTimeouts_Errors(t *testing.T) {
+
+	// nothing listens on the port, the server selection fails
+	client, err := mongodb.NewTestClient("mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=50", nil)
+	assert.Nil(t, err)
+	defer client.Disconnect(context.TODO())
+	coll := client.Database("bank").Collection("accounts")
+
+	type TC struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		run     func(ctx context.Context) error
+		timeout bool
+		class   mongodb.OperationClass
+		applied time.Duration
+		code    string
+	}
+
+	tests := []TC{
+		{
+			name:    "driver timeout",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.Background(), func() {} },
+			run:     func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			timeout: true,
+			class:   mongodb.ReadOperation,
+			applied: mongodb.DefaultReadTimeout,
+			code:    "Timeout",
+		},
+		{
+			name: "deadline of the operation",
+			ctx: func() (context.Context, context.CancelFunc) {
+				// shorter than the server selection timeout, the deadline expires first
+				return mongodb.WithOperationTimeout(context.Background(), 20*time.Millisecond), func() {}
+			},
+			run: func(ctx context.Context) error {
+				_, err := coll.InsertOne(ctx, bson.M{"balance": 1})
+				return err
+			},
+			timeout: true,
+			class:   mongodb.WriteOperation,
+			applied: 20 * time.Millisecond,
+			code:    "Timeout",
+		},
+		{
+			name: "deadline of the caller",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			run:     func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			timeout: true,
+			class:   mongodb.ReadOperation,
+			code:    "Timeout",
+		},
+		{
+			name: "cancelled context",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			run:  func(ctx context.Context) error { return coll.FindOne(ctx, bson.M{}).Err() },
+			code: "InternalServerErr",
+		},
+		{
+			name: "other error",
+			ctx:  func() (context.Context, context.CancelFunc) { return context.Background(), func() {} },
+			run: func(ctx context.Context) error {
+				// not a document, rejected before the server selection
+				_, err := coll.InsertOne(ctx, 42)
+				return err
+			},
+			code: "InternalServerErr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			err := tt.run(ctx)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.timeout, mongodb.IsTimeout(err))
+			assert.Equal(t, tt.timeout, errors.Is(err, mongodb.ErrTimeout))
+			assert.Equal(t, tt.code, service.AsError(errors.Wrap(err, "failed")).Code)
+
+			var te *mongodb.TimeoutError
+			assert.Equal(t, tt.timeout, errors.As(err, &te))
+			if te != nil {
+				assert.Equal(t, tt.class, te.Class)
+				assert.Equal(t, tt.applied, te.Timeout)
+			}
+		})
+	}
+}
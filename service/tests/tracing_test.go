@@ -0,0 +1,165 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/mongodb"
+	"go-app/internals/tracing"
+	"go-app/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHTTPImpl_Get_Tracing(t *testing.T) {
+
+	exporter := tracetest.NewInMemoryExporter()
+	tr, err := tracing.NewTracing(&tracing.TracingOpts{Exporter: exporter})
+	assert.Nil(t, err)
+	h := service.NewHttp(&service.HTTPOpts{Transport: tr.Transport(nil)})
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	type TC struct {
+		name     string
+		url      string
+		wantErr  bool
+		validate func(tt *TC, parent trace.Span, span tracetest.SpanStub)
+	}
+
+	tests := []TC{
+		{
+			name: "success",
+			url:  srv.URL + "/ok",
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, "GET", span.Name)
+				assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+				assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+				assert.Equal(t, codes.Unset, span.Status.Code)
+				// the called service continues the trace from the client span
+				assert.Equal(t, "00-"+span.SpanContext.TraceID().String()+"-"+span.SpanContext.SpanID().String()+"-01", traceparent)
+			},
+		},
+		{
+			name: "error status",
+			url:  srv.URL + "/fail",
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, codes.Error, span.Status.Code)
+			},
+		},
+		{
+			name:    "unreachable",
+			url:     "http://127.0.0.1:1/",
+			wantErr: true,
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, codes.Error, span.Status.Code)
+				assert.Len(t, span.Events, 1)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			ctx, parent := tr.TracerProvider().Tracer("test").Start(context.TODO(), "parent")
+			resp, err := h.Get(ctx, tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HTTPImpl.Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if resp != nil {
+				resp.Body.Close()
+			}
+			parent.End()
+
+			spans := exporter.GetSpans()
+			if assert.Len(t, spans, 2) {
+				tt.validate(&tt, parent, spans[0])
+			}
+		})
+	}
+}
+
+func TestTracingImpl_MongoDBInterceptor(t *testing.T) {
+
+	exporter := tracetest.NewInMemoryExporter()
+	tr, err := tracing.NewTracing(&tracing.TracingOpts{Exporter: exporter})
+	assert.Nil(t, err)
+	intercept := tr.MongoDBInterceptor()
+
+	type TC struct {
+		name     string
+		op       mongodb.Operation
+		err      error
+		validate func(tt *TC, parent trace.Span, span tracetest.SpanStub)
+	}
+
+	tests := []TC{
+		{
+			name: "collection operation",
+			op:   mongodb.Operation{Name: "findOne", Class: mongodb.ReadOperation, Database: "bank", Collection: "account"},
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, "findOne bank.account", span.Name)
+				assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+				assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+				assert.Equal(t, codes.Unset, span.Status.Code)
+			},
+		},
+		{
+			name: "client operation",
+			op:   mongodb.Operation{Name: "withTransaction", Class: mongodb.TransactionOperation},
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, "withTransaction", span.Name)
+			},
+		},
+		{
+			name: "no documents is not an error",
+			op:   mongodb.Operation{Name: "findOne", Class: mongodb.ReadOperation, Database: "bank", Collection: "account"},
+			err:  mongo.ErrNoDocuments,
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, codes.Unset, span.Status.Code)
+			},
+		},
+		{
+			name: "failed operation",
+			op:   mongodb.Operation{Name: "insertOne", Class: mongodb.WriteOperation, Database: "bank", Collection: "account"},
+			err:  errors.New("write failed"),
+			validate: func(tt *TC, parent trace.Span, span tracetest.SpanStub) {
+				assert.Equal(t, codes.Error, span.Status.Code)
+				assert.Equal(t, "write failed", span.Status.Description)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			ctx, parent := tr.TracerProvider().Tracer("test").Start(context.TODO(), "parent")
+			err := intercept(ctx, tt.op, func(ctx context.Context) error {
+				// the driver call runs within the span of the operation
+				assert.NotEqual(t, parent.SpanContext().SpanID(), trace.SpanContextFromContext(ctx).SpanID())
+				return tt.err
+			})
+			assert.Equal(t, tt.err, err)
+			parent.End()
+
+			spans := exporter.GetSpans()
+			if assert.Len(t, spans, 2) {
+				tt.validate(&tt, parent, spans[0])
+			}
+		})
+	}
+}
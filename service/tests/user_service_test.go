@@ -0,0 +1,359 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testJWTConfig = &config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "secret", Issuer: "go-app", Audience: "go-app"}
+
+func newUserService(t *testing.T, tsi *TestService, password *config.PasswordConfig) service.UserService {
+	j, err := auth.NewJWT(&auth.JWTOpts{Config: testJWTConfig})
+	assert.Nil(t, err)
+	if password == nil {
+		password = tsi.Service.(*service.ServiceImpl).Config.UserServiceConfig.Password
+	}
+	passwords, err := auth.NewPasswordHasher(&auth.PasswordHasherOpts{Config: password})
+	assert.Nil(t, err)
+	return service.NewUserService(&service.UserServiceOpts{
+		Logger:    &zerolog.Logger{},
+		Config:    &config.UserServiceConfig{AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		DB:        tsi.Service,
+		JWT:       j,
+		Passwords: passwords,
+	})
+}
+
+func TestUserServiceImpl_Register(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	userColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.UserColl)
+
+	type TC struct {
+		name     string
+		opts     *schema.User_RegisterOpts
+		wantErr  bool
+		err      error
+		validate func(tt *TC, user *schema.User_Get)
+	}
+
+	tests := []TC{
+		{
+			name: "success",
+			opts: &schema.User_RegisterOpts{Email: " Jane@Example.com", Password: "correct horse battery"},
+			validate: func(tt *TC, user *schema.User_Get) {
+				assert.Equal(t, "jane@example.com", user.Email)
+				assert.Equal(t, []string{schema.RoleCustomer}, user.Roles)
+				var doc model.User
+				assert.Nil(t, Get_DocByFilter(userColl, bson.M{"_id": user.ID}, &doc))
+				assert.True(t, strings.HasPrefix(doc.PasswordHash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+				assert.NotContains(t, doc.PasswordHash, tt.opts.Password)
+			},
+		},
+		{
+			name:    "email is taken regardless of its case",
+			opts:    &schema.User_RegisterOpts{Email: "JANE@example.com", Password: "another password"},
+			wantErr: true,
+			err:     service.ErrEmailTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := s.Register(context.TODO(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.Register() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, user)
+		})
+	}
+}
+
+func TestUserServiceImpl_Login(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	userColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.UserColl)
+	j, _ := auth.NewJWT(&auth.JWTOpts{Config: testJWTConfig})
+
+	// the user registered while the passwords were hashed with bcrypt
+	bcryptService := newUserService(t, tsi, &config.PasswordConfig{Algorithm: auth.PasswordBcrypt, BcryptCost: 4})
+	user, err := bcryptService.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+
+	type TC struct {
+		name     string
+		opts     *schema.User_LoginOpts
+		wantErr  bool
+		err      error
+		validate func(tt *TC, resp *schema.User_TokenResp)
+	}
+
+	tests := []TC{
+		{
+			name: "bcrypt hash is replaced by the configured algorithm",
+			opts: &schema.User_LoginOpts{Email: "Jane@example.com", Password: "correct horse battery"},
+			validate: func(tt *TC, resp *schema.User_TokenResp) {
+				assert.Equal(t, schema.TokenTypeBearer, resp.TokenType)
+				assert.Equal(t, int64(60), resp.ExpiresIn)
+				assert.Equal(t, int64(3600), resp.RefreshExpiresIn)
+				assert.NotEmpty(t, resp.RefreshToken)
+				claims, err := j.Verify(resp.AccessToken)
+				if assert.Nil(t, err) {
+					assert.Equal(t, user.ID.Hex(), claims.Subject)
+					assert.Equal(t, []string{schema.RoleCustomer}, claims.Roles)
+					assert.Equal(t, "go-app", claims.Issuer)
+				}
+				var doc model.User
+				assert.Nil(t, Get_DocByFilter(userColl, bson.M{"_id": user.ID}, &doc))
+				assert.True(t, strings.HasPrefix(doc.PasswordHash, "$argon2id$"))
+			},
+		},
+		{
+			name: "argon2id hash",
+			opts: &schema.User_LoginOpts{Email: "jane@example.com", Password: "correct horse battery"},
+			validate: func(tt *TC, resp *schema.User_TokenResp) {
+				assert.NotEmpty(t, resp.AccessToken)
+			},
+		},
+		{
+			name:    "wrong password",
+			opts:    &schema.User_LoginOpts{Email: "jane@example.com", Password: "incorrect horse battery"},
+			wantErr: true,
+			err:     service.ErrInvalidCredentials,
+		},
+		{
+			name:    "unknown email",
+			opts:    &schema.User_LoginOpts{Email: "john@example.com", Password: "correct horse battery"},
+			wantErr: true,
+			err:     service.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.Login(context.TODO(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.Login() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, resp)
+		})
+	}
+}
+
+func TestUserServiceImpl_Refresh(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	tokenColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.RefreshTokenColl)
+	_, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+	login := func() *schema.User_TokenResp {
+		resp, err := s.Login(context.TODO(), &schema.User_LoginOpts{Email: "jane@example.com", Password: "correct horse battery"})
+		assert.Nil(t, err)
+		return resp
+	}
+	refresh := func(token string) (*schema.User_TokenResp, error) {
+		return s.Refresh(context.TODO(), &schema.User_RefreshOpts{RefreshToken: token})
+	}
+
+	type TC struct {
+		name    string
+		token   string
+		wantErr bool
+		err     error
+		prepare func(tt *TC)
+		// validate runs after the refresh, it gets the refreshed tokens when the refresh succeeded
+		validate func(tt *TC, resp *schema.User_TokenResp)
+	}
+
+	tests := []TC{
+		{
+			name: "token is rotated",
+			prepare: func(tt *TC) {
+				tt.token = login().RefreshToken
+			},
+			validate: func(tt *TC, resp *schema.User_TokenResp) {
+				assert.NotEqual(t, tt.token, resp.RefreshToken)
+				next, err := refresh(resp.RefreshToken)
+				assert.Nil(t, err)
+				assert.NotEmpty(t, next.AccessToken)
+			},
+		},
+		{
+			name:    "reused token revokes the session",
+			wantErr: true,
+			err:     service.ErrRefreshTokenReused,
+			prepare: func(tt *TC) {
+				tt.token = login().RefreshToken
+				_, err := refresh(tt.token)
+				assert.Nil(t, err)
+			},
+			validate: func(tt *TC, resp *schema.User_TokenResp) {
+				var tokens []model.RefreshToken
+				assert.Nil(t, Get_DocsByFilter(tokenColl, bson.M{"revoked_at": bson.M{"$exists": true}}, &tokens))
+				assert.Len(t, tokens, 2)
+				for _, rt := range tokens {
+					assert.Equal(t, tokens[0].FamilyID, rt.FamilyID)
+				}
+			},
+		},
+		{
+			name:    "token of a revoked session",
+			wantErr: true,
+			err:     service.ErrInvalidRefreshToken,
+			prepare: func(tt *TC) {
+				tt.token = login().RefreshToken
+				next, err := refresh(tt.token)
+				assert.Nil(t, err)
+				_, err = refresh(tt.token)
+				assert.True(t, errors.Is(err, service.ErrRefreshTokenReused))
+				// the token issued before the reuse was detected is revoked with the session
+				tt.token = next.RefreshToken
+			},
+		},
+		{
+			name:    "expired token",
+			wantErr: true,
+			err:     service.ErrRefreshTokenExpired,
+			prepare: func(tt *TC) {
+				tt.token = login().RefreshToken
+				_, err := tokenColl.UpdateMany(context.TODO(), bson.M{"used_at": bson.M{"$exists": false}, "revoked_at": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}})
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:    "unknown token",
+			token:   "not-a-refresh-token",
+			wantErr: true,
+			err:     service.ErrInvalidRefreshToken,
+			prepare: func(tt *TC) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			resp, err := refresh(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.Refresh() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+			}
+			if tt.validate != nil {
+				tt.validate(&tt, resp)
+			}
+		})
+	}
+}
+
+func TestUserServiceImpl_Logout(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	_, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+	login := func() string {
+		resp, err := s.Login(context.TODO(), &schema.User_LoginOpts{Email: "jane@example.com", Password: "correct horse battery"})
+		assert.Nil(t, err)
+		return resp.RefreshToken
+	}
+	refreshErr := func(token string) error {
+		_, err := s.Refresh(context.TODO(), &schema.User_RefreshOpts{RefreshToken: token})
+		return err
+	}
+
+	type TC struct {
+		name     string
+		all      bool
+		wantErr  bool
+		err      error
+		prepare  func(tt *TC) string
+		validate func(tt *TC, token string)
+	}
+
+	var other string
+	tests := []TC{
+		{
+			name: "session of the token",
+			prepare: func(tt *TC) string {
+				other = login()
+				return login()
+			},
+			validate: func(tt *TC, token string) {
+				assert.True(t, errors.Is(refreshErr(token), service.ErrInvalidRefreshToken))
+				assert.Nil(t, refreshErr(other))
+			},
+		},
+		{
+			name: "every session of the user",
+			all:  true,
+			prepare: func(tt *TC) string {
+				other = login()
+				return login()
+			},
+			validate: func(tt *TC, token string) {
+				assert.True(t, errors.Is(refreshErr(token), service.ErrInvalidRefreshToken))
+				assert.True(t, errors.Is(refreshErr(other), service.ErrInvalidRefreshToken))
+			},
+		},
+		{
+			name:    "unknown token",
+			wantErr: true,
+			err:     service.ErrInvalidRefreshToken,
+			prepare: func(tt *TC) string {
+				return "not-a-refresh-token"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.prepare(&tt)
+			err := s.Logout(context.TODO(), &schema.User_LogoutOpts{RefreshToken: token, All: tt.all})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.Logout() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, token)
+		})
+	}
+}
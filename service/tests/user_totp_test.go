@@ -0,0 +1,354 @@
+package test_service
+
+import (
+	"context"
+	"go-app/internals/auth"
+	"go-app/internals/config"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"go-app/schema"
+	"go-app/service"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// totpCode returns the code of secret for the current time step shifted by offset steps.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+offset)
+	assert.Nil(t, err)
+	return code
+}
+
+func TestUserServiceImpl_ConfirmTOTP(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	userColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.UserColl)
+	user, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+
+	var enrolled *schema.TOTP_EnrollResp
+
+	type TC struct {
+		name     string
+		prepare  func(tt *TC)
+		code     string
+		wantErr  bool
+		err      error
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "enrollment is not confirmed yet",
+			prepare: func(tt *TC) {
+				enrolled, err = s.EnrollTOTP(context.TODO(), user.ID)
+				assert.Nil(t, err)
+				assert.Len(t, enrolled.RecoveryCodes, 10)
+				assert.True(t, strings.HasPrefix(enrolled.URI, "otpauth://totp/go-app:jane@example.com?"))
+				assert.Contains(t, enrolled.URI, "secret="+enrolled.Secret)
+				// the secret is only stored encrypted
+				subtype, _, ok := getRawDoc(t, userColl, user.ID).Lookup("totp", "secret").BinaryOK()
+				assert.True(t, ok)
+				assert.Equal(t, mongodb.BinaryEncrypted, subtype)
+				tt.code = "000000"
+				if totpCode(t, enrolled.Secret, 0) == tt.code {
+					tt.code = "111111"
+				}
+			},
+			wantErr: true,
+			err:     service.ErrInvalidTOTPCode,
+		},
+		{
+			name: "enrollment is replaced until it is confirmed",
+			prepare: func(tt *TC) {
+				first := enrolled.Secret
+				enrolled, err = s.EnrollTOTP(context.TODO(), user.ID)
+				assert.Nil(t, err)
+				assert.NotEqual(t, first, enrolled.Secret)
+				tt.code = totpCode(t, enrolled.Secret, 0)
+			},
+			validate: func(tt *TC) {
+				var doc model.User
+				assert.Nil(t, Get_DocByFilter(userColl, bson.M{"_id": user.ID}, &doc))
+				assert.NotNil(t, doc.TOTP.ConfirmedAt)
+				assert.Equal(t, enrolled.Secret, doc.TOTP.Secret)
+				_, err := s.EnrollTOTP(context.TODO(), user.ID)
+				assert.True(t, errors.Is(err, service.ErrTOTPAlreadyEnabled))
+			},
+		},
+		{
+			name: "already confirmed",
+			prepare: func(tt *TC) {
+				tt.code = totpCode(t, enrolled.Secret, 1)
+			},
+			wantErr: true,
+			err:     service.ErrTOTPAlreadyEnabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare(&tt)
+			err := s.ConfirmTOTP(context.TODO(), &schema.TOTP_ConfirmOpts{UserID: user.ID, Code: tt.code})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.ConfirmTOTP() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+			}
+			if tt.validate != nil {
+				tt.validate(&tt)
+			}
+		})
+	}
+}
+
+func TestUserServiceImpl_StepUp(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	s := newUserService(t, tsi, nil)
+	j, _ := auth.NewJWT(&auth.JWTOpts{Config: testJWTConfig})
+	user, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+	other, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "john@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+	enrolled, err := s.EnrollTOTP(context.TODO(), user.ID)
+	assert.Nil(t, err)
+	confirmCode := totpCode(t, enrolled.Secret, 0)
+	assert.Nil(t, s.ConfirmTOTP(context.TODO(), &schema.TOTP_ConfirmOpts{UserID: user.ID, Code: confirmCode}))
+
+	type TC struct {
+		name     string
+		opts     *schema.TOTP_VerifyOpts
+		wantErr  bool
+		err      error
+		validate func(tt *TC, resp *schema.TOTP_StepUpResp)
+	}
+
+	tests := []TC{
+		{
+			name:    "code used to confirm the enrollment is not replayed",
+			opts:    &schema.TOTP_VerifyOpts{UserID: user.ID, Code: confirmCode},
+			wantErr: true,
+			err:     service.ErrInvalidTOTPCode,
+		},
+		{
+			name: "code of the next time step",
+			opts: &schema.TOTP_VerifyOpts{UserID: user.ID, Code: totpCode(t, enrolled.Secret, 1)},
+			validate: func(tt *TC, resp *schema.TOTP_StepUpResp) {
+				assert.Equal(t, schema.TokenTypeBearer, resp.TokenType)
+				assert.Equal(t, int64(60), resp.ExpiresIn)
+				claims, err := j.Verify(resp.AccessToken)
+				if assert.Nil(t, err) {
+					assert.Equal(t, user.ID.Hex(), claims.Subject)
+					assert.True(t, claims.HasAMR(schema.AMROTP))
+					assert.True(t, claims.HasAMR(schema.AMRPassword))
+					assert.WithinDuration(t, time.Now(), time.Unix(claims.AuthTime, 0), 5*time.Second)
+				}
+			},
+		},
+		{
+			name:    "code of an earlier time step",
+			opts:    &schema.TOTP_VerifyOpts{UserID: user.ID, Code: totpCode(t, enrolled.Secret, -1)},
+			wantErr: true,
+			err:     service.ErrInvalidTOTPCode,
+		},
+		{
+			name: "recovery code in any case",
+			opts: &schema.TOTP_VerifyOpts{UserID: user.ID, RecoveryCode: strings.ToUpper(enrolled.RecoveryCodes[0])},
+			validate: func(tt *TC, resp *schema.TOTP_StepUpResp) {
+				assert.NotEmpty(t, resp.AccessToken)
+			},
+		},
+		{
+			name:    "recovery code is used once",
+			opts:    &schema.TOTP_VerifyOpts{UserID: user.ID, RecoveryCode: enrolled.RecoveryCodes[0]},
+			wantErr: true,
+			err:     service.ErrInvalidTOTPCode,
+		},
+		{
+			name:    "user without second factor",
+			opts:    &schema.TOTP_VerifyOpts{UserID: other.ID, Code: "123456"},
+			wantErr: true,
+			err:     service.ErrTOTPNotEnabled,
+		},
+		{
+			name:    "unknown user",
+			opts:    &schema.TOTP_VerifyOpts{UserID: primitive.NewObjectID(), Code: "123456"},
+			wantErr: true,
+			err:     service.ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.StepUp(context.TODO(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.StepUp() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			tt.validate(&tt, resp)
+		})
+	}
+}
+
+// invalidTOTPCode returns a code rejected for secret, whatever the allowed skew.
+func invalidTOTPCode(t *testing.T, secret string) string {
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		valid := false
+		for offset := int64(-1); offset <= 1; offset++ {
+			valid = valid || totpCode(t, secret, offset) == code
+		}
+		if !valid {
+			return code
+		}
+	}
+	t.Fatal("no invalid code found")
+	return ""
+}
+
+func TestUserServiceImpl_TOTPLockout(t *testing.T) {
+
+	tsi := NewTestService(t)
+	defer tsi.Clean()
+
+	j, err := auth.NewJWT(&auth.JWTOpts{Config: testJWTConfig})
+	assert.Nil(t, err)
+	passwords, err := auth.NewPasswordHasher(&auth.PasswordHasherOpts{Config: tsi.Service.(*service.ServiceImpl).Config.UserServiceConfig.Password})
+	assert.Nil(t, err)
+	s := service.NewUserService(&service.UserServiceOpts{
+		Logger: &zerolog.Logger{},
+		Config: &config.UserServiceConfig{
+			AccessTokenTTL:  time.Minute,
+			RefreshTokenTTL: time.Hour,
+			TOTP:            &config.TOTPConfig{Skew: 1, MaxAttempts: 3, Lockout: time.Minute},
+		},
+		DB:        tsi.Service,
+		JWT:       j,
+		Passwords: passwords,
+	})
+	userColl := tsi.Service.MongoDB().Cli().Database(model.AuthDB).Collection(model.UserColl)
+	user, err := s.Register(context.TODO(), &schema.User_RegisterOpts{Email: "jane@example.com", Password: "correct horse battery"})
+	assert.Nil(t, err)
+	enrolled, err := s.EnrollTOTP(context.TODO(), user.ID)
+	assert.Nil(t, err)
+	invalid := invalidTOTPCode(t, enrolled.Secret)
+
+	stepUp := func(code string) error {
+		_, err := s.StepUp(context.TODO(), &schema.TOTP_VerifyOpts{UserID: user.ID, Code: code})
+		return err
+	}
+	totpDoc := func() *model.UserTOTP {
+		var doc model.User
+		assert.Nil(t, Get_DocByFilter(userColl, bson.M{"_id": user.ID}, &doc))
+		return doc.TOTP
+	}
+
+	type TC struct {
+		name     string
+		run      func() error
+		err      error
+		validate func(tt *TC)
+	}
+
+	tests := []TC{
+		{
+			name: "invalid codes of the enrollment are counted",
+			run: func() error {
+				return s.ConfirmTOTP(context.TODO(), &schema.TOTP_ConfirmOpts{UserID: user.ID, Code: invalid})
+			},
+			err: service.ErrInvalidTOTPCode,
+			validate: func(tt *TC) {
+				assert.Equal(t, 1, totpDoc().FailedAttempts)
+			},
+		},
+		{
+			name: "accepted code resets the count",
+			run: func() error {
+				return s.ConfirmTOTP(context.TODO(), &schema.TOTP_ConfirmOpts{UserID: user.ID, Code: totpCode(t, enrolled.Secret, -1)})
+			},
+			validate: func(tt *TC) {
+				assert.Equal(t, 0, totpDoc().FailedAttempts)
+			},
+		},
+		{
+			name: "invalid codes below the limit",
+			run: func() error {
+				assert.True(t, errors.Is(stepUp(invalid), service.ErrInvalidTOTPCode))
+				return stepUp(invalid)
+			},
+			err: service.ErrInvalidTOTPCode,
+			validate: func(tt *TC) {
+				doc := totpDoc()
+				assert.Equal(t, 2, doc.FailedAttempts)
+				assert.Nil(t, doc.LockedUntil)
+			},
+		},
+		{
+			name: "invalid code reaching the limit locks the codes out",
+			run:  func() error { return stepUp(invalid) },
+			err:  service.ErrInvalidTOTPCode,
+			validate: func(tt *TC) {
+				doc := totpDoc()
+				assert.Equal(t, 0, doc.FailedAttempts)
+				if assert.NotNil(t, doc.LockedUntil) {
+					assert.WithinDuration(t, time.Now().Add(time.Minute), *doc.LockedUntil, 5*time.Second)
+				}
+			},
+		},
+		{
+			name: "valid code is rejected while locked out",
+			run:  func() error { return stepUp(totpCode(t, enrolled.Secret, 0)) },
+			err:  service.ErrTOTPLocked,
+		},
+		{
+			name: "recovery codes are accepted while locked out",
+			run: func() error {
+				_, err := s.StepUp(context.TODO(), &schema.TOTP_VerifyOpts{UserID: user.ID, RecoveryCode: enrolled.RecoveryCodes[0]})
+				return err
+			},
+		},
+		{
+			name: "codes are accepted once the lockout expired",
+			run: func() error {
+				_, err := userColl.UpdateOne(context.TODO(), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totp.locked_until": time.Now().Add(-time.Second)}})
+				assert.Nil(t, err)
+				return stepUp(totpCode(t, enrolled.Secret, 0))
+			},
+			validate: func(tt *TC) {
+				assert.Nil(t, totpDoc().LockedUntil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "got %v", err)
+			} else {
+				assert.Nil(t, err)
+			}
+			if tt.validate != nil {
+				tt.validate(&tt)
+			}
+		})
+	}
+}
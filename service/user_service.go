@@ -0,0 +1,279 @@
+//go:generate $GOPATH/bin/mockgen -destination=../mock/mock_user_service.go -package=mock go-app/service UserService
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"go-app/internals/mongodb"
+	"go-app/model"
+	"go-app/schema"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserService interface {
+	Register(ctx context.Context, opts *schema.User_RegisterOpts) (*schema.User_Get, error)
+	// Login verifies the credentials and starts a session, its refresh token is rotated by Refresh.
+	Login(ctx context.Context, opts *schema.User_LoginOpts) (*schema.User_TokenResp, error)
+	// Refresh exchanges a refresh token for new tokens. Refresh tokens are accepted once, presenting one again revokes
+	// the session as the token was likely stolen.
+	Refresh(ctx context.Context, opts *schema.User_RefreshOpts) (*schema.User_TokenResp, error)
+	// Logout revokes the session of the refresh token, or every session of its user. The access tokens already issued
+	// stay valid until they expire.
+	Logout(ctx context.Context, opts *schema.User_LogoutOpts) error
+	GetUser(ctx context.Context, id primitive.ObjectID) (*schema.User_Get, error)
+	// EnrollTOTP generates the secret and the recovery codes of a second factor, which replaces any unconfirmed one.
+	// It is only required once ConfirmTOTP verified a first code.
+	EnrollTOTP(ctx context.Context, id primitive.ObjectID) (*schema.TOTP_EnrollResp, error)
+	ConfirmTOTP(ctx context.Context, opts *schema.TOTP_ConfirmOpts) error
+	// StepUp verifies a code of the second factor, or consumes a recovery code, and issues an access token asserting
+	// the second factor.
+	StepUp(ctx context.Context, opts *schema.TOTP_VerifyOpts) (*schema.TOTP_StepUpResp, error)
+}
+
+func (us *UserServiceImpl) collection(name string) mongodb.Collection {
+	return us.DB.MongoDB().Cli().Database(model.AuthDB).Collection(name)
+}
+
+func (us *UserServiceImpl) Register(ctx context.Context, opts *schema.User_RegisterOpts) (*schema.User_Get, error) {
+	hash, err := us.Passwords.Hash(opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	now := UTCNow()
+	u := &model.User{
+		ID:           primitive.NewObjectID(),
+		Email:        normalizeEmail(opts.Email),
+		PasswordHash: hash,
+		Roles:        []string{schema.RoleCustomer},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	// the collections have no unique index on the email, the reservation is keyed by it instead
+	if _, err := us.collection(model.UserEmailColl).InsertOne(ctx, &model.UserEmail{Email: u.Email, UserID: u.ID}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, errors.Wrap(err, "failed to reserve email")
+	}
+	if _, err := us.collection(model.UserColl).InsertOne(ctx, u); err != nil {
+		// release the email so that the registration can be retried
+		if _, derr := us.collection(model.UserEmailColl).DeleteOne(ctx, bson.M{"_id": u.Email}); derr != nil {
+			us.Logger.Err(derr).Ctx(ctx).Str("user_id", u.ID.Hex()).Msg("failed to release the email of a failed registration")
+		}
+		return nil, errors.Wrap(err, "failed to insert user")
+	}
+	return toUserGet(u), nil
+}
+
+func (us *UserServiceImpl) Login(ctx context.Context, opts *schema.User_LoginOpts) (*schema.User_TokenResp, error) {
+	var u model.User
+	err := us.collection(model.UserColl).FindOne(ctx, bson.M{"email": normalizeEmail(opts.Email)}).Decode(&u)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// unknown emails take as long as wrong passwords, so they cannot be told apart
+		_, _ = us.Passwords.Verify(us.dummyHash(), opts.Password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find user")
+	}
+	ok, err := us.Passwords.Verify(u.PasswordHash, opts.Password)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to verify password")
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if us.Passwords.NeedsRehash(u.PasswordHash) {
+		us.rehash(ctx, &u, opts.Password)
+	}
+	return us.issueTokens(ctx, &u, primitive.NewObjectID(), UTCNow())
+}
+
+// rehash replaces the password hash of u with one of the configured algorithm, the login succeeds even if it fails.
+func (us *UserServiceImpl) rehash(ctx context.Context, u *model.User, password string) {
+	hash, err := us.Passwords.Hash(password)
+	if err == nil {
+		update := bson.M{"$set": bson.M{"password_hash": hash, "updated_at": UTCNow()}}
+		_, err = us.collection(model.UserColl).UpdateOne(ctx, bson.M{"_id": u.ID, "password_hash": u.PasswordHash}, update)
+	}
+	if err != nil {
+		us.Logger.Err(err).Ctx(ctx).Str("user_id", u.ID.Hex()).Msg("failed to rehash password")
+	}
+}
+
+func (us *UserServiceImpl) Refresh(ctx context.Context, opts *schema.User_RefreshOpts) (*schema.User_TokenResp, error) {
+	rt, err := us.findRefreshToken(ctx, opts.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	now := UTCNow()
+	switch {
+	case rt.RevokedAt != nil:
+		return nil, ErrInvalidRefreshToken
+	case rt.UsedAt != nil:
+		return nil, us.reused(ctx, rt)
+	case !now.Before(rt.ExpiresAt):
+		return nil, ErrRefreshTokenExpired
+	}
+	// of concurrent refreshes with the same token only one marks it used, the others are reuses
+	filter := bson.M{"_id": rt.ID, "used_at": bson.M{"$exists": false}, "revoked_at": bson.M{"$exists": false}}
+	res, err := us.collection(model.RefreshTokenColl).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to use refresh token")
+	}
+	if res.MatchedCount == 0 {
+		return nil, us.reused(ctx, rt)
+	}
+	u, err := us.findUser(ctx, rt.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return us.issueTokens(ctx, u, rt.FamilyID, rt.AuthTime)
+}
+
+// reused revokes the session of a refresh token presented after it was used.
+func (us *UserServiceImpl) reused(ctx context.Context, rt *model.RefreshToken) error {
+	us.Logger.Warn().Ctx(ctx).Str("user_id", rt.UserID.Hex()).Str("family_id", rt.FamilyID.Hex()).Msg("refresh token reused, revoking the session")
+	if err := us.revoke(ctx, bson.M{"family_id": rt.FamilyID}); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func (us *UserServiceImpl) Logout(ctx context.Context, opts *schema.User_LogoutOpts) error {
+	rt, err := us.findRefreshToken(ctx, opts.RefreshToken)
+	if err != nil {
+		return err
+	}
+	if opts.All {
+		return us.revoke(ctx, bson.M{"user_id": rt.UserID})
+	}
+	return us.revoke(ctx, bson.M{"family_id": rt.FamilyID})
+}
+
+func (us *UserServiceImpl) revoke(ctx context.Context, filter bson.M) error {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	if _, err := us.collection(model.RefreshTokenColl).UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": UTCNow()}}); err != nil {
+		return errors.Wrap(err, "failed to revoke refresh tokens")
+	}
+	return nil
+}
+
+func (us *UserServiceImpl) GetUser(ctx context.Context, id primitive.ObjectID) (*schema.User_Get, error) {
+	u, err := us.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return toUserGet(u), nil
+}
+
+func (us *UserServiceImpl) findRefreshToken(ctx context.Context, token string) (*model.RefreshToken, error) {
+	var rt model.RefreshToken
+	if err := us.collection(model.RefreshTokenColl).FindOne(ctx, bson.M{"hash": hashToken(token)}).Decode(&rt); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, errors.Wrap(err, "failed to find refresh token")
+	}
+	return &rt, nil
+}
+
+// issueTokens signs an access token for u and stores the next refresh token of the session family, authTime is when
+// the user logged in.
+func (us *UserServiceImpl) issueTokens(ctx context.Context, u *model.User, family primitive.ObjectID, authTime time.Time) (*schema.User_TokenResp, error) {
+	now := UTCNow()
+	access, err := us.signAccessToken(u, now, authTime, schema.AMRPassword)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	rt := &model.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    u.ID,
+		FamilyID:  family,
+		Hash:      hashToken(refresh),
+		AuthTime:  authTime,
+		ExpiresAt: now.Add(us.Config.RefreshTokenTTL),
+		CreatedAt: now,
+	}
+	if _, err := us.collection(model.RefreshTokenColl).InsertOne(ctx, rt); err != nil {
+		return nil, errors.Wrap(err, "failed to insert refresh token")
+	}
+	return &schema.User_TokenResp{
+		AccessToken:      access,
+		TokenType:        schema.TokenTypeBearer,
+		ExpiresIn:        int64(us.Config.AccessTokenTTL.Seconds()),
+		RefreshToken:     refresh,
+		RefreshExpiresIn: int64(us.Config.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+func (us *UserServiceImpl) signAccessToken(u *model.User, now, authTime time.Time, amr ...string) (string, error) {
+	if us.JWT == nil {
+		return "", errors.New("access tokens are not configured")
+	}
+	claims := &schema.Claims{
+		Subject:   u.ID.Hex(),
+		Roles:     u.Roles,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(us.Config.AccessTokenTTL).Unix(),
+		ID:        primitive.NewObjectID().Hex(),
+		AMR:       amr,
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+	return us.JWT.Sign(claims)
+}
+
+func (us *UserServiceImpl) findUser(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	var u model.User
+	if err := us.collection(model.UserColl).FindOne(ctx, bson.M{"_id": id}).Decode(&u); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find user")
+	}
+	return &u, nil
+}
+
+func (us *UserServiceImpl) dummyHash() string {
+	us.dummyOnce.Do(func() {
+		us.dummy, _ = us.Passwords.Hash("not the password of anyone")
+	})
+	return us.dummy
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate refresh token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func toUserGet(u *model.User) *schema.User_Get {
+	return &schema.User_Get{
+		ID:        u.ID,
+		Email:     u.Email,
+		Roles:     u.Roles,
+		CreatedAt: u.CreatedAt,
+	}
+}
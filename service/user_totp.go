@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"go-app/internals/auth"
+	"go-app/model"
+	"go-app/schema"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recoveryCodeBytes is the entropy of a recovery code, it is hashed like the other random tokens.
+const recoveryCodeBytes = 10
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func (us *UserServiceImpl) EnrollTOTP(ctx context.Context, id primitive.ObjectID) (*schema.TOTP_EnrollResp, error) {
+	u, err := us.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTP != nil && u.TOTP.ConfirmedAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes(us.Config.TOTP.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+	// the struct is encoded by the registry of the client, which encrypts the secret
+	totp := &model.UserTOTP{Secret: secret, RecoveryCodes: hashes}
+	filter := bson.M{"_id": u.ID, "totp.confirmed_at": bson.M{"$exists": false}}
+	res, err := us.collection(model.UserColl).UpdateOne(ctx, filter, bson.M{"$set": bson.M{"totp": totp, "updated_at": UTCNow()}})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to enroll second factor")
+	}
+	if res.MatchedCount == 0 {
+		// confirmed concurrently
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	return &schema.TOTP_EnrollResp{
+		Secret:        secret,
+		URI:           auth.TOTPURI(us.Config.TOTP.Issuer, u.Email, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+func (us *UserServiceImpl) ConfirmTOTP(ctx context.Context, opts *schema.TOTP_ConfirmOpts) error {
+	u, err := us.findUser(ctx, opts.UserID)
+	if err != nil {
+		return err
+	}
+	if u.TOTP == nil {
+		return ErrTOTPNotEnabled
+	}
+	if u.TOTP.ConfirmedAt != nil {
+		return ErrTOTPAlreadyEnabled
+	}
+	return us.useTOTPCode(ctx, u, opts.Code, bson.M{"totp.confirmed_at": UTCNow()})
+}
+
+func (us *UserServiceImpl) StepUp(ctx context.Context, opts *schema.TOTP_VerifyOpts) (*schema.TOTP_StepUpResp, error) {
+	u, err := us.findUser(ctx, opts.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTP == nil || u.TOTP.ConfirmedAt == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+	if opts.RecoveryCode != "" {
+		err = us.useRecoveryCode(ctx, u, opts.RecoveryCode)
+	} else {
+		err = us.useTOTPCode(ctx, u, opts.Code, bson.M{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := UTCNow()
+	access, err := us.signAccessToken(u, now, now, schema.AMRPassword, schema.AMROTP)
+	if err != nil {
+		return nil, err
+	}
+	return &schema.TOTP_StepUpResp{
+		AccessToken: access,
+		TokenType:   schema.TokenTypeBearer,
+		ExpiresIn:   int64(us.Config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// useTOTPCode verifies code and records its time step along with set, so that the code cannot be replayed. The
+// codes are rejected while the user is locked out after too many invalid ones.
+func (us *UserServiceImpl) useTOTPCode(ctx context.Context, u *model.User, code string, set bson.M) error {
+	now := UTCNow()
+	if u.TOTP.LockedUntil != nil && now.Before(*u.TOTP.LockedUntil) {
+		return ErrTOTPLocked
+	}
+	step, ok, err := auth.VerifyTOTP(u.TOTP.Secret, code, now, us.Config.TOTP.Skew)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify code")
+	}
+	if !ok {
+		if err := us.recordInvalidTOTPCode(ctx, u, now); err != nil {
+			return err
+		}
+		return ErrInvalidTOTPCode
+	}
+	set["totp.last_step"] = step
+	filter := bson.M{"_id": u.ID, "totp.last_step": bson.M{"$not": bson.M{"$gte": step}}}
+	update := bson.M{"$set": set, "$unset": bson.M{"totp.failed_attempts": "", "totp.locked_until": ""}}
+	res, err := us.collection(model.UserColl).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "failed to record the use of the code")
+	}
+	if res.MatchedCount == 0 {
+		// the code, or a later one, was already used
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// recordInvalidTOTPCode counts an invalid code of u and locks its codes out once there are too many. The count is
+// compared in the filter, so that concurrent attempts cannot get past the limit.
+func (us *UserServiceImpl) recordInvalidTOTPCode(ctx context.Context, u *model.User, now time.Time) error {
+	coll := us.collection(model.UserColl)
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": u.ID}, bson.M{"$inc": bson.M{"totp.failed_attempts": 1}}); err != nil {
+		return errors.Wrap(err, "failed to record the invalid code")
+	}
+	filter := bson.M{"_id": u.ID, "totp.failed_attempts": bson.M{"$gte": us.Config.TOTP.MaxAttempts}}
+	update := bson.M{
+		"$set":   bson.M{"totp.locked_until": now.Add(us.Config.TOTP.Lockout)},
+		"$unset": bson.M{"totp.failed_attempts": ""},
+	}
+	res, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "failed to lock the second factor")
+	}
+	if res.ModifiedCount > 0 {
+		us.Logger.Warn().Ctx(ctx).Str("user_id", u.ID.Hex()).Dur("lockout", us.Config.TOTP.Lockout).Msg("too many invalid codes, second factor locked")
+	}
+	return nil
+}
+
+// useRecoveryCode consumes a recovery code, each of them is accepted once.
+func (us *UserServiceImpl) useRecoveryCode(ctx context.Context, u *model.User, code string) error {
+	hash := hashToken(normalizeRecoveryCode(code))
+	filter := bson.M{"_id": u.ID, "totp.recovery_codes": hash}
+	res, err := us.collection(model.UserColl).UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"totp.recovery_codes": hash}})
+	if err != nil {
+		return errors.Wrap(err, "failed to use recovery code")
+	}
+	if res.MatchedCount == 0 {
+		return ErrInvalidTOTPCode
+	}
+	us.Logger.Info().Ctx(ctx).Str("user_id", u.ID.Hex()).Msg("recovery code used")
+	return nil
+}
+
+// newRecoveryCodes returns n recovery codes, formatted as xxxx-xxxx-xxxx-xxxx, and their hashes.
+func newRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to generate recovery code")
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, code[0:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:16])
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts the codes in any case, with or without separators.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}